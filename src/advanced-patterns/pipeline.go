@@ -1,118 +1,38 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"time"
+
+	"github.com/smaruf/go-lang-study/src/pipeline"
 )
 
 // Pipeline demonstrates the pipeline pattern for concurrent data processing
 // Data flows through multiple stages, each stage processes and passes to next
 
-// Stage represents a processing stage in the pipeline
-type Stage func(<-chan interface{}) <-chan interface{}
-
-// Pipeline builds and executes a pipeline of stages
-func Pipeline(stages ...Stage) Stage {
-	return func(in <-chan interface{}) <-chan interface{} {
-		out := in
-		for _, stage := range stages {
-			out = stage(out)
-		}
-		return out
-	}
-}
-
-// Generator creates a channel and sends values to it
-func generator(nums ...int) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		defer close(out)
-		for _, n := range nums {
-			out <- n
-		}
-	}()
-	return out
-}
-
 // Square multiplies each number by itself
-func square(in <-chan interface{}) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		defer close(out)
-		for n := range in {
-			num := n.(int)
-			out <- num * num
-		}
-	}()
-	return out
+func square(_ context.Context, n int) (int, error) {
+	return n * n, nil
 }
 
 // Double multiplies each number by 2
-func double(in <-chan interface{}) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		defer close(out)
-		for n := range in {
-			num := n.(int)
-			out <- num * 2
-		}
-	}()
-	return out
+func double(_ context.Context, n int) (int, error) {
+	return n * 2, nil
 }
 
 // AddTen adds 10 to each number
-func addTen(in <-chan interface{}) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		defer close(out)
-		for n := range in {
-			num := n.(int)
-			out <- num + 10
-		}
-	}()
-	return out
-}
-
-// FanOut creates multiple workers to process input concurrently
-func fanOut(in <-chan interface{}, workers int, processor Stage) []<-chan interface{} {
-	channels := make([]<-chan interface{}, workers)
-	for i := 0; i < workers; i++ {
-		channels[i] = processor(in)
-	}
-	return channels
-}
-
-// FanIn merges multiple channels into one
-func fanIn(channels ...<-chan interface{}) <-chan interface{} {
-	out := make(chan interface{})
-	var wg sync.WaitGroup
-
-	multiplex := func(c <-chan interface{}) {
-		defer wg.Done()
-		for n := range c {
-			out <- n
-		}
-	}
-
-	wg.Add(len(channels))
-	for _, c := range channels {
-		go multiplex(c)
-	}
-
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
-
-	return out
+func addTen(_ context.Context, n int) (int, error) {
+	return n + 10, nil
 }
 
 func main() {
 	fmt.Println("=== Simple Pipeline Example ===")
 	// Create a simple pipeline: generator -> square -> double -> addTen
-	input := generator(1, 2, 3, 4, 5)
-	pipeline := Pipeline(square, double, addTen)
-	output := pipeline(input)
+	p := pipeline.New(context.Background())
+	input := pipeline.From(p, 1, 2, 3, 4, 5)
+	output := pipeline.Map(p, pipeline.Map(p, pipeline.Map(p, input, square), double), addTen)
 
 	for result := range output {
 		fmt.Printf("%v ", result)
@@ -121,33 +41,88 @@ func main() {
 
 	fmt.Println("\n=== Fan-Out/Fan-In Pattern Example ===")
 	// Demonstrate fan-out/fan-in for parallel processing
-	input2 := generator(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
-	
+	p = pipeline.New(context.Background())
+	input2 := pipeline.From(p, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
 	// Fan-out: Create 3 workers to square numbers concurrently
-	workers := fanOut(input2, 3, square)
-	
-	// Fan-in: Merge results from all workers
-	merged := fanIn(workers...)
-	
-	// Further process merged results
-	final := double(merged)
-
-	results := make([]int, 0)
-	for result := range final {
-		results = append(results, result.(int))
+	var workers []<-chan int
+	for _, branch := range pipeline.FanOut(p, input2, 3) {
+		workers = append(workers, pipeline.Map(p, branch, square))
 	}
-	fmt.Printf("Results: %v\n", results)
 
-	fmt.Println("\n=== Complex Multi-Stage Pipeline ===")
-	// Build a complex pipeline with multiple stages
-	complexInput := generator(1, 2, 3, 4, 5)
-	stage1 := square(complexInput)
-	stage2 := addTen(stage1)
-	stage3 := double(stage2)
+	// Fan-in: Merge results from all workers, then process them further
+	final := pipeline.Map(p, pipeline.FanIn(p, workers...), double)
 
-	fmt.Print("Processing: ")
-	for result := range stage3 {
-		fmt.Printf("%v ", result)
+	results, err := pipeline.Collect(p, final)
+	fmt.Printf("Results: %v (err: %v)\n", results, err)
+
+	fmt.Println("\n=== Ordered Parallel Map ===")
+	// Workers(n) does the fan-out/fan-in itself; Ordered keeps input order
+	p = pipeline.New(context.Background())
+	slowSquare := func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(10-n) * 5 * time.Millisecond)
+		return n * n, nil
+	}
+	results, err = pipeline.Collect(p, pipeline.Map(p, pipeline.From(p, 1, 2, 3, 4, 5, 6, 7, 8, 9),
+		slowSquare, pipeline.Workers(4), pipeline.Ordered()))
+	fmt.Printf("Results: %v (err: %v)\n", results, err)
+
+	fmt.Println("\n=== Batching ===")
+	p = pipeline.New(context.Background())
+	batches := pipeline.Batch(p, pipeline.From(p, 1, 2, 3, 4, 5, 6, 7), 3, 100*time.Millisecond)
+	for batch := range batches {
+		fmt.Printf("Batch: %v\n", batch)
+	}
+
+	fmt.Println("\n=== Error Policies ===")
+	errOdd := errors.New("odd number")
+	evensOnly := func(_ context.Context, n int) (int, error) {
+		if n%2 == 1 {
+			return 0, errOdd
+		}
+		return n, nil
+	}
+
+	// Skip drops the failing items and keeps going
+	p = pipeline.New(context.Background())
+	results, err = pipeline.Collect(p, pipeline.Map(p, pipeline.From(p, 1, 2, 3, 4, 5, 6),
+		evensOnly, pipeline.OnError(pipeline.SkipErrors)))
+	fmt.Printf("Skip:      %v, skipped %d (err: %v)\n", results, p.Skipped(), err)
+
+	// Fail-fast stops every stage on the first error
+	p = pipeline.New(context.Background())
+	_, err = pipeline.Collect(p, pipeline.Map(p, pipeline.From(p, 2, 4, 5, 6),
+		evensOnly, pipeline.Named("evens")))
+	fmt.Printf("Fail-fast: %v\n", err)
+
+	// Retry tries a flaky item again with a growing backoff
+	attempts := 0
+	flaky := func(_ context.Context, n int) (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, errors.New("temporary failure")
+		}
+		return n, nil
+	}
+	p = pipeline.New(context.Background())
+	results, err = pipeline.Collect(p, pipeline.Map(p, pipeline.From(p, 42),
+		flaky, pipeline.OnError(pipeline.Retry(3, 10*time.Millisecond))))
+	fmt.Printf("Retry:     %v after %d attempts (err: %v)\n", results, attempts, err)
+
+	fmt.Println("\n=== Stopping Early ===")
+	// An endless generator; Stop tears down every stage once we have enough
+	p = pipeline.New(context.Background())
+	naturals := pipeline.Generate(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := 1; emit(i); i++ {
+		}
+		return nil
+	})
+	squares := pipeline.Map(p, naturals, square, pipeline.Workers(2), pipeline.Ordered())
+	fmt.Print("First squares: ")
+	for i := 0; i < 5; i++ {
+		fmt.Printf("%v ", <-squares)
 	}
 	fmt.Println()
+	p.Stop()
+	fmt.Printf("All stages stopped (err: %v)\n", p.Wait())
 }
@@ -4,95 +4,19 @@ import (
 	"context"
 	"fmt"
 	"time"
-)
-
-// RateLimiter implements a token bucket rate limiter
-type RateLimiter struct {
-	tokens       chan struct{}
-	fillInterval time.Duration
-	capacity     int
-	ctx          context.Context
-	cancel       context.CancelFunc
-}
-
-// NewRateLimiter creates a new rate limiter
-// rate: number of tokens per second
-// burst: maximum number of tokens (bucket capacity)
-func NewRateLimiter(rate int, burst int) *RateLimiter {
-	ctx, cancel := context.WithCancel(context.Background())
-	rl := &RateLimiter{
-		tokens:       make(chan struct{}, burst),
-		fillInterval: time.Second / time.Duration(rate),
-		capacity:     burst,
-		ctx:          ctx,
-		cancel:       cancel,
-	}
-
-	// Fill initial tokens
-	for i := 0; i < burst; i++ {
-		rl.tokens <- struct{}{}
-	}
-
-	// Start token refiller
-	go rl.refiller()
-
-	return rl
-}
 
-// refiller continuously adds tokens to the bucket
-func (rl *RateLimiter) refiller() {
-	ticker := time.NewTicker(rl.fillInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-rl.ctx.Done():
-			return
-		case <-ticker.C:
-			select {
-			case rl.tokens <- struct{}{}:
-				// Token added
-			default:
-				// Bucket is full, skip
-			}
-		}
-	}
-}
-
-// Allow returns true if the request is allowed
-func (rl *RateLimiter) Allow() bool {
-	select {
-	case <-rl.tokens:
-		return true
-	default:
-		return false
-	}
-}
-
-// Wait blocks until a token is available or context is cancelled
-func (rl *RateLimiter) Wait(ctx context.Context) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-rl.tokens:
-		return nil
-	}
-}
-
-// Stop shuts down the rate limiter
-func (rl *RateLimiter) Stop() {
-	rl.cancel()
-}
+	"github.com/smaruf/go-lang-study/src/ratelimit"
+)
 
 // APIClient demonstrates rate-limited API client
 type APIClient struct {
-	limiter *RateLimiter
+	limiter ratelimit.Limiter
 }
 
 // NewAPIClient creates a new API client with rate limiting
 func NewAPIClient(requestsPerSecond int, burst int) *APIClient {
 	return &APIClient{
-		limiter: NewRateLimiter(requestsPerSecond, burst),
+		limiter: ratelimit.NewTokenBucket(ratelimit.Limit(requestsPerSecond), burst),
 	}
 }
 
@@ -104,7 +28,7 @@ func (c *APIClient) MakeRequest(requestID int) error {
 	fmt.Printf("Request %d: Waiting for rate limiter...\n", requestID)
 	start := time.Now()
 
-	if err := c.limiter.Wait(ctx); err != nil {
+	if err := c.limiter.WaitN(ctx, 1); err != nil {
 		return fmt.Errorf("rate limiter error: %w", err)
 	}
 
@@ -118,23 +42,18 @@ func (c *APIClient) MakeRequest(requestID int) error {
 	return nil
 }
 
-// Close shuts down the API client
-func (c *APIClient) Close() {
-	c.limiter.Stop()
-}
-
 func main() {
 	fmt.Println("=== Basic Rate Limiter Demo ===")
-	
-	// Create a rate limiter: 2 requests per second, burst of 3
-	limiter := NewRateLimiter(2, 3)
-	defer limiter.Stop()
+
+	// Create a rate limiter: 2 requests per second, burst of 3. The bucket
+	// is refilled from the elapsed time when asked, so there is no
+	// goroutine to stop.
+	limiter := ratelimit.NewTokenBucket(2, 3)
 
 	// Try 10 requests quickly
 	fmt.Println("\nAttempting 10 rapid requests (2/sec limit, burst 3):")
 	for i := 1; i <= 10; i++ {
-		allowed := limiter.Allow()
-		if allowed {
+		if limiter.AllowN(time.Now(), 1) {
 			fmt.Printf("Request %d: ✓ Allowed\n", i)
 		} else {
 			fmt.Printf("Request %d: ✗ Rate limited\n", i)
@@ -142,11 +61,44 @@ func main() {
 		time.Sleep(100 * time.Millisecond)
 	}
 
+	fmt.Println("\n=== Comparing Algorithms ===")
+
+	// The same burst of 6 requests against 3 requests per second
+	algorithms := []struct {
+		name    string
+		limiter ratelimit.Limiter
+	}{
+		{"Token bucket", ratelimit.NewTokenBucket(3, 3)},
+		{"GCRA", ratelimit.NewGCRA(3, 3)},
+		{"Sliding window", ratelimit.NewSlidingWindow(3, time.Second)},
+	}
+	for _, a := range algorithms {
+		now := time.Now()
+		allowed := 0
+		for i := 0; i < 6; i++ {
+			if a.limiter.AllowN(now, 1) {
+				allowed++
+			}
+		}
+		r := a.limiter.ReserveN(now, 1)
+		fmt.Printf("%-15s allowed %d of 6, next request in %v\n", a.name, allowed, r.DelayFrom(now).Round(time.Millisecond))
+		r.CancelAt(now)
+	}
+
+	fmt.Println("\n=== Per-Client Limits ===")
+
+	// One bucket per client, keeping at most 1000 clients in memory
+	clients := ratelimit.NewKeyed(1000, func(string) ratelimit.Limiter {
+		return ratelimit.NewTokenBucket(1, 2)
+	})
+	for _, client := range []string{"alice", "alice", "alice", "bob"} {
+		fmt.Printf("%s: allowed=%v\n", client, clients.AllowN(client, time.Now(), 1))
+	}
+
 	fmt.Println("\n=== API Client with Rate Limiting ===")
-	
+
 	// Create API client with rate limiting
 	client := NewAPIClient(3, 5) // 3 requests per second, burst of 5
-	defer client.Close()
 
 	// Make multiple requests
 	numRequests := 10
@@ -159,13 +111,13 @@ func main() {
 	}
 
 	// Wait for all requests to complete
-	time.Sleep(5 * time.Second)
+	time.Sleep(3 * time.Second)
 
 	fmt.Println("\n=== Concurrent Rate Limiting Test ===")
-	
-	// Test concurrent access
-	concurrentLimiter := NewRateLimiter(5, 10)
-	defer concurrentLimiter.Stop()
+
+	// Test concurrent access, with at most 3 requests in flight
+	concurrentLimiter := ratelimit.NewTokenBucket(5, 10)
+	inFlight := ratelimit.NewConcurrency(3)
 
 	start := time.Now()
 	const concurrentRequests = 20
@@ -173,15 +125,21 @@ func main() {
 
 	for i := 1; i <= concurrentRequests; i++ {
 		go func(id int) {
+			defer func() { done <- true }()
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 
-			if err := concurrentLimiter.Wait(ctx); err != nil {
+			if err := concurrentLimiter.WaitN(ctx, 1); err != nil {
+				fmt.Printf("Request %d: Failed - %v\n", id, err)
+				return
+			}
+			if err := inFlight.WaitN(ctx, 1); err != nil {
 				fmt.Printf("Request %d: Failed - %v\n", id, err)
-			} else {
-				fmt.Printf("Request %d: Success at %v\n", id, time.Since(start))
+				return
 			}
-			done <- true
+			defer inFlight.ReleaseN(1)
+			fmt.Printf("Request %d: Success at %v\n", id, time.Since(start).Round(time.Millisecond))
+			time.Sleep(50 * time.Millisecond)
 		}(i)
 	}
 
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
 	"time"
+
+	"github.com/smaruf/go-lang-study/src/pool"
 )
 
 // Job represents a unit of work
@@ -13,130 +15,60 @@ type Job struct {
 	Payload string
 }
 
-// Result represents the result of a job
-type Result struct {
-	JobID  int
-	Output string
-	Err    error
-}
-
-// WorkerPool manages a pool of workers
-type WorkerPool struct {
-	numWorkers int
-	jobs       chan Job
-	results    chan Result
-	wg         sync.WaitGroup
-	ctx        context.Context
-	cancel     context.CancelFunc
-}
-
-// NewWorkerPool creates a new worker pool
-func NewWorkerPool(numWorkers int, jobBufferSize int) *WorkerPool {
-	ctx, cancel := context.WithCancel(context.Background())
-	return &WorkerPool{
-		numWorkers: numWorkers,
-		jobs:       make(chan Job, jobBufferSize),
-		results:    make(chan Result, jobBufferSize),
-		ctx:        ctx,
-		cancel:     cancel,
-	}
-}
-
-// Start initializes and starts all workers
-func (wp *WorkerPool) Start() {
-	for i := 0; i < wp.numWorkers; i++ {
-		wp.wg.Add(1)
-		go wp.worker(i)
-	}
-}
-
-// worker processes jobs from the jobs channel
-func (wp *WorkerPool) worker(id int) {
-	defer wp.wg.Done()
-	fmt.Printf("Worker %d started\n", id)
-
-	for {
-		select {
-		case <-wp.ctx.Done():
-			fmt.Printf("Worker %d shutting down\n", id)
-			return
-		case job, ok := <-wp.jobs:
-			if !ok {
-				fmt.Printf("Worker %d: jobs channel closed\n", id)
-				return
-			}
-			result := wp.processJob(id, job)
-			wp.results <- result
-		}
-	}
-}
-
 // processJob simulates job processing
-func (wp *WorkerPool) processJob(workerID int, job Job) Result {
-	fmt.Printf("Worker %d processing job %d: %s\n", workerID, job.ID, job.Payload)
-	
+func processJob(ctx context.Context, job Job) (string, error) {
+	fmt.Printf("Processing job %d: %s\n", job.ID, job.Payload)
+
 	// Simulate work
-	time.Sleep(time.Millisecond * 100)
-	
-	return Result{
-		JobID:  job.ID,
-		Output: fmt.Sprintf("Processed by worker %d: %s", workerID, job.Payload),
-		Err:    nil,
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
-}
-
-// Submit adds a job to the pool
-func (wp *WorkerPool) Submit(job Job) {
-	wp.jobs <- job
-}
-
-// Close gracefully shuts down the worker pool
-func (wp *WorkerPool) Close() {
-	close(wp.jobs)
-	wp.wg.Wait()
-	close(wp.results)
-}
-
-// Shutdown forcefully stops all workers
-func (wp *WorkerPool) Shutdown() {
-	wp.cancel()
-	wp.wg.Wait()
-	close(wp.results)
-}
-
-// Results returns the results channel
-func (wp *WorkerPool) Results() <-chan Result {
-	return wp.results
+	if job.ID%7 == 0 {
+		return "", errors.New("payload rejected")
+	}
+	return fmt.Sprintf("Processed: %s", job.Payload), nil
 }
 
 func main() {
-	// Create a worker pool with 3 workers and buffer size of 10
-	pool := NewWorkerPool(3, 10)
-	pool.Start()
+	// Create a worker pool of up to 3 workers with room for 10 queued jobs
+	workers := pool.New(processJob, pool.Options{MinWorkers: 1, MaxWorkers: 3, QueueSize: 10})
 
 	// Submit jobs
 	numJobs := 10
+	tasks := make(chan *pool.Task[Job, string], numJobs)
 	go func() {
+		defer close(tasks)
 		for i := 1; i <= numJobs; i++ {
 			job := Job{
 				ID:      i,
 				Payload: fmt.Sprintf("Task-%d", i),
 			}
-			pool.Submit(job)
+			task, err := workers.Submit(context.Background(), job)
+			if err != nil {
+				fmt.Printf("Job %d not submitted: %v\n", job.ID, err)
+				continue
+			}
+			tasks <- task
 		}
-		pool.Close() // Close when all jobs are submitted
 	}()
 
 	// Collect results
 	resultsReceived := 0
-	for result := range pool.Results() {
-		if result.Err != nil {
-			fmt.Printf("Job %d failed: %v\n", result.JobID, result.Err)
+	for task := range tasks {
+		output, err := task.Result()
+		if err != nil {
+			fmt.Printf("Job %d failed: %v\n", task.Input.ID, err)
 		} else {
-			fmt.Printf("Job %d completed: %s\n", result.JobID, result.Output)
+			fmt.Printf("Job %d completed: %s\n", task.Input.ID, output)
 		}
 		resultsReceived++
 	}
 
-	fmt.Printf("\nAll jobs completed! Processed %d jobs\n", resultsReceived)
+	// Close gracefully once everything submitted is done
+	workers.Drain(context.Background())
+	stats := workers.Stats()
+	fmt.Printf("\nAll jobs completed! Processed %d jobs (%d failed, average %v)\n",
+		resultsReceived, stats.Failed, stats.AvgLatency)
 }
@@ -12,25 +12,48 @@ type Broker struct {
 
 	topics map[string]Subscribers
 	tLock  sync.RWMutex
+
+	defaults SubscriberOptions
+
+	durable map[string]*durableTopic
+	dLock   sync.RWMutex
+	closed  bool
 }
 
-// NewBroker Create new broker
+// NewBroker Create new broker whose subscribers get the default options
 func NewBroker() *Broker {
+	return NewBrokerWithOptions(DefaultSubscriberOptions())
+}
+
+// NewBrokerWithOptions Create new broker whose subscribers get the given
+// queue size and overflow policy unless attached with their own
+func NewBrokerWithOptions(defaults SubscriberOptions) *Broker {
 	return &Broker{
 		subscribers: Subscribers{},
 		sLock:       sync.RWMutex{},
 		topics:      map[string]Subscribers{},
 		tLock:       sync.RWMutex{},
+		defaults:    defaults,
+		durable:     map[string]*durableTopic{},
 	}
 }
 
 // Attach Create a new subscriber and register it into our main broker
 func (b *Broker) Attach() (*Subscriber, error) {
-	s, err := NewSubscriber()
+	return b.AttachWithOptions(b.defaults)
+}
+
+// AttachWithOptions Create a new subscriber with its own queue size and
+// overflow policy and register it into our main broker
+func (b *Broker) AttachWithOptions(options SubscriberOptions) (*Subscriber, error) {
+	s, err := NewSubscriberWithOptions(options)
 
 	if err != nil {
 		return nil, err
 	}
+	s.lock.Lock()
+	s.onOverflow = func() { b.Detach(s) }
+	s.lock.Unlock()
 
 	b.sLock.Lock()
 	b.subscribers[s.GetID()] = s
@@ -39,7 +62,8 @@ func (b *Broker) Attach() (*Subscriber, error) {
 	return s, nil
 }
 
-// Subscribe subscribes the specified subscriber "s" to the specified list of topic(s)
+// Subscribe subscribes the specified subscriber "s" to the specified list of topic(s).
+// A topic may be a wildcard pattern, see MatchTopic.
 func (b *Broker) Subscribe(s *Subscriber, topics ...string) {
 	b.tLock.Lock()
 	defer b.tLock.Unlock()
@@ -77,28 +101,74 @@ func (b *Broker) Detach(s *Subscriber) {
 	defer b.sLock.Unlock()
 }
 
-// Broadcast broadcast the specified payload to all the topic(s) subscribers
+// Broadcast broadcast the specified payload to all the topic(s) subscribers,
+// including those subscribed with a matching wildcard pattern. A subscriber
+// matching a topic through several patterns gets the message once.
+//
+// The message is queued for each subscriber before Broadcast returns, so
+// every subscriber sees one publisher's messages in order. With the Block
+// policy Broadcast waits while a subscriber's queue is full.
+//
+// A []byte payload for a durable topic is written to its log first; use
+// Publish to learn whether that worked.
 func (b *Broker) Broadcast(payload interface{}, topics ...string) {
 	for _, topic := range topics {
-		if b.Subscribers(topic) < 1 {
+		if data, ok := payload.([]byte); ok && b.durableTopic(topic) != nil {
+			b.Publish(topic, data)
 			continue
 		}
-		b.tLock.RLock()
-		for _, s := range b.topics[topic] {
-			m := &Message{
-				topic:     topic,
-				payload:   payload,
-				createdAt: time.Now().UnixNano(),
+		b.deliver(&Message{
+			topic:     topic,
+			payload:   payload,
+			createdAt: time.Now().UnixNano(),
+			offset:    -1,
+		})
+	}
+}
+
+// deliver queues m for the live subscribers of its topic
+func (b *Broker) deliver(m *Message) {
+	for _, s := range b.matching(m.topic) {
+		s.Signal(m)
+	}
+}
+
+// matching returns the subscribers for a topic, each once. The topic lock
+// is released before anything is queued, so a blocked publisher never
+// holds up Subscribe or Detach.
+func (b *Broker) matching(topic string) []*Subscriber {
+	b.tLock.RLock()
+	defer b.tLock.RUnlock()
+
+	var matched []*Subscriber
+	seen := map[string]bool{}
+	for pattern, subscribers := range b.topics {
+		if !MatchTopic(pattern, topic) {
+			continue
+		}
+		for id, s := range subscribers {
+			if !seen[id] {
+				seen[id] = true
+				matched = append(matched, s)
 			}
-			go (func(s *Subscriber) {
-				s.Signal(m)
-			})(s)
 		}
-		b.tLock.RUnlock()
 	}
+	return matched
+}
+
+// Stats Returns the delivery metrics of every attached subscriber
+func (b *Broker) Stats() []SubscriberStats {
+	b.sLock.RLock()
+	defer b.sLock.RUnlock()
+
+	stats := make([]SubscriberStats, 0, len(b.subscribers))
+	for _, s := range b.subscribers {
+		stats = append(stats, s.Stats())
+	}
+	return stats
 }
 
-// Subscribers Get the subscribers count
+// Subscribers Get the count of subscribers to exactly this topic or pattern
 func (b *Broker) Subscribers(topic string) int {
 	b.tLock.RLock()
 	defer b.tLock.RUnlock()
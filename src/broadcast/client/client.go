@@ -0,0 +1,320 @@
+// Package client connects to a broker server. A Client reconnects on its
+// own when the connection drops and subscribes to its topics again, so
+// callers only see a pause in the message stream.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"broadcast"
+	"broadcast/protocol"
+)
+
+// ErrClosed is returned once the client has been closed
+var ErrClosed = errors.New("client closed")
+
+// Message is a published payload received on a subscription
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Options configures a Client
+type Options struct {
+	// MinBackoff and MaxBackoff bound the wait between reconnect attempts,
+	// which doubles after each failure
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Buffer is the capacity of the Messages channel. When it is full the
+	// client stops reading from the server.
+	Buffer int
+	// OnError receives errors the server reports, such as an invalid
+	// topic, and reconnect failures
+	OnError func(err error)
+	Dialer  net.Dialer
+}
+
+// Client publishes to and subscribes on a broker server
+type Client struct {
+	address  *url.URL
+	options  Options
+	messages chan Message
+	done     chan struct{}
+
+	mu        sync.Mutex
+	conn      protocol.Conn
+	connected chan struct{} // closed while conn is usable
+	topics    map[string]bool
+	closed    bool
+}
+
+// Dial connects to a broker server. The address is tcp://host:port for the
+// length-prefixed protocol or ws:// or wss:// URL of the WebSocket endpoint.
+func Dial(ctx context.Context, address string, options Options) (*Client, error) {
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker address: %w", err)
+	}
+	switch target.Scheme {
+	case "tcp", "ws", "wss":
+	default:
+		return nil, fmt.Errorf("unsupported broker address scheme %q", target.Scheme)
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = 100 * time.Millisecond
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = 10 * time.Second
+		if options.MaxBackoff < options.MinBackoff {
+			options.MaxBackoff = options.MinBackoff
+		}
+	}
+	if options.Buffer <= 0 {
+		options.Buffer = 256
+	}
+
+	c := &Client{
+		address:   target,
+		options:   options,
+		messages:  make(chan Message, options.Buffer),
+		done:      make(chan struct{}),
+		connected: make(chan struct{}),
+		topics:    map[string]bool{},
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.setConn(conn)
+	go c.run(conn)
+	return c, nil
+}
+
+// Messages returns the messages for the client's subscriptions. It is
+// closed when the client is closed.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Subscribe adds topics, which may be wildcard patterns. They are kept
+// across reconnects.
+func (c *Client) Subscribe(topics ...string) error {
+	for _, topic := range topics {
+		if err := broadcast.ValidatePattern(topic); err != nil {
+			return err
+		}
+	}
+	return c.updateTopics(protocol.Subscribe, topics)
+}
+
+// Unsubscribe removes topics
+func (c *Client) Unsubscribe(topics ...string) error {
+	return c.updateTopics(protocol.Unsubscribe, topics)
+}
+
+func (c *Client) updateTopics(op protocol.Op, topics []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	for _, topic := range topics {
+		if op == protocol.Subscribe {
+			c.topics[topic] = true
+		} else {
+			delete(c.topics, topic)
+		}
+		// While disconnected the next connection sends the whole set
+		if c.conn != nil {
+			if err := c.conn.WriteFrame(protocol.Frame{Op: op, Topic: topic}); err != nil {
+				c.conn.Close()
+			}
+		}
+	}
+	return nil
+}
+
+// Publish sends payload to topic. While the client is reconnecting it
+// waits for the connection, until ctx is done.
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte) error {
+	if err := broadcast.ValidateTopic(topic); err != nil {
+		return err
+	}
+	frame := protocol.Frame{Op: protocol.Publish, Topic: topic, Payload: payload}
+	for {
+		conn, err := c.waitConnected(ctx)
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteFrame(frame); err == nil {
+			return nil
+		}
+		// The read loop notices the broken connection and reconnects
+		conn.Close()
+		c.clearConn(conn)
+	}
+}
+
+// Close disconnects and stops reconnecting
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// run reads from conn, and from each replacement after a disconnect,
+// until the client is closed
+func (c *Client) run(conn protocol.Conn) {
+	defer close(c.messages)
+	for {
+		c.read(conn)
+		conn.Close()
+		c.clearConn(conn)
+
+		var ok bool
+		if conn, ok = c.reconnect(); !ok {
+			return
+		}
+	}
+}
+
+// read delivers messages from conn until it fails
+func (c *Client) read(conn protocol.Conn) {
+	for {
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch frame.Op {
+		case protocol.Message:
+			select {
+			case c.messages <- Message{Topic: frame.Topic, Payload: frame.Payload}:
+			case <-c.done:
+				return
+			}
+		case protocol.Error:
+			c.reportError(fmt.Errorf("broker: %s", frame.Payload))
+		}
+	}
+}
+
+// reconnect dials with exponential backoff and restores the subscriptions
+func (c *Client) reconnect() (protocol.Conn, bool) {
+	backoff := c.options.MinBackoff
+	for {
+		select {
+		case <-c.done:
+			return nil, false
+		case <-time.After(backoff):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.options.MaxBackoff)
+		conn, err := c.dial(ctx)
+		cancel()
+		if err == nil {
+			if c.setConn(conn) {
+				return conn, true
+			}
+			conn.Close()
+			return nil, false
+		}
+		c.reportError(fmt.Errorf("failed to reconnect: %w", err))
+		if backoff *= 2; backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+}
+
+// setConn subscribes conn to the client's topics and makes it current.
+// It reports false if the client was closed meanwhile.
+func (c *Client) setConn(conn protocol.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	for topic := range c.topics {
+		if err := conn.WriteFrame(protocol.Frame{Op: protocol.Subscribe, Topic: topic}); err != nil {
+			// Leave it to the read loop to notice and try again
+			conn.Close()
+			break
+		}
+	}
+	c.conn = conn
+	close(c.connected)
+	return true
+}
+
+// clearConn marks conn as gone, if it is still the current one
+func (c *Client) clearConn(conn protocol.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		c.conn = nil
+		c.connected = make(chan struct{})
+	}
+}
+
+func (c *Client) waitConnected(ctx context.Context) (protocol.Conn, error) {
+	for {
+		c.mu.Lock()
+		conn, connected, closed := c.conn, c.connected, c.closed
+		c.mu.Unlock()
+		if closed {
+			return nil, ErrClosed
+		}
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-connected:
+		case <-c.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (protocol.Conn, error) {
+	if c.address.Scheme == "tcp" {
+		conn, err := c.options.Dialer.DialContext(ctx, "tcp", c.address.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to broker: %w", err)
+		}
+		return protocol.NewStreamConn(conn), nil
+	}
+	dialer := websocket.Dialer{NetDialContext: c.options.Dialer.DialContext}
+	ws, _, err := dialer.DialContext(ctx, c.address.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	return protocol.NewWebSocketConn(ws), nil
+}
+
+func (c *Client) reportError(err error) {
+	if c.options.OnError != nil {
+		c.options.OnError(err)
+		return
+	}
+	log.Printf("broadcast client: %v", err)
+}
@@ -0,0 +1,112 @@
+// Command broker-server runs a broadcast broker that services publish to
+// and subscribe on over TCP and WebSocket.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"broadcast"
+	"broadcast/server"
+)
+
+func main() {
+	tcpAddr := flag.String("tcp", ":7070", "address for the length-prefixed TCP protocol, empty to disable")
+	httpAddr := flag.String("http", ":7071", "address for WebSocket clients at /ws, empty to disable")
+	origins := flag.String("origins", "", "comma-separated browser origins allowed to open a WebSocket")
+	queueSize := flag.Int("queue", 1024, "messages queued per client before the overflow policy applies")
+	overflow := flag.String("overflow", string(broadcast.Disconnect), "overflow policy: block, drop-oldest, drop-newest or disconnect")
+	dataDir := flag.String("data", "data", "directory for durable topic logs")
+	durable := flag.String("durable", "", "comma-separated topics whose messages are kept on disk")
+	maxBytes := flag.Int64("max-bytes", 0, "log size kept per durable topic, 0 for no limit")
+	maxAge := flag.Duration("max-age", 0, "how long durable messages are kept, 0 for no limit")
+	flag.Parse()
+
+	options := server.Options{
+		Queue: broadcast.SubscriberOptions{QueueSize: *queueSize, Policy: broadcast.OverflowPolicy(*overflow)},
+	}
+	if err := options.Queue.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *origins != "" {
+		allowed := map[string]bool{}
+		for _, origin := range strings.Split(*origins, ",") {
+			allowed[strings.TrimSpace(origin)] = true
+		}
+		options.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || allowed[origin]
+		}
+	}
+	broker := broadcast.NewBroker()
+	logOptions := broadcast.DefaultLogOptions(*dataDir)
+	logOptions.MaxBytes = *maxBytes
+	logOptions.MaxAge = *maxAge
+	if *durable != "" {
+		for _, topic := range strings.Split(*durable, ",") {
+			if err := broker.EnableDurability(strings.TrimSpace(topic), logOptions); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	srv := server.New(broker, options)
+
+	if *tcpAddr != "" {
+		listener, err := net.Listen("tcp", *tcpAddr)
+		if err != nil {
+			log.Fatalf("failed to listen on %s: %v", *tcpAddr, err)
+		}
+		log.Printf("TCP protocol on %s", listener.Addr())
+		go func() {
+			if err := srv.ServeTCP(listener); err != nil && !errors.Is(err, server.ErrServerClosed) {
+				log.Fatalf("TCP server failed: %v", err)
+			}
+		}()
+	}
+
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/ws", srv)
+		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+		// Per-client lag and drop counts
+		mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(broker.Stats())
+		})
+		httpServer = &http.Server{Addr: *httpAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		log.Printf("WebSocket protocol on %s/ws", *httpAddr)
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("HTTP server failed: %v", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("shutting down")
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}
+	srv.Close()
+	if err := broker.Close(); err != nil {
+		log.Printf("failed to close durable logs: %v", err)
+	}
+}
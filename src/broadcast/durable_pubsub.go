@@ -0,0 +1,461 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotDurable is returned for durable operations on a topic that
+	// wasn't made durable
+	ErrNotDurable = errors.New("topic is not durable")
+	// ErrBrokerClosed is returned after Close
+	ErrBrokerClosed = errors.New("broker closed")
+)
+
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// cursorBatch is how many records a cursor reads from the log at a time
+const cursorBatch = 64
+
+// StartPosition is where a replaying subscriber starts reading
+type StartPosition struct {
+	offset int64
+	time   time.Time
+	byTime bool
+}
+
+// AtOffset starts at the record with the given offset. Offsets older than
+// the retained records start at the oldest one.
+func AtOffset(offset int64) StartPosition {
+	return StartPosition{offset: offset}
+}
+
+// AtTime starts at the first record written at or after t
+func AtTime(t time.Time) StartPosition {
+	return StartPosition{time: t, byTime: true}
+}
+
+// durableTopic is a topic whose messages are kept in a log
+type durableTopic struct {
+	name   string
+	log    *segmentLog
+	dir    string
+	closed chan struct{}
+
+	mu       sync.Mutex
+	appended chan struct{} // closed and replaced on every append
+	groups   map[string]*consumerGroup
+	cursors  sync.WaitGroup
+}
+
+// EnableDurability keeps every []byte message broadcast to topic in an
+// append-only log under options.Dir, so it can be replayed with
+// SubscribeAt and consumed by groups with JoinGroup
+func (b *Broker) EnableDurability(topic string, options LogOptions) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+	if strings.ContainsAny(topic, `/\`) {
+		return fmt.Errorf("invalid durable topic %q: path separators are not allowed", topic)
+	}
+
+	b.dLock.Lock()
+	defer b.dLock.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if b.durable[topic] != nil {
+		return nil
+	}
+	dir := filepath.Join(options.Dir, topic)
+	log, err := openLog(dir, options)
+	if err != nil {
+		return fmt.Errorf("failed to open log for %s: %w", topic, err)
+	}
+	d := &durableTopic{
+		name:     topic,
+		log:      log,
+		dir:      dir,
+		closed:   make(chan struct{}),
+		appended: make(chan struct{}),
+		groups:   map[string]*consumerGroup{},
+	}
+	if options.MaxAge > 0 {
+		go d.enforceRetention(options.MaxAge)
+	}
+	b.durable[topic] = d
+	return nil
+}
+
+// Publish broadcasts payload to a durable topic and returns its offset.
+// Unlike Broadcast it reports a failure to write the log.
+func (b *Broker) Publish(topic string, payload []byte) (int64, error) {
+	d := b.durableTopic(topic)
+	if d == nil {
+		return 0, ErrNotDurable
+	}
+	m, err := d.append(topic, payload)
+	if err != nil {
+		return 0, err
+	}
+	b.deliver(m)
+	return m.offset, nil
+}
+
+// Bounds returns the oldest retained offset of a durable topic and the
+// offset its next message will get
+func (b *Broker) Bounds(topic string) (oldest, next int64, err error) {
+	d := b.durableTopic(topic)
+	if d == nil {
+		return 0, 0, ErrNotDurable
+	}
+	oldest, next = d.log.Bounds()
+	return oldest, next, nil
+}
+
+// SubscribeAt replays a durable topic to s from start and then keeps
+// delivering new messages, in offset order, until s is detached. The
+// messages come from the log, so nothing is missed in between, and the
+// reader waits for room in the queue whatever its overflow policy.
+func (b *Broker) SubscribeAt(s *Subscriber, topic string, start StartPosition) error {
+	d := b.durableTopic(topic)
+	if d == nil {
+		return ErrNotDurable
+	}
+	offset := start.offset
+	if start.byTime {
+		offset = d.log.OffsetAt(start.time)
+	}
+	d.startCursor(offset, s.done, func(m *Message) bool {
+		return s.signal(m, true)
+	})
+	return nil
+}
+
+// JoinGroup attaches a member of the named consumer group of a durable
+// topic. Each message goes to one member of the group, whichever has the
+// shortest queue. A group that has no members left stops, and when a member
+// joins again it resumes after the last committed offset, so messages
+// handed out but not committed are delivered again. Leave the group with
+// Detach.
+func (b *Broker) JoinGroup(topic, group string, options SubscriberOptions) (*Subscriber, error) {
+	d := b.durableTopic(topic)
+	if d == nil {
+		return nil, ErrNotDurable
+	}
+	if !groupNamePattern.MatchString(group) {
+		return nil, fmt.Errorf("invalid group name %q", group)
+	}
+	s, err := b.AttachWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.join(group, s); err != nil {
+		b.Detach(s)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Commit records that a consumer group has processed every message of a
+// durable topic up to and including offset. Commits never move backwards.
+func (b *Broker) Commit(topic, group string, offset int64) error {
+	d := b.durableTopic(topic)
+	if d == nil {
+		return ErrNotDurable
+	}
+	g, err := d.group(group)
+	if err != nil {
+		return err
+	}
+	return g.commit(offset)
+}
+
+// Committed returns a consumer group's committed offset, or -1 if it has
+// committed nothing yet
+func (b *Broker) Committed(topic, group string) (int64, error) {
+	d := b.durableTopic(topic)
+	if d == nil {
+		return 0, ErrNotDurable
+	}
+	g, err := d.group(group)
+	if err != nil {
+		return 0, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.committed, nil
+}
+
+// Close stops replays and consumer groups and closes the durable logs
+func (b *Broker) Close() error {
+	b.dLock.Lock()
+	if b.closed {
+		b.dLock.Unlock()
+		return nil
+	}
+	b.closed = true
+	topics := b.durable
+	b.durable = map[string]*durableTopic{}
+	b.dLock.Unlock()
+
+	var first error
+	for _, d := range topics {
+		close(d.closed)
+		d.cursors.Wait()
+		if err := d.log.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (b *Broker) durableTopic(topic string) *durableTopic {
+	b.dLock.RLock()
+	defer b.dLock.RUnlock()
+	return b.durable[topic]
+}
+
+// append writes payload to the log and wakes the cursors
+func (d *durableTopic) append(topic string, payload []byte) (*Message, error) {
+	record, err := d.log.Append(payload)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	close(d.appended)
+	d.appended = make(chan struct{})
+	d.mu.Unlock()
+	return recordMessage(topic, record), nil
+}
+
+func recordMessage(topic string, record Record) *Message {
+	return &Message{
+		topic:     topic,
+		payload:   record.Payload,
+		createdAt: record.Time.UnixNano(),
+		offset:    record.Offset,
+	}
+}
+
+// startCursor reads the log from offset in a goroutine, handing each
+// message to deliver, until stop is closed, deliver returns false or the
+// broker is closed
+func (d *durableTopic) startCursor(offset int64, stop <-chan struct{}, deliver func(*Message) bool) {
+	d.cursors.Add(1)
+	go func() {
+		defer d.cursors.Done()
+		for {
+			// Take the wakeup channel before reading so an append in
+			// between isn't missed
+			d.mu.Lock()
+			appended := d.appended
+			d.mu.Unlock()
+
+			records, err := d.log.Read(offset, cursorBatch)
+			for _, record := range records {
+				if !deliver(recordMessage(d.name, record)) {
+					return
+				}
+				offset = record.Offset + 1
+			}
+			if err == nil && len(records) > 0 {
+				continue
+			}
+			if err != nil {
+				// Retry a failed read after the pause below
+				appended = nil
+			}
+
+			select {
+			case <-appended:
+			case <-time.After(time.Second):
+			case <-stop:
+				return
+			case <-d.closed:
+				return
+			}
+		}
+	}()
+}
+
+// enforceRetention applies the age limit while no messages arrive
+func (d *durableTopic) enforceRetention(maxAge time.Duration) {
+	interval := maxAge / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.log.Retain()
+		case <-d.closed:
+			return
+		}
+	}
+}
+
+// consumerGroup hands each message of a durable topic to one member
+type consumerGroup struct {
+	name  string
+	topic *durableTopic
+	path  string
+
+	mu        sync.Mutex
+	members   []*Subscriber
+	committed int64
+	stop      chan struct{} // closed to stop the running cursor, nil if none
+	next      int           // round robin among members with equal lag
+}
+
+// group returns the named group, loading its committed offset
+func (d *durableTopic) group(name string) (*consumerGroup, error) {
+	if !groupNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid group name %q", name)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if g := d.groups[name]; g != nil {
+		return g, nil
+	}
+
+	g := &consumerGroup{
+		name:      name,
+		topic:     d,
+		path:      filepath.Join(d.dir, "groups", name+".offset"),
+		committed: -1,
+	}
+	data, err := os.ReadFile(g.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read committed offset: %w", err)
+	}
+	if err == nil {
+		if g.committed, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid committed offset in %s: %w", g.path, err)
+		}
+	}
+	d.groups[name] = g
+	return g, nil
+}
+
+// join adds a member, starting the group's cursor after the committed
+// offset if it isn't running. A cursor whose members have all left is
+// replaced even if it hasn't noticed yet.
+func (d *durableTopic) join(name string, s *Subscriber) error {
+	g, err := d.group(name)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.prune() == 0 {
+		g.halt()
+	}
+	g.members = append(g.members, s)
+	if g.stop == nil {
+		stop := make(chan struct{})
+		g.stop = stop
+		d.startCursor(g.committed+1, stop, func(m *Message) bool {
+			return g.dispatch(stop, m)
+		})
+	}
+	return nil
+}
+
+// dispatch hands a message from the cursor stopped by stop to a member,
+// trying another if the chosen one has left. It returns false once that
+// cursor has been stopped.
+func (g *consumerGroup) dispatch(stop chan struct{}, m *Message) bool {
+	for {
+		member := g.pick(stop)
+		if member == nil {
+			return false
+		}
+		if member.signal(m, true) {
+			return true
+		}
+	}
+}
+
+// pick returns the member with the shortest queue, or nil if the cursor
+// stopped by stop is no longer the group's. It stops the group when no
+// members are left.
+func (g *consumerGroup) pick(stop chan struct{}) *Subscriber {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stop != stop {
+		return nil
+	}
+	if g.prune() == 0 {
+		g.halt()
+		return nil
+	}
+	members := g.members
+
+	g.next++
+	var best *Subscriber
+	bestLag := 0
+	for i := range members {
+		s := members[(g.next+i)%len(members)]
+		if lag := s.Stats().Lag; best == nil || lag < bestLag {
+			best, bestLag = s, lag
+		}
+	}
+	return best
+}
+
+// prune drops members that have left and returns how many remain. The
+// caller holds g.mu.
+func (g *consumerGroup) prune() int {
+	members := g.members[:0]
+	for _, s := range g.members {
+		if !s.isDestroyed() {
+			members = append(members, s)
+		}
+	}
+	for i := len(members); i < len(g.members); i++ {
+		g.members[i] = nil
+	}
+	g.members = members
+	return len(members)
+}
+
+// halt stops the running cursor, if any. The caller holds g.mu.
+func (g *consumerGroup) halt() {
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+}
+
+// commit stores offset if it is past the committed one
+func (g *consumerGroup) commit(offset int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if offset <= g.committed {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return fmt.Errorf("failed to create groups directory: %w", err)
+	}
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return fmt.Errorf("failed to write committed offset: %w", err)
+	}
+	if err := os.Rename(tmp, g.path); err != nil {
+		return fmt.Errorf("failed to commit offset: %w", err)
+	}
+	g.committed = offset
+	return nil
+}
@@ -0,0 +1,280 @@
+package broadcast
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// payloads reads n messages and returns their payloads as strings
+func payloads(t *testing.T, s *Subscriber, n int) []string {
+	t.Helper()
+	var got []string
+	for i := 0; i < n; i++ {
+		select {
+		case m := <-s.GetMessages():
+			got = append(got, string(m.GetPayload().([]byte)))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %v; want %d messages", got, n)
+		}
+	}
+	return got
+}
+
+func newDurableBroker(t *testing.T, dir string) *Broker {
+	t.Helper()
+	b := NewBroker()
+	if err := b.EnableDurability("orders", DefaultLogOptions(dir)); err != nil {
+		t.Fatalf("EnableDurability failed: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestLogAppendReadReopen(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openLog(dir, LogOptions{SegmentBytes: 100})
+	if err != nil {
+		t.Fatalf("openLog failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if record, err := l.Append([]byte(fmt.Sprintf("m%d", i))); err != nil || record.Offset != int64(i) {
+			t.Fatalf("Append %d = %d, %v", i, record.Offset, err)
+		}
+	}
+	if len(l.segments) < 2 {
+		t.Errorf("%d segments; want the log rolled", len(l.segments))
+	}
+	l.Close()
+
+	// Tear the last record as a crash mid-write would
+	last := l.segments[len(l.segments)-1]
+	if err := os.Truncate(last.path, last.size-3); err != nil {
+		t.Fatal(err)
+	}
+	l, err = openLog(dir, LogOptions{SegmentBytes: 100})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer l.Close()
+	if oldest, next := l.Bounds(); oldest != 0 || next != 9 {
+		t.Errorf("bounds after reopen %d, %d; want 0, 9", oldest, next)
+	}
+	records, err := l.Read(7, 10)
+	if err != nil || len(records) != 2 || string(records[1].Payload) != "m8" {
+		t.Errorf("Read(7) = %v, %v", records, err)
+	}
+	if record, err := l.Append([]byte("again")); err != nil || record.Offset != 9 {
+		t.Errorf("append after truncation = %d, %v", record.Offset, err)
+	}
+}
+
+func TestLogCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	l, _ := openLog(dir, LogOptions{SegmentBytes: 40})
+	for i := 0; i < 4; i++ {
+		l.Append([]byte("payload"))
+	}
+	l.Close()
+
+	// Damage inside an older segment is not silently dropped
+	file, _ := os.OpenFile(l.segments[0].path, os.O_RDWR, 0644)
+	file.WriteAt([]byte{0xff}, recordHeader)
+	file.Close()
+	if _, err := openLog(dir, LogOptions{SegmentBytes: 40}); err == nil {
+		t.Error("corrupt segment opened")
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		options LogOptions
+		advance time.Duration
+		oldest  int64
+	}{
+		{"unlimited", LogOptions{SegmentBytes: 100}, 0, 0},
+		{"size", LogOptions{SegmentBytes: 100, MaxBytes: 200}, 0, 8},
+		{"age", LogOptions{SegmentBytes: 100, MaxAge: time.Hour}, 2 * time.Hour, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := openLog(t.TempDir(), tt.options)
+			if err != nil {
+				t.Fatalf("openLog failed: %v", err)
+			}
+			defer l.Close()
+			now := clock
+			l.now = func() time.Time { return now }
+			// 34 byte records, so two per segment. The segment being
+			// written is never removed.
+			for i := 0; i < 12; i++ {
+				l.Append([]byte("0123456789"))
+			}
+			now = now.Add(tt.advance)
+			l.Retain()
+			if oldest, next := l.Bounds(); oldest != tt.oldest || next != 12 {
+				t.Errorf("bounds %d, %d; want %d, 12", oldest, next, tt.oldest)
+			}
+			// Reading from before the retained records starts at the oldest
+			if records, _ := l.Read(0, 1); len(records) != 1 || records[0].Offset != tt.oldest {
+				t.Errorf("Read(0) = %v", records)
+			}
+		})
+	}
+}
+
+func TestSubscribeAt(t *testing.T) {
+	b := newDurableBroker(t, t.TempDir())
+	d := b.durableTopic("orders")
+	start := time.Unix(1700000000, 0)
+	now := start
+	d.log.now = func() time.Time { return now }
+
+	// Nobody is subscribed, yet nothing is lost
+	for i := 0; i < 5; i++ {
+		if offset, err := b.Publish("orders", []byte(fmt.Sprintf("m%d", i))); err != nil || offset != int64(i) {
+			t.Fatalf("Publish = %d, %v", offset, err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	tests := []struct {
+		name  string
+		start StartPosition
+		want  string
+	}{
+		{"offset", AtOffset(3), "m3"},
+		{"before oldest", AtOffset(-10), "m0"},
+		{"time", AtTime(start.Add(90 * time.Second)), "m2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := b.AttachWithOptions(SubscriberOptions{QueueSize: 1, Policy: Disconnect})
+			defer b.Detach(s)
+			if err := b.SubscribeAt(s, "orders", tt.start); err != nil {
+				t.Fatalf("SubscribeAt failed: %v", err)
+			}
+			if got := payloads(t, s, 1); got[0] != tt.want {
+				t.Errorf("first message %s; want %s", got[0], tt.want)
+			}
+		})
+	}
+
+	// A replay catches up and then follows live messages, without
+	// overflowing a small queue
+	s, _ := b.AttachWithOptions(SubscriberOptions{QueueSize: 1, Policy: Disconnect})
+	b.SubscribeAt(s, "orders", AtOffset(0))
+	b.Broadcast([]byte("m5"), "orders")
+	got := payloads(t, s, 6)
+	if got[0] != "m0" || got[5] != "m5" || s.Err() != nil {
+		t.Errorf("replay got %v, err %v", got, s.Err())
+	}
+	b.Publish("orders", []byte("m6"))
+	select {
+	case m := <-s.GetMessages():
+		if m.GetOffset() != 6 {
+			t.Errorf("live message offset %d; want 6", m.GetOffset())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("live message not delivered")
+	}
+
+	if err := b.SubscribeAt(s, "other", AtOffset(0)); err != ErrNotDurable {
+		t.Errorf("SubscribeAt on a plain topic: %v", err)
+	}
+}
+
+func TestConsumerGroups(t *testing.T) {
+	dir := t.TempDir()
+	b := newDurableBroker(t, dir)
+	for i := 0; i < 20; i++ {
+		b.Publish("orders", []byte(fmt.Sprintf("m%d", i)))
+	}
+
+	first, err := b.JoinGroup("orders", "billing", SubscriberOptions{QueueSize: 4, Policy: Block})
+	if err != nil {
+		t.Fatalf("JoinGroup failed: %v", err)
+	}
+	second, _ := b.JoinGroup("orders", "billing", SubscriberOptions{QueueSize: 4, Policy: Block})
+
+	// Each message goes to exactly one member
+	seen := map[string]int{}
+	counts := map[*Subscriber]int{}
+	for len(seen) < 20 {
+		select {
+		case m := <-first.GetMessages():
+			seen[string(m.GetPayload().([]byte))]++
+			counts[first]++
+		case m := <-second.GetMessages():
+			seen[string(m.GetPayload().([]byte))]++
+			counts[second]++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("group delivered %d of 20 messages", len(seen))
+		}
+	}
+	for payload, n := range seen {
+		if n != 1 {
+			t.Errorf("%s delivered %d times", payload, n)
+		}
+	}
+	if counts[first] == 0 || counts[second] == 0 {
+		t.Errorf("delivery not balanced: %d and %d", counts[first], counts[second])
+	}
+
+	if err := b.Commit("orders", "billing", 14); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	b.Commit("orders", "billing", 9)
+	if committed, _ := b.Committed("orders", "billing"); committed != 14 {
+		t.Errorf("committed %d; want 14 after a backwards commit", committed)
+	}
+	if committed, _ := b.Committed("orders", "shipping"); committed != -1 {
+		t.Errorf("new group committed %d; want -1", committed)
+	}
+	if _, err := b.JoinGroup("orders", "../escape", DefaultSubscriberOptions()); err == nil {
+		t.Error("invalid group name accepted")
+	}
+
+	// A restarted broker resumes the group after the committed offset
+	b.Detach(first)
+	b.Detach(second)
+	b.Close()
+	b = newDurableBroker(t, dir)
+	if _, next, _ := b.Bounds("orders"); next != 20 {
+		t.Errorf("next offset after restart %d; want 20", next)
+	}
+	member, _ := b.JoinGroup("orders", "billing", SubscriberOptions{QueueSize: 4, Policy: Block})
+	if got := payloads(t, member, 1); got[0] != "m15" {
+		t.Errorf("resumed at %s; want m15", got[0])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "orders", "groups", "billing.offset")); err != nil {
+		t.Errorf("offset file missing: %v", err)
+	}
+}
+
+func TestConsumerGroupRejoinResumesAfterCommit(t *testing.T) {
+	b := newDurableBroker(t, t.TempDir())
+	for i := 0; i < 5; i++ {
+		b.Publish("orders", []byte(fmt.Sprintf("m%d", i)))
+	}
+
+	member, err := b.JoinGroup("orders", "billing", SubscriberOptions{QueueSize: 8, Policy: Block})
+	if err != nil {
+		t.Fatalf("JoinGroup failed: %v", err)
+	}
+	payloads(t, member, 2)
+	b.Commit("orders", "billing", 0)
+
+	// The cursor has handed everything to the member and is idle, so it
+	// doesn't notice the member leaving before another joins
+	b.Detach(member)
+	member, _ = b.JoinGroup("orders", "billing", SubscriberOptions{QueueSize: 8, Policy: Block})
+	got := payloads(t, member, 4)
+	if want := []string{"m1", "m2", "m3", "m4"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("rejoined member got %v; want %v", got, want)
+	}
+}
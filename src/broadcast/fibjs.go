@@ -1,3 +1,9 @@
+//go:build ignore
+
+// Code snippet, kept out of the broadcast package build.
+
+package main
+
 func fibonacci(w http.ResponseWriter, req *http.Request) {
     nValue, _ := strconv.Atoi(req.URL.Query().Get("n"))
 
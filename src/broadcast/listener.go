@@ -1,32 +1,123 @@
-type BroadcastServer interface {
-  Subscribe() <-chan int
-  CancelSubscription(<-chan int)
+package broadcast
+
+import (
+	"context"
+	"sync"
+)
+
+// FanOutMode decides what a BroadcastServer does when a listener's buffer
+// is full
+type FanOutMode string
+
+const (
+	// FanOutBuffered waits for room in the full buffer, so nothing is lost.
+	// Only a listener whose buffer has filled up holds back the source.
+	FanOutBuffered FanOutMode = "buffered"
+	// FanOutLatest keeps only the newest value a listener hasn't taken yet,
+	// for streams where a stale value is worthless. It never waits.
+	FanOutLatest FanOutMode = "latest"
+)
+
+// BroadcastOptions configures a BroadcastServer
+type BroadcastOptions struct {
+	// Buffer is how many values each listener may fall behind by
+	Buffer int
+	// Replay is how many of the latest values a new listener receives first
+	Replay int
+	Mode   FanOutMode
+}
+
+// DefaultBroadcastOptions buffers 16 values per listener without replay
+func DefaultBroadcastOptions() BroadcastOptions {
+	return BroadcastOptions{Buffer: 16, Mode: FanOutBuffered}
+}
+
+// BroadcastServer copies every value from a source channel to each
+// subscribed listener
+type BroadcastServer[T any] interface {
+	// Subscribe returns a channel that receives the values until ctx is
+	// done, the subscription is cancelled or the source is exhausted
+	Subscribe(ctx context.Context) <-chan T
+	// CancelSubscription closes a channel returned by Subscribe
+	CancelSubscription(<-chan T)
+	// Listeners returns the number of open subscriptions
+	Listeners() int
 }
 
-type broadcastServer struct {
-  source <-chan int
-  listeners []chan int
-  addListener chan chan int
-  removeListener chan (<-chan int)
+type broadcastServer[T any] struct {
+	options BroadcastOptions
+
+	mu        sync.Mutex
+	listeners map[<-chan T]*listener[T]
+	recent    []T // the last options.Replay values, oldest first
+	ended     bool
+}
+
+// NewBroadcastServer starts copying source to the listeners until ctx is
+// done or source is closed. When source is closed the listeners receive
+// what is buffered for them and then their channels close.
+func NewBroadcastServer[T any](ctx context.Context, source <-chan T, options BroadcastOptions) BroadcastServer[T] {
+	if options.Buffer <= 0 {
+		options.Buffer = DefaultBroadcastOptions().Buffer
+	}
+	if options.Mode == "" {
+		options.Mode = FanOutBuffered
+	}
+	if options.Replay < 0 {
+		options.Replay = 0
+	}
+	service := &broadcastServer[T]{
+		options:   options,
+		listeners: map[<-chan T]*listener[T]{},
+	}
+	go service.serve(ctx, source)
+	return service
+}
+
+func (s *broadcastServer[T]) Subscribe(ctx context.Context) <-chan T {
+	l := newListener[T](s.options)
+
+	s.mu.Lock()
+	replay := s.recent
+	if s.options.Mode == FanOutLatest && len(replay) > 1 {
+		replay = replay[len(replay)-1:]
+	}
+	l.queue = append(l.queue, replay...)
+	if s.ended {
+		l.ended = true
+	} else {
+		s.listeners[l.out] = l
+	}
+	s.mu.Unlock()
+
+	go l.pump(func() { s.remove(l) })
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.cancel()
+		case <-l.exited:
+		}
+	}()
+	return l.out
 }
 
-func (s *broadcastServer) Subscribe() <-chan int {
-  newListener := make(chan int)
-  s.addListener <- newListener
-  return newListener
+func (s *broadcastServer[T]) CancelSubscription(channel <-chan T) {
+	s.mu.Lock()
+	l := s.listeners[channel]
+	s.mu.Unlock()
+	if l != nil {
+		l.cancel()
+	}
 }
 
-func (s *broadcastServer) CancelSubscription(channel <-chan int) {
-  s.removeListener <- channel
+func (s *broadcastServer[T]) Listeners() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.listeners)
 }
 
-func NewBroadcastServer(ctx context.Context, source <-chan int) BroadcastServer {
-  service := &broadcastServer{
-    source: source,
-    listeners: make([]chan int, 0),
-    addListener: make(chan chan int),
-    removeListener: make(chan (<-chan int)),
-  }
-  go service.serve(ctx)
-  return service
+func (s *broadcastServer[T]) remove(l *listener[T]) {
+	s.mu.Lock()
+	delete(s.listeners, l.out)
+	s.mu.Unlock()
 }
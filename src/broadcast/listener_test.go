@@ -0,0 +1,137 @@
+package broadcast
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// drain reads a listener until it closes
+func drain(t *testing.T, c <-chan int) []int {
+	t.Helper()
+	var got []int
+	for {
+		select {
+		case v, ok := <-c:
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("listener not closed after %v", got)
+		}
+	}
+}
+
+func sendAll(source chan<- int, n int) {
+	for i := 0; i < n; i++ {
+		source <- i
+	}
+	close(source)
+}
+
+func TestBroadcastServerFanOut(t *testing.T) {
+	source := make(chan int)
+	server := NewBroadcastServer[int](context.Background(), source, BroadcastOptions{Buffer: 10})
+	ctx := context.Background()
+	slow := server.Subscribe(ctx)
+	fast := server.Subscribe(ctx)
+
+	// The fast listener gets everything while the slow one isn't reading
+	go sendAll(source, 10)
+	got := drain(t, fast)
+	if len(got) != 10 || got[9] != 9 {
+		t.Errorf("fast listener got %v", got)
+	}
+	if got := drain(t, slow); len(got) != 10 || got[0] != 0 {
+		t.Errorf("slow listener got %v", got)
+	}
+
+	// A listener that subscribes after the source is exhausted closes
+	if _, ok := <-server.Subscribe(ctx); ok {
+		t.Error("late listener got a value")
+	}
+	if n := server.Listeners(); n != 0 {
+		t.Errorf("%d listeners left", n)
+	}
+}
+
+func TestBroadcastServerReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		options BroadcastOptions
+		want    []int
+	}{
+		{"none", BroadcastOptions{}, nil},
+		{"last three", BroadcastOptions{Replay: 3}, []int{2, 3, 4}},
+		{"latest mode replays one", BroadcastOptions{Replay: 3, Mode: FanOutLatest}, []int{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := make(chan int)
+			server := NewBroadcastServer[int](context.Background(), source, tt.options)
+			sendAll(source, 5)
+			got := drain(t, server.Subscribe(context.Background()))
+			if len(got) != len(tt.want) {
+				t.Fatalf("late joiner got %v; want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("late joiner got %v; want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBroadcastServerLatest(t *testing.T) {
+	source := make(chan int)
+	server := NewBroadcastServer[int](context.Background(), source, BroadcastOptions{Mode: FanOutLatest})
+	stalled := server.Subscribe(context.Background())
+
+	// The source never waits for the stalled listener
+	done := make(chan struct{})
+	go func() {
+		sendAll(source, 1000)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("source blocked by a stalled listener")
+	}
+	got := drain(t, stalled)
+	if len(got) == 0 || len(got) > 2 || got[len(got)-1] != 999 {
+		t.Errorf("stalled listener got %v; want the latest value", got)
+	}
+}
+
+func TestBroadcastServerCancel(t *testing.T) {
+	serverCtx, stop := context.WithCancel(context.Background())
+	source := make(chan int)
+	server := NewBroadcastServer[int](serverCtx, source, DefaultBroadcastOptions())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	byContext := server.Subscribe(ctx)
+	byCall := server.Subscribe(context.Background())
+	open := server.Subscribe(context.Background())
+	if n := server.Listeners(); n != 3 {
+		t.Fatalf("%d listeners; want 3", n)
+	}
+
+	cancel()
+	server.CancelSubscription(byCall)
+	drain(t, byContext)
+	drain(t, byCall)
+	source <- 1
+	if v := <-open; v != 1 {
+		t.Errorf("remaining listener got %d", v)
+	}
+	if n := server.Listeners(); n != 1 {
+		t.Errorf("%d listeners after cancelling two; want 1", n)
+	}
+
+	// Stopping the server closes the rest
+	stop()
+	drain(t, open)
+}
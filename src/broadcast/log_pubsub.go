@@ -0,0 +1,348 @@
+package broadcast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogOptions configures the on-disk log of a durable topic
+type LogOptions struct {
+	// Dir holds one directory per durable topic
+	Dir string
+	// SegmentBytes is the size at which a new segment file is started
+	SegmentBytes int64
+	// MaxBytes and MaxAge bound what is kept; zero keeps everything.
+	// Whole segments are removed, oldest first, never the one being written.
+	MaxBytes int64
+	MaxAge   time.Duration
+	// Sync flushes every append to disk before it is delivered, instead of
+	// leaving it to the operating system
+	Sync bool
+}
+
+// DefaultLogOptions returns 16 MiB segments and unlimited retention in dir
+func DefaultLogOptions(dir string) LogOptions {
+	return LogOptions{Dir: dir, SegmentBytes: 16 << 20}
+}
+
+// Record is one message in a durable topic's log
+type Record struct {
+	Offset  int64
+	Time    time.Time
+	Payload []byte
+}
+
+// ErrCorruptLog is returned when a segment other than the last one has a
+// damaged record
+var ErrCorruptLog = errors.New("corrupt log segment")
+
+const (
+	segmentSuffix = ".log"
+	// record header: payload length, CRC-32 of the rest, offset, time
+	recordHeader = 4 + 4 + 8 + 8
+	// maxRecordSize keeps a damaged length from allocating gigabytes
+	maxRecordSize = 64 << 20
+)
+
+type indexEntry struct {
+	position int64
+	time     int64
+}
+
+// segment is one file of the log, holding the records from base onwards
+type segment struct {
+	base  int64
+	path  string
+	file  *os.File
+	size  int64
+	index []indexEntry // entry i is the record at offset base+i
+}
+
+// segmentLog is an append-only log split into segment files named after
+// their first offset. Every record is indexed in memory.
+type segmentLog struct {
+	mu       sync.RWMutex
+	dir      string
+	options  LogOptions
+	segments []*segment
+	next     int64
+	now      func() time.Time
+}
+
+// openLog opens or creates the log in dir. A record cut short by a crash
+// at the end of the last segment is truncated away.
+func openLog(dir string, options LogOptions) (*segmentLog, error) {
+	if options.SegmentBytes <= 0 {
+		options.SegmentBytes = DefaultLogOptions("").SegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	var bases []int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseInt(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i] < bases[j] })
+
+	l := &segmentLog{dir: dir, options: options, now: time.Now}
+	for i, base := range bases {
+		seg, err := openSegment(dir, base, i == len(bases)-1)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.segments = append(l.segments, seg)
+		l.next = base + int64(len(seg.index))
+	}
+	if len(l.segments) == 0 {
+		seg, err := createSegment(dir, 0)
+		if err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, seg)
+	}
+	return l, nil
+}
+
+func segmentPath(dir string, base int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentSuffix))
+}
+
+func createSegment(dir string, base int64) (*segment, error) {
+	path := segmentPath(dir, base)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create segment: %w", err)
+	}
+	return &segment{base: base, path: path, file: file}, nil
+}
+
+// openSegment indexes an existing segment. Only the last segment may end
+// in a damaged record, which is then truncated.
+func openSegment(dir string, base int64, last bool) (*segment, error) {
+	path := segmentPath(dir, base)
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment: %w", err)
+	}
+	seg := &segment{base: base, path: path, file: file}
+	for {
+		record, size, err := readRecord(file, seg.size)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && record.Offset != base+int64(len(seg.index)) {
+			err = fmt.Errorf("%w: offset %d out of sequence", ErrCorruptLog, record.Offset)
+		}
+		if err != nil {
+			if !last {
+				file.Close()
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if err := file.Truncate(seg.size); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("failed to truncate damaged record: %w", err)
+			}
+			break
+		}
+		seg.index = append(seg.index, indexEntry{position: seg.size, time: record.Time.UnixNano()})
+		seg.size += size
+	}
+	return seg, nil
+}
+
+// readRecord reads the record at position, returning io.EOF at the clean
+// end of the file
+func readRecord(file *os.File, position int64) (Record, int64, error) {
+	var header [recordHeader]byte
+	n, err := file.ReadAt(header[:], position)
+	if n == 0 && err == io.EOF {
+		return Record{}, 0, io.EOF
+	}
+	if n < recordHeader {
+		return Record{}, 0, fmt.Errorf("%w: short header", ErrCorruptLog)
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return Record{}, 0, fmt.Errorf("%w: record of %d bytes", ErrCorruptLog, length)
+	}
+	payload := make([]byte, length)
+	if _, err := file.ReadAt(payload, position+recordHeader); err != nil {
+		return Record{}, 0, fmt.Errorf("%w: short payload", ErrCorruptLog)
+	}
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[8:])
+	checksum.Write(payload)
+	if checksum.Sum32() != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, 0, fmt.Errorf("%w: checksum mismatch", ErrCorruptLog)
+	}
+	return Record{
+		Offset:  int64(binary.BigEndian.Uint64(header[8:16])),
+		Time:    time.Unix(0, int64(binary.BigEndian.Uint64(header[16:24]))),
+		Payload: payload,
+	}, recordHeader + int64(length), nil
+}
+
+// Append writes payload as the next record
+func (l *segmentLog) Append(payload []byte) (Record, error) {
+	if len(payload) > maxRecordSize {
+		return Record{}, fmt.Errorf("payload of %d bytes is over the %d byte limit", len(payload), maxRecordSize)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	active := l.segments[len(l.segments)-1]
+	if active.size > 0 && active.size+recordHeader+int64(len(payload)) > l.options.SegmentBytes {
+		if err := l.roll(); err != nil {
+			return Record{}, err
+		}
+		active = l.segments[len(l.segments)-1]
+	}
+
+	record := Record{Offset: l.next, Time: l.now(), Payload: payload}
+	buf := make([]byte, recordHeader+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(record.Offset))
+	binary.BigEndian.PutUint64(buf[16:24], uint64(record.Time.UnixNano()))
+	copy(buf[recordHeader:], payload)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+
+	if _, err := active.file.WriteAt(buf, active.size); err != nil {
+		// Leave no partial record for the next append to follow
+		active.file.Truncate(active.size)
+		return Record{}, fmt.Errorf("failed to append record: %w", err)
+	}
+	if l.options.Sync {
+		if err := active.file.Sync(); err != nil {
+			return Record{}, fmt.Errorf("failed to sync log: %w", err)
+		}
+	}
+	active.index = append(active.index, indexEntry{position: active.size, time: record.Time.UnixNano()})
+	active.size += int64(len(buf))
+	l.next++
+	l.retain()
+	return record, nil
+}
+
+// roll starts a new segment at the next offset
+func (l *segmentLog) roll() error {
+	active := l.segments[len(l.segments)-1]
+	if err := active.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	seg, err := createSegment(l.dir, l.next)
+	if err != nil {
+		return err
+	}
+	l.segments = append(l.segments, seg)
+	return nil
+}
+
+// Retain applies the retention limits
+func (l *segmentLog) Retain() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retain()
+}
+
+func (l *segmentLog) retain() {
+	var total int64
+	for _, seg := range l.segments {
+		total += seg.size
+	}
+	cutoff := l.now().Add(-l.options.MaxAge).UnixNano()
+	for len(l.segments) > 1 {
+		oldest := l.segments[0]
+		tooBig := l.options.MaxBytes > 0 && total > l.options.MaxBytes
+		tooOld := l.options.MaxAge > 0 && (len(oldest.index) == 0 || oldest.index[len(oldest.index)-1].time < cutoff)
+		if !tooBig && !tooOld {
+			return
+		}
+		oldest.file.Close()
+		os.Remove(oldest.path)
+		total -= oldest.size
+		l.segments = l.segments[1:]
+	}
+}
+
+// Bounds returns the oldest retained offset and the offset the next record
+// will get; they are equal when the log is empty
+func (l *segmentLog) Bounds() (oldest, next int64) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.segments[0].base, l.next
+}
+
+// Read returns up to max records from offset on. An offset older than the
+// retained records reads from the oldest one.
+func (l *segmentLog) Read(offset int64, max int) ([]Record, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if offset < l.segments[0].base {
+		offset = l.segments[0].base
+	}
+	var records []Record
+	for _, seg := range l.segments {
+		end := seg.base + int64(len(seg.index))
+		for ; offset < end && len(records) < max; offset++ {
+			record, _, err := readRecord(seg.file, seg.index[offset-seg.base].position)
+			if err != nil {
+				return records, err
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// OffsetAt returns the offset of the first record written at or after t
+func (l *segmentLog) OffsetAt(t time.Time) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	target := t.UnixNano()
+	for _, seg := range l.segments {
+		i := sort.Search(len(seg.index), func(i int) bool { return seg.index[i].time >= target })
+		if i < len(seg.index) {
+			return seg.base + int64(i)
+		}
+	}
+	return l.next
+}
+
+// Close closes the segment files
+func (l *segmentLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var first error
+	for _, seg := range l.segments {
+		if err := seg.file.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
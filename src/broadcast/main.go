@@ -1,3 +1,9 @@
+//go:build ignore
+
+// Code snippet, kept out of the broadcast package build.
+
+package main
+
 func main() {
   ctx, cancel := context.WithCancel(context.Background())
   defer cancel()
@@ -5,10 +11,10 @@ func main() {
 // From 0 to 9
   range10 := rangeChannel(ctx, 10)
 
-  broadcaster := NewBroadcastServer(ctx, range10)
-  listener1 := broadcaster.Subscribe()
-  listener2 := broadcaster.Subscribe()
-  listener3 := broadcaster.Subscribe()
+  broadcaster := NewBroadcastServer[int](ctx, range10, DefaultBroadcastOptions())
+  listener1 := broadcaster.Subscribe(ctx)
+  listener2 := broadcaster.Subscribe(ctx)
+  listener3 := broadcaster.Subscribe(ctx)
 
   var wg sync.WaitGroup
   wg.Add(3)
@@ -1,3 +1,9 @@
+//go:build ignore
+
+// Code snippet, kept out of the broadcast package build.
+
+package main
+
 func md5Worker(c chan string, wg *sync.WaitGroup) {
     hash := md5.Sum([]byte("nodejs-golang"))
 
@@ -5,6 +5,7 @@ type Message struct {
 	topic     string
 	payload   interface{}
 	createdAt int64
+	offset    int64
 }
 
 // GetTopic Return the topic of the current message
@@ -21,3 +22,9 @@ func (m *Message) GetPayload() interface{} {
 func (m *Message) GetCreatedAt() int64 {
 	return m.createdAt
 }
+
+// GetOffset Get the offset of this message in its durable topic's log, or
+// -1 if it wasn't written to one
+func (m *Message) GetOffset() int64 {
+	return m.offset
+}
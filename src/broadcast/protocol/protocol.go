@@ -0,0 +1,250 @@
+// Package protocol defines the frames the broker server and its clients
+// exchange, and their encoding over TCP and WebSocket.
+//
+// Over TCP each frame is length-prefixed:
+//
+//	uint32  length of the rest of the frame, big endian
+//	uint8   op
+//	uint16  topic length, big endian
+//	[]byte  topic
+//	[]byte  payload, up to the end of the frame
+//
+// Over WebSocket each frame is a JSON text message such as
+// {"op":"publish","topic":"orders.created","payload":{"id":1}}. A payload
+// that isn't valid JSON is sent as a base64 string with "encoding":"base64".
+package protocol
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Op is the kind of a frame
+type Op uint8
+
+// Frame ops. Clients send Subscribe, Unsubscribe and Publish; the server
+// sends Message and Error.
+const (
+	Subscribe Op = iota + 1
+	Unsubscribe
+	Publish
+	Message
+	Error
+)
+
+var opNames = map[Op]string{
+	Subscribe:   "subscribe",
+	Unsubscribe: "unsubscribe",
+	Publish:     "publish",
+	Message:     "message",
+	Error:       "error",
+}
+
+func (o Op) String() string {
+	if name, ok := opNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("op(%d)", uint8(o))
+}
+
+// MaxFrameSize bounds a frame so a bad length can't exhaust memory
+const MaxFrameSize = 1 << 20
+
+// WriteTimeout bounds how long a write to a stalled peer may block
+const WriteTimeout = 10 * time.Second
+
+// ErrFrameTooLarge is returned for frames over MaxFrameSize
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Frame is one protocol message. For Subscribe and Unsubscribe the topic
+// may be a wildcard pattern; for Error the payload is the error text.
+type Frame struct {
+	Op      Op
+	Topic   string
+	Payload []byte
+}
+
+// Conn sends and receives frames. WriteFrame is safe to call from several
+// goroutines; ReadFrame is not.
+type Conn interface {
+	ReadFrame() (Frame, error)
+	WriteFrame(Frame) error
+	Close() error
+}
+
+// streamConn speaks the length-prefixed encoding over a net.Conn
+type streamConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+// NewStreamConn wraps a TCP (or any stream) connection
+func NewStreamConn(conn net.Conn) Conn {
+	return &streamConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *streamConn) ReadFrame() (Frame, error) {
+	return ReadFrame(c.reader)
+}
+
+func (c *streamConn) WriteFrame(frame Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	return WriteFrame(c.conn, frame)
+}
+
+func (c *streamConn) Close() error {
+	return c.conn.Close()
+}
+
+// ReadFrame reads one length-prefixed frame
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return Frame{}, ErrFrameTooLarge
+	}
+	if size < 3 {
+		return Frame{}, fmt.Errorf("frame of %d bytes is too short", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Frame{}, fmt.Errorf("failed to read frame: %w", err)
+	}
+
+	topicLen := int(binary.BigEndian.Uint16(body[1:3]))
+	if 3+topicLen > len(body) {
+		return Frame{}, errors.New("topic runs past the end of the frame")
+	}
+	return Frame{
+		Op:      Op(body[0]),
+		Topic:   string(body[3 : 3+topicLen]),
+		Payload: body[3+topicLen:],
+	}, nil
+}
+
+// WriteFrame writes one length-prefixed frame
+func WriteFrame(w io.Writer, frame Frame) error {
+	size := 3 + len(frame.Topic) + len(frame.Payload)
+	if size > MaxFrameSize || len(frame.Topic) > 0xffff {
+		return ErrFrameTooLarge
+	}
+	buf := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(size))
+	buf[4] = byte(frame.Op)
+	binary.BigEndian.PutUint16(buf[5:7], uint16(len(frame.Topic)))
+	copy(buf[7:], frame.Topic)
+	copy(buf[7+len(frame.Topic):], frame.Payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// jsonFrame is the WebSocket form of a Frame
+type jsonFrame struct {
+	Op       string          `json:"op"`
+	Topic    string          `json:"topic,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (f Frame) MarshalJSON() ([]byte, error) {
+	out := jsonFrame{Op: f.Op.String(), Topic: f.Topic}
+	switch {
+	case len(f.Payload) == 0:
+	case f.Op == Error:
+		out.Payload, _ = json.Marshal(string(f.Payload))
+	case json.Valid(f.Payload):
+		out.Payload = f.Payload
+	default:
+		out.Payload, _ = json.Marshal(base64.StdEncoding.EncodeToString(f.Payload))
+		out.Encoding = "base64"
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *Frame) UnmarshalJSON(data []byte) error {
+	var in jsonFrame
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	f.Op = 0
+	for op, name := range opNames {
+		if name == in.Op {
+			f.Op = op
+		}
+	}
+	if f.Op == 0 {
+		return fmt.Errorf("unknown op %q", in.Op)
+	}
+	f.Topic = in.Topic
+	f.Payload = nil
+
+	switch {
+	case len(in.Payload) == 0:
+	case in.Encoding == "base64" || f.Op == Error:
+		var text string
+		if err := json.Unmarshal(in.Payload, &text); err != nil {
+			return fmt.Errorf("payload must be a string: %w", err)
+		}
+		if f.Op == Error {
+			f.Payload = []byte(text)
+			return nil
+		}
+		payload, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		f.Payload = payload
+	case in.Encoding != "":
+		return fmt.Errorf("unknown encoding %q", in.Encoding)
+	default:
+		f.Payload = []byte(in.Payload)
+	}
+	return nil
+}
+
+// webSocketConn speaks the JSON encoding over a WebSocket
+type webSocketConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// NewWebSocketConn wraps a WebSocket connection
+func NewWebSocketConn(conn *websocket.Conn) Conn {
+	conn.SetReadLimit(MaxFrameSize)
+	return &webSocketConn{conn: conn}
+}
+
+func (c *webSocketConn) ReadFrame() (Frame, error) {
+	var frame Frame
+	err := c.conn.ReadJSON(&frame)
+	return frame, err
+}
+
+func (c *webSocketConn) WriteFrame(frame Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	return c.conn.WriteJSON(frame)
+}
+
+func (c *webSocketConn) Close() error {
+	return c.conn.Close()
+}
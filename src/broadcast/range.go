@@ -1,3 +1,9 @@
+//go:build ignore
+
+// Code snippet, kept out of the broadcast package build.
+
+package main
+
 func rangeChannel(
   ctx context.Context,
   n int,
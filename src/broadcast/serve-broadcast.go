@@ -1,41 +1,187 @@
-func (s *broadcastServer) serve(ctx context.Context) {
-  defer func () {
-    for _, listener := range s.listeners {
-      if listener != nil {
-          close(listener)
-      }
-    }
-  } ()
-
-  for {
-    select {
-      case <-ctx.Done():
-        return
-      case newListener := <- s.addListener:
-        s.listeners = append(s.listeners, newListener)
-      case listenerToRemove := <- s.removeListener:
-        for i, ch := range s.listeners {
-          if ch == listenerToRemove {
-              s.listeners[i] = s.listeners[len(s.listeners)-1]
-              s.listeners = s.listeners[:len(s.listeners)-1]
-              close(ch)
-              break
-          }
-        }
-      case val, ok := <-s.source:
-        if !ok {
-          return
-        }
-        for _, listener := range s.listeners {
-          if listener != nil {
-            select {
-             case listener <- val:
-             case <-ctx.Done():
-              return
-            }
-            
-          }
-        }
-    }
-  }
+package broadcast
+
+import (
+	"context"
+	"sync"
+)
+
+func (s *broadcastServer[T]) serve(ctx context.Context, source <-chan T) {
+	for {
+		select {
+		case <-ctx.Done():
+			// Stop at once, dropping what the listeners haven't taken
+			for _, l := range s.close() {
+				l.cancel()
+			}
+			return
+		case val, ok := <-source:
+			if !ok {
+				for _, l := range s.close() {
+					l.finish()
+				}
+				return
+			}
+
+			s.mu.Lock()
+			if s.options.Replay > 0 {
+				if len(s.recent) == s.options.Replay {
+					s.recent = s.recent[1:]
+				}
+				s.recent = append(s.recent, val)
+			}
+			listeners := make([]*listener[T], 0, len(s.listeners))
+			for _, l := range s.listeners {
+				listeners = append(listeners, l)
+			}
+			s.mu.Unlock()
+
+			for _, l := range listeners {
+				if !l.push(ctx, val) && ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// close marks the source exhausted and returns the listeners
+func (s *broadcastServer[T]) close() []*listener[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	listeners := make([]*listener[T], 0, len(s.listeners))
+	for _, l := range s.listeners {
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// listener buffers values for one subscription. Its pump goroutine owns
+// the out channel, so a slow reader only holds up its own buffer.
+type listener[T any] struct {
+	options BroadcastOptions
+	out     chan T
+
+	mu    sync.Mutex
+	queue []T
+	ended bool // no more values will be pushed
+
+	ready  chan struct{} // a value was queued or the listener ended
+	space  chan struct{} // a value was taken from the queue
+	done   chan struct{} // closed by cancel
+	exited chan struct{} // closed when the pump has closed out
+	once   sync.Once
+}
+
+func newListener[T any](options BroadcastOptions) *listener[T] {
+	return &listener[T]{
+		options: options,
+		out:     make(chan T),
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// push queues val. In buffered mode it waits for room and reports false
+// if the listener or ctx finished first.
+func (l *listener[T]) push(ctx context.Context, val T) bool {
+	for {
+		l.mu.Lock()
+		switch {
+		case l.options.Mode == FanOutLatest:
+			l.queue = append(l.queue[:0], val)
+		case len(l.queue) >= l.options.Buffer:
+			l.mu.Unlock()
+			select {
+			case <-l.space:
+				continue
+			case <-l.done:
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		default:
+			l.queue = append(l.queue, val)
+		}
+		l.mu.Unlock()
+		notify(l.ready)
+		return true
+	}
+}
+
+// finish lets the pump close out once the queue is drained
+func (l *listener[T]) finish() {
+	l.mu.Lock()
+	l.ended = true
+	l.mu.Unlock()
+	notify(l.ready)
+}
+
+func (l *listener[T]) cancel() {
+	l.once.Do(func() { close(l.done) })
+}
+
+// next takes the oldest queued value. ok is false when the queue is empty;
+// ended then says whether more may come.
+func (l *listener[T]) next() (val T, ok, ended bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		return val, false, l.ended
+	}
+	val = l.queue[0]
+	var zero T
+	l.queue[0] = zero
+	l.queue = l.queue[1:]
+	return val, true, false
+}
+
+func (l *listener[T]) pump(onExit func()) {
+	defer func() {
+		onExit()
+		close(l.out)
+		close(l.exited)
+	}()
+	for {
+		val, ok, ended := l.next()
+		if !ok {
+			if ended {
+				return
+			}
+			select {
+			case <-l.ready:
+				continue
+			case <-l.done:
+				return
+			}
+		}
+		notify(l.space)
+
+		// In latest mode a newer value replaces the one waiting to be sent
+		var newer chan struct{}
+		if l.options.Mode == FanOutLatest {
+			newer = l.ready
+		}
+		for sent := false; !sent; {
+			select {
+			case l.out <- val:
+				sent = true
+			case <-newer:
+				if latest, ok, _ := l.next(); ok {
+					val = latest
+				}
+			case <-l.done:
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,162 @@
+// Package server exposes a broadcast.Broker over the network, speaking the
+// frames from the protocol package over TCP and WebSocket.
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"broadcast"
+	"broadcast/protocol"
+)
+
+// Server accepts publishers and subscribers and relays between them
+// through a broker
+type Server struct {
+	broker   *broadcast.Broker
+	upgrader websocket.Upgrader
+	logger   *log.Logger
+	queue    broadcast.SubscriberOptions
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[protocol.Conn]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Options configures a Server
+type Options struct {
+	// CheckOrigin decides which browser origins may open a WebSocket.
+	// Nil allows only same-origin requests and non-browser clients.
+	CheckOrigin func(r *http.Request) bool
+	Logger      *log.Logger
+	// Queue is each client's subscriber queue. The default disconnects
+	// clients that fall 1024 messages behind; they reconnect and carry on,
+	// instead of stalling publishers.
+	Queue broadcast.SubscriberOptions
+}
+
+// New creates a server relaying through broker
+func New(broker *broadcast.Broker, options Options) *Server {
+	logger := options.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	queue := options.Queue
+	if queue == (broadcast.SubscriberOptions{}) {
+		queue = broadcast.SubscriberOptions{QueueSize: 1024, Policy: broadcast.Disconnect}
+	}
+	return &Server{
+		broker:    broker,
+		upgrader:  websocket.Upgrader{CheckOrigin: options.CheckOrigin},
+		logger:    logger,
+		queue:     queue,
+		listeners: map[net.Listener]bool{},
+		conns:     map[protocol.Conn]bool{},
+	}
+}
+
+// ErrServerClosed is returned by ServeTCP after Close
+var ErrServerClosed = errors.New("broker server closed")
+
+// ServeTCP accepts length-prefixed protocol connections on listener until
+// the server is closed
+func (s *Server) ServeTCP(listener net.Listener) error {
+	if !s.track(listener) {
+		return ErrServerClosed
+	}
+	defer s.untrack(listener)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetKeepAlive(true)
+		}
+		s.serve(protocol.NewStreamConn(conn), conn.RemoteAddr().String())
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket speaking the JSON protocol
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has already answered
+	}
+	s.serve(protocol.NewWebSocketConn(ws), r.RemoteAddr)
+}
+
+// Close stops the listeners and disconnects every client
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) track(listener net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.listeners[listener] = true
+	return true
+}
+
+func (s *Server) untrack(listener net.Listener) {
+	s.mu.Lock()
+	delete(s.listeners, listener)
+	s.mu.Unlock()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// serve starts a session for conn in the background
+func (s *Server) serve(conn protocol.Conn, remote string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = true
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		if err := s.session(conn); err != nil {
+			s.logger.Printf("broker client %s: %v", remote, err)
+		}
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+}
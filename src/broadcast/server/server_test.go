@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"broadcast"
+	"broadcast/client"
+	"broadcast/protocol"
+)
+
+func newTestServer(t *testing.T) (*Server, string, string) {
+	t.Helper()
+	srv := New(broadcast.NewBroker(), Options{Logger: log.New(io.Discard, "", 0)})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.ServeTCP(listener)
+	ws := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		ws.Close()
+		srv.Close()
+	})
+	return srv, "tcp://" + listener.Addr().String(), "ws" + strings.TrimPrefix(ws.URL, "http")
+}
+
+func dial(t *testing.T, address string, options client.Options) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, address, options)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func receive(t *testing.T, c *client.Client) client.Message {
+	t.Helper()
+	select {
+	case m := <-c.Messages():
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return client.Message{}
+}
+
+// waitForSubscribers lets Subscribe frames reach the broker before publishing
+func waitForSubscribers(t *testing.T, srv *Server, pattern string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.broker.Subscribers(pattern) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers to %s; want %d", srv.broker.Subscribers(pattern), pattern, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	srv, tcpAddress, wsAddress := newTestServer(t)
+	tcpSub := dial(t, tcpAddress, client.Options{})
+	wsSub := dial(t, wsAddress, client.Options{})
+	publisher := dial(t, tcpAddress, client.Options{})
+
+	tcpSub.Subscribe("orders.*")
+	wsSub.Subscribe("sensors.#")
+	waitForSubscribers(t, srv, "orders.*", 1)
+	waitForSubscribers(t, srv, "sensors.#", 1)
+
+	ctx := context.Background()
+	publisher.Publish(ctx, "orders.created", []byte(`{"id":1}`))
+	publisher.Publish(ctx, "sensors.temp.kitchen", []byte{0xff, 0x00})
+
+	if m := receive(t, tcpSub); m.Topic != "orders.created" || string(m.Payload) != `{"id":1}` {
+		t.Errorf("tcp subscriber got %+v", m)
+	}
+	// Binary payloads survive the JSON encoding
+	if m := receive(t, wsSub); m.Topic != "sensors.temp.kitchen" || !bytes.Equal(m.Payload, []byte{0xff, 0x00}) {
+		t.Errorf("websocket subscriber got %+v", m)
+	}
+
+	if err := publisher.Publish(ctx, "orders.*", nil); err == nil {
+		t.Error("publishing to a wildcard accepted")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	_, tcpAddress, _ := newTestServer(t)
+	conn, err := net.Dial("tcp", strings.TrimPrefix(tcpAddress, "tcp://"))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	stream := protocol.NewStreamConn(conn)
+
+	stream.WriteFrame(protocol.Frame{Op: protocol.Subscribe, Topic: "orders.a*"})
+	frame, err := stream.ReadFrame()
+	if err != nil || frame.Op != protocol.Error || !strings.Contains(string(frame.Payload), "whole words") {
+		t.Errorf("invalid pattern answered with %v %s (%v)", frame.Op, frame.Payload, err)
+	}
+
+	stream.WriteFrame(protocol.Frame{Op: protocol.Message, Topic: "x"})
+	if frame, _ := stream.ReadFrame(); frame.Op != protocol.Error {
+		t.Errorf("message frame from a client answered with %v", frame.Op)
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	srv := New(broadcast.NewBroker(), Options{Logger: log.New(io.Discard, "", 0)})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	go srv.ServeTCP(listener)
+
+	options := client.Options{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, OnError: func(error) {}}
+	sub := dial(t, "tcp://"+address, options)
+	sub.Subscribe("orders.#")
+	waitForSubscribers(t, srv, "orders.#", 1)
+
+	// Restart the server on the same address with a fresh broker
+	srv.Close()
+	srv = New(broadcast.NewBroker(), Options{Logger: log.New(io.Discard, "", 0)})
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("failed to listen again: %v", err)
+	}
+	go srv.ServeTCP(listener)
+	defer srv.Close()
+
+	pub := dial(t, "tcp://"+address, options)
+	waitForSubscribers(t, srv, "orders.#", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pub.Publish(ctx, "orders.shipped", []byte(`"again"`)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if m := receive(t, sub); m.Topic != "orders.shipped" {
+		t.Errorf("after reconnect got %+v", m)
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Messages(); ok {
+		t.Error("Messages not closed after Close")
+	}
+}
+
+func TestSlowClientDisconnected(t *testing.T) {
+	broker := broadcast.NewBroker()
+	srv := New(broker, Options{
+		Logger: log.New(io.Discard, "", 0),
+		Queue:  broadcast.SubscriberOptions{QueueSize: 4, Policy: broadcast.Disconnect},
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.ServeTCP(listener)
+	defer srv.Close()
+
+	// A subscriber that never reads
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	protocol.WriteFrame(conn, protocol.Frame{Op: protocol.Subscribe, Topic: "bulk"})
+	waitForSubscribers(t, srv, "bulk", 1)
+
+	payload := bytes.Repeat([]byte("x"), 64<<10)
+	deadline := time.Now().Add(10 * time.Second)
+	for broker.Subscribers("bulk") > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stalled client still subscribed: %+v", broker.Stats())
+		}
+		broker.Broadcast(payload, "bulk")
+	}
+}
+
+func TestFrameEncoding(t *testing.T) {
+	frames := []protocol.Frame{
+		{Op: protocol.Publish, Topic: "orders.created", Payload: []byte(`{"id":1}`)},
+		{Op: protocol.Message, Topic: "bin", Payload: []byte{0, 1, 2}},
+		{Op: protocol.Subscribe, Topic: "sensors.#"},
+		{Op: protocol.Error, Payload: []byte("bad topic")},
+	}
+	for _, frame := range frames {
+		var buf bytes.Buffer
+		if err := protocol.WriteFrame(&buf, frame); err != nil {
+			t.Fatalf("WriteFrame failed: %v", err)
+		}
+		got, err := protocol.ReadFrame(&buf)
+		if err != nil || got.Op != frame.Op || got.Topic != frame.Topic || !bytes.Equal(got.Payload, frame.Payload) {
+			t.Errorf("stream round trip of %+v = %+v, %v", frame, got, err)
+		}
+
+		data, _ := json.Marshal(frame)
+		got = protocol.Frame{}
+		if err := json.Unmarshal(data, &got); err != nil || got.Op != frame.Op || got.Topic != frame.Topic || !bytes.Equal(got.Payload, frame.Payload) {
+			t.Errorf("JSON round trip of %+v via %s = %+v, %v", frame, data, got, err)
+		}
+	}
+
+	var oversized bytes.Buffer
+	oversized.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := protocol.ReadFrame(&oversized); err != protocol.ErrFrameTooLarge {
+		t.Errorf("oversized frame: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/gorilla/websocket"
+
+	"broadcast"
+	"broadcast/protocol"
+)
+
+// session serves one client until it disconnects. Every client gets its
+// own broker subscriber, whose messages are forwarded as Message frames.
+func (s *Server) session(conn protocol.Conn) error {
+	defer conn.Close()
+
+	subscriber, err := s.broker.AttachWithOptions(s.queue)
+	if err != nil {
+		return fmt.Errorf("failed to attach subscriber: %w", err)
+	}
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		// Keeps draining after the connection is gone, so Detach never
+		// waits on a message nobody reads
+		for m := range subscriber.GetMessages() {
+			payload, _ := m.GetPayload().([]byte)
+			conn.WriteFrame(protocol.Frame{Op: protocol.Message, Topic: m.GetTopic(), Payload: payload})
+		}
+		// Dropped by the broker for falling behind
+		if err := subscriber.Err(); err != nil {
+			conn.WriteFrame(errorFrame("", err))
+			conn.Close()
+		}
+	}()
+	defer func() {
+		s.broker.Detach(subscriber)
+		<-forwarded
+	}()
+
+	for {
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			if isDisconnect(err) {
+				return nil
+			}
+			conn.WriteFrame(errorFrame("", err))
+			return err
+		}
+		if err := s.handle(subscriber, frame); err != nil {
+			if err := conn.WriteFrame(errorFrame(frame.Topic, err)); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// handle applies one client frame
+func (s *Server) handle(subscriber *broadcast.Subscriber, frame protocol.Frame) error {
+	switch frame.Op {
+	case protocol.Subscribe:
+		if err := broadcast.ValidatePattern(frame.Topic); err != nil {
+			return err
+		}
+		s.broker.Subscribe(subscriber, frame.Topic)
+	case protocol.Unsubscribe:
+		s.broker.Unsubscribe(subscriber, frame.Topic)
+	case protocol.Publish:
+		if err := broadcast.ValidateTopic(frame.Topic); err != nil {
+			return err
+		}
+		s.broker.Broadcast(frame.Payload, frame.Topic)
+	default:
+		return fmt.Errorf("unexpected %s frame", frame.Op)
+	}
+	return nil
+}
+
+func errorFrame(topic string, err error) protocol.Frame {
+	return protocol.Frame{Op: protocol.Error, Topic: topic, Payload: []byte(err.Error())}
+}
+
+// isDisconnect reports whether a read error just means the client left
+func isDisconnect(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+}
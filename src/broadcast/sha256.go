@@ -1,3 +1,9 @@
+//go:build ignore
+
+// Code snippet, kept out of the broadcast package build.
+
+package main
+
 func sha256Worker(c chan string, wg *sync.WaitGroup) {
     h := sha256.New()
     h.Write([]byte("nodejs-golang"))
@@ -2,11 +2,69 @@ package broadcast
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
 )
 
+// OverflowPolicy decides what happens to a message for a subscriber whose
+// queue is full
+type OverflowPolicy string
+
+const (
+	// Block makes the publisher wait for room in the queue
+	Block OverflowPolicy = "block"
+	// DropOldest discards the oldest queued message to make room
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest discards the new message
+	DropNewest OverflowPolicy = "drop-newest"
+	// Disconnect detaches the subscriber; its channel is closed and Err
+	// returns ErrSlowConsumer
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+// ErrSlowConsumer is the reason a subscriber was disconnected by the
+// Disconnect policy
+var ErrSlowConsumer = errors.New("subscriber disconnected: queue full")
+
+// SubscriberOptions configures a subscriber's queue
+type SubscriberOptions struct {
+	QueueSize int
+	Policy    OverflowPolicy
+}
+
+// DefaultSubscriberOptions queues 64 messages and blocks publishers after
+// that, so nothing is lost
+func DefaultSubscriberOptions() SubscriberOptions {
+	return SubscriberOptions{QueueSize: 64, Policy: Block}
+}
+
+// Validate checks the options
+func (o SubscriberOptions) Validate() error {
+	if o.QueueSize < 1 {
+		return fmt.Errorf("queue size must be at least 1, got %d", o.QueueSize)
+	}
+	switch o.Policy {
+	case Block, DropOldest, DropNewest, Disconnect:
+		return nil
+	}
+	return fmt.Errorf("unknown overflow policy %q", o.Policy)
+}
+
+// SubscriberStats are a subscriber's delivery metrics
+type SubscriberStats struct {
+	ID     string         `json:"id"`
+	Policy OverflowPolicy `json:"policy"`
+	// Lag is the number of messages queued for the subscriber and not yet
+	// received, including one handed over but not yet read
+	Lag       int    `json:"lag"`
+	Capacity  int    `json:"capacity"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+}
+
 // Subscribers ...
 type Subscribers map[string]*Subscriber
 
@@ -18,23 +76,55 @@ type Subscriber struct {
 	destroyed bool
 	topics    map[string]bool
 	lock      sync.RWMutex
+
+	// Messages wait in a ring buffer, oldest at head, until the pump
+	// goroutine hands them to the messages channel one at a time, which
+	// keeps them in order
+	options   SubscriberOptions
+	queue     []*Message
+	head      int
+	queued    int
+	inFlight  bool
+	changed   *sync.Cond // queue shrank, grew or the subscriber was destroyed
+	done      chan struct{}
+	delivered uint64
+	dropped   uint64
+	err       error
+	// onOverflow is set by the broker to detach the subscriber under the
+	// Disconnect policy
+	onOverflow func()
 }
 
-// NewSubscriber returns a new subscriber
+// NewSubscriber returns a new subscriber with the default options
 func NewSubscriber() (*Subscriber, error) {
+	return NewSubscriberWithOptions(DefaultSubscriberOptions())
+}
+
+// NewSubscriberWithOptions returns a new subscriber with its own queue
+// size and overflow policy
+func NewSubscriberWithOptions(options SubscriberOptions) (*Subscriber, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
 	id := make([]byte, 50)
 	if _, err := rand.Read(id); err != nil {
 		return nil, err
 	}
 
-	return &Subscriber{
+	s := &Subscriber{
 		id:        hex.EncodeToString(id),
 		messages:  make(chan *Message),
 		createdAt: time.Now().UnixNano(),
 		destroyed: false,
 		lock:      sync.RWMutex{},
 		topics:    map[string]bool{},
-	}, nil
+		options:   options,
+		queue:     make([]*Message, options.QueueSize),
+		done:      make(chan struct{}),
+	}
+	s.changed = sync.NewCond(&s.lock)
+	go s.pump()
+	return s, nil
 }
 
 // GetID return the subscriber id
@@ -70,37 +160,156 @@ func (s *Subscriber) RemoveTopic(topic string) {
 // GetTopics return slice of subscriber topics
 func (s *Subscriber) GetTopics() []string {
 	s.lock.RLock()
-	subscriberTopics := s.topics
-	s.lock.RUnlock()
+	defer s.lock.RUnlock()
 
 	topics := []string{}
-	for topic := range subscriberTopics {
+	for topic := range s.topics {
 		topics = append(topics, topic)
 	}
 	return topics
 }
 
-// GetMessages returns a channel of *Message to listen on
+// GetMessages returns a channel of *Message to listen on. It is closed
+// when the subscriber is detached.
 func (s *Subscriber) GetMessages() <-chan *Message {
 	return s.messages
 }
 
-// Signal sends a message to subscriber
-func (s *Subscriber) Signal(m *Message) *Subscriber {
+// Err returns why the subscriber was closed by the broker, if it was
+func (s *Subscriber) Err() error {
 	s.lock.RLock()
-	if !s.destroyed {
-		s.messages <- m
+	defer s.lock.RUnlock()
+	return s.err
+}
+
+// Stats returns the subscriber's delivery metrics
+func (s *Subscriber) Stats() SubscriberStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	lag := s.queued
+	if s.inFlight {
+		lag++
+	}
+	return SubscriberStats{
+		ID:        s.id,
+		Policy:    s.options.Policy,
+		Lag:       lag,
+		Capacity:  s.options.QueueSize,
+		Delivered: s.delivered,
+		Dropped:   s.dropped,
 	}
-	s.lock.RUnlock()
+}
 
+// Signal queues a message for the subscriber, applying the overflow
+// policy if the queue is full
+func (s *Subscriber) Signal(m *Message) *Subscriber {
+	s.signal(m, s.options.Policy == Block)
 	return s
 }
 
-// close the underlying channels/resources
-func (s *Subscriber) destroy() {
+// signal queues m, waiting for room if wait is set and applying the
+// overflow policy otherwise. It reports false if the subscriber is gone.
+func (s *Subscriber) signal(m *Message, wait bool) bool {
 	s.lock.Lock()
-	s.destroyed = true
+	for wait && !s.destroyed && s.queued == len(s.queue) {
+		s.changed.Wait()
+	}
+	if s.destroyed {
+		s.lock.Unlock()
+		return false
+	}
+
+	overflow := false
+	if s.queued < len(s.queue) {
+		s.push(m)
+	} else {
+		switch s.options.Policy {
+		case DropOldest:
+			s.pop()
+			s.push(m)
+			s.dropped++
+		case DropNewest:
+			s.dropped++
+		case Disconnect:
+			s.dropped++
+			s.err = ErrSlowConsumer
+			overflow = true
+		}
+	}
+	s.changed.Broadcast()
+	onOverflow := s.onOverflow
 	s.lock.Unlock()
 
-	close(s.messages)
+	if overflow {
+		if onOverflow != nil {
+			onOverflow()
+		} else {
+			s.destroy()
+		}
+	}
+	return true
+}
+
+func (s *Subscriber) isDestroyed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.destroyed
+}
+
+// pump hands queued messages to the messages channel in order, and closes
+// it once the subscriber is destroyed
+func (s *Subscriber) pump() {
+	defer close(s.messages)
+	for {
+		s.lock.Lock()
+		for s.queued == 0 && !s.destroyed {
+			s.changed.Wait()
+		}
+		if s.destroyed {
+			s.lock.Unlock()
+			return
+		}
+		m := s.pop()
+		s.inFlight = true
+		s.changed.Broadcast()
+		s.lock.Unlock()
+
+		select {
+		case s.messages <- m:
+		case <-s.done:
+			return
+		}
+
+		s.lock.Lock()
+		s.inFlight = false
+		s.delivered++
+		s.lock.Unlock()
+	}
+}
+
+func (s *Subscriber) push(m *Message) {
+	s.queue[(s.head+s.queued)%len(s.queue)] = m
+	s.queued++
+}
+
+func (s *Subscriber) pop() *Message {
+	m := s.queue[s.head]
+	s.queue[s.head] = nil
+	s.head = (s.head + 1) % len(s.queue)
+	s.queued--
+	return m
+}
+
+// close the underlying channels/resources. Safe to call more than once.
+func (s *Subscriber) destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.destroyed {
+		return
+	}
+	s.destroyed = true
+	s.queue, s.queued = nil, 0
+	close(s.done)
+	s.changed.Broadcast()
 }
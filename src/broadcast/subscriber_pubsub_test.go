@@ -0,0 +1,195 @@
+package broadcast
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// attach subscribes a new subscriber with options to "t"
+func attach(t *testing.T, b *Broker, options SubscriberOptions) *Subscriber {
+	t.Helper()
+	s, err := b.AttachWithOptions(options)
+	if err != nil {
+		t.Fatalf("AttachWithOptions failed: %v", err)
+	}
+	b.Subscribe(s, "t")
+	return s
+}
+
+// waitForPump waits until the pump has taken the first message and is
+// blocked handing it over, so the queue is empty again
+func waitForPump(t *testing.T, s *Subscriber) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.lock.RLock()
+		taken := s.inFlight && s.queued == 0
+		s.lock.RUnlock()
+		if taken {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pump never took the message")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receiveAll reads n payloads
+func receiveAll(t *testing.T, s *Subscriber, n int) []int {
+	t.Helper()
+	var got []int
+	for i := 0; i < n; i++ {
+		select {
+		case m := <-s.GetMessages():
+			got = append(got, m.GetPayload().(int))
+		case <-time.After(time.Second):
+			t.Fatalf("received %v; want %d messages", got, n)
+		}
+	}
+	return got
+}
+
+func TestOrderedDelivery(t *testing.T) {
+	b := NewBroker()
+	s := attach(t, b, SubscriberOptions{QueueSize: 8, Policy: Block})
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			b.Broadcast(i, "t")
+		}
+	}()
+	for i, got := range receiveAll(t, s, 100) {
+		if got != i {
+			t.Fatalf("message %d has payload %d", i, got)
+		}
+	}
+	if stats := s.Stats(); stats.Delivered < 99 || stats.Dropped != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		want    []int
+		dropped uint64
+	}{
+		// The first message is with the pump, the queue holds the next two
+		{DropOldest, []int{0, 3, 4}, 2},
+		{DropNewest, []int{0, 1, 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			b := NewBroker()
+			s := attach(t, b, SubscriberOptions{QueueSize: 2, Policy: tt.policy})
+			b.Broadcast(0, "t")
+			waitForPump(t, s)
+			for i := 1; i < 5; i++ {
+				b.Broadcast(i, "t")
+			}
+			if stats := s.Stats(); stats.Lag != 3 || stats.Dropped != tt.dropped {
+				t.Errorf("stats %+v; want lag 3, %d dropped", stats, tt.dropped)
+			}
+			got := receiveAll(t, s, 3)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("received %v; want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockPolicy(t *testing.T) {
+	b := NewBroker()
+	s := attach(t, b, SubscriberOptions{QueueSize: 1, Policy: Block})
+	b.Broadcast(0, "t")
+	waitForPump(t, s)
+	b.Broadcast(1, "t")
+
+	published := make(chan struct{})
+	go func() {
+		b.Broadcast(2, "t")
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("Broadcast returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if got := receiveAll(t, s, 3); got[0] != 0 || got[1] != 1 || got[2] != 2 {
+		t.Errorf("received %v", got)
+	}
+	<-published
+
+	// Detaching releases a blocked publisher
+	b.Broadcast(3, "t")
+	waitForPump(t, s)
+	b.Broadcast(4, "t")
+	released := make(chan struct{})
+	go func() {
+		b.Broadcast(5, "t")
+		close(released)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Detach(s)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Error("publisher still blocked after Detach")
+	}
+}
+
+func TestDisconnectPolicy(t *testing.T) {
+	b := NewBroker()
+	slow := attach(t, b, SubscriberOptions{QueueSize: 1, Policy: Disconnect})
+	fast := attach(t, b, SubscriberOptions{QueueSize: 16, Policy: Block})
+
+	for i := 0; i < 4; i++ {
+		b.Broadcast(i, "t")
+		if i == 0 {
+			waitForPump(t, slow)
+		}
+	}
+
+	// The slow subscriber gets what was queued, then its channel closes
+	count := 0
+	for range slow.GetMessages() {
+		count++
+	}
+	if count > 2 || slow.Err() != ErrSlowConsumer {
+		t.Errorf("slow subscriber got %d messages, err %v", count, slow.Err())
+	}
+	if b.Subscribers("t") != 1 || len(b.Stats()) != 1 {
+		t.Errorf("slow subscriber still attached: %d subscribers", b.Subscribers("t"))
+	}
+	if got := receiveAll(t, fast, 4); got[3] != 3 {
+		t.Errorf("fast subscriber received %v", got)
+	}
+}
+
+func TestStalledSubscriberLeaksNothing(t *testing.T) {
+	b := NewBroker()
+	attach(t, b, SubscriberOptions{QueueSize: 4, Policy: DropNewest})
+	before := runtime.NumGoroutine()
+	for i := 0; i < 1000; i++ {
+		b.Broadcast(i, "t")
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines grew from %d to %d", before, after)
+	}
+}
+
+func TestSubscriberOptionsValidate(t *testing.T) {
+	for _, options := range []SubscriberOptions{
+		{QueueSize: 0, Policy: Block},
+		{QueueSize: 1, Policy: "spill"},
+	} {
+		if _, err := NewSubscriberWithOptions(options); err == nil {
+			t.Errorf("%+v accepted", options)
+		}
+	}
+}
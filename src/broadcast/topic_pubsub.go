@@ -0,0 +1,74 @@
+package broadcast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topics are dot-separated words such as "orders.created". Subscriptions
+// may use two wildcards: "*" matches exactly one word and "#" matches zero
+// or more, so "orders.*" gets "orders.created" but not "orders.eu.created",
+// while "sensors.#" gets "sensors", "sensors.temp" and "sensors.temp.kitchen".
+const (
+	WildcardOne  = "*"
+	WildcardMany = "#"
+)
+
+// ValidateTopic checks a topic that messages are broadcast to
+func ValidateTopic(topic string) error {
+	for _, word := range strings.Split(topic, ".") {
+		if word == "" {
+			return fmt.Errorf("invalid topic %q: empty word", topic)
+		}
+		if word == WildcardOne || word == WildcardMany {
+			return fmt.Errorf("invalid topic %q: wildcards are only allowed in subscriptions", topic)
+		}
+	}
+	return nil
+}
+
+// ValidatePattern checks a topic or wildcard pattern to subscribe to
+func ValidatePattern(pattern string) error {
+	for _, word := range strings.Split(pattern, ".") {
+		if word == "" {
+			return fmt.Errorf("invalid pattern %q: empty word", pattern)
+		}
+		if word != WildcardOne && word != WildcardMany && strings.ContainsAny(word, WildcardOne+WildcardMany) {
+			return fmt.Errorf("invalid pattern %q: wildcards must be whole words", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether topic matches pattern
+func MatchTopic(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+	return matchWords(strings.Split(pattern, "."), strings.Split(topic, "."))
+}
+
+func matchWords(pattern, topic []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case WildcardMany:
+			// Try every number of words for "#" to swallow
+			for skip := 0; skip <= len(topic); skip++ {
+				if matchWords(pattern[1:], topic[skip:]) {
+					return true
+				}
+			}
+			return false
+		case WildcardOne:
+			if len(topic) == 0 {
+				return false
+			}
+		default:
+			if len(topic) == 0 || pattern[0] != topic[0] {
+				return false
+			}
+		}
+		pattern, topic = pattern[1:], topic[1:]
+	}
+	return len(topic) == 0
+}
@@ -0,0 +1,93 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.updated", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders", false},
+		{"orders.*", "orders.eu.created", false},
+		{"*.created", "orders.created", true},
+		{"sensors.#", "sensors", true},
+		{"sensors.#", "sensors.temp", true},
+		{"sensors.#", "sensors.temp.kitchen", true},
+		{"sensors.#", "sensorsx.temp", false},
+		{"#", "anything.at.all", true},
+		{"#.alarm", "sensors.smoke.alarm", true},
+		{"#.alarm", "alarm", true},
+		{"sensors.#.alarm", "sensors.alarm", true},
+		{"sensors.#.alarm", "sensors.smoke.alarm.reset", false},
+		{"*.*", "a.b", true},
+		{"*.*", "a", false},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v; want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	for topic, valid := range map[string]bool{
+		"orders.created": true,
+		"orders":         true,
+		"orders.*":       false,
+		"orders..x":      false,
+		"":               false,
+	} {
+		if err := ValidateTopic(topic); (err == nil) != valid {
+			t.Errorf("ValidateTopic(%q) = %v", topic, err)
+		}
+	}
+	for pattern, valid := range map[string]bool{
+		"orders.*":  true,
+		"sensors.#": true,
+		"orders.a*": false,
+		"orders.":   false,
+	} {
+		if err := ValidatePattern(pattern); (err == nil) != valid {
+			t.Errorf("ValidatePattern(%q) = %v", pattern, err)
+		}
+	}
+}
+
+func TestBroadcastWildcards(t *testing.T) {
+	broker := NewBroker()
+	s, err := broker.Attach()
+	if err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+	// Overlapping subscriptions must not deliver twice
+	broker.Subscribe(s, "orders.*", "orders.created", "sensors.#")
+
+	broker.Broadcast("a", "orders.created")
+	broker.Broadcast("b", "sensors.temp.kitchen")
+	broker.Broadcast("ignored", "orders.eu.created")
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-s.GetMessages():
+			got[m.GetTopic()+"="+m.GetPayload().(string)] = true
+		case <-time.After(time.Second):
+			t.Fatalf("got %v; want two messages", got)
+		}
+	}
+	if !got["orders.created=a"] || !got["sensors.temp.kitchen=b"] {
+		t.Errorf("got %v", got)
+	}
+	select {
+	case m := <-s.GetMessages():
+		t.Errorf("unexpected message %s=%v", m.GetTopic(), m.GetPayload())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,60 +1,231 @@
 package chitsheet
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // Message is a object used to pass data on sockets.
 type Message struct {
-	Name string      `json:"name"`
-	Data interface{} `json:"data"`
+	Name  string      `json:"name"`
+	Data  interface{} `json:"data,omitempty"`
+	ID    string      `json:"id,omitempty"`    // ID correlates a request with its response.
+	Room  string      `json:"room,omitempty"`  // Room is the target or origin room.
+	To    string      `json:"to,omitempty"`    // To is the target client of a direct message.
+	From  string      `json:"from,omitempty"`  // From is the sending client, set by the server.
+	Error string      `json:"error,omitempty"` // Error is set on failed responses.
 }
 
 // FindHandler is a type that defines handler finding functions.
 type FindHandler func(Event) (Handler, bool)
 
+var (
+	// ErrClientClosed is returned when the connection closed before a response arrived.
+	ErrClientClosed = errors.New("client connection closed")
+	// ErrQueueFull is returned when a request can't be queued for a slow client.
+	ErrQueueFull = errors.New("client write queue full")
+)
+
 // Client is a type that reads and writes on sockets.
 type Client struct {
-	send        Message
+	ID string // ID identifies the client for direct messages.
+
+	send        chan Message // send queues messages for the write routine.
 	socket      *websocket.Conn
 	findHandler FindHandler
+	hub         *Hub
+	options     Options
+	rooms       map[string]bool // rooms is guarded by the hub.
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	pending map[string]chan Message // pending maps request IDs to waiting callers.
 }
 
 // NewClient accepts a socket and returns an initialized Client.
 func NewClient(socket *websocket.Conn, findHandler FindHandler) *Client {
+	return newClient(socket, findHandler, nil, DefaultOptions())
+}
+
+func newClient(socket *websocket.Conn, findHandler FindHandler, hub *Hub, options Options) *Client {
 	return &Client{
+		ID:          newID(),
+		send:        make(chan Message, options.QueueSize),
 		socket:      socket,
 		findHandler: findHandler,
+		hub:         hub,
+		options:     options,
+		rooms:       make(map[string]bool),
+		done:        make(chan struct{}),
+		pending:     make(map[string]chan Message),
+	}
+}
+
+// newID returns a random identifier.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
 	}
+	return hex.EncodeToString(b)
 }
 
-// Write receives messages from the channel and writes to the socket.
+// Send queues a message for the client. A client whose queue is full is
+// too slow to keep up, so it is disconnected and Send returns false.
+func (c *Client) Send(msg Message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		log.Printf("socket write queue full, closing client %s\n", c.ID)
+		c.Close()
+		return false
+	}
+}
+
+// Reply answers a request, copying its name and correlation ID.
+func (c *Client) Reply(request Message, data interface{}) bool {
+	return c.Send(Message{Name: request.Name, ID: request.ID, Data: data})
+}
+
+// ReplyError answers a request with an error.
+func (c *Client) ReplyError(request Message, err error) bool {
+	return c.Send(Message{Name: request.Name, ID: request.ID, Error: err.Error()})
+}
+
+// Request sends a message to the client and waits for the response with
+// the same ID. Don't call it from a handler for the same client: the
+// response is read by the routine running the handler.
+func (c *Client) Request(ctx context.Context, name string, data interface{}) (Message, error) {
+	id := newID()
+	response := make(chan Message, 1)
+	c.mu.Lock()
+	c.pending[id] = response
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if !c.Send(Message{Name: name, ID: id, Data: data}) {
+		return Message{}, ErrQueueFull
+	}
+	select {
+	case msg := <-response:
+		if msg.Error != "" {
+			return msg, errors.New(msg.Error)
+		}
+		return msg, nil
+	case <-c.done:
+		return Message{}, ErrClientClosed
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// resolve hands a response to a waiting Request. Only the first response
+// with an ID is delivered, so a peer repeating it can't block the reader.
+func (c *Client) resolve(msg Message) bool {
+	if msg.ID == "" {
+		return false
+	}
+	c.mu.Lock()
+	response, found := c.pending[msg.ID]
+	delete(c.pending, msg.ID)
+	c.mu.Unlock()
+	if found {
+		select {
+		case response <- msg:
+		default:
+		}
+	}
+	return found
+}
+
+// Close closes the connection, ending the read and write routines.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.socket.Close()
+	})
+}
+
+// Write receives messages from the queue and writes them to the socket,
+// pinging the peer while the queue is idle.
 func (c *Client) Write() {
-	msg := c.send
-	err := c.socket.WriteJSON(msg)
-	if err != nil {
-		log.Printf("socket write error: %v\n", err)
+	ticker := time.NewTicker(c.options.PingPeriod())
+	defer func() {
+		ticker.Stop()
+		c.Close()
+	}()
+	for {
+		select {
+		case msg := <-c.send:
+			c.socket.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
+			if err := c.socket.WriteJSON(msg); err != nil {
+				log.Printf("socket write error: %v\n", err)
+				return
+			}
+		case <-ticker.C:
+			if err := c.socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.options.WriteWait)); err != nil {
+				log.Printf("socket ping error: %v\n", err)
+				return
+			}
+		case <-c.done:
+			return
+		}
 	}
 }
 
 // Read intercepts messages on the socket and assigns them to a handler function.
 func (c *Client) Read() {
-	var msg Message
+	c.socket.SetReadLimit(c.options.MaxMessageSize)
+	c.socket.SetReadDeadline(time.Now().Add(c.options.PongWait))
+	c.socket.SetPongHandler(func(string) error {
+		return c.socket.SetReadDeadline(time.Now().Add(c.options.PongWait))
+	})
+
 	for {
 		// read incoming message from socket
+		var msg Message
 		if err := c.socket.ReadJSON(&msg); err != nil {
-			log.Printf("socket read error: %v\n", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("socket read error: %v\n", err)
+			}
 			break
 		}
+		c.socket.SetReadDeadline(time.Now().Add(c.options.PongWait))
+
+		// a response to one of our requests
+		if c.resolve(msg) {
+			continue
+		}
 		// assign message to a function handler
 		if handler, found := c.findHandler(Event(msg.Name)); found {
-			handler(c, msg.Data)
+			handler(c, msg)
+		} else if msg.ID != "" {
+			c.ReplyError(msg, errors.New("unknown event "+msg.Name))
 		}
 	}
-	log.Println("exiting read loop")
 
 	// close interrupted socket connection
-	c.socket.Close()
+	c.Close()
+	if c.hub != nil {
+		c.hub.unregister(c)
+	}
 }
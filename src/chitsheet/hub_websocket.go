@@ -0,0 +1,140 @@
+package chitsheet
+
+import (
+	"sort"
+	"sync"
+)
+
+// Hub is a registry of connected clients and the rooms they have joined.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[string]*Client          // clients maps client IDs to clients.
+	rooms   map[string]map[*Client]bool // rooms maps room names to members.
+}
+
+// NewHub returns an empty Hub.
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[string]*Client),
+		rooms:   make(map[string]map[*Client]bool),
+	}
+}
+
+// register adds a client to the registry.
+func (h *Hub) register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c.ID] = c
+}
+
+// unregister removes a client from the registry and from every room.
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c.ID)
+	for room := range c.rooms {
+		h.leave(room, c)
+	}
+}
+
+// Client returns the connected client with the given ID.
+func (h *Hub) Client(id string) (*Client, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	c, found := h.clients[id]
+	return c, found
+}
+
+// Clients returns the IDs of the connected clients.
+func (h *Hub) Clients() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.clients))
+	for id := range h.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Join adds a client to a room, creating the room if needed.
+func (h *Hub) Join(room string, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, connected := h.clients[c.ID]; !connected {
+		return
+	}
+	members, found := h.rooms[room]
+	if !found {
+		members = make(map[*Client]bool)
+		h.rooms[room] = members
+	}
+	members[c] = true
+	c.rooms[room] = true
+}
+
+// Leave removes a client from a room. Empty rooms are deleted.
+func (h *Hub) Leave(room string, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leave(room, c)
+}
+
+func (h *Hub) leave(room string, c *Client) {
+	delete(c.rooms, room)
+	if members, found := h.rooms[room]; found {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// InRoom reports whether a client has joined a room.
+func (h *Hub) InRoom(room string, c *Client) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.rooms[room][c]
+}
+
+// Members returns the IDs of the clients in a room.
+func (h *Hub) Members(room string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		ids = append(ids, c.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Broadcast queues a message for every member of a room except the one
+// with the ID except, which may be empty. It returns how many were queued.
+func (h *Hub) Broadcast(room string, msg Message, except string) int {
+	h.mu.RLock()
+	members := make([]*Client, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		if c.ID != except {
+			members = append(members, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	sent := 0
+	for _, c := range members {
+		if c.Send(msg) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// SendTo queues a message for the client with the given ID.
+func (h *Hub) SendTo(id string, msg Message) bool {
+	c, found := h.Client(id)
+	if !found {
+		return false
+	}
+	return c.Send(msg)
+}
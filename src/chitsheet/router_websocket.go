@@ -1,63 +1,194 @@
 package chitsheet
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // Handler is a type representing functions which resolve requests.
-type Handler func(*Client, interface{})
+type Handler func(*Client, Message)
 
 // Event is a type representing request names.
 type Event string
 
+// Built-in events handled by every Router.
+const (
+	EventWelcome Event = "welcome" // sent on connect with the client's ID
+	EventJoin    Event = "join"    // join the room in Message.Room
+	EventLeave   Event = "leave"   // leave the room in Message.Room
+	EventRoom    Event = "room"    // send Data to the other members of Message.Room
+	EventDirect  Event = "direct"  // send Data to the client in Message.To
+)
+
+// Options configures a Router's connections.
+type Options struct {
+	// AllowedOrigins lists the browser origins that may connect, such as
+	// "https://example.com". Empty allows only the server's own host; "*"
+	// allows any origin.
+	AllowedOrigins []string
+	QueueSize      int           // QueueSize is how many messages may wait to be written to a client.
+	WriteWait      time.Duration // WriteWait bounds each write.
+	PongWait       time.Duration // PongWait is how long a silent peer is kept.
+	MaxMessageSize int64         // MaxMessageSize bounds incoming messages.
+}
+
+// DefaultOptions returns the options used by NewRouter.
+func DefaultOptions() Options {
+	return Options{
+		QueueSize:      256,
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		MaxMessageSize: 64 << 10,
+	}
+}
+
+// PingPeriod is how often peers are pinged, often enough to answer before PongWait.
+func (o Options) PingPeriod() time.Duration {
+	return o.PongWait * 9 / 10
+}
+
 // Router is a message routing object mapping events to function handlers.
 type Router struct {
-	rules map[Event]Handler // rules maps events to functions.
+	rules    map[Event]Handler // rules maps events to functions.
+	hub      *Hub
+	options  Options
+	upgrader websocket.Upgrader
 }
 
 // NewRouter returns an initialized Router.
 func NewRouter() *Router {
-	return &Router{
-		rules: make(map[Event]Handler),
+	return NewRouterWithOptions(DefaultOptions())
+}
+
+// NewRouterWithOptions returns a Router with the given options, filling
+// unset ones from DefaultOptions.
+func NewRouterWithOptions(options Options) *Router {
+	defaults := DefaultOptions()
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaults.QueueSize
 	}
+	if options.WriteWait <= 0 {
+		options.WriteWait = defaults.WriteWait
+	}
+	if options.PongWait <= 0 {
+		options.PongWait = defaults.PongWait
+	}
+	if options.MaxMessageSize <= 0 {
+		options.MaxMessageSize = defaults.MaxMessageSize
+	}
+
+	rt := &Router{
+		rules:   make(map[Event]Handler),
+		hub:     NewHub(),
+		options: options,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     checkOrigin(options.AllowedOrigins),
+		},
+	}
+	rt.Handle(EventJoin, rt.join)
+	rt.Handle(EventLeave, rt.leave)
+	rt.Handle(EventRoom, rt.room)
+	rt.Handle(EventDirect, rt.direct)
+	return rt
 }
 
-// ServeHTTP creates the socket connection and begins the read routine.
-func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// configure upgrader
-	upgrader := websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		// accept all?
-		CheckOrigin: func(r *http.Request) bool { return true },
+// checkOrigin returns an origin check for the allowed origins. A nil check
+// makes the upgrader reject origins other than the request's host.
+func checkOrigin(allowed []string) func(*http.Request) bool {
+	if len(allowed) == 0 {
+		return nil
+	}
+	origins := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		if origin == "*" {
+			return func(r *http.Request) bool { return true }
+		}
+		origins[origin] = true
 	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		// non-browser clients send no origin
+		return origin == "" || origins[origin]
+	}
+}
 
-	// upgrade connection to socket
-	socket, err := upgrader.Upgrade(w, r, nil)
+// Hub returns the registry of connected clients and rooms.
+func (rt *Router) Hub() *Hub {
+	return rt.hub
+}
+
+// ServeHTTP creates the socket connection and begins the read routine.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// upgrade connection to socket; the upgrader answers failed requests
+	socket, err := rt.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("socket server configuration error: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("socket upgrade error: %v\n", err)
 		return
 	}
 
-	client := NewClient(socket, rt.FindHandler)
+	client := newClient(socket, rt.FindHandler, rt.hub, rt.options)
+	rt.hub.register(client)
+	client.Send(Message{Name: string(EventWelcome), Data: map[string]string{"id": client.ID}})
 
-	// running method for reading from sockets, in main routine
+	// writing in its own routine, reading in this one
+	go client.Write()
 	client.Read()
 }
 
 // FindHandler implements a handler finding function for router.
 func (rt *Router) FindHandler(event Event) (Handler, bool) {
-	handler, found := rt.rules["helloFromClient"]
+	handler, found := rt.rules[event]
 	return handler, found
 }
 
-// Handle is a function to add handlers to the router.
+// Handle is a function to add handlers to the router. Handlers must be
+// added before the router serves connections.
 func (rt *Router) Handle(event Event, handler Handler) {
 	// store in to router rules
 	rt.rules[event] = handler
+}
 
+func (rt *Router) join(c *Client, msg Message) {
+	if msg.Room == "" {
+		c.ReplyError(msg, errors.New("room is required"))
+		return
+	}
+	rt.hub.Join(msg.Room, c)
+	if msg.ID != "" {
+		c.Reply(msg, rt.hub.Members(msg.Room))
+	}
+}
+
+func (rt *Router) leave(c *Client, msg Message) {
+	rt.hub.Leave(msg.Room, c)
+	if msg.ID != "" {
+		c.Reply(msg, nil)
+	}
+}
+
+func (rt *Router) room(c *Client, msg Message) {
+	if !rt.hub.InRoom(msg.Room, c) {
+		c.ReplyError(msg, errors.New("not a member of room "+msg.Room))
+		return
+	}
+	sent := rt.hub.Broadcast(msg.Room, Message{Name: string(EventRoom), Room: msg.Room, From: c.ID, Data: msg.Data}, c.ID)
+	if msg.ID != "" {
+		c.Reply(msg, sent)
+	}
+}
+
+func (rt *Router) direct(c *Client, msg Message) {
+	if !rt.hub.SendTo(msg.To, Message{Name: string(EventDirect), From: c.ID, Data: msg.Data}) {
+		c.ReplyError(msg, errors.New("client "+msg.To+" is not connected"))
+		return
+	}
+	if msg.ID != "" {
+		c.Reply(msg, nil)
+	}
 }
@@ -0,0 +1,195 @@
+package chitsheet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// startRouter serves a router over HTTP and returns its ws:// URL.
+func startRouter(t *testing.T, options Options) (*Router, string) {
+	rt := NewRouterWithOptions(options)
+	server := httptest.NewServer(rt)
+	t.Cleanup(server.Close)
+	return rt, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// dial connects to the router and returns the connection with the client
+// ID from the welcome message.
+func dial(t *testing.T, url string) (*websocket.Conn, string) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	welcome := read(t, conn)
+	require.Equal(t, string(EventWelcome), welcome.Name)
+	return conn, welcome.Data.(map[string]interface{})["id"].(string)
+}
+
+// read returns the next message on the connection.
+func read(t *testing.T, conn *websocket.Conn) Message {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg Message
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestWebSocketRoomsAndDirect(t *testing.T) {
+	rt, url := startRouter(t, DefaultOptions())
+	ada, adaID := dial(t, url)
+	bob, bobID := dial(t, url)
+	eve, eveID := dial(t, url)
+
+	require.NoError(t, ada.WriteJSON(Message{Name: "join", ID: "1", Room: "go"}))
+	require.Equal(t, []interface{}{adaID}, read(t, ada).Data)
+	require.NoError(t, bob.WriteJSON(Message{Name: "join", ID: "2", Room: "go"}))
+	require.Len(t, read(t, bob).Data, 2)
+	require.Len(t, rt.Hub().Members("go"), 2)
+
+	// room messages reach the other members only
+	require.NoError(t, ada.WriteJSON(Message{Name: "room", ID: "3", Room: "go", Data: "hello"}))
+	require.Equal(t, float64(1), read(t, ada).Data)
+	got := read(t, bob)
+	require.Equal(t, Message{Name: "room", Room: "go", From: adaID, Data: "hello"}, got)
+
+	// direct messages reach one client; eve's first message is this one,
+	// so the room message passed her by
+	require.NoError(t, ada.WriteJSON(Message{Name: "direct", ID: "4", To: eveID, Data: "hi"}))
+	require.Equal(t, Message{Name: "direct", ID: "4"}, read(t, ada))
+	require.Equal(t, Message{Name: "direct", From: adaID, Data: "hi"}, read(t, eve))
+	require.NoError(t, eve.WriteJSON(Message{Name: "direct", To: bobID, Data: "psst"}))
+	require.Equal(t, Message{Name: "direct", From: eveID, Data: "psst"}, read(t, bob))
+
+	require.NoError(t, eve.WriteJSON(Message{Name: "room", ID: "5", Room: "go", Data: "sneak"}))
+	require.Contains(t, read(t, eve).Error, "not a member")
+	require.NoError(t, eve.WriteJSON(Message{Name: "direct", ID: "6", To: "nobody"}))
+	require.Contains(t, read(t, eve).Error, "not connected")
+
+	// leaving the room, or disconnecting, removes the member
+	require.NoError(t, bob.WriteJSON(Message{Name: "leave", ID: "7", Room: "go"}))
+	require.Equal(t, "7", read(t, bob).ID)
+	require.Equal(t, []string{adaID}, rt.Hub().Members("go"))
+	ada.Close()
+	require.Eventually(t, func() bool { return len(rt.Hub().Members("go")) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebSocketRequest(t *testing.T) {
+	rt, url := startRouter(t, DefaultOptions())
+	conn, id := dial(t, url)
+	client, found := rt.Hub().Client(id)
+	require.True(t, found)
+
+	type result struct {
+		msg Message
+		err error
+	}
+	request := func(data string) chan result {
+		done := make(chan result, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			msg, err := client.Request(ctx, "ask", data)
+			done <- result{msg, err}
+		}()
+		return done
+	}
+
+	// the answer is matched to the request by its ID, and repeating the ID
+	// doesn't stall the connection
+	done := request("question")
+	asked := read(t, conn)
+	require.Equal(t, "question", asked.Data)
+	require.NotEmpty(t, asked.ID)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, conn.WriteJSON(Message{Name: "ask", ID: asked.ID, Data: "answer"}))
+	}
+	r := <-done
+	require.NoError(t, r.err)
+	require.Equal(t, "answer", r.msg.Data)
+
+	require.NoError(t, conn.WriteJSON(Message{Name: "join", ID: "after", Room: "r"}))
+	for msg := read(t, conn); msg.ID != "after"; msg = read(t, conn) {
+		// replies to the repeated answers, which are now unknown requests
+		require.Contains(t, msg.Error, "unknown event")
+	}
+
+	done = request("fail")
+	asked = read(t, conn)
+	require.NoError(t, conn.WriteJSON(Message{Name: "ask", ID: asked.ID, Error: "refused"}))
+	require.EqualError(t, (<-done).err, "refused")
+
+	// a request still waiting when the connection drops fails
+	done = request("lost")
+	read(t, conn)
+	conn.Close()
+	require.True(t, errors.Is((<-done).err, ErrClientClosed))
+}
+
+func TestWebSocketQueueFullDisconnects(t *testing.T) {
+	rt, url := startRouter(t, Options{QueueSize: 1})
+	conn, id := dial(t, url)
+	client, found := rt.Hub().Client(id)
+	require.True(t, found)
+
+	// the peer never reads, so the queue fills and the client is dropped
+	payload := strings.Repeat("x", 32<<10)
+	sent := 0
+	for client.Send(Message{Name: "flood", Data: payload}) {
+		sent++
+		require.Less(t, sent, 100000, "queue never filled")
+	}
+	require.False(t, client.Send(Message{Name: "after"}))
+
+	require.Eventually(t, func() bool {
+		_, connected := rt.Hub().Client(id)
+		return !connected
+	}, 2*time.Second, 10*time.Millisecond)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr interface{ Timeout() bool }
+			require.False(t, errors.As(err, &netErr) && netErr.Timeout(), "connection not closed")
+			break
+		}
+	}
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{"same host by default", nil, "", true},
+		{"other origin by default", nil, "https://evil.example", false},
+		{"listed origin", []string{"https://example.com"}, "https://example.com", true},
+		{"unlisted origin", []string{"https://example.com"}, "https://evil.example", false},
+		{"no origin with a list", []string{"https://example.com"}, "", true},
+		{"wildcard", []string{"*"}, "https://anywhere.example", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, url := startRouter(t, Options{AllowedOrigins: tt.allowed})
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if tt.ok {
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			require.ErrorIs(t, err, websocket.ErrBadHandshake)
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// journalKeep is how many operations the journal retains for undo
+const journalKeep = 100
+
+// TaskChange is the before and after image of one task touched by an
+// operation. A nil Before means the task was added, a nil After that it was
+// deleted.
+type TaskChange struct {
+	ID     int   `json:"id"`
+	Before *Task `json:"before,omitempty"`
+	After  *Task `json:"after,omitempty"`
+}
+
+// JournalEntry describes one operation on the tasks file
+type JournalEntry struct {
+	Seq       int64        `json:"seq"`
+	Time      time.Time    `json:"time"`
+	Operation string       `json:"operation"`
+	Changes   []TaskChange `json:"changes"`
+	Undoes    []int64      `json:"undoes,omitempty"` // set on entries written by undo
+}
+
+// journalRecord is one line of the journal file
+type journalRecord struct {
+	Type  string        `json:"type"` // begin or commit
+	Seq   int64         `json:"seq"`
+	Entry *JournalEntry `json:"entry,omitempty"`
+}
+
+// Journal is a write-ahead log of task operations. Each save appends a begin
+// record with before and after images, then rewrites the tasks file, then
+// appends a commit record. An operation that began but never committed is
+// redone from its after images the next time the tasks file is opened.
+type Journal struct {
+	path string
+}
+
+// NewJournal creates a journal stored at path
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// journalFile returns the journal path for a tasks data file
+func journalFile(dataFile string) string {
+	return dataFile + ".journal"
+}
+
+// journalState is the parsed content of the journal file
+type journalState struct {
+	entries   []JournalEntry
+	committed map[int64]bool
+	undone    map[int64]bool
+	lastSeq   int64
+}
+
+// read parses the journal. A torn last line from a crash mid-append is ignored.
+func (j *Journal) read() (*journalState, error) {
+	state := &journalState{
+		committed: make(map[int64]bool),
+		undone:    make(map[int64]bool),
+	}
+
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			continue
+		}
+
+		switch record.Type {
+		case "begin":
+			if record.Entry != nil {
+				state.entries = append(state.entries, *record.Entry)
+			}
+		case "commit":
+			state.committed[record.Seq] = true
+		}
+		if record.Seq > state.lastSeq {
+			state.lastSeq = record.Seq
+		}
+	}
+
+	// Undo markers only count once the undo itself committed
+	for _, entry := range state.entries {
+		if state.committed[entry.Seq] {
+			for _, seq := range entry.Undoes {
+				state.undone[seq] = true
+			}
+		}
+	}
+
+	return state, scanner.Err()
+}
+
+// append writes records to the journal and fsyncs before returning
+func (j *Journal) append(records ...journalRecord) error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %v", err)
+	}
+	defer file.Close()
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write journal: %v", err)
+		}
+	}
+
+	return file.Sync()
+}
+
+// Begin durably records an operation before the tasks file is changed
+func (j *Journal) Begin(entry *JournalEntry) error {
+	state, err := j.read()
+	if err != nil {
+		return err
+	}
+
+	entry.Seq = state.lastSeq + 1
+	entry.Time = time.Now()
+	return j.append(journalRecord{Type: "begin", Seq: entry.Seq, Entry: entry})
+}
+
+// Commit marks an operation as fully applied to the tasks file
+func (j *Journal) Commit(seq int64) error {
+	return j.append(journalRecord{Type: "commit", Seq: seq})
+}
+
+// Pending returns the last operation if it began but never committed
+func (j *Journal) Pending() (*JournalEntry, error) {
+	state, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+	if len(state.entries) == 0 {
+		return nil, nil
+	}
+
+	last := state.entries[len(state.entries)-1]
+	if state.committed[last.Seq] {
+		return nil, nil
+	}
+	return &last, nil
+}
+
+// Undoable returns up to n committed operations that have not been undone,
+// newest first. Undo operations themselves are not undoable.
+func (j *Journal) Undoable(n int) ([]JournalEntry, error) {
+	state, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	for i := len(state.entries) - 1; i >= 0 && len(entries) < n; i-- {
+		entry := state.entries[i]
+		if !state.committed[entry.Seq] || state.undone[entry.Seq] || len(entry.Undoes) > 0 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Compact rewrites the journal keeping only the newest keep operations
+func (j *Journal) Compact(keep int) error {
+	state, err := j.read()
+	if err != nil {
+		return err
+	}
+	if len(state.entries) <= keep*2 {
+		return nil // compact in batches to avoid rewriting on every save
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range state.entries[len(state.entries)-keep:] {
+		entry := entry
+		records := []journalRecord{{Type: "begin", Seq: entry.Seq, Entry: &entry}}
+		if state.committed[entry.Seq] {
+			records = append(records, journalRecord{Type: "commit", Seq: entry.Seq})
+		}
+
+		for _, record := range records {
+			line, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			buf.Write(append(line, '\n'))
+		}
+	}
+
+	return writeFileAtomic(j.path, buf.Bytes(), 0644)
+}
+
+// diffTasks returns the changes between two task lists, ordered by ID
+func diffTasks(before, after []Task) []TaskChange {
+	encode := func(tasks []Task) map[int][]byte {
+		encoded := make(map[int][]byte, len(tasks))
+		for _, task := range tasks {
+			data, _ := json.Marshal(task)
+			encoded[task.ID] = data
+		}
+		return encoded
+	}
+	find := func(tasks []Task, id int) *Task {
+		for i := range tasks {
+			if tasks[i].ID == id {
+				task := tasks[i]
+				return &task
+			}
+		}
+		return nil
+	}
+
+	old, cur := encode(before), encode(after)
+	ids := make(map[int]bool)
+	for id := range old {
+		ids[id] = true
+	}
+	for id := range cur {
+		ids[id] = true
+	}
+
+	var changes []TaskChange
+	for id := range ids {
+		if bytes.Equal(old[id], cur[id]) {
+			continue
+		}
+		changes = append(changes, TaskChange{ID: id, Before: find(before, id), After: find(after, id)})
+	}
+
+	sort.Slice(changes, func(i, k int) bool { return changes[i].ID < changes[k].ID })
+	return changes
+}
+
+// applyChanges replaces tasks by ID with either the after or the before
+// images, keeping the list ordered by ID
+func applyChanges(tasks []Task, changes []TaskChange, useAfter bool) []Task {
+	byID := make(map[int]Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	for _, change := range changes {
+		image := change.Before
+		if useAfter {
+			image = change.After
+		}
+		if image == nil {
+			delete(byID, change.ID)
+		} else {
+			byID[change.ID] = *image
+		}
+	}
+
+	result := make([]Task, 0, len(byID))
+	for _, task := range byID {
+		result = append(result, task)
+	}
+	sort.Slice(result, func(i, k int) bool { return result[i].ID < result[k].ID })
+	return result
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock opens path and takes an exclusive flock without blocking
+func tryLock(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// unlock releases the flock and closes the file
+func unlock(file *os.File) error {
+	defer file.Close()
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,36 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// staleLockAge is how old a lock file must be before it is assumed to be
+// left over from a crashed process
+const staleLockAge = 10 * time.Minute
+
+// tryLock creates path exclusively. Windows has no flock in the standard
+// library, so the presence of the lock file is the lock.
+func tryLock(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err == nil {
+		return file, nil
+	}
+	if !os.IsExist(err) {
+		return nil, err
+	}
+
+	if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+		os.Remove(path)
+	}
+	return nil, errLocked
+}
+
+// unlock closes and removes the lock file
+func unlock(file *os.File) error {
+	name := file.Name()
+	file.Close()
+	return os.Remove(name)
+}
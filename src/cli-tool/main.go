@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -24,6 +25,11 @@ type Task struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	Priority    string    `json:"priority"` // low, medium, high
 	Tags        []string  `json:"tags"`
+
+	// Sync metadata, see sync.go
+	UID         string                 `json:"uid,omitempty"`
+	Vector      VectorClock            `json:"vector,omitempty"`
+	FieldClocks map[string]VectorClock `json:"field_clocks,omitempty"`
 }
 
 // TaskManager manages tasks and persistence
@@ -31,17 +37,64 @@ type TaskManager struct {
 	tasks    []Task
 	dataFile string
 	nextID   int
+
+	saved     []Task    // tasks as last loaded or saved, diffed for the journal
+	journal   *Journal  // write-ahead journal used for crash recovery and undo
+	lock      *fileLock // held from load to the last save when opened with OpenTaskManager
+	backups   int       // number of rolling backups kept of the data file
+	operation string    // description of the running command for the journal
+	times     *TimeLog  // time entries, loaded on first use, see timelog.go
 }
 
 // NewTaskManager creates a new task manager
 func NewTaskManager(dataFile string) *TaskManager {
-	tm := &TaskManager{
+	tm := newTaskManager(dataFile)
+	tm.loadTasks()
+	return tm
+}
+
+// newTaskManager creates an empty task manager for dataFile
+func newTaskManager(dataFile string) *TaskManager {
+	backups, err := strconv.Atoi(getEnv("TASK_BACKUPS", "3"))
+	if err != nil {
+		backups = 3
+	}
+
+	return &TaskManager{
 		tasks:    make([]Task, 0),
 		dataFile: dataFile,
 		nextID:   1,
+		journal:  NewJournal(journalFile(dataFile)),
+		backups:  backups,
 	}
-	tm.loadTasks()
-	return tm
+}
+
+// OpenTaskManager locks the data file and loads it, so a whole
+// load-modify-save cycle is safe against other task commands. An operation
+// interrupted by a crash is redone from the journal. Call Close when done.
+func OpenTaskManager(dataFile string) (*TaskManager, error) {
+	lock, err := acquireFileLock(dataFile+".lock", lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	tm := newTaskManager(dataFile)
+	tm.lock = lock
+	if err := tm.loadTasks(); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	if err := tm.recoverJournal(); err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	return tm, nil
+}
+
+// Close releases the data file lock
+func (tm *TaskManager) Close() error {
+	return tm.lock.Release()
 }
 
 // loadTasks loads tasks from the data file
@@ -60,8 +113,9 @@ func (tm *TaskManager) loadTasks() error {
 	}
 
 	if err := json.Unmarshal(data, &tm.tasks); err != nil {
-		return fmt.Errorf("failed to parse tasks file: %v", err)
+		return fmt.Errorf("failed to parse tasks file (backups are kept as %s.bak.N): %v", tm.dataFile, err)
 	}
+	tm.saved = cloneTasks(tm.tasks)
 
 	// Find the highest ID to set nextID
 	for _, task := range tm.tasks {
@@ -75,24 +129,108 @@ func (tm *TaskManager) loadTasks() error {
 
 // saveTasks saves tasks to the data file
 func (tm *TaskManager) saveTasks() error {
+	return tm.commit(tm.operation, nil)
+}
+
+// commit journals the changes since the last save, then writes the data file
+// atomically after rotating backups, then marks the journal entry committed
+func (tm *TaskManager) commit(operation string, undoes []int64) error {
 	// Ensure directory exists
 	dir := filepath.Dir(tm.dataFile)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
 
+	entry := &JournalEntry{
+		Operation: operation,
+		Changes:   diffTasks(tm.saved, tm.tasks),
+		Undoes:    undoes,
+	}
+	if len(entry.Changes) == 0 && len(undoes) == 0 {
+		return nil
+	}
+
+	if err := tm.journal.Begin(entry); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	if err := tm.writeTasks(); err != nil {
+		return err
+	}
+	if err := tm.journal.Commit(entry.Seq); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+
+	return tm.journal.Compact(journalKeep)
+}
+
+// writeTasks rotates backups and atomically replaces the data file
+func (tm *TaskManager) writeTasks() error {
 	data, err := json.MarshalIndent(tm.tasks, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal tasks: %v", err)
 	}
 
-	if err := ioutil.WriteFile(tm.dataFile, data, 0644); err != nil {
+	if err := rotateBackups(tm.dataFile, tm.backups); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(tm.dataFile, data, 0644); err != nil {
 		return fmt.Errorf("failed to write tasks file: %v", err)
 	}
 
+	tm.saved = cloneTasks(tm.tasks)
 	return nil
 }
 
+// recoverJournal redoes an operation that was journaled but not committed
+func (tm *TaskManager) recoverJournal() error {
+	pending, err := tm.journal.Pending()
+	if err != nil || pending == nil {
+		return err
+	}
+
+	tm.tasks = applyChanges(tm.tasks, pending.Changes, true)
+	if err := tm.writeTasks(); err != nil {
+		return fmt.Errorf("failed to recover operation %q: %v", pending.Operation, err)
+	}
+	return tm.journal.Commit(pending.Seq)
+}
+
+// Undo reverts the last n operations, newest first, and returns them. The
+// undo is journaled like any other operation but cannot itself be undone.
+func (tm *TaskManager) Undo(n int) ([]JournalEntry, error) {
+	entries, err := tm.journal.Undoable(n)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	undoes := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		tm.tasks = applyChanges(tm.tasks, entry.Changes, false)
+		undoes = append(undoes, entry.Seq)
+	}
+
+	if err := tm.commit(fmt.Sprintf("undo %d operation(s)", len(entries)), undoes); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// History returns up to n operations that can be undone, newest first
+func (tm *TaskManager) History(n int) ([]JournalEntry, error) {
+	return tm.journal.Undoable(n)
+}
+
+// cloneTasks deep copies tasks so later in-place edits don't alter the copy
+func cloneTasks(tasks []Task) []Task {
+	data, _ := json.Marshal(tasks)
+	var clone []Task
+	json.Unmarshal(data, &clone)
+	return clone
+}
+
 // addTask adds a new task
 func (tm *TaskManager) addTask(title, description, priority string, tags []string) (*Task, error) {
 	task := Task{
@@ -116,38 +254,17 @@ func (tm *TaskManager) addTask(title, description, priority string, tags []strin
 	return &task, nil
 }
 
-// listTasks returns filtered tasks
-func (tm *TaskManager) listTasks(showCompleted bool, priority string, tag string) []Task {
+// listTasks returns the tasks matching query, in the query's sort order
+func (tm *TaskManager) listTasks(query *Query) []Task {
 	var filtered []Task
-	
+
 	for _, task := range tm.tasks {
-		// Filter by completion status
-		if !showCompleted && task.Completed {
-			continue
-		}
-		
-		// Filter by priority
-		if priority != "" && task.Priority != priority {
-			continue
+		if query.Match(&task) {
+			filtered = append(filtered, task)
 		}
-		
-		// Filter by tag
-		if tag != "" {
-			hasTag := false
-			for _, t := range task.Tags {
-				if t == tag {
-					hasTag = true
-					break
-				}
-			}
-			if !hasTag {
-				continue
-			}
-		}
-		
-		filtered = append(filtered, task)
 	}
 
+	query.SortTasks(filtered)
 	return filtered
 }
 
@@ -220,73 +337,204 @@ var (
 	tag           string
 	description   string
 	tags          []string
+	syncRemote    string
+	syncToken     string
+	keepValue     string
+	serveAddr     string
+	serveStore    string
+	listHistory   bool
+	sortSpec      string
+	outputFormat  string
+	timeNote      string
+	timeDate      string
+	reportBy      string
+	reportFrom    string
+	reportTo      string
+	reportFormat  string
 )
 
 func main() {
 	// Load environment variables
 	godotenv.Load()
 
-	// Initialize task manager
-	defaultDataFile := getEnv("TASK_DATA_FILE", filepath.Join(os.Getenv("HOME"), ".tasks", "tasks.json"))
-	taskManager = NewTaskManager(defaultDataFile)
-
-	// Execute root command
+	// Execute root command, which opens the task manager before each command
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// openTaskManager locks and loads the tasks file for the running command.
+// The lock is released by closeTaskManager, or by the OS if the command exits.
+func openTaskManager(cmd *cobra.Command, args []string) {
+	file := dataFile
+	if file == "" {
+		file = getEnv("TASK_DATA_FILE", filepath.Join(os.Getenv("HOME"), ".tasks", "tasks.json"))
+	}
+
+	tm, err := OpenTaskManager(file)
+	if err != nil {
+		fmt.Printf("Error opening tasks: %v\n", err)
+		os.Exit(1)
+	}
+	tm.operation = strings.TrimSpace(cmd.Name() + " " + strings.Join(args, " "))
+	taskManager = tm
+}
+
+// closeTaskManager releases the tasks file lock
+func closeTaskManager(cmd *cobra.Command, args []string) {
+	if taskManager != nil {
+		taskManager.Close()
+	}
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "task",
 	Short: "A modern CLI task management tool",
 	Long: `Task Manager is a CLI application for managing your tasks.
 It supports creating, listing, updating, and deleting tasks with
 priorities, tags, and completion tracking.`,
+	PersistentPreRun:  openTaskManager,
+	PersistentPostRun: closeTaskManager,
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
 }
 
 var listCmd = &cobra.Command{
-	Use:   "list",
+	Use:   "list [query...]",
 	Short: "List tasks",
-	Long:  "List all tasks with optional filtering by completion status, priority, or tags.",
+	Long: `List tasks matching an optional query, sorted and formatted as requested.
+
+Query terms (all must match, prefix with ! or - to negate; quote !term so
+the shell doesn't expand it, and put -term after -- so it isn't a flag):
+  priority:high  priority>=medium   tag:work   status:open|done|all
+  created>2026-01-01  updated>=7d  created:today   id<10
+  title:word  desc:word  "words in title or description"  sort:-created
+
+Completed tasks are hidden unless --completed or a status term is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		tasks := taskManager.listTasks(showCompleted, priority, tag)
-		
-		if len(tasks) == 0 {
-			fmt.Println("No tasks found.")
-			return
+		query, err := ParseQuery(joinQueryArgs(args))
+		if err != nil {
+			fmt.Printf("Invalid query: %v\n", err)
+			os.Exit(1)
 		}
 
-		fmt.Printf("Found %d task(s):\n\n", len(tasks))
-		
-		for _, task := range tasks {
-			status := "❌"
-			if task.Completed {
-				status = "✅"
-			}
+		// The filter flags are shorthands for query terms
+		query.IncludeCompleted = showCompleted
+		if priority != "" {
+			query.Terms = append(query.Terms, QueryTerm{Field: "priority", Op: ":", Value: priority})
+		}
+		if tag != "" {
+			query.Terms = append(query.Terms, QueryTerm{Field: "tag", Op: ":", Value: tag})
+		}
+
+		keys, err := ParseSort(sortSpec)
+		if err != nil {
+			fmt.Printf("Invalid sort: %v\n", err)
+			os.Exit(1)
+		}
+		query.Sort = append(keys, query.Sort...)
+
+		if err := renderTasks(os.Stdout, taskManager.listTasks(query), outputFormat); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var viewCmd = &cobra.Command{
+	Use:   "view [name]",
+	Short: "Show a saved view",
+	Long:  "Run a named query saved with 'task view save'. Views are stored in views.json in the config dir.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		view, err := NewViewStore(defaultConfigDir()).Get(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 
-			priorityColor := getPriorityColor(task.Priority)
-			
-			fmt.Printf("%s [ID:%d] %s%s%s\n", status, task.ID, priorityColor, task.Title, resetColor())
-			
-			if task.Description != "" {
-				fmt.Printf("   Description: %s\n", task.Description)
+		query, err := view.Build()
+		if err != nil {
+			fmt.Printf("Error in view %s: %v\n", view.Name, err)
+			os.Exit(1)
+		}
+
+		format := view.Format
+		if outputFormat != "" {
+			format = outputFormat
+		}
+		if err := renderTasks(os.Stdout, taskManager.listTasks(query), format); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var viewSaveCmd = &cobra.Command{
+	Use:   "save [name] [query...]",
+	Short: "Save a named view",
+	Long:  "Save a query with its sort order and output format under a name.",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		view := SavedView{
+			Name:   args[0],
+			Query:  joinQueryArgs(args[1:]),
+			Sort:   sortSpec,
+			Format: outputFormat,
+		}
+
+		if err := NewViewStore(defaultConfigDir()).Save(view); err != nil {
+			fmt.Printf("Error saving view: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ View %s saved! Show it with: task view %s\n", view.Name, view.Name)
+	},
+}
+
+var viewListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved views",
+	Run: func(cmd *cobra.Command, args []string) {
+		views, err := NewViewStore(defaultConfigDir()).List()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(views) == 0 {
+			fmt.Println("No saved views.")
+			return
+		}
+		for _, view := range views {
+			fmt.Printf("%s: %s", view.Name, view.Query)
+			if view.Sort != "" {
+				fmt.Printf(" (sort: %s)", view.Sort)
 			}
-			
-			if len(task.Tags) > 0 {
-				fmt.Printf("   Tags: %s\n", strings.Join(task.Tags, ", "))
+			if view.Format != "" {
+				fmt.Printf(" [%s]", view.Format)
 			}
-			
-			fmt.Printf("   Priority: %s | Created: %s\n", 
-				task.Priority, task.CreatedAt.Format("2006-01-02 15:04"))
 			fmt.Println()
 		}
 	},
 }
 
+var viewDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete a saved view",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := NewViewStore(defaultConfigDir()).Delete(args[0]); err != nil {
+			fmt.Printf("Error deleting view: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("🗑️  View %s deleted successfully!\n", args[0])
+	},
+}
+
 var addCmd = &cobra.Command{
 	Use:   "add [title]",
 	Short: "Add a new task",
@@ -387,6 +635,279 @@ var deleteCmd = &cobra.Command{
 	},
 }
 
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync tasks with a remote task server",
+	Long: `Pull tasks from the remote task server, merge concurrent edits field by
+field, and push the merged result. Fields edited on two machines since the
+last sync keep the local value and are listed by 'task conflicts'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		state, err := loadSyncState(taskManager.dataFile)
+		if err != nil {
+			fmt.Printf("Error loading sync state: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The --remote flag wins over the remembered remote, which wins over the env
+		switch {
+		case syncRemote != "":
+			state.Remote = syncRemote
+		case state.Remote == "":
+			state.Remote = os.Getenv("TASK_SYNC_URL")
+		}
+		if syncToken == "" {
+			syncToken = os.Getenv("TASK_SYNC_TOKEN")
+		}
+		if state.Remote == "" {
+			fmt.Println("No remote configured. Use --remote or set TASK_SYNC_URL.")
+			os.Exit(1)
+		}
+
+		conflicts, err := taskManager.Sync(NewSyncClient(state.Remote, syncToken), state)
+		if err != nil {
+			fmt.Printf("Error syncing tasks: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("🔄 Synced %d task(s) with %s (revision %d)\n", len(taskManager.tasks), state.Remote, state.Revision)
+		if len(conflicts) > 0 {
+			fmt.Printf("⚠️  %d new conflict(s), run 'task conflicts' to review\n", len(conflicts))
+		}
+	},
+}
+
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "List unresolved sync conflicts",
+	Long:  "List fields that were edited concurrently on different machines and still need a decision.",
+	Run: func(cmd *cobra.Command, args []string) {
+		state, err := loadSyncState(taskManager.dataFile)
+		if err != nil {
+			fmt.Printf("Error loading sync state: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(state.Conflicts) == 0 {
+			fmt.Println("No conflicts.")
+			return
+		}
+
+		fmt.Printf("Found %d conflict(s):\n\n", len(state.Conflicts))
+		for _, conflict := range sortedConflicts(state.Conflicts) {
+			fmt.Printf("⚠️  [ID:%d] %s\n", conflict.TaskID, conflict.Field)
+			fmt.Printf("   Local:  %s\n", conflict.Local)
+			fmt.Printf("   Remote: %s\n", conflict.Remote)
+			fmt.Printf("   Detected: %s\n", conflict.DetectedAt.Format("2006-01-02 15:04"))
+			fmt.Println()
+		}
+		fmt.Println("Resolve with: task conflicts resolve [id] [field] --keep local|remote")
+	},
+}
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve [id] [field]",
+	Short: "Resolve a sync conflict",
+	Long:  "Resolve a sync conflict by keeping the local or the remote value. The choice is pushed on the next sync.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Printf("Invalid task ID: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		state, err := loadSyncState(taskManager.dataFile)
+		if err != nil {
+			fmt.Printf("Error loading sync state: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := taskManager.ResolveConflict(state, id, args[1], keepValue); err != nil {
+			fmt.Printf("Error resolving conflict: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ Kept %s value for %s of task %d\n", keepValue, args[1], id)
+	},
+}
+
+var startCmd = &cobra.Command{
+	Use:   "start [id]",
+	Short: "Start tracking time on a task",
+	Long:  "Start the timer on a task. Only one timer runs at a time, so a running timer is stopped first.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Printf("Invalid task ID: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		stopped, err := taskManager.StartTimer(id, timeNote)
+		if err != nil {
+			fmt.Printf("Error starting timer: %v\n", err)
+			os.Exit(1)
+		}
+
+		if stopped != nil {
+			fmt.Printf("⏹️  Stopped task %d after %s\n", stopped.TaskID, formatDuration(stopped.Duration(stopped.End)))
+		}
+		fmt.Printf("⏱️  Timer started for task %d\n", id)
+	},
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running timer",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		entry, err := taskManager.StopTimer()
+		if err != nil {
+			fmt.Printf("Error stopping timer: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("⏹️  Stopped task %d after %s\n", entry.TaskID, formatDuration(entry.Duration(entry.End)))
+	},
+}
+
+var logTimeCmd = &cobra.Command{
+	Use:   "log [id] [duration]",
+	Short: "Add a manual time entry",
+	Long:  "Record time spent on a task without the timer, e.g. 'task log 3 1h30m --date 2026-01-15'.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Printf("Invalid task ID: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		duration, err := time.ParseDuration(args[1])
+		if err != nil {
+			fmt.Printf("Invalid duration: %s (use e.g. 45m, 1h30m, 2.5h)\n", args[1])
+			os.Exit(1)
+		}
+
+		// Manual entries end now unless a date is given, then they start at 09:00
+		start := time.Now().Add(-duration)
+		if timeDate != "" {
+			day, _, err := parseQueryDate(timeDate)
+			if err != nil {
+				fmt.Printf("Invalid date: %v\n", err)
+				os.Exit(1)
+			}
+			start = day.Add(9 * time.Hour)
+		}
+
+		entry, err := taskManager.AddTimeEntry(id, start, duration, timeNote)
+		if err != nil {
+			fmt.Printf("Error logging time: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ Logged %s on task %d (%s)\n", formatDuration(duration), id, entry.Start.Format("2006-01-02"))
+	},
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report time spent",
+	Long:  "Print time totals grouped by tag, priority or day, optionally limited to a date range.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, to, err := parseReportRange(reportFrom, reportTo)
+		if err != nil {
+			fmt.Printf("Invalid date: %v\n", err)
+			os.Exit(1)
+		}
+
+		rows, total, err := taskManager.TimeReport(reportBy, from, to)
+		if err != nil {
+			fmt.Printf("Error building report: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := renderReport(os.Stdout, reportBy, rows, total, reportFormat); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [n]",
+	Short: "Undo the last operations",
+	Long: `Revert the last n operations (default 1) using the write-ahead journal.
+Use --list to see which operations can be undone.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		n := 1
+		if len(args) == 1 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				fmt.Printf("Invalid count: %s\n", args[0])
+				os.Exit(1)
+			}
+		}
+
+		if listHistory {
+			history, err := taskManager.History(n)
+			if err != nil {
+				fmt.Printf("Error reading journal: %v\n", err)
+				os.Exit(1)
+			}
+			if len(history) == 0 {
+				fmt.Println("Nothing to undo.")
+				return
+			}
+			for _, entry := range history {
+				fmt.Printf("#%d %s  %s (%d task(s))\n", entry.Seq, entry.Time.Format("2006-01-02 15:04"),
+					entry.Operation, len(entry.Changes))
+			}
+			return
+		}
+
+		undone, err := taskManager.Undo(n)
+		if err != nil {
+			fmt.Printf("Error undoing: %v\n", err)
+			os.Exit(1)
+		}
+		if len(undone) == 0 {
+			fmt.Println("Nothing to undo.")
+			return
+		}
+		for _, entry := range undone {
+			fmt.Printf("↩️  Undid: %s\n", entry.Operation)
+		}
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a task sync server",
+	Long:  "Run an HTTP server that stores the shared task list for 'task sync'.",
+	// The server does not use the local tasks file, so don't hold its lock
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		if syncToken == "" {
+			syncToken = os.Getenv("TASK_SYNC_TOKEN")
+		}
+
+		server, err := NewSyncServer(serveStore, syncToken)
+		if err != nil {
+			fmt.Printf("Error starting sync server: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("🌐 Sync server listening on %s (store: %s)\n", serveAddr, serveStore)
+		if err := http.ListenAndServe(serveAddr, server); err != nil {
+			fmt.Printf("Error running sync server: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
 func init() {
 	// Root command flags
 	rootCmd.PersistentFlags().StringVar(&dataFile, "data-file", "", "Path to the tasks data file")
@@ -395,6 +916,14 @@ func init() {
 	listCmd.Flags().BoolVar(&showCompleted, "completed", false, "Show completed tasks")
 	listCmd.Flags().StringVar(&priority, "priority", "", "Filter by priority (low, medium, high)")
 	listCmd.Flags().StringVar(&tag, "tag", "", "Filter by tag")
+	listCmd.Flags().StringVar(&sortSpec, "sort", "", "Sort by fields, e.g. priority,-created (id, title, priority, status, created, updated)")
+	listCmd.Flags().StringVar(&outputFormat, "format", "list", "Output format (list, table, json, csv, markdown)")
+
+	// View command flags
+	viewCmd.Flags().StringVar(&outputFormat, "format", "", "Override the view's output format")
+	viewSaveCmd.Flags().StringVar(&sortSpec, "sort", "", "Sort order stored with the view")
+	viewSaveCmd.Flags().StringVar(&outputFormat, "format", "", "Output format stored with the view")
+	viewCmd.AddCommand(viewSaveCmd, viewListCmd, viewDeleteCmd)
 
 	// Add command flags
 	addCmd.Flags().StringVar(&description, "description", "", "Task description")
@@ -407,8 +936,33 @@ func init() {
 	updateCmd.Flags().StringVar(&priority, "priority", "", "New task priority (low, medium, high)")
 	updateCmd.Flags().StringSliceVar(&tags, "tags", []string{}, "New task tags (comma-separated)")
 
+	// Sync command flags
+	syncCmd.Flags().StringVar(&syncRemote, "remote", "", "Sync server URL (remembered after the first sync)")
+	syncCmd.Flags().StringVar(&syncToken, "token", "", "Bearer token for the sync server")
+	resolveCmd.Flags().StringVar(&keepValue, "keep", "local", "Value to keep (local, remote)")
+	conflictsCmd.AddCommand(resolveCmd)
+
+	// Serve command flags
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8090", "Address to listen on")
+	serveCmd.Flags().StringVar(&serveStore, "store", "tasks-server.json", "File to persist the shared task list")
+	serveCmd.Flags().StringVar(&syncToken, "token", "", "Bearer token required from clients")
+
+	// Time tracking flags
+	startCmd.Flags().StringVar(&timeNote, "note", "", "Note for the time entry")
+	logTimeCmd.Flags().StringVar(&timeNote, "note", "", "Note for the time entry")
+	logTimeCmd.Flags().StringVar(&timeDate, "date", "", "Day the time was spent (YYYY-MM-DD, today, yesterday or Nd)")
+	reportCmd.Flags().StringVar(&reportBy, "by", "tag", "Group totals by tag, priority or day")
+	reportCmd.Flags().StringVar(&reportFrom, "from", "", "First day to include (YYYY-MM-DD, today, yesterday or Nd)")
+	reportCmd.Flags().StringVar(&reportTo, "to", "", "Last day to include (YYYY-MM-DD, today, yesterday or Nd)")
+	reportCmd.Flags().StringVar(&reportFormat, "format", "table", "Output format (table, csv)")
+
+	// Undo command flags
+	undoCmd.Flags().BoolVar(&listHistory, "list", false, "List operations that can be undone instead of undoing")
+
 	// Add commands to root
-	rootCmd.AddCommand(listCmd, addCmd, updateCmd, completeCmd, deleteCmd)
+	rootCmd.AddCommand(listCmd, addCmd, updateCmd, completeCmd, deleteCmd, viewCmd)
+	rootCmd.AddCommand(syncCmd, conflictsCmd, serveCmd, undoCmd)
+	rootCmd.AddCommand(startCmd, stopCmd, logTimeCmd, reportCmd)
 }
 
 // Helper functions
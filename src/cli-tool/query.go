@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryTerm is one filter in a task query, e.g. priority:high, !tag:someday
+// or -tag:someday. A leading - only negates a field term, and on the command
+// line needs to follow -- so it isn't taken for a flag.
+type QueryTerm struct {
+	Field  string `json:"field"`
+	Op     string `json:"op"` // :, =, >, <, >=, <=
+	Value  string `json:"value"`
+	Negate bool   `json:"negate,omitempty"`
+}
+
+// SortKey orders query results by one field
+type SortKey struct {
+	Field      string `json:"field"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+// Query is a parsed task query. Completed tasks are hidden unless the query
+// filters on status explicitly or IncludeCompleted is set.
+type Query struct {
+	Terms            []QueryTerm `json:"terms"`
+	Sort             []SortKey   `json:"sort,omitempty"`
+	IncludeCompleted bool        `json:"include_completed,omitempty"`
+}
+
+// queryFields maps accepted field names and aliases to canonical names
+var queryFields = map[string]string{
+	"id":          "id",
+	"title":       "title",
+	"desc":        "description",
+	"description": "description",
+	"priority":    "priority",
+	"tag":         "tag",
+	"tags":        "tag",
+	"status":      "status",
+	"is":          "status",
+	"created":     "created",
+	"updated":     "updated",
+	"text":        "text",
+}
+
+// sortFields lists the fields results can be sorted by
+var sortFields = map[string]bool{
+	"id": true, "title": true, "priority": true, "status": true, "created": true, "updated": true,
+}
+
+// priorityRank orders priorities for comparisons and sorting
+var priorityRank = map[string]int{"low": 1, "medium": 2, "high": 3}
+
+// queryOps are the comparison operators, longest first so >= wins over >
+var queryOps = []string{">=", "<=", ":", "=", ">", "<"}
+
+// ParseQuery parses a query such as
+//
+//	priority:high tag:work created>2026-01-01 "title words" !tag:someday -tag:later sort:-created
+//
+// Bare words and quoted phrases match the title or description.
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{}
+	for _, token := range tokens {
+		if token.quoted {
+			query.Terms = append(query.Terms, QueryTerm{Field: "text", Op: ":", Value: token.text})
+			continue
+		}
+
+		text := token.text
+		negate := false
+		switch {
+		case len(text) > 1 && text[0] == '!':
+			negate, text = true, text[1:]
+		case text[0] == '-':
+			// -word stays a text search; only -field:value is negated
+			if _, isTerm := splitTerm(text[1:]); isTerm {
+				negate, text = true, text[1:]
+			}
+		}
+
+		term, ok := splitTerm(text)
+		if !ok {
+			query.Terms = append(query.Terms, QueryTerm{Field: "text", Op: ":", Value: text, Negate: negate})
+			continue
+		}
+		term.Negate = negate
+
+		if term.Field == "sort" {
+			keys, err := ParseSort(term.Value)
+			if err != nil {
+				return nil, err
+			}
+			query.Sort = append(query.Sort, keys...)
+			continue
+		}
+
+		field, known := queryFields[strings.ToLower(term.Field)]
+		if !known {
+			return nil, fmt.Errorf("unknown query field %q", term.Field)
+		}
+		term.Field = field
+		if err := validateTerm(term); err != nil {
+			return nil, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+
+	return query, nil
+}
+
+// ParseSort parses a comma-separated sort spec such as priority,-created
+func ParseSort(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key := SortKey{Field: strings.ToLower(part)}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Descending = true
+			key.Field = key.Field[1:]
+		}
+		if !sortFields[key.Field] {
+			return nil, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// queryToken is a word or quoted phrase from the query input
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeQuery splits on whitespace while keeping quoted phrases together.
+// A quote inside a word (title:"two words") quotes the value only.
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	var current strings.Builder
+	inQuote, quotedWhole := false, false
+
+	flush := func() {
+		if current.Len() > 0 || quotedWhole {
+			tokens = append(tokens, queryToken{text: current.String(), quoted: quotedWhole})
+		}
+		current.Reset()
+		quotedWhole = false
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			if !inQuote && current.Len() == 0 {
+				quotedWhole = true
+			}
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	flush()
+
+	return tokens, nil
+}
+
+// splitTerm splits field<op>value, reporting false for bare words
+func splitTerm(text string) (QueryTerm, bool) {
+	best, bestOp := -1, ""
+	for _, op := range queryOps {
+		if i := strings.Index(text, op); i > 0 && (best == -1 || i < best || (i == best && len(op) > len(bestOp))) {
+			best, bestOp = i, op
+		}
+	}
+	if best == -1 {
+		return QueryTerm{}, false
+	}
+
+	field := text[:best]
+	for _, r := range field {
+		if !unicode.IsLetter(r) {
+			return QueryTerm{}, false
+		}
+	}
+	return QueryTerm{Field: field, Op: bestOp, Value: text[best+len(bestOp):]}, true
+}
+
+// validateTerm checks that a term's operator and value suit its field
+func validateTerm(term QueryTerm) error {
+	ordered := term.Op != ":" && term.Op != "="
+	switch term.Field {
+	case "id":
+		if _, err := strconv.Atoi(term.Value); err != nil {
+			return fmt.Errorf("invalid id %q", term.Value)
+		}
+	case "priority":
+		if _, ok := priorityRank[strings.ToLower(term.Value)]; !ok {
+			return fmt.Errorf("invalid priority %q", term.Value)
+		}
+	case "status":
+		switch strings.ToLower(term.Value) {
+		case "open", "done", "completed", "all":
+		default:
+			return fmt.Errorf("invalid status %q (use open, done or all)", term.Value)
+		}
+		if ordered {
+			return fmt.Errorf("status does not support %s", term.Op)
+		}
+	case "created", "updated":
+		if _, _, err := parseQueryDate(term.Value); err != nil {
+			return err
+		}
+	default:
+		if ordered {
+			return fmt.Errorf("%s does not support %s", term.Field, term.Op)
+		}
+	}
+	return nil
+}
+
+// parseQueryDate parses YYYY-MM-DD, RFC3339, today, yesterday or Nd (N days
+// ago) and returns the half-open period [start, end) it names
+func parseQueryDate(value string) (time.Time, time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch value {
+	case "today":
+		return today, today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	}
+
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			day := today.AddDate(0, 0, -days)
+			return day, day.AddDate(0, 0, 1), nil
+		}
+	}
+	if day, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t.Add(time.Nanosecond), nil
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD, RFC3339, today or Nd)", value)
+}
+
+// Match reports whether task satisfies every term of the query
+func (q *Query) Match(task *Task) bool {
+	statusFiltered := q.IncludeCompleted
+	for _, term := range q.Terms {
+		if term.Field == "status" {
+			statusFiltered = true
+		}
+		if term.match(task) == term.Negate {
+			return false
+		}
+	}
+
+	return statusFiltered || !task.Completed
+}
+
+// match evaluates a single term without its negation
+func (t QueryTerm) match(task *Task) bool {
+	value := strings.ToLower(t.Value)
+
+	switch t.Field {
+	case "id":
+		id, _ := strconv.Atoi(t.Value)
+		return compareOrdered(task.ID-id, t.Op)
+	case "title":
+		return strings.Contains(strings.ToLower(task.Title), value)
+	case "description":
+		return strings.Contains(strings.ToLower(task.Description), value)
+	case "text":
+		return strings.Contains(strings.ToLower(task.Title), value) ||
+			strings.Contains(strings.ToLower(task.Description), value)
+	case "priority":
+		return compareOrdered(priorityRank[task.Priority]-priorityRank[value], t.Op)
+	case "tag":
+		for _, tag := range task.Tags {
+			if strings.EqualFold(tag, t.Value) {
+				return true
+			}
+		}
+		return false
+	case "status":
+		switch value {
+		case "open":
+			return !task.Completed
+		case "done", "completed":
+			return task.Completed
+		default:
+			return true
+		}
+	case "created", "updated":
+		ts := task.CreatedAt
+		if t.Field == "updated" {
+			ts = task.UpdatedAt
+		}
+		start, end, _ := parseQueryDate(t.Value)
+		switch t.Op {
+		case ">":
+			return !ts.Before(end)
+		case ">=":
+			return !ts.Before(start)
+		case "<":
+			return ts.Before(start)
+		case "<=":
+			return ts.Before(end)
+		default:
+			return !ts.Before(start) && ts.Before(end)
+		}
+	}
+	return false
+}
+
+// compareOrdered applies op to the sign of a difference
+func compareOrdered(diff int, op string) bool {
+	switch op {
+	case ">":
+		return diff > 0
+	case ">=":
+		return diff >= 0
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	default:
+		return diff == 0
+	}
+}
+
+// SortTasks orders tasks by the query's sort keys, falling back to ID
+func (q *Query) SortTasks(tasks []Task) {
+	keys := append(append([]SortKey{}, q.Sort...), SortKey{Field: "id"})
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := &tasks[i], &tasks[j]
+		for _, key := range keys {
+			cmp := 0
+			switch key.Field {
+			case "id":
+				cmp = a.ID - b.ID
+			case "title":
+				cmp = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+			case "priority":
+				cmp = priorityRank[a.Priority] - priorityRank[b.Priority]
+			case "status":
+				cmp = boolRank(a.Completed) - boolRank(b.Completed)
+			case "created":
+				cmp = a.CreatedAt.Compare(b.CreatedAt)
+			case "updated":
+				cmp = a.UpdatedAt.Compare(b.UpdatedAt)
+			}
+			if cmp != 0 {
+				return (cmp < 0) != key.Descending
+			}
+		}
+		return false
+	})
+}
+
+// boolRank orders false before true
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
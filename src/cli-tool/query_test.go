@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryMatch(t *testing.T) {
+	created := time.Date(2026, 3, 15, 10, 0, 0, 0, time.Local)
+	tasks := []Task{
+		{ID: 1, Title: "Write quarterly report", Priority: "high", Tags: []string{"work"}, CreatedAt: created},
+		{ID: 2, Title: "Buy milk", Priority: "low", Tags: []string{"home", "someday"}, CreatedAt: created.AddDate(0, -3, 0)},
+		{ID: 3, Title: "Fix laptop", Description: "work laptop fan", Priority: "medium", Tags: []string{"work", "someday"}, CreatedAt: created},
+		{ID: 4, Title: "Old report", Priority: "high", Tags: []string{"work"}, Completed: true, CreatedAt: created},
+	}
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"", []int{1, 2, 3}},
+		{"priority:high", []int{1}},
+		{"priority>=medium", []int{1, 3}},
+		{"tag:work !tag:someday", []int{1}},
+		{"tag:work !tag:someday status:all", []int{1, 4}},
+		{"tag:work -tag:someday", []int{1}},
+		{"-priority>=medium", []int{2}},
+		{"-milk", nil},
+		{"status:done", []int{4}},
+		{`"work laptop"`, []int{3}},
+		{"report status:all", []int{1, 4}},
+		{"title:laptop", []int{3}},
+		{"created>2026-01-01", []int{1, 3}},
+		{"created:2026-03-15", []int{1, 3}},
+		{"created<2026-03-15", []int{2}},
+		{"id>1 id<=3", []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) failed: %v", tt.query, err)
+			}
+
+			var got []int
+			for i := range tasks {
+				if query.Match(&tasks[i]) {
+					got = append(got, tasks[i].ID)
+				}
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("matched %v; want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("matched %v; want %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, input := range []string{
+		"color:red",
+		"priority:urgent",
+		"status>open",
+		"created>someday",
+		"tag>work",
+		`"unterminated`,
+		"sort:colour",
+		"-colour:red",
+	} {
+		if _, err := ParseQuery(input); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded; want error", input)
+		}
+	}
+}
+
+func TestQuerySort(t *testing.T) {
+	tasks := []Task{
+		{ID: 1, Priority: "low"},
+		{ID: 2, Priority: "high"},
+		{ID: 3, Priority: "medium"},
+		{ID: 4, Priority: "high"},
+	}
+
+	query, err := ParseQuery("sort:-priority")
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	query.SortTasks(tasks)
+
+	expected := []int{2, 4, 3, 1}
+	for i, task := range tasks {
+		if task.ID != expected[i] {
+			t.Fatalf("sorted order %v; want %v", taskIDs(tasks), expected)
+		}
+	}
+}
+
+func TestJoinQueryArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"priority:high", "title words"}, `priority:high "title words"`},
+		{[]string{"tag:work !tag:someday"}, "tag:work !tag:someday"},
+		{[]string{"tag:work -tag:someday"}, "tag:work -tag:someday"},
+		{[]string{`title:"two words"`}, `title:"two words"`},
+	}
+
+	for _, tt := range tests {
+		if got := joinQueryArgs(tt.args); got != tt.expected {
+			t.Errorf("joinQueryArgs(%q) = %q; want %q", tt.args, got, tt.expected)
+		}
+	}
+}
+
+// taskIDs returns the IDs of tasks in order
+func taskIDs(tasks []Task) []int {
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
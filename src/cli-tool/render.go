@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// outputFormats lists the formats accepted by --format
+var outputFormats = []string{"list", "table", "json", "csv", "markdown"}
+
+// renderTasks writes tasks to w in the given output format
+func renderTasks(w io.Writer, tasks []Task, format string) error {
+	switch strings.ToLower(format) {
+	case "", "list":
+		renderList(w, tasks)
+		return nil
+	case "table":
+		return renderTable(w, tasks)
+	case "json":
+		if tasks == nil {
+			tasks = []Task{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tasks)
+	case "csv":
+		return renderCSV(w, tasks)
+	case "markdown", "md":
+		renderMarkdown(w, tasks)
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q (use %s)", format, strings.Join(outputFormats, ", "))
+	}
+}
+
+// renderList prints the detailed, color-coded task list
+func renderList(w io.Writer, tasks []Task) {
+	if len(tasks) == 0 {
+		fmt.Fprintln(w, "No tasks found.")
+		return
+	}
+
+	fmt.Fprintf(w, "Found %d task(s):\n\n", len(tasks))
+
+	for _, task := range tasks {
+		status := "❌"
+		if task.Completed {
+			status = "✅"
+		}
+
+		priorityColor := getPriorityColor(task.Priority)
+
+		fmt.Fprintf(w, "%s [ID:%d] %s%s%s\n", status, task.ID, priorityColor, task.Title, resetColor())
+
+		if task.Description != "" {
+			fmt.Fprintf(w, "   Description: %s\n", task.Description)
+		}
+
+		if len(task.Tags) > 0 {
+			fmt.Fprintf(w, "   Tags: %s\n", strings.Join(task.Tags, ", "))
+		}
+
+		fmt.Fprintf(w, "   Priority: %s | Created: %s\n",
+			task.Priority, task.CreatedAt.Format("2006-01-02 15:04"))
+		fmt.Fprintln(w)
+	}
+}
+
+// renderTable prints one aligned row per task
+func renderTable(w io.Writer, tasks []Task) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tPRIORITY\tTITLE\tTAGS\tCREATED")
+	for _, task := range tasks {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			task.ID, taskStatus(task), task.Priority, task.Title,
+			strings.Join(task.Tags, ","), task.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+// renderCSV writes tasks as CSV with a header row
+func renderCSV(w io.Writer, tasks []Task) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "title", "description", "status", "priority", "tags", "created_at", "updated_at"})
+	for _, task := range tasks {
+		writer.Write([]string{
+			strconv.Itoa(task.ID),
+			task.Title,
+			task.Description,
+			taskStatus(task),
+			task.Priority,
+			strings.Join(task.Tags, ","),
+			task.CreatedAt.Format(time.RFC3339),
+			task.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// renderMarkdown prints tasks as a Markdown table
+func renderMarkdown(w io.Writer, tasks []Task) {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ").Replace
+
+	fmt.Fprintln(w, "| ID | Status | Priority | Title | Tags | Created |")
+	fmt.Fprintln(w, "|---:|--------|----------|-------|------|---------|")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "| %d | %s | %s | %s | %s | %s |\n",
+			task.ID, taskStatus(task), task.Priority, escape(task.Title),
+			escape(strings.Join(task.Tags, ", ")), task.CreatedAt.Format("2006-01-02"))
+	}
+}
+
+// taskStatus returns the plain-text status of a task
+func taskStatus(task Task) string {
+	if task.Completed {
+		return "done"
+	}
+	return "open"
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// lockTimeout is how long a command waits for another one to finish
+const lockTimeout = 10 * time.Second
+
+// errLocked is returned by tryLock when another process holds the lock
+var errLocked = errors.New("file is locked by another process")
+
+// fileLock is an advisory lock held on a separate .lock file so that
+// replacing the data file by rename does not invalidate it
+type fileLock struct {
+	file *os.File
+}
+
+// acquireFileLock blocks until the lock at path is held or timeout expires
+func acquireFileLock(path string, timeout time.Duration) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := tryLock(path)
+		if err == nil {
+			return &fileLock{file: file}, nil
+		}
+		if err != errLocked {
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s: another task command is running", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Release unlocks and closes the lock file
+func (l *fileLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := unlock(l.file)
+	l.file = nil
+	return err
+}
+
+// writeFileAtomic replaces path with data so readers see either the old or
+// the new content, never a partial write: the data goes to a temp file in the
+// same directory, is fsynced, renamed over path, and the directory is synced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil // directories cannot be opened for sync on Windows
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// rotateBackups keeps the last count versions of path as path.bak.1 (newest)
+// through path.bak.<count> (oldest). The current file is hard linked rather
+// than moved so path exists at every point during the rotation.
+func rotateBackups(path string, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	backup := func(i int) string { return fmt.Sprintf("%s.bak.%d", path, i) }
+
+	os.Remove(backup(count))
+	for i := count - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate backup: %v", err)
+		}
+	}
+
+	if err := os.Link(path, backup(1)); err == nil {
+		return nil
+	}
+	return copyFile(path, backup(1))
+}
+
+// copyFile copies src to dst, used where hard links are unsupported
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentAddsUnderLock(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "tasks.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tm, err := OpenTaskManager(dataFile)
+			if err != nil {
+				t.Errorf("OpenTaskManager failed: %v", err)
+				return
+			}
+			defer tm.Close()
+			if _, err := tm.addTask("concurrent", "", "low", nil); err != nil {
+				t.Errorf("addTask failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tm := NewTaskManager(dataFile)
+	if len(tm.tasks) != 10 {
+		t.Errorf("got %d tasks; want 10", len(tm.tasks))
+	}
+}
+
+func TestLockTimesOut(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "tasks.json.lock")
+
+	held, err := acquireFileLock(lockFile, time.Second)
+	if err != nil {
+		t.Fatalf("acquireFileLock failed: %v", err)
+	}
+	defer held.Release()
+
+	if _, err := acquireFileLock(lockFile, 100*time.Millisecond); err == nil {
+		t.Errorf("second lock acquired while the first is held")
+	}
+}
+
+func TestUndoRevertsOperations(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "tasks.json")
+	tm, err := OpenTaskManager(dataFile)
+	if err != nil {
+		t.Fatalf("OpenTaskManager failed: %v", err)
+	}
+	defer tm.Close()
+
+	tm.addTask("first", "", "low", nil)
+	tm.addTask("second", "", "low", nil)
+	tm.updateTask(1, "renamed", "", "", nil)
+	tm.deleteTask(2)
+
+	undone, err := tm.Undo(2)
+	if err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if len(undone) != 2 {
+		t.Fatalf("undid %d operations; want 2", len(undone))
+	}
+
+	reloaded := NewTaskManager(dataFile)
+	if len(reloaded.tasks) != 2 || reloaded.tasks[0].Title != "first" || reloaded.tasks[1].Title != "second" {
+		t.Errorf("unexpected tasks after undo: %+v", reloaded.tasks)
+	}
+
+	// Undo operations are skipped, so the next undo reverts the second add
+	if _, err := tm.Undo(1); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if len(tm.tasks) != 1 || tm.tasks[0].Title != "first" {
+		t.Errorf("unexpected tasks after second undo: %+v", tm.tasks)
+	}
+}
+
+func TestRecoverUncommittedOperation(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "tasks.json")
+	tm, err := OpenTaskManager(dataFile)
+	if err != nil {
+		t.Fatalf("OpenTaskManager failed: %v", err)
+	}
+	tm.addTask("kept", "", "low", nil)
+
+	// Simulate a crash after the journal write but before the data file write
+	tm.tasks = append(tm.tasks, Task{ID: 2, Title: "in flight"})
+	entry := &JournalEntry{Operation: "add in flight", Changes: diffTasks(tm.saved, tm.tasks)}
+	if err := tm.journal.Begin(entry); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	tm.Close()
+
+	recovered, err := OpenTaskManager(dataFile)
+	if err != nil {
+		t.Fatalf("OpenTaskManager failed: %v", err)
+	}
+	defer recovered.Close()
+
+	if len(recovered.tasks) != 2 || recovered.tasks[1].Title != "in flight" {
+		t.Errorf("operation was not redone: %+v", recovered.tasks)
+	}
+	if pending, _ := recovered.journal.Pending(); pending != nil {
+		t.Errorf("operation still pending after recovery: %+v", pending)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+
+	for _, content := range []string{"v1", "v2", "v3", "v4"} {
+		if err := rotateBackups(path, 2); err != nil {
+			t.Fatalf("rotateBackups failed: %v", err)
+		}
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writeFileAtomic failed: %v", err)
+		}
+	}
+
+	for file, want := range map[string]string{path: "v4", path + ".bak.1": "v3", path + ".bak.2": "v2"} {
+		got, err := os.ReadFile(file)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q (%v); want %q", filepath.Base(file), got, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".bak.3"); !os.IsNotExist(err) {
+		t.Errorf("more backups kept than configured")
+	}
+}
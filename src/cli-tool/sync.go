@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// syncFields lists the task fields that are tracked and merged individually.
+// IDs stay local to each replica; tasks are matched across replicas by UID.
+var syncFields = []string{"title", "description", "completed", "priority", "tags"}
+
+// VectorClock counts changes per replica
+type VectorClock map[string]uint64
+
+// Clock ordering results
+const (
+	clockEqual = iota
+	clockBefore
+	clockAfter
+	clockConcurrent
+)
+
+// compare returns how vc is ordered relative to other
+func (vc VectorClock) compare(other VectorClock) int {
+	less, greater := false, false
+	for replica, n := range vc {
+		if n > other[replica] {
+			greater = true
+		} else if n < other[replica] {
+			less = true
+		}
+	}
+	for replica, n := range other {
+		if _, ok := vc[replica]; !ok && n > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return clockConcurrent
+	case less:
+		return clockBefore
+	case greater:
+		return clockAfter
+	default:
+		return clockEqual
+	}
+}
+
+// join returns the element-wise maximum of both clocks
+func (vc VectorClock) join(other VectorClock) VectorClock {
+	joined := make(VectorClock, len(vc)+len(other))
+	for replica, n := range vc {
+		joined[replica] = n
+	}
+	for replica, n := range other {
+		if n > joined[replica] {
+			joined[replica] = n
+		}
+	}
+	return joined
+}
+
+// tick returns a copy of the clock advanced for replica
+func (vc VectorClock) tick(replica string) VectorClock {
+	next := vc.join(nil)
+	next[replica]++
+	return next
+}
+
+// Conflict records a field edited concurrently on two replicas. The local
+// value is kept until the conflict is resolved with `task conflicts resolve`.
+type Conflict struct {
+	UID        string          `json:"uid"`
+	TaskID     int             `json:"task_id"`
+	Field      string          `json:"field"`
+	Local      json.RawMessage `json:"local"`
+	Remote     json.RawMessage `json:"remote"`
+	DetectedAt time.Time       `json:"detected_at"`
+}
+
+// SyncSnapshot is the replicated task state exchanged with the sync server
+type SyncSnapshot struct {
+	Revision   int64                  `json:"revision"`
+	Tasks      []Task                 `json:"tasks"`
+	Tombstones map[string]VectorClock `json:"tombstones"`
+}
+
+// SyncState is the per-replica bookkeeping stored next to the tasks file
+type SyncState struct {
+	ReplicaID  string                 `json:"replica_id"`
+	Remote     string                 `json:"remote,omitempty"`
+	Revision   int64                  `json:"revision"`
+	LastSync   time.Time              `json:"last_sync,omitempty"`
+	Base       map[string]Task        `json:"base"` // tasks as of the last sync, by UID
+	Tombstones map[string]VectorClock `json:"tombstones"`
+	Conflicts  []Conflict             `json:"conflicts"`
+
+	file string
+}
+
+// syncStateFile returns the sync state path for a tasks data file
+func syncStateFile(dataFile string) string {
+	ext := filepath.Ext(dataFile)
+	return strings.TrimSuffix(dataFile, ext) + ".sync.json"
+}
+
+// loadSyncState loads the sync state, creating a new replica ID on first use
+func loadSyncState(dataFile string) (*SyncState, error) {
+	state := &SyncState{
+		Base:       make(map[string]Task),
+		Tombstones: make(map[string]VectorClock),
+		file:       syncStateFile(dataFile),
+	}
+
+	data, err := ioutil.ReadFile(state.file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read sync state: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse sync state: %v", err)
+		}
+	}
+
+	if state.Base == nil {
+		state.Base = make(map[string]Task)
+	}
+	if state.Tombstones == nil {
+		state.Tombstones = make(map[string]VectorClock)
+	}
+	if state.ReplicaID == "" {
+		if state.ReplicaID, err = newSyncID(); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// save writes the sync state next to the tasks file
+func (s *SyncState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync state: %v", err)
+	}
+
+	if err := writeFileAtomic(s.file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %v", err)
+	}
+
+	return nil
+}
+
+// newSyncID returns a random hex identifier for replicas and task UIDs
+func newSyncID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate id: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// fieldJSON returns the canonical JSON encoding of a synced field
+func fieldJSON(task *Task, field string) json.RawMessage {
+	var v interface{}
+	switch field {
+	case "title":
+		v = task.Title
+	case "description":
+		v = task.Description
+	case "completed":
+		v = task.Completed
+	case "priority":
+		v = task.Priority
+	case "tags":
+		tags := task.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		v = tags
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// setFieldJSON decodes value into the named field of task
+func setFieldJSON(task *Task, field string, value json.RawMessage) error {
+	var target interface{}
+	switch field {
+	case "title":
+		target = &task.Title
+	case "description":
+		target = &task.Description
+	case "completed":
+		target = &task.Completed
+	case "priority":
+		target = &task.Priority
+	case "tags":
+		target = &task.Tags
+	default:
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	return json.Unmarshal(value, target)
+}
+
+// setFieldClock updates one field clock and recomputes the task change vector
+func setFieldClock(task *Task, field string, clock VectorClock) {
+	if task.FieldClocks == nil {
+		task.FieldClocks = make(map[string]VectorClock)
+	}
+	task.FieldClocks[field] = clock
+
+	vector := VectorClock{}
+	for _, fc := range task.FieldClocks {
+		vector = vector.join(fc)
+	}
+	task.Vector = vector
+}
+
+// stampLocalChanges advances the local replica's clocks for every field that
+// changed since the last sync and records deletions as tombstones
+func (tm *TaskManager) stampLocalChanges(state *SyncState) error {
+	seen := make(map[string]bool)
+
+	for i := range tm.tasks {
+		task := &tm.tasks[i]
+
+		if task.UID == "" {
+			uid, err := newSyncID()
+			if err != nil {
+				return err
+			}
+			task.UID = uid
+		}
+		seen[task.UID] = true
+
+		base, synced := state.Base[task.UID]
+		for _, field := range syncFields {
+			if synced && bytes.Equal(fieldJSON(task, field), fieldJSON(&base, field)) {
+				continue
+			}
+			if !synced && task.FieldClocks[field] != nil {
+				continue // already stamped, e.g. pulled before the base was recorded
+			}
+			setFieldClock(task, field, task.FieldClocks[field].tick(state.ReplicaID))
+		}
+	}
+
+	for uid, base := range state.Base {
+		if !seen[uid] {
+			state.Tombstones[uid] = base.Vector.tick(state.ReplicaID)
+		}
+	}
+
+	return nil
+}
+
+// mergeSnapshot merges a remote snapshot into the local tasks field by field.
+// Concurrent edits with different values keep the local value and are
+// returned as conflicts.
+func (tm *TaskManager) mergeSnapshot(state *SyncState, remote *SyncSnapshot) []Conflict {
+	var conflicts []Conflict
+	now := time.Now()
+
+	// Merge tombstones first so deletions apply to both sides
+	for uid, clock := range remote.Tombstones {
+		state.Tombstones[uid] = state.Tombstones[uid].join(clock)
+	}
+
+	local := make(map[string]int, len(tm.tasks))
+	for i, task := range tm.tasks {
+		local[task.UID] = i
+	}
+
+	for _, rt := range remote.Tasks {
+		i, ok := local[rt.UID]
+		if !ok {
+			// Skip tasks this replica already deleted
+			if tombstone, deleted := state.Tombstones[rt.UID]; deleted {
+				if order := rt.Vector.compare(tombstone); order == clockEqual || order == clockBefore {
+					continue
+				}
+			}
+
+			// New to this replica, keep its ID unless it is taken
+			if _, err := tm.getTask(rt.ID); err == nil || rt.ID <= 0 {
+				rt.ID = tm.nextID
+			}
+			if rt.ID >= tm.nextID {
+				tm.nextID = rt.ID + 1
+			}
+			tm.tasks = append(tm.tasks, rt)
+			local[rt.UID] = len(tm.tasks) - 1
+			continue
+		}
+
+		lt := &tm.tasks[i]
+		for _, field := range syncFields {
+			lc, rc := lt.FieldClocks[field], rt.FieldClocks[field]
+			switch lc.compare(rc) {
+			case clockEqual, clockAfter:
+				// Local value already reflects the remote edit
+			case clockBefore:
+				setFieldJSON(lt, field, fieldJSON(&rt, field))
+				setFieldClock(lt, field, rc)
+			case clockConcurrent:
+				localValue, remoteValue := fieldJSON(lt, field), fieldJSON(&rt, field)
+				if !bytes.Equal(localValue, remoteValue) {
+					conflicts = append(conflicts, Conflict{
+						UID:        lt.UID,
+						TaskID:     lt.ID,
+						Field:      field,
+						Local:      localValue,
+						Remote:     remoteValue,
+						DetectedAt: now,
+					})
+				}
+				setFieldClock(lt, field, lc.join(rc))
+			}
+		}
+
+		if rt.CreatedAt.Before(lt.CreatedAt) {
+			lt.CreatedAt = rt.CreatedAt
+		}
+		if rt.UpdatedAt.After(lt.UpdatedAt) {
+			lt.UpdatedAt = rt.UpdatedAt
+		}
+	}
+
+	// Drop tasks whose deletion happened after every edit we know about.
+	// Edits made concurrently with a deletion win and revive the task.
+	kept := tm.tasks[:0]
+	for _, task := range tm.tasks {
+		tombstone, deleted := state.Tombstones[task.UID]
+		if deleted {
+			switch task.Vector.compare(tombstone) {
+			case clockEqual, clockBefore:
+				continue
+			default:
+				delete(state.Tombstones, task.UID)
+			}
+		}
+		kept = append(kept, task)
+	}
+	tm.tasks = kept
+
+	return conflicts
+}
+
+// snapshot returns the local replicated state for pushing to the server
+func (tm *TaskManager) snapshot(state *SyncState) *SyncSnapshot {
+	tasks := make([]Task, len(tm.tasks))
+	copy(tasks, tm.tasks)
+	return &SyncSnapshot{
+		Revision:   state.Revision,
+		Tasks:      tasks,
+		Tombstones: state.Tombstones,
+	}
+}
+
+// recordSync stores the synced tasks as the base for the next sync
+func (tm *TaskManager) recordSync(state *SyncState, revision int64, conflicts []Conflict) {
+	state.Revision = revision
+	state.LastSync = time.Now()
+	state.Base = make(map[string]Task, len(tm.tasks))
+	for _, task := range tm.tasks {
+		state.Base[task.UID] = task
+	}
+
+	// A newer conflict on the same field replaces the older one
+	for _, conflict := range conflicts {
+		replaced := false
+		for i, existing := range state.Conflicts {
+			if existing.UID == conflict.UID && existing.Field == conflict.Field {
+				state.Conflicts[i] = conflict
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			state.Conflicts = append(state.Conflicts, conflict)
+		}
+	}
+
+	// Forget conflicts for tasks that no longer exist
+	active := state.Conflicts[:0]
+	for _, conflict := range state.Conflicts {
+		if _, ok := state.Base[conflict.UID]; ok {
+			active = append(active, conflict)
+		}
+	}
+	state.Conflicts = active
+}
+
+// Sync pulls the remote state, merges it, and pushes the result. A push that
+// races with another replica is retried from a fresh pull.
+func (tm *TaskManager) Sync(client *SyncClient, state *SyncState) ([]Conflict, error) {
+	if err := tm.stampLocalChanges(state); err != nil {
+		return nil, err
+	}
+
+	// Conflicts found in an attempt whose push lost the race are kept, since
+	// the merged clocks hide them from the retry
+	var conflicts []Conflict
+
+	const maxAttempts = 3
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		remote, err := client.Pull()
+		if err != nil {
+			return nil, err
+		}
+
+		conflicts = append(conflicts, tm.mergeSnapshot(state, remote)...)
+
+		pushed, err := client.Push(tm.snapshot(state), remote.Revision)
+		if err == errStaleRevision {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tm.recordSync(state, pushed.Revision, conflicts)
+		if err := tm.saveTasks(); err != nil {
+			return nil, err
+		}
+		if err := state.save(); err != nil {
+			return nil, err
+		}
+		return conflicts, nil
+	}
+
+	return nil, fmt.Errorf("sync failed after %d attempts: remote keeps changing", maxAttempts)
+}
+
+// ResolveConflict settles a recorded conflict by keeping the local or remote
+// value. The field clock is advanced so the choice wins on the next sync.
+func (tm *TaskManager) ResolveConflict(state *SyncState, taskID int, field, keep string) error {
+	if keep != "local" && keep != "remote" {
+		return fmt.Errorf("invalid choice %q: use local or remote", keep)
+	}
+
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return err
+	}
+
+	for i, conflict := range state.Conflicts {
+		if conflict.UID != task.UID || conflict.Field != field {
+			continue
+		}
+
+		if keep == "remote" {
+			if err := setFieldJSON(task, field, conflict.Remote); err != nil {
+				return fmt.Errorf("failed to apply remote value: %v", err)
+			}
+		}
+		setFieldClock(task, field, task.FieldClocks[field].tick(state.ReplicaID))
+		task.UpdatedAt = time.Now()
+
+		state.Conflicts = append(state.Conflicts[:i], state.Conflicts[i+1:]...)
+		if err := tm.saveTasks(); err != nil {
+			return err
+		}
+		return state.save()
+	}
+
+	return fmt.Errorf("no conflict on field %q of task %d", field, taskID)
+}
+
+// sortedConflicts returns conflicts ordered by task ID and field
+func sortedConflicts(conflicts []Conflict) []Conflict {
+	sorted := make([]Conflict, len(conflicts))
+	copy(sorted, conflicts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TaskID != sorted[j].TaskID {
+			return sorted[i].TaskID < sorted[j].TaskID
+		}
+		return sorted[i].Field < sorted[j].Field
+	})
+	return sorted
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncPath is the single endpoint used to pull and push replicated state
+const syncPath = "/api/v1/sync"
+
+// errStaleRevision is returned when a push was based on an outdated revision
+var errStaleRevision = errors.New("remote revision changed since pull")
+
+// SyncClient talks to a remote task sync server over HTTP
+type SyncClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewSyncClient creates a new sync client for the given server URL
+func NewSyncClient(baseURL, token string) *SyncClient {
+	return &SyncClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Pull fetches the current remote snapshot
+func (c *SyncClient) Pull() (*SyncSnapshot, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+syncPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// Push uploads a merged snapshot. The server rejects it with errStaleRevision
+// if another replica pushed since the given revision was pulled.
+func (c *SyncClient) Push(snapshot *SyncSnapshot, baseRevision int64) (*SyncSnapshot, error) {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.baseURL+syncPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", strconv.FormatInt(baseRevision, 10))
+	return c.do(req)
+}
+
+// do sends a request and decodes the snapshot in the response
+func (c *SyncClient) do(req *http.Request) (*SyncSnapshot, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sync request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPreconditionFailed:
+		return nil, errStaleRevision
+	default:
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("sync server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var snapshot SyncSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode sync response: %v", err)
+	}
+	if snapshot.Tombstones == nil {
+		snapshot.Tombstones = make(map[string]VectorClock)
+	}
+	return &snapshot, nil
+}
+
+// SyncServer stores the shared task state for a team. Merging happens on the
+// clients; the server only enforces that each push builds on the latest
+// revision so no replica overwrites changes it has not seen.
+type SyncServer struct {
+	mu        sync.Mutex
+	snapshot  SyncSnapshot
+	storeFile string
+	token     string
+	logger    *log.Logger
+}
+
+// NewSyncServer creates a sync server persisting to storeFile
+func NewSyncServer(storeFile, token string) (*SyncServer, error) {
+	s := &SyncServer{
+		snapshot:  SyncSnapshot{Tasks: []Task{}, Tombstones: make(map[string]VectorClock)},
+		storeFile: storeFile,
+		token:     token,
+		logger:    log.New(os.Stdout, "[SYNC-SERVER] ", log.LstdFlags),
+	}
+
+	data, err := ioutil.ReadFile(storeFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read store: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse store: %v", err)
+		}
+	}
+
+	return s, nil
+}
+
+// ServeHTTP handles pull (GET) and push (PUT) requests
+func (s *SyncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != syncPath {
+		http.NotFound(w, r)
+		return
+	}
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handlePull(w)
+	case http.MethodPut:
+		s.handlePush(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePull returns the current snapshot
+func (s *SyncServer) handlePull(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writeSnapshot(w)
+}
+
+// handlePush replaces the snapshot if the client merged the latest revision
+func (s *SyncServer) handlePush(w http.ResponseWriter, r *http.Request) {
+	baseRevision, err := strconv.ParseInt(r.Header.Get("If-Match"), 10, 64)
+	if err != nil {
+		http.Error(w, "If-Match revision header required", http.StatusPreconditionRequired)
+		return
+	}
+
+	var pushed SyncSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&pushed); err != nil {
+		http.Error(w, fmt.Sprintf("invalid snapshot: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if baseRevision != s.snapshot.Revision {
+		http.Error(w, errStaleRevision.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	if pushed.Tasks == nil {
+		pushed.Tasks = []Task{}
+	}
+	if pushed.Tombstones == nil {
+		pushed.Tombstones = make(map[string]VectorClock)
+	}
+	pushed.Revision = s.snapshot.Revision + 1
+
+	previous := s.snapshot
+	s.snapshot = pushed
+	if err := s.save(); err != nil {
+		s.snapshot = previous
+		s.logger.Printf("Error saving store: %v", err)
+		http.Error(w, "failed to persist snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Printf("Accepted revision %d with %d task(s)", pushed.Revision, len(pushed.Tasks))
+	s.writeSnapshot(w)
+}
+
+// writeSnapshot encodes the current snapshot; callers hold s.mu
+func (s *SyncServer) writeSnapshot(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", strconv.FormatInt(s.snapshot.Revision, 10))
+	json.NewEncoder(w).Encode(s.snapshot)
+}
+
+// save persists the snapshot; callers hold s.mu
+func (s *SyncServer) save() error {
+	if s.storeFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.storeFile, data, 0644)
+}
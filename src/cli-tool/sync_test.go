@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newTestReplica creates a task manager and sync state in a temp dir
+func newTestReplica(t *testing.T) (*TaskManager, *SyncState) {
+	dataFile := filepath.Join(t.TempDir(), "tasks.json")
+	tm := NewTaskManager(dataFile)
+	state, err := loadSyncState(dataFile)
+	if err != nil {
+		t.Fatalf("loadSyncState failed: %v", err)
+	}
+	return tm, state
+}
+
+func TestVectorClockCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     VectorClock
+		expected int
+	}{
+		{"equal", VectorClock{"a": 1}, VectorClock{"a": 1}, clockEqual},
+		{"nil equal", nil, VectorClock{}, clockEqual},
+		{"before", VectorClock{"a": 1}, VectorClock{"a": 2}, clockBefore},
+		{"after missing replica", VectorClock{"a": 1, "b": 1}, VectorClock{"a": 1}, clockAfter},
+		{"concurrent", VectorClock{"a": 2, "b": 1}, VectorClock{"a": 1, "b": 2}, clockConcurrent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.compare(tt.b); got != tt.expected {
+				t.Errorf("compare() = %d; want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSyncMergesFieldByField(t *testing.T) {
+	server, err := NewSyncServer("", "")
+	if err != nil {
+		t.Fatalf("NewSyncServer failed: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewSyncClient(ts.URL, "")
+
+	a, stateA := newTestReplica(t)
+	b, stateB := newTestReplica(t)
+
+	a.addTask("Write docs", "", "medium", []string{"docs"})
+	if _, err := a.Sync(client, stateA); err != nil {
+		t.Fatalf("sync A failed: %v", err)
+	}
+	if _, err := b.Sync(client, stateB); err != nil {
+		t.Fatalf("sync B failed: %v", err)
+	}
+	if len(b.tasks) != 1 {
+		t.Fatalf("B has %d tasks after pull; want 1", len(b.tasks))
+	}
+
+	// Different fields edited on each side merge cleanly,
+	// the same field edited on both sides is a conflict
+	a.updateTask(1, "Write API docs", "", "", nil)
+	a.updateTask(1, "", "", "high", nil)
+	b.updateTask(1, "Write user docs", "", "", nil)
+	b.completeTask(1)
+
+	if _, err := a.Sync(client, stateA); err != nil {
+		t.Fatalf("sync A failed: %v", err)
+	}
+	conflicts, err := b.Sync(client, stateB)
+	if err != nil {
+		t.Fatalf("sync B failed: %v", err)
+	}
+
+	if len(conflicts) != 1 || conflicts[0].Field != "title" {
+		t.Fatalf("conflicts = %+v; want one title conflict", conflicts)
+	}
+	task := b.tasks[0]
+	if task.Title != "Write user docs" || task.Priority != "high" || !task.Completed {
+		t.Errorf("unexpected merged task on B: %+v", task)
+	}
+
+	if err := b.ResolveConflict(stateB, 1, "title", "remote"); err != nil {
+		t.Fatalf("ResolveConflict failed: %v", err)
+	}
+	if _, err := b.Sync(client, stateB); err != nil {
+		t.Fatalf("sync B failed: %v", err)
+	}
+	if _, err := a.Sync(client, stateA); err != nil {
+		t.Fatalf("sync A failed: %v", err)
+	}
+
+	for name, tm := range map[string]*TaskManager{"A": a, "B": b} {
+		task := tm.tasks[0]
+		if task.Title != "Write API docs" || task.Priority != "high" || !task.Completed {
+			t.Errorf("replica %s did not converge: %+v", name, task)
+		}
+	}
+	if len(stateB.Conflicts) != 0 {
+		t.Errorf("conflict still recorded after resolve: %+v", stateB.Conflicts)
+	}
+}
+
+func TestSyncPropagatesDeletes(t *testing.T) {
+	server, _ := NewSyncServer("", "")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewSyncClient(ts.URL, "")
+
+	a, stateA := newTestReplica(t)
+	b, stateB := newTestReplica(t)
+
+	a.addTask("Temporary", "", "low", nil)
+	a.Sync(client, stateA)
+	b.Sync(client, stateB)
+
+	if err := b.deleteTask(1); err != nil {
+		t.Fatalf("deleteTask failed: %v", err)
+	}
+	b.Sync(client, stateB)
+	a.Sync(client, stateA)
+
+	if len(a.tasks) != 0 {
+		t.Errorf("delete did not propagate, A has %d task(s)", len(a.tasks))
+	}
+}
+
+func TestSyncServerRejectsStalePush(t *testing.T) {
+	server, _ := NewSyncServer("", "")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewSyncClient(ts.URL, "")
+
+	if _, err := client.Push(&SyncSnapshot{}, 0); err != nil {
+		t.Fatalf("first push failed: %v", err)
+	}
+	if _, err := client.Push(&SyncSnapshot{}, 0); err != errStaleRevision {
+		t.Errorf("stale push error = %v; want errStaleRevision", err)
+	}
+}
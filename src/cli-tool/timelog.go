@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TimeEntry is a span of time spent on a task
+type TimeEntry struct {
+	ID     int       `json:"id"`
+	TaskID int       `json:"task_id"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"` // zero while the timer is running
+	Note   string    `json:"note,omitempty"`
+	Manual bool      `json:"manual,omitempty"`
+}
+
+// Duration returns the entry length, counting a running timer up to now
+func (e *TimeEntry) Duration(now time.Time) time.Duration {
+	end := e.End
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(e.Start)
+}
+
+// TimeLog holds time entries and the single active timer. It is stored next
+// to the tasks file and only written while the tasks file lock is held.
+type TimeLog struct {
+	NextID  int         `json:"next_id"`
+	Active  *TimeEntry  `json:"active,omitempty"`
+	Entries []TimeEntry `json:"entries"`
+
+	file string
+}
+
+// timeLogFile returns the time log path for a tasks data file
+func timeLogFile(dataFile string) string {
+	return strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".timelog.json"
+}
+
+// loadTimeLog reads the time log, returning an empty log if none exists
+func loadTimeLog(file string) (*TimeLog, error) {
+	log := &TimeLog{NextID: 1, Entries: []TimeEntry{}, file: file}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read time log: %v", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, log); err != nil {
+			return nil, fmt.Errorf("failed to parse time log: %v", err)
+		}
+	}
+	if log.NextID < 1 {
+		log.NextID = 1
+	}
+	return log, nil
+}
+
+// save writes the time log atomically
+func (l *TimeLog) save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal time log: %v", err)
+	}
+	if err := writeFileAtomic(l.file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write time log: %v", err)
+	}
+	return nil
+}
+
+// timeLog loads the time log for this task manager on first use
+func (tm *TaskManager) timeLog() (*TimeLog, error) {
+	if tm.times == nil {
+		log, err := loadTimeLog(timeLogFile(tm.dataFile))
+		if err != nil {
+			return nil, err
+		}
+		tm.times = log
+	}
+	return tm.times, nil
+}
+
+// StartTimer starts timing a task. A timer already running on another task
+// is stopped first and returned.
+func (tm *TaskManager) StartTimer(taskID int, note string) (stopped *TimeEntry, err error) {
+	if _, err := tm.getTask(taskID); err != nil {
+		return nil, err
+	}
+
+	log, err := tm.timeLog()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if log.Active != nil {
+		if log.Active.TaskID == taskID {
+			return nil, fmt.Errorf("timer already running for task %d since %s", taskID, log.Active.Start.Format("15:04"))
+		}
+		stopped = log.stopActive(now)
+	}
+
+	log.Active = &TimeEntry{ID: log.NextID, TaskID: taskID, Start: now, Note: note}
+	log.NextID++
+
+	if err := log.save(); err != nil {
+		return nil, err
+	}
+	return stopped, nil
+}
+
+// StopTimer stops the active timer and returns the finished entry
+func (tm *TaskManager) StopTimer() (*TimeEntry, error) {
+	log, err := tm.timeLog()
+	if err != nil {
+		return nil, err
+	}
+	if log.Active == nil {
+		return nil, fmt.Errorf("no timer is running")
+	}
+
+	entry := log.stopActive(time.Now())
+	if err := log.save(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// stopActive moves the active timer into the finished entries
+func (l *TimeLog) stopActive(now time.Time) *TimeEntry {
+	entry := *l.Active
+	entry.End = now
+	l.Entries = append(l.Entries, entry)
+	l.Active = nil
+	return &entry
+}
+
+// AddTimeEntry records time spent on a task without running a timer
+func (tm *TaskManager) AddTimeEntry(taskID int, start time.Time, duration time.Duration, note string) (*TimeEntry, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if _, err := tm.getTask(taskID); err != nil {
+		return nil, err
+	}
+
+	log, err := tm.timeLog()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := TimeEntry{
+		ID:     log.NextID,
+		TaskID: taskID,
+		Start:  start,
+		End:    start.Add(duration),
+		Note:   note,
+		Manual: true,
+	}
+	log.Entries = append(log.Entries, entry)
+	log.NextID++
+
+	if err := log.save(); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ReportRow is the total time for one group of a report
+type ReportRow struct {
+	Key     string        `json:"key"`
+	Total   time.Duration `json:"total"`
+	Entries int           `json:"entries"`
+}
+
+// TimeReport builds totals grouped by tag, priority or day over [from, to).
+// Entries are clipped to the range and split at midnight for daily totals.
+// A task with several tags counts toward each of them, so tag totals can add
+// up to more than the time tracked.
+func (tm *TaskManager) TimeReport(by string, from, to time.Time) ([]ReportRow, time.Duration, error) {
+	if by != "tag" && by != "priority" && by != "day" {
+		return nil, 0, fmt.Errorf("invalid grouping %q (use tag, priority or day)", by)
+	}
+
+	log, err := tm.timeLog()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	entries := append([]TimeEntry{}, log.Entries...)
+	if log.Active != nil {
+		entries = append(entries, *log.Active)
+	}
+
+	totals := make(map[string]*ReportRow)
+	add := func(key string, d time.Duration) {
+		row, ok := totals[key]
+		if !ok {
+			row = &ReportRow{Key: key}
+			totals[key] = row
+		}
+		row.Total += d
+		row.Entries++
+	}
+
+	var grand time.Duration
+	for _, entry := range entries {
+		start, end := entry.Start, entry.Start.Add(entry.Duration(now))
+		if !from.IsZero() && start.Before(from) {
+			start = from
+		}
+		if !to.IsZero() && end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		grand += end.Sub(start)
+
+		switch by {
+		case "day":
+			for day := start; day.Before(end); {
+				next := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+				if next.After(end) {
+					next = end
+				}
+				add(day.Format("2006-01-02"), next.Sub(day))
+				day = next
+			}
+		case "priority":
+			key := "(deleted task)"
+			if task, err := tm.getTask(entry.TaskID); err == nil {
+				key = task.Priority
+			}
+			add(key, end.Sub(start))
+		case "tag":
+			task, err := tm.getTask(entry.TaskID)
+			switch {
+			case err != nil:
+				add("(deleted task)", end.Sub(start))
+			case len(task.Tags) == 0:
+				add("(untagged)", end.Sub(start))
+			default:
+				for _, tag := range task.Tags {
+					add(tag, end.Sub(start))
+				}
+			}
+		}
+	}
+
+	rows := make([]ReportRow, 0, len(totals))
+	for _, row := range totals {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if by == "day" {
+			return rows[i].Key < rows[j].Key
+		}
+		if rows[i].Total != rows[j].Total {
+			return rows[i].Total > rows[j].Total
+		}
+		return rows[i].Key < rows[j].Key
+	})
+
+	return rows, grand, nil
+}
+
+// renderReport writes a time report as an aligned table or CSV
+func renderReport(w io.Writer, by string, rows []ReportRow, total time.Duration, format string) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tTIME\tHOURS\tENTRIES\n", strings.ToUpper(by))
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t%.2f\t%d\n", row.Key, formatDuration(row.Total), row.Total.Hours(), row.Entries)
+		}
+		fmt.Fprintf(tw, "TOTAL\t%s\t%.2f\t\n", formatDuration(total), total.Hours())
+		return tw.Flush()
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{by, "seconds", "hours", "entries"})
+		for _, row := range rows {
+			writer.Write([]string{
+				row.Key,
+				strconv.FormatInt(int64(row.Total.Seconds()), 10),
+				strconv.FormatFloat(row.Total.Hours(), 'f', 2, 64),
+				strconv.Itoa(row.Entries),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown report format %q (use table or csv)", format)
+	}
+}
+
+// formatDuration formats a duration as h:mm
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// parseReportRange parses --from and --to dates. Both are inclusive, so the
+// range ends after the period named by --to. Empty values leave it open.
+func parseReportRange(fromValue, toValue string) (from, to time.Time, err error) {
+	if fromValue != "" {
+		if from, _, err = parseQueryDate(fromValue); err != nil {
+			return from, to, err
+		}
+	}
+	if toValue != "" {
+		if _, to, err = parseQueryDate(toValue); err != nil {
+			return from, to, err
+		}
+	}
+	return from, to, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSingleActiveTimer(t *testing.T) {
+	tm := newTaskManager(filepath.Join(t.TempDir(), "tasks.json"))
+	tm.addTask("first", "", "low", nil)
+	tm.addTask("second", "", "low", nil)
+
+	if _, err := tm.StartTimer(1, ""); err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+	if _, err := tm.StartTimer(1, ""); err == nil {
+		t.Errorf("StartTimer on the running task succeeded; want error")
+	}
+
+	stopped, err := tm.StartTimer(2, "")
+	if err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+	if stopped == nil || stopped.TaskID != 1 || stopped.End.IsZero() {
+		t.Errorf("starting task 2 stopped %+v; want the finished task 1 timer", stopped)
+	}
+
+	reloaded, err := loadTimeLog(timeLogFile(tm.dataFile))
+	if err != nil {
+		t.Fatalf("loadTimeLog failed: %v", err)
+	}
+	if reloaded.Active == nil || reloaded.Active.TaskID != 2 || len(reloaded.Entries) != 1 {
+		t.Errorf("unexpected time log: %+v", reloaded)
+	}
+}
+
+func TestTimeReport(t *testing.T) {
+	tm := newTaskManager(filepath.Join(t.TempDir(), "tasks.json"))
+	tm.addTask("report", "", "high", []string{"work", "client"})
+	tm.addTask("groceries", "", "low", nil)
+
+	day := time.Date(2026, 3, 15, 0, 0, 0, 0, time.Local)
+	tm.AddTimeEntry(1, day.Add(23*time.Hour), 2*time.Hour, "") // runs past midnight
+	tm.AddTimeEntry(2, day.Add(10*time.Hour), 30*time.Minute, "")
+
+	tests := []struct {
+		by       string
+		from, to time.Time
+		expected map[string]time.Duration
+		total    time.Duration
+	}{
+		{"tag", time.Time{}, time.Time{}, map[string]time.Duration{
+			"work": 2 * time.Hour, "client": 2 * time.Hour, "(untagged)": 30 * time.Minute,
+		}, 150 * time.Minute},
+		{"priority", time.Time{}, time.Time{}, map[string]time.Duration{
+			"high": 2 * time.Hour, "low": 30 * time.Minute,
+		}, 150 * time.Minute},
+		{"day", time.Time{}, time.Time{}, map[string]time.Duration{
+			"2026-03-15": 90 * time.Minute, "2026-03-16": time.Hour,
+		}, 150 * time.Minute},
+		{"day", day.AddDate(0, 0, 1), time.Time{}, map[string]time.Duration{
+			"2026-03-16": time.Hour,
+		}, time.Hour},
+	}
+
+	for _, tt := range tests {
+		rows, total, err := tm.TimeReport(tt.by, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("TimeReport(%s) failed: %v", tt.by, err)
+		}
+		if total != tt.total {
+			t.Errorf("TimeReport(%s) total = %v; want %v", tt.by, total, tt.total)
+		}
+		if len(rows) != len(tt.expected) {
+			t.Errorf("TimeReport(%s) = %+v; want %v", tt.by, rows, tt.expected)
+			continue
+		}
+		for _, row := range rows {
+			if row.Total != tt.expected[row.Key] {
+				t.Errorf("TimeReport(%s)[%s] = %v; want %v", tt.by, row.Key, row.Total, tt.expected[row.Key])
+			}
+		}
+	}
+}
+
+func TestParseReportRangeIncludesLastDay(t *testing.T) {
+	from, to, err := parseReportRange("2026-03-01", "2026-03-31")
+	if err != nil {
+		t.Fatalf("parseReportRange failed: %v", err)
+	}
+	if !from.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) || !to.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("parseReportRange = [%v, %v); want March 2026", from, to)
+	}
+}
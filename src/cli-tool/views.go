@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isReservedViewName reports whether name is taken by a subcommand of
+// `task view`, which cobra would run instead of showing the view
+func isReservedViewName(name string) bool {
+	for _, cmd := range viewCmd.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SavedView is a named query with its sort order and output format
+type SavedView struct {
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	Sort   string `json:"sort,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// ViewStore persists saved views as JSON in the config dir
+type ViewStore struct {
+	file string
+}
+
+// NewViewStore creates a view store under configDir
+func NewViewStore(configDir string) *ViewStore {
+	return &ViewStore{file: filepath.Join(configDir, "views.json")}
+}
+
+// defaultConfigDir returns TASK_CONFIG_DIR or the user config dir for task
+func defaultConfigDir() string {
+	if dir := os.Getenv("TASK_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "task")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".tasks")
+}
+
+// load reads all saved views keyed by name
+func (vs *ViewStore) load() (map[string]SavedView, error) {
+	views := make(map[string]SavedView)
+
+	data, err := os.ReadFile(vs.file)
+	if os.IsNotExist(err) {
+		return views, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read views: %v", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &views); err != nil {
+			return nil, fmt.Errorf("failed to parse views: %v", err)
+		}
+	}
+	return views, nil
+}
+
+// write replaces the views file atomically
+func (vs *ViewStore) write(views map[string]SavedView) error {
+	data, err := json.MarshalIndent(views, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal views: %v", err)
+	}
+	return writeFileAtomic(vs.file, data, 0644)
+}
+
+// Get returns a saved view by name
+func (vs *ViewStore) Get(name string) (*SavedView, error) {
+	views, err := vs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	view, ok := views[name]
+	if !ok {
+		return nil, fmt.Errorf("view %q not found", name)
+	}
+	return &view, nil
+}
+
+// Save validates and stores a view, replacing any view with the same name
+func (vs *ViewStore) Save(view SavedView) error {
+	if view.Name == "" || strings.ContainsAny(view.Name, " \t/") {
+		return fmt.Errorf("invalid view name %q", view.Name)
+	}
+	if isReservedViewName(view.Name) {
+		return fmt.Errorf("%q is reserved, choose another view name", view.Name)
+	}
+	if _, err := view.Build(); err != nil {
+		return err
+	}
+	if view.Format != "" {
+		if err := renderTasks(io.Discard, nil, view.Format); err != nil {
+			return err
+		}
+	}
+
+	views, err := vs.load()
+	if err != nil {
+		return err
+	}
+	views[view.Name] = view
+	return vs.write(views)
+}
+
+// Delete removes a saved view
+func (vs *ViewStore) Delete(name string) error {
+	views, err := vs.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := views[name]; !ok {
+		return fmt.Errorf("view %q not found", name)
+	}
+	delete(views, name)
+	return vs.write(views)
+}
+
+// List returns saved views ordered by name
+func (vs *ViewStore) List() ([]SavedView, error) {
+	views, err := vs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]SavedView, 0, len(views))
+	for _, view := range views {
+		list = append(list, view)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Build parses the view's query and sort into a Query
+func (v *SavedView) Build() (*Query, error) {
+	query, err := ParseQuery(v.Query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+
+	keys, err := ParseSort(v.Sort)
+	if err != nil {
+		return nil, err
+	}
+	query.Sort = append(query.Sort, keys...)
+	return query, nil
+}
+
+// joinQueryArgs rebuilds a query string from shell arguments. An argument
+// with spaces made only of plain words was a quoted phrase on the command
+// line and is re-quoted; one containing terms is a whole query and kept as is.
+func joinQueryArgs(args []string) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, " \t") || strings.Contains(arg, `"`) {
+			parts = append(parts, arg)
+			continue
+		}
+
+		phrase := true
+		for _, word := range strings.Fields(arg) {
+			if _, isTerm := splitTerm(word); isTerm || strings.HasPrefix(word, "-") || strings.HasPrefix(word, "!") {
+				phrase = false
+				break
+			}
+		}
+
+		if phrase {
+			parts = append(parts, `"`+arg+`"`)
+		} else {
+			parts = append(parts, arg)
+		}
+	}
+	return strings.Join(parts, " ")
+}
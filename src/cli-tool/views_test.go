@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestSaveRejectsSubcommandNames(t *testing.T) {
+	views := NewViewStore(t.TempDir())
+	if len(viewCmd.Commands()) == 0 {
+		t.Fatal("view has no subcommands")
+	}
+	for _, cmd := range viewCmd.Commands() {
+		if err := views.Save(SavedView{Name: cmd.Name(), Query: "tag:work"}); err == nil {
+			t.Errorf("view named %q saved, but `task view %s` runs the subcommand", cmd.Name(), cmd.Name())
+		}
+	}
+
+	if err := views.Save(SavedView{Name: "work", Query: "tag:work"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if view, err := views.Get("work"); err != nil || view.Query != "tag:work" {
+		t.Errorf("Get = %+v, %v", view, err)
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"sync"
 	"time"
+
+	"github.com/smaruf/go-lang-study/src/pool"
 )
 
 // Job represents work to be done
@@ -14,156 +15,17 @@ type Job struct {
 	ID       int
 	Duration time.Duration
 	Name     string
+	Priority int
 }
 
-// Result represents the result of processing a job
-type Result struct {
-	JobID     int
-	Success   bool
-	Message   string
-	Duration  time.Duration
-	ProcessedAt time.Time
-}
-
-// Worker represents a worker goroutine
-type Worker struct {
-	ID         int
-	jobChannel chan Job
-	resultCh   chan Result
-	quit       chan bool
-}
-
-// WorkerPool manages a pool of workers
-type WorkerPool struct {
-	workers    []*Worker
-	jobQueue   chan Job
-	resultCh   chan Result
-	numWorkers int
-	wg         sync.WaitGroup
-}
-
-// NewWorker creates a new worker
-func NewWorker(id int, jobCh chan Job, resultCh chan Result) *Worker {
-	return &Worker{
-		ID:         id,
-		jobChannel: jobCh,
-		resultCh:   resultCh,
-		quit:       make(chan bool),
-	}
-}
-
-// Start begins the worker's processing loop
-func (w *Worker) Start(ctx context.Context) {
-	go func() {
-		defer func() {
-			log.Printf("Worker %d stopped", w.ID)
-		}()
-		
-		for {
-			select {
-			case job := <-w.jobChannel:
-				start := time.Now()
-				log.Printf("Worker %d started job %d (%s)", w.ID, job.ID, job.Name)
-				
-				// Simulate work with context cancellation support
-				select {
-				case <-time.After(job.Duration):
-					w.resultCh <- Result{
-						JobID:       job.ID,
-						Success:     true,
-						Message:     fmt.Sprintf("Job %d completed by worker %d", job.ID, w.ID),
-						Duration:    time.Since(start),
-						ProcessedAt: time.Now(),
-					}
-					log.Printf("Worker %d completed job %d", w.ID, job.ID)
-				case <-ctx.Done():
-					w.resultCh <- Result{
-						JobID:       job.ID,
-						Success:     false,
-						Message:     fmt.Sprintf("Job %d cancelled", job.ID),
-						Duration:    time.Since(start),
-						ProcessedAt: time.Now(),
-					}
-					log.Printf("Worker %d cancelled job %d", w.ID, job.ID)
-					return
-				}
-			case <-ctx.Done():
-				return
-			case <-w.quit:
-				return
-			}
-		}
-	}()
-}
-
-// Stop stops the worker
-func (w *Worker) Stop() {
-	go func() {
-		w.quit <- true
-	}()
-}
-
-// NewWorkerPool creates a new worker pool
-func NewWorkerPool(numWorkers int) *WorkerPool {
-	return &WorkerPool{
-		workers:    make([]*Worker, numWorkers),
-		jobQueue:   make(chan Job, 100),
-		resultCh:   make(chan Result, 100),
-		numWorkers: numWorkers,
-	}
-}
-
-// Start initializes and starts all workers
-func (wp *WorkerPool) Start(ctx context.Context) {
-	log.Printf("Starting worker pool with %d workers", wp.numWorkers)
-	
-	for i := 0; i < wp.numWorkers; i++ {
-		worker := NewWorker(i+1, wp.jobQueue, wp.resultCh)
-		wp.workers[i] = worker
-		worker.Start(ctx)
-	}
-	
-	// Start result processor
-	go wp.processResults(ctx)
-}
-
-// processResults handles the results from workers
-func (wp *WorkerPool) processResults(ctx context.Context) {
-	for {
-		select {
-		case result := <-wp.resultCh:
-			status := "SUCCESS"
-			if !result.Success {
-				status = "FAILED"
-			}
-			log.Printf("[%s] Job %d: %s (took %v)", 
-				status, result.JobID, result.Message, result.Duration)
-			wp.wg.Done()
-		case <-ctx.Done():
-			log.Println("Result processor stopped")
-			return
-		}
-	}
-}
-
-// SubmitJob adds a job to the job queue
-func (wp *WorkerPool) SubmitJob(job Job) {
-	wp.wg.Add(1)
-	go func() {
-		wp.jobQueue <- job
-	}()
-}
-
-// Wait waits for all jobs to complete
-func (wp *WorkerPool) Wait() {
-	wp.wg.Wait()
-}
-
-// Stop gracefully stops all workers
-func (wp *WorkerPool) Stop() {
-	log.Println("Stopping worker pool...")
-	for _, worker := range wp.workers {
-		worker.Stop()
+// process simulates a job, giving up when its context is cancelled
+func process(ctx context.Context, job Job) (string, error) {
+	log.Printf("Started job %d (%s)", job.ID, job.Name)
+	select {
+	case <-time.After(job.Duration):
+		return fmt.Sprintf("Job %d (%s) completed", job.ID, job.Name), nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("job %d cancelled: %w", job.ID, ctx.Err())
 	}
 }
 
@@ -172,42 +34,66 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Create and start worker pool
-	pool := NewWorkerPool(3)
-	pool.Start(ctx)
+	// One worker idles; up to three run while jobs are waiting, and none
+	// may run for more than 3 seconds
+	workers := pool.New(process, pool.Options{
+		MinWorkers:  1,
+		MaxWorkers:  3,
+		QueueSize:   100,
+		IdleTimeout: time.Second,
+		JobTimeout:  3 * time.Second,
+	})
+	log.Println("Started worker pool with 1 to 3 workers")
 
 	// Submit jobs
 	jobs := []Job{
 		{ID: 1, Duration: 2 * time.Second, Name: "Process Data"},
-		{ID: 2, Duration: 1 * time.Second, Name: "Send Email"},
+		{ID: 2, Duration: 1 * time.Second, Name: "Send Email", Priority: 1},
 		{ID: 3, Duration: 3 * time.Second, Name: "Generate Report"},
 		{ID: 4, Duration: 500 * time.Millisecond, Name: "Update Cache"},
-		{ID: 5, Duration: 1500 * time.Millisecond, Name: "Backup Database"},
+		{ID: 5, Duration: 1500 * time.Millisecond, Name: "Backup Database", Priority: 2},
 		{ID: 6, Duration: 800 * time.Millisecond, Name: "Clean Logs"},
 		{ID: 7, Duration: 2500 * time.Millisecond, Name: "Sync Files"},
 		{ID: 8, Duration: 600 * time.Millisecond, Name: "Index Search"},
 	}
 
 	log.Printf("Submitting %d jobs...", len(jobs))
-	
+
 	// Add some randomness to job duration
-	rand.Seed(time.Now().UnixNano())
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var tasks []*pool.Task[Job, string]
 	for _, job := range jobs {
 		// Add random variation to duration (±50%)
-		variation := time.Duration(rand.Intn(int(job.Duration/2)))
-		if rand.Intn(2) == 0 {
+		variation := time.Duration(random.Intn(int(job.Duration / 2)))
+		if random.Intn(2) == 0 {
 			job.Duration += variation
 		} else {
 			job.Duration -= variation
 		}
-		pool.SubmitJob(job)
+		task, err := workers.SubmitWith(ctx, job, pool.JobOptions{Priority: job.Priority})
+		if err != nil {
+			log.Fatalf("Failed to submit job %d: %v", job.ID, err)
+		}
+		tasks = append(tasks, task)
 	}
 
 	// Wait for all jobs to complete
 	log.Println("Waiting for jobs to complete...")
-	pool.Wait()
+	for _, task := range tasks {
+		message, err := task.Result()
+		if err != nil {
+			log.Printf("[FAILED] Job %d: %v (took %v)", task.Input.ID, err, task.RunTime())
+			continue
+		}
+		log.Printf("[SUCCESS] %s (waited %v, took %v)", message, task.QueueTime(), task.RunTime())
+	}
 
 	// Graceful shutdown
-	pool.Stop()
-	log.Println("All jobs completed!")
-}
\ No newline at end of file
+	if err := workers.Drain(ctx); err != nil {
+		log.Printf("Drain interrupted: %v", err)
+		workers.Stop()
+	}
+	stats := workers.Stats()
+	log.Printf("All jobs completed! %d succeeded, %d failed, average run %v, utilization %.0f%%",
+		stats.Completed-stats.Failed, stats.Failed, stats.AvgLatency, stats.Utilization*100)
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Group-by dimensions supported by the aggregator
+const (
+	GroupByCategory       = "category"
+	GroupByTag            = "tag"
+	GroupByMetadataPrefix = "metadata:"
+	allRecordsGroup       = "all"
+)
+
+// AggregationConfig controls group-by aggregation and time windows
+type AggregationConfig struct {
+	GroupBy     []string      `json:"group_by"`     // category, tag, metadata:<key>
+	WindowSize  time.Duration `json:"window_size"`  // 0 disables windowing
+	WindowSlide time.Duration `json:"window_slide"` // 0 or equal to size means tumbling
+	Percentiles []float64     `json:"percentiles"`  // e.g. 50, 90, 99
+}
+
+// AggregateStats holds the statistics reported for a group or a window
+type AggregateStats struct {
+	Count          int                `json:"count"`
+	Sum            float64            `json:"sum"`
+	Mean           float64            `json:"mean"`
+	Min            float64            `json:"min"`
+	Max            float64            `json:"max"`
+	Percentiles    map[string]float64 `json:"percentiles,omitempty"`
+	DistinctCounts map[string]int     `json:"distinct_counts"`
+}
+
+// GroupResult is the aggregate for one key of a group-by dimension
+type GroupResult struct {
+	Dimension string         `json:"dimension"`
+	Key       string         `json:"key"`
+	Stats     AggregateStats `json:"stats"`
+}
+
+// WindowResult is the aggregate for one time window of one series
+type WindowResult struct {
+	Series string         `json:"series"`
+	Start  time.Time      `json:"start"`
+	End    time.Time      `json:"end"`
+	Stats  AggregateStats `json:"stats"`
+}
+
+// AggregationResult contains every group and window computed for a run
+type AggregationResult struct {
+	Config         AggregationConfig `json:"config"`
+	Groups         []GroupResult     `json:"groups"`
+	Windows        []WindowResult    `json:"windows,omitempty"`
+	UndatedRecords int               `json:"undated_records,omitempty"`
+}
+
+// Aggregator computes group-by and windowed statistics over records
+type Aggregator struct {
+	config AggregationConfig
+}
+
+// NewAggregator creates a new aggregator after validating the config
+func NewAggregator(config AggregationConfig) (*Aggregator, error) {
+	for _, dim := range config.GroupBy {
+		if dim != GroupByCategory && dim != GroupByTag &&
+			!(strings.HasPrefix(dim, GroupByMetadataPrefix) && len(dim) > len(GroupByMetadataPrefix)) {
+			return nil, fmt.Errorf("unsupported group-by dimension: %s", dim)
+		}
+	}
+	if config.WindowSize < 0 || config.WindowSlide < 0 {
+		return nil, fmt.Errorf("window size and slide must not be negative")
+	}
+	if config.WindowSlide == 0 {
+		config.WindowSlide = config.WindowSize
+	}
+	if config.WindowSize > 0 && config.WindowSlide > config.WindowSize {
+		return nil, fmt.Errorf("window slide %v is larger than window size %v", config.WindowSlide, config.WindowSize)
+	}
+	for _, p := range config.Percentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentile out of range: %v", p)
+		}
+	}
+	return &Aggregator{config: config}, nil
+}
+
+// Aggregate runs every configured group-by and window over the records
+func (a *Aggregator) Aggregate(records []Record) *AggregationResult {
+	result := &AggregationResult{
+		Config: a.config,
+		Groups: []GroupResult{},
+	}
+
+	// Group-by aggregations
+	for _, dim := range a.config.GroupBy {
+		groups := a.groupRecords(dim, records)
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			result.Groups = append(result.Groups, GroupResult{
+				Dimension: dim,
+				Key:       key,
+				Stats:     a.computeStats(groups[key]),
+			})
+		}
+	}
+
+	if a.config.WindowSize == 0 {
+		return result
+	}
+
+	// Time windows, one series for all records and one per group key
+	dated := make([]Record, 0, len(records))
+	for _, record := range records {
+		if record.Date.IsZero() {
+			result.UndatedRecords++
+			continue
+		}
+		dated = append(dated, record)
+	}
+
+	result.Windows = append(result.Windows, a.windowRecords(allRecordsGroup, dated)...)
+	for _, dim := range a.config.GroupBy {
+		groups := a.groupRecords(dim, dated)
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			result.Windows = append(result.Windows, a.windowRecords(dim+"="+key, groups[key])...)
+		}
+	}
+
+	return result
+}
+
+// groupRecords buckets records by the given dimension
+func (a *Aggregator) groupRecords(dim string, records []Record) map[string][]Record {
+	groups := make(map[string][]Record)
+
+	for _, record := range records {
+		switch {
+		case dim == GroupByCategory:
+			groups[record.Category] = append(groups[record.Category], record)
+		case dim == GroupByTag:
+			// A record contributes to every tag it carries, once per tag
+			seen := make(map[string]bool)
+			for _, tag := range record.Tags {
+				if seen[tag] {
+					continue
+				}
+				seen[tag] = true
+				groups[tag] = append(groups[tag], record)
+			}
+		case strings.HasPrefix(dim, GroupByMetadataPrefix):
+			key := strings.TrimPrefix(dim, GroupByMetadataPrefix)
+			if value, ok := record.Metadata[key]; ok {
+				groupKey := fmt.Sprintf("%v", value)
+				groups[groupKey] = append(groups[groupKey], record)
+			}
+		}
+	}
+
+	return groups
+}
+
+// windowRecords splits records into tumbling or sliding windows over Date.
+// Windows are aligned to multiples of the slide and gaps are reported with a
+// zero count so the output forms a continuous time series.
+func (a *Aggregator) windowRecords(series string, records []Record) []WindowResult {
+	if len(records) == 0 {
+		return nil
+	}
+
+	sorted := make([]Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	size := a.config.WindowSize
+	slide := a.config.WindowSlide
+	first := sorted[0].Date.UTC()
+	last := sorted[len(sorted)-1].Date.UTC()
+
+	// Step back to the earliest aligned window that still contains the first record
+	start := first.Truncate(slide)
+	for start.Add(-slide).Add(size).After(first) {
+		start = start.Add(-slide)
+	}
+
+	var windows []WindowResult
+	lo := 0
+	for ; !start.After(last); start = start.Add(slide) {
+		end := start.Add(size)
+
+		// Records are sorted, so advance the lower bound monotonically
+		for lo < len(sorted) && sorted[lo].Date.Before(start) {
+			lo++
+		}
+		hi := lo
+		for hi < len(sorted) && sorted[hi].Date.Before(end) {
+			hi++
+		}
+
+		windows = append(windows, WindowResult{
+			Series: series,
+			Start:  start,
+			End:    end,
+			Stats:  a.computeStats(sorted[lo:hi]),
+		})
+	}
+
+	return windows
+}
+
+// computeStats calculates the aggregate statistics of a set of records
+func (a *Aggregator) computeStats(records []Record) AggregateStats {
+	stats := AggregateStats{
+		Count: len(records),
+		DistinctCounts: map[string]int{
+			"names":      0,
+			"categories": 0,
+			"tags":       0,
+		},
+	}
+
+	if len(records) == 0 {
+		return stats
+	}
+
+	names := make(map[string]bool)
+	categories := make(map[string]bool)
+	tags := make(map[string]bool)
+	values := make([]float64, 0, len(records))
+
+	for _, record := range records {
+		stats.Sum += record.Value
+		values = append(values, record.Value)
+		names[record.Name] = true
+		categories[record.Category] = true
+		for _, tag := range record.Tags {
+			tags[tag] = true
+		}
+	}
+
+	sort.Float64s(values)
+	stats.Mean = stats.Sum / float64(len(values))
+	stats.Min = values[0]
+	stats.Max = values[len(values)-1]
+	stats.DistinctCounts["names"] = len(names)
+	stats.DistinctCounts["categories"] = len(categories)
+	stats.DistinctCounts["tags"] = len(tags)
+
+	if len(a.config.Percentiles) > 0 {
+		stats.Percentiles = make(map[string]float64, len(a.config.Percentiles))
+		for _, p := range a.config.Percentiles {
+			stats.Percentiles[percentileLabel(p)] = percentile(values, p)
+		}
+	}
+
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values using linear
+// interpolation between the closest ranks
+func percentile(values []float64, p float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	if n == 1 {
+		return values[0]
+	}
+
+	rank := p / 100 * float64(n-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return values[lower]
+	}
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
+
+// percentileLabel formats a percentile as a stable key such as p50 or p99.9
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// SaveJSON writes the aggregation result as a JSON document
+func (r *AggregationResult) SaveJSON(filename string) error {
+	return writeJSON(filename, r)
+}
+
+// SaveTimeSeriesJSON writes the windows grouped by series as a JSON document
+func (r *AggregationResult) SaveTimeSeriesJSON(filename string) error {
+	series := make(map[string][]WindowResult)
+	for _, window := range r.Windows {
+		series[window.Series] = append(series[window.Series], window)
+	}
+	return writeJSON(filename, series)
+}
+
+// SaveGroupsCSV writes one CSV row per group-by key
+func (r *AggregationResult) SaveGroupsCSV(filename string) error {
+	rows := make([][]string, 0, len(r.Groups))
+	for _, group := range r.Groups {
+		rows = append(rows, append([]string{group.Dimension, group.Key}, r.statsColumns(group.Stats)...))
+	}
+	return r.writeCSV(filename, []string{"dimension", "key"}, rows)
+}
+
+// SaveTimeSeriesCSV writes one CSV row per window
+func (r *AggregationResult) SaveTimeSeriesCSV(filename string) error {
+	rows := make([][]string, 0, len(r.Windows))
+	for _, window := range r.Windows {
+		prefix := []string{window.Series, window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339)}
+		rows = append(rows, append(prefix, r.statsColumns(window.Stats)...))
+	}
+	return r.writeCSV(filename, []string{"series", "window_start", "window_end"}, rows)
+}
+
+// writeCSV writes rows under the given leading columns plus the stats columns
+func (r *AggregationResult) writeCSV(filename string, leading []string, rows [][]string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := append(leading, "count", "sum", "mean", "min", "max")
+	for _, p := range r.Config.Percentiles {
+		header = append(header, percentileLabel(p))
+	}
+	header = append(header, "distinct_names", "distinct_categories", "distinct_tags")
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// statsColumns flattens stats into CSV columns matching writeCSV's header
+func (r *AggregationResult) statsColumns(stats AggregateStats) []string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	columns := []string{
+		strconv.Itoa(stats.Count),
+		format(stats.Sum),
+		format(stats.Mean),
+		format(stats.Min),
+		format(stats.Max),
+	}
+	for _, p := range r.Config.Percentiles {
+		value := ""
+		if v, ok := stats.Percentiles[percentileLabel(p)]; ok {
+			value = format(v)
+		}
+		columns = append(columns, value)
+	}
+	columns = append(columns,
+		strconv.Itoa(stats.DistinctCounts["names"]),
+		strconv.Itoa(stats.DistinctCounts["categories"]),
+		strconv.Itoa(stats.DistinctCounts["tags"]),
+	)
+
+	return columns
+}
+
+// Export writes JSON and CSV outputs for the aggregation into outputDir
+func (r *AggregationResult) Export(outputDir string) ([]string, error) {
+	var written []string
+
+	jsonFile := filepath.Join(outputDir, "aggregations.json")
+	if err := r.SaveJSON(jsonFile); err != nil {
+		return written, fmt.Errorf("failed to save aggregations: %v", err)
+	}
+	written = append(written, jsonFile)
+
+	if len(r.Groups) > 0 {
+		groupsFile := filepath.Join(outputDir, "group_stats.csv")
+		if err := r.SaveGroupsCSV(groupsFile); err != nil {
+			return written, fmt.Errorf("failed to save group stats: %v", err)
+		}
+		written = append(written, groupsFile)
+	}
+
+	if len(r.Windows) > 0 {
+		seriesJSON := filepath.Join(outputDir, "timeseries.json")
+		if err := r.SaveTimeSeriesJSON(seriesJSON); err != nil {
+			return written, fmt.Errorf("failed to save time series: %v", err)
+		}
+		written = append(written, seriesJSON)
+
+		seriesCSV := filepath.Join(outputDir, "timeseries.csv")
+		if err := r.SaveTimeSeriesCSV(seriesCSV); err != nil {
+			return written, fmt.Errorf("failed to save time series: %v", err)
+		}
+		written = append(written, seriesCSV)
+	}
+
+	return written, nil
+}
+
+// ParseAggregationConfig builds an aggregation config from string settings,
+// as read from the environment
+func ParseAggregationConfig(groupBy, windowSize, windowSlide, percentiles string) (AggregationConfig, error) {
+	config := AggregationConfig{}
+
+	for _, dim := range strings.Split(groupBy, ",") {
+		if dim = strings.TrimSpace(dim); dim != "" {
+			config.GroupBy = append(config.GroupBy, dim)
+		}
+	}
+
+	var err error
+	if config.WindowSize, err = parseWindowDuration(windowSize); err != nil {
+		return config, fmt.Errorf("invalid window size: %v", err)
+	}
+	if config.WindowSlide, err = parseWindowDuration(windowSlide); err != nil {
+		return config, fmt.Errorf("invalid window slide: %v", err)
+	}
+
+	for _, p := range strings.Split(percentiles, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid percentile %q: %v", p, err)
+		}
+		config.Percentiles = append(config.Percentiles, value)
+	}
+
+	return config, nil
+}
+
+// parseWindowDuration extends time.ParseDuration with d (day) and w (week) units
+func parseWindowDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(value, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	return time.ParseDuration(value)
+}
+
+// writeJSON writes v as indented JSON to filename
+func writeJSON(filename string, v interface{}) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
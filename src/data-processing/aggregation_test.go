@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{10, 20, 30, 40, 50}
+
+	tests := []struct {
+		p        float64
+		expected float64
+	}{
+		{0, 10},
+		{50, 30},
+		{90, 46},
+		{100, 50},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.expected {
+			t.Errorf("percentile(%v) = %v; want %v", tt.p, got, tt.expected)
+		}
+	}
+}
+
+func TestAggregateGroupBy(t *testing.T) {
+	aggregator, err := NewAggregator(AggregationConfig{
+		GroupBy:     []string{GroupByCategory, GroupByTag, "metadata:region"},
+		Percentiles: []float64{50},
+	})
+	if err != nil {
+		t.Fatalf("NewAggregator failed: %v", err)
+	}
+
+	records := []Record{
+		{Name: "a", Category: "books", Value: 10, Tags: []string{"new", "new"}, Metadata: map[string]interface{}{"region": "eu"}},
+		{Name: "b", Category: "books", Value: 30, Tags: []string{"sale"}},
+		{Name: "c", Category: "games", Value: 5, Tags: []string{"new"}, Metadata: map[string]interface{}{"region": "us"}},
+	}
+
+	result := aggregator.Aggregate(records)
+
+	stats := make(map[string]AggregateStats)
+	for _, group := range result.Groups {
+		stats[group.Dimension+"="+group.Key] = group.Stats
+	}
+
+	books := stats["category=books"]
+	if books.Count != 2 || books.Sum != 40 || books.Mean != 20 || books.Min != 10 || books.Max != 30 {
+		t.Errorf("unexpected books stats: %+v", books)
+	}
+	if books.Percentiles["p50"] != 20 {
+		t.Errorf("books p50 = %v; want 20", books.Percentiles["p50"])
+	}
+	if books.DistinctCounts["tags"] != 2 {
+		t.Errorf("books distinct tags = %d; want 2", books.DistinctCounts["tags"])
+	}
+
+	// Duplicate tags on one record must only count once
+	if got := stats["tag=new"].Count; got != 2 {
+		t.Errorf("tag=new count = %d; want 2", got)
+	}
+	if got := stats["metadata:region=eu"].Count; got != 1 {
+		t.Errorf("metadata:region=eu count = %d; want 1", got)
+	}
+	if _, ok := stats["metadata:region="]; ok {
+		t.Errorf("records without the metadata key must not be grouped")
+	}
+}
+
+func TestAggregateWindows(t *testing.T) {
+	day := 24 * time.Hour
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Name: "a", Value: 1, Date: base.Add(1 * time.Hour)},
+		{Name: "b", Value: 2, Date: base.Add(25 * time.Hour)},
+		{Name: "c", Value: 3, Date: base.Add(73 * time.Hour)},
+		{Name: "undated", Value: 100},
+	}
+
+	tests := []struct {
+		name   string
+		size   time.Duration
+		slide  time.Duration
+		counts []int
+	}{
+		{"tumbling", day, 0, []int{1, 1, 0, 1}},
+		{"sliding", 2 * day, day, []int{1, 2, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregator, err := NewAggregator(AggregationConfig{WindowSize: tt.size, WindowSlide: tt.slide})
+			if err != nil {
+				t.Fatalf("NewAggregator failed: %v", err)
+			}
+
+			result := aggregator.Aggregate(records)
+			if result.UndatedRecords != 1 {
+				t.Errorf("undated records = %d; want 1", result.UndatedRecords)
+			}
+			if len(result.Windows) != len(tt.counts) {
+				t.Fatalf("got %d windows; want %d", len(result.Windows), len(tt.counts))
+			}
+			for i, window := range result.Windows {
+				if window.Stats.Count != tt.counts[i] {
+					t.Errorf("window %d (%v) count = %d; want %d", i, window.Start, window.Stats.Count, tt.counts[i])
+				}
+				if window.End.Sub(window.Start) != tt.size {
+					t.Errorf("window %d has length %v; want %v", i, window.End.Sub(window.Start), tt.size)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAggregationConfig(t *testing.T) {
+	config, err := ParseAggregationConfig("category, tag", "1w", "1d", "50,99.9")
+	if err != nil {
+		t.Fatalf("ParseAggregationConfig failed: %v", err)
+	}
+	if len(config.GroupBy) != 2 || config.GroupBy[1] != "tag" {
+		t.Errorf("unexpected group-by: %v", config.GroupBy)
+	}
+	if config.WindowSize != 7*24*time.Hour || config.WindowSlide != 24*time.Hour {
+		t.Errorf("unexpected window: size=%v slide=%v", config.WindowSize, config.WindowSlide)
+	}
+	if percentileLabel(config.Percentiles[1]) != "p99.9" {
+		t.Errorf("unexpected percentile label: %s", percentileLabel(config.Percentiles[1]))
+	}
+
+	if _, err := NewAggregator(AggregationConfig{GroupBy: []string{"color"}}); err == nil {
+		t.Errorf("expected error for unsupported dimension")
+	}
+	if _, err := NewAggregator(AggregationConfig{WindowSize: time.Hour, WindowSlide: 2 * time.Hour}); err == nil {
+		t.Errorf("expected error for slide larger than size")
+	}
+}
@@ -40,6 +40,9 @@ type ProcessingResult struct {
 	Statistics       map[string]float64             `json:"statistics"`
 	TimeTaken        time.Duration                  `json:"time_taken"`
 	Errors           []string                       `json:"errors,omitempty"`
+	Aggregations     *AggregationResult             `json:"aggregations,omitempty"`
+
+	records []Record // raw records kept for group-by and window aggregation
 }
 
 // DataProcessor handles data processing operations
@@ -48,6 +51,7 @@ type DataProcessor struct {
 	outputDir   string
 	concurrency int
 	logger      *log.Logger
+	aggregator  *Aggregator
 }
 
 // NewDataProcessor creates a new data processor
@@ -60,6 +64,16 @@ func NewDataProcessor(inputDir, outputDir string, concurrency int) *DataProcesso
 	}
 }
 
+// EnableAggregation turns on group-by and windowed statistics for ProcessFiles
+func (dp *DataProcessor) EnableAggregation(config AggregationConfig) error {
+	aggregator, err := NewAggregator(config)
+	if err != nil {
+		return err
+	}
+	dp.aggregator = aggregator
+	return nil
+}
+
 // ProcessFiles processes all files in the input directory
 func (dp *DataProcessor) ProcessFiles(ctx context.Context) (*ProcessingResult, error) {
 	start := time.Now()
@@ -120,10 +134,18 @@ func (dp *DataProcessor) ProcessFiles(ctx context.Context) (*ProcessingResult, e
 		
 		// Merge errors
 		result.Errors = append(result.Errors, fileResult.Errors...)
+
+		// Keep records only when they are needed for aggregation
+		if dp.aggregator != nil {
+			result.records = append(result.records, fileResult.records...)
+		}
 	}
 
 	// Calculate statistics
 	dp.calculateStatistics(result)
+	if dp.aggregator != nil {
+		result.Aggregations = dp.aggregator.Aggregate(result.records)
+	}
 	result.TimeTaken = time.Since(start)
 
 	dp.logger.Printf("Processing completed in %v", result.TimeTaken)
@@ -184,6 +206,7 @@ func (dp *DataProcessor) processFile(filePath string) (*ProcessingResult, error)
 
 	// Process and analyze records
 	result := dp.analyzeRecords(records)
+	result.records = records
 	
 	// Save processed data
 	outputFile := filepath.Join(dp.outputDir, 
@@ -541,6 +564,22 @@ func main() {
 	// Create processor
 	processor := NewDataProcessor(inputDir, outputDir, concurrency)
 
+	// Configure optional group-by and time-window aggregation
+	aggConfig, err := ParseAggregationConfig(
+		getEnv("GROUP_BY", ""),
+		getEnv("WINDOW_SIZE", ""),
+		getEnv("WINDOW_SLIDE", ""),
+		getEnv("PERCENTILES", "50,90,99"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid aggregation config: %v", err)
+	}
+	if len(aggConfig.GroupBy) > 0 || aggConfig.WindowSize > 0 {
+		if err := processor.EnableAggregation(aggConfig); err != nil {
+			log.Fatalf("Invalid aggregation config: %v", err)
+		}
+	}
+
 	// Generate sample data if requested
 	if generateSample {
 		if err := processor.GenerateSampleData(); err != nil {
@@ -572,6 +611,26 @@ func main() {
 		fmt.Printf("  %s: %.2f\n", stat, value)
 	}
 
+	if result.Aggregations != nil {
+		fmt.Printf("\nGroups:\n")
+		for _, group := range result.Aggregations.Groups {
+			fmt.Printf("  %s=%s: count=%d sum=%.2f mean=%.2f min=%.2f max=%.2f\n",
+				group.Dimension, group.Key, group.Stats.Count, group.Stats.Sum,
+				group.Stats.Mean, group.Stats.Min, group.Stats.Max)
+		}
+		if len(result.Aggregations.Windows) > 0 {
+			fmt.Printf("\nTime Windows: %d\n", len(result.Aggregations.Windows))
+		}
+
+		files, err := result.Aggregations.Export(outputDir)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		for _, file := range files {
+			fmt.Printf("Aggregations saved to: %s\n", file)
+		}
+	}
+
 	if len(result.Errors) > 0 {
 		fmt.Printf("\nErrors:\n")
 		for _, err := range result.Errors {
@@ -3,17 +3,24 @@ package main
 import (
 	"context"
 	"fmt"
+	"html/template"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/sirupsen/logrus"
+
+	"echo-example/ratelimit"
 )
 
 // User represents a user entity
@@ -29,12 +36,18 @@ type Response struct {
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Errors  []string    `json:"errors,omitempty"`
 }
 
 // Server wraps the Echo instance with dependencies
 type Server struct {
-	echo   *echo.Echo
-	logger *logrus.Logger
+	echo       *echo.Echo
+	logger     *logrus.Logger
+	spec       *openapi3.T
+	specRouter routers.Router
+	limiter    *ratelimit.Limiter
+	// strictResponses turns responses that break the spec into errors
+	strictResponses bool
 }
 
 // In-memory user storage for demo
@@ -51,8 +64,11 @@ func main() {
 	}
 
 	// Initialize server
-	server := NewServer()
-	
+	server, err := NewServer()
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+
 	// Setup routes
 	server.setupRoutes()
 	
@@ -61,7 +77,12 @@ func main() {
 }
 
 // NewServer creates a new server instance
-func NewServer() *Server {
+func NewServer() (*Server, error) {
+	spec, specRouter, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
+
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	
@@ -70,13 +91,28 @@ func NewServer() *Server {
 		logger.SetLevel(level)
 	}
 
+	limiter, err := newRateLimiter(os.Getenv("RATE_LIMIT_CONFIG"))
+	if err != nil {
+		return nil, err
+	}
+	limiter.OnError = func(c echo.Context, err error) {
+		logger.WithError(err).Warn("Rate limit store unavailable, request not limited")
+	}
+
 	e := echo.New()
 	e.HideBanner = true
+	// Rate limits and logs use the peer address; X-Forwarded-For and
+	// X-Real-IP come from the client and can't be trusted
+	e.IPExtractor = echo.ExtractIPDirect()
 	
 	return &Server{
-		echo:   e,
-		logger: logger,
-	}
+		echo:            e,
+		logger:          logger,
+		spec:            spec,
+		specRouter:      specRouter,
+		limiter:         limiter,
+		strictResponses: getEnv("ENV", "development") != "production",
+	}, nil
 }
 
 // setupRoutes configures all routes and middleware
@@ -88,17 +124,26 @@ func (s *Server) setupRoutes() {
 	s.echo.Use(middleware.Secure())
 	s.echo.Use(middleware.RequestID())
 	
-	// Rate limiting
-	s.echo.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(10)))
+	// Rate limiting per API key, user or IP. Authentication middleware
+	// registered before this one marks the user with ratelimit.UserIDKey.
+	s.echo.Use(s.limiter.Middleware())
 
 	// Custom middleware for structured logging
 	s.echo.Use(s.structuredLoggingMiddleware())
 
+	// Requests and responses must match openapi.yaml
+	s.echo.Use(s.openAPIMiddleware())
+
 	// Root route
 	s.echo.GET("/", s.homeHandler)
 	
 	// Health check
 	s.echo.GET("/health", s.healthHandler)
+
+	// API documentation
+	s.echo.GET("/openapi.yaml", s.specHandler)
+	s.echo.GET("/openapi.json", s.specJSONHandler)
+	s.echo.GET("/docs", s.docsHandler)
 	
 	// API v1 routes
 	api := s.echo.Group("/api/v1")
@@ -121,6 +166,23 @@ func (s *Server) setupRoutes() {
 	s.echo.Static("/static", "static")
 }
 
+// newRateLimiter builds the rate limiter from the config file at path, or
+// the defaults when there is none
+func newRateLimiter(path string) (*ratelimit.Limiter, error) {
+	config := ratelimit.DefaultConfig()
+	if path != "" {
+		var err error
+		if config, err = ratelimit.LoadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	store, err := ratelimit.NewStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.NewLimiter(store, config)
+}
+
 // Middleware functions
 
 // structuredLoggingMiddleware adds structured logging
@@ -151,9 +213,9 @@ func (s *Server) structuredLoggingMiddleware() echo.MiddlewareFunc {
 
 // Handler functions
 
-// homeHandler serves the home page
-func (s *Server) homeHandler(c echo.Context) error {
-	html := `
+// homeTemplate renders the home page; the endpoint list comes from the
+// OpenAPI spec
+var homeTemplate = template.Must(template.New("home").Parse(`
 <!DOCTYPE html>
 <html>
 <head>
@@ -186,37 +248,13 @@ func (s *Server) homeHandler(c echo.Context) error {
         
         <h2>API Endpoints</h2>
         
+        {{range .}}
         <div class="endpoint">
-            <span class="method">GET</span> <span class="url">/health</span> - Health check endpoint
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">GET</span> <span class="url">/api/v1/users</span> - Get all users
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">POST</span> <span class="url">/api/v1/users</span> - Create new user
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">GET</span> <span class="url">/api/v1/users/:id</span> - Get user by ID
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">PUT</span> <span class="url">/api/v1/users/:id</span> - Update user
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">DELETE</span> <span class="url">/api/v1/users/:id</span> - Delete user
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">GET</span> <span class="url">/api/v1/echo/:message</span> - Echo message
-        </div>
-        
-        <div class="endpoint">
-            <span class="method">POST</span> <span class="url">/api/v1/echo</span> - Echo POST data
+            <span class="method">{{.Method}}</span> <span class="url">{{.Path}}</span> - {{.Summary}}
         </div>
+        {{end}}
+
+        <p>Full documentation: <a href="/docs">Swagger UI</a> or the <a href="/openapi.yaml">OpenAPI spec</a>.</p>
         
         <h2>Quick Test</h2>
         <p>Try these links:</p>
@@ -239,8 +277,15 @@ func (s *Server) homeHandler(c echo.Context) error {
         </ul>
     </div>
 </body>
-</html>`
-	return c.HTML(http.StatusOK, html)
+</html>`))
+
+// homeHandler serves the home page
+func (s *Server) homeHandler(c echo.Context) error {
+	var page strings.Builder
+	if err := homeTemplate.Execute(&page, endpoints(s.spec)); err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, page.String())
 }
 
 // healthHandler provides health check
@@ -302,14 +347,6 @@ func (s *Server) createUserHandler(c echo.Context) error {
 		})
 	}
 
-	// Validate required fields
-	if user.Name == "" || user.Email == "" {
-		return c.JSON(http.StatusBadRequest, Response{
-			Success: false,
-			Error:   "Name and email are required",
-		})
-	}
-
 	// Assign ID and add user
 	user.ID = nextUserID
 	nextUserID++
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// The typed client in ./client is generated from the same spec
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.3.0 -generate types,client -package client -o client/client.gen.go openapi.yaml
+
+// openAPISpec is the API contract; requests and responses are validated
+// against it
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// validationOptions reports every problem at once and rejects responses
+// with undocumented status codes. The API key is optional and only selects
+// a rate limit tier, so it isn't checked here.
+var validationOptions = &openapi3filter.Options{
+	MultiError:            true,
+	IncludeResponseStatus: true,
+	AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+}
+
+func init() {
+	openapi3.DefineStringFormat("email", openapi3.FormatOfStringForEmail)
+}
+
+// loadSpec parses and checks the embedded OpenAPI document
+func loadSpec() (*openapi3.T, routers.Router, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+	return doc, router, nil
+}
+
+// openAPIMiddleware rejects requests that don't match the spec and checks
+// every response against it. A response that breaks the contract is logged
+// and, unless running in production, replaced by a 500 so it gets noticed.
+func (s *Server) openAPIMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route, pathParams, err := s.specRouter.FindRoute(req)
+			if err != nil {
+				// Not part of the API, e.g. the home page or static files
+				return next(c)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    validationOptions,
+			}
+			if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+				return c.JSON(http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Request does not match the API specification",
+					Errors:  validationMessages(err),
+				})
+			}
+
+			res := c.Response()
+			original := res.Writer
+			buffered := &bufferedResponse{ResponseWriter: original}
+			res.Writer = buffered
+			defer func() { res.Writer = original }()
+			if err := next(c); err != nil {
+				// Send what the handler wrote before failing; if it wrote
+				// nothing, Echo's error handler responds
+				buffered.flush()
+				return err
+			}
+
+			if buffered.status != 0 {
+				responseInput := &openapi3filter.ResponseValidationInput{
+					RequestValidationInput: input,
+					Status:                 buffered.status,
+					Header:                 original.Header(),
+					Options:                validationOptions,
+				}
+				responseInput.SetBodyBytes(buffered.body.Bytes())
+				if verr := openapi3filter.ValidateResponse(req.Context(), responseInput); verr != nil {
+					s.logger.WithFields(logrus.Fields{
+						"method":    req.Method,
+						"route":     route.Path,
+						"status":    buffered.status,
+						"violation": strings.Join(validationMessages(verr), "; "),
+					}).Error("Response does not match the API specification")
+
+					if s.strictResponses {
+						res.Status = http.StatusInternalServerError
+						return writeJSON(original, http.StatusInternalServerError, Response{
+							Success: false,
+							Error:   "Response does not match the API specification",
+						})
+					}
+				}
+			}
+			return buffered.flush()
+		}
+	}
+}
+
+// validationMessages flattens validation errors into one line per problem,
+// naming the offending field or parameter where there is one
+func validationMessages(err error) []string {
+	if requestErr, ok := err.(*openapi3filter.RequestError); ok && requestErr.Parameter != nil {
+		if requestErr.Err == nil {
+			return []string{requestErr.Parameter.Name + ": " + requestErr.Reason}
+		}
+		messages := validationMessages(requestErr.Err)
+		for i, message := range messages {
+			messages[i] = requestErr.Parameter.Name + ": " + message
+		}
+		return messages
+	}
+
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var messages []string
+		for _, e := range multi {
+			messages = append(messages, validationMessages(e)...)
+		}
+		return messages
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if field := strings.Join(schemaErr.JSONPointer(), "."); field != "" {
+			return []string{field + ": " + schemaErr.Reason}
+		}
+		return []string{schemaErr.Reason}
+	}
+	return []string{err.Error()}
+}
+
+// bufferedResponse holds a response back until it has been validated
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponse) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponse) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// flush sends the held response
+func (w *bufferedResponse) flush() error {
+	if w.status == 0 {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+// endpoint is one documented operation, as listed on the home page
+type endpoint struct {
+	Method  string
+	Path    string
+	Summary string
+}
+
+// methodOrder sorts operations on the same path
+var methodOrder = map[string]int{"GET": 0, "POST": 1, "PUT": 2, "PATCH": 3, "DELETE": 4}
+
+// endpoints lists the operations in the spec, sorted by path
+func endpoints(doc *openapi3.T) []endpoint {
+	var list []endpoint
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			list = append(list, endpoint{Method: method, Path: path, Summary: op.Summary})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return methodOrder[list[i].Method] < methodOrder[list[j].Method]
+	})
+	return list
+}
+
+// specHandler serves the OpenAPI document as written
+func (s *Server) specHandler(c echo.Context) error {
+	return c.Blob(http.StatusOK, "application/yaml", openAPISpec)
+}
+
+// specJSONHandler serves the OpenAPI document as JSON
+func (s *Server) specJSONHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.spec)
+}
+
+// docsHandler serves Swagger UI for the spec
+func (s *Server) docsHandler(c echo.Context) error {
+	return c.HTML(http.StatusOK, `<!DOCTYPE html>
+<html>
+<head>
+    <title>Echo Framework Example API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+    <script>
+        window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+    </script>
+</body>
+</html>`)
+}
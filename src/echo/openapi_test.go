@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"echo-example/client"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.logger.SetOutput(io.Discard)
+	server.echo.Logger.SetOutput(io.Discard)
+	return server
+}
+
+func TestRequestValidation(t *testing.T) {
+	server := newTestServer(t)
+	server.setupRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+		errors []string // substrings expected in the field errors
+	}{
+		{"missing fields", "POST", "/api/v1/users", `{}`, http.StatusBadRequest, []string{"name", "email"}},
+		{"invalid email", "POST", "/api/v1/users", `{"name":"Ann","email":"not-an-email"}`, http.StatusBadRequest, []string{"email"}},
+		{"unknown field", "POST", "/api/v1/users", `{"name":"Ann","email":"ann@example.com","admin":true}`, http.StatusBadRequest, []string{"admin"}},
+		{"non-numeric id", "GET", "/api/v1/users/abc", ``, http.StatusBadRequest, []string{"id"}},
+		{"update without name", "PUT", "/api/v1/users/1", `{"email":"john@example.com"}`, http.StatusBadRequest, []string{"name"}},
+		{"valid user", "POST", "/api/v1/users", `{"name":"Ann","email":"ann@example.com"}`, http.StatusCreated, nil},
+		{"unknown user", "GET", "/api/v1/users/999", ``, http.StatusNotFound, nil},
+		{"not in spec", "GET", "/", ``, http.StatusOK, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			server.echo.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d; want %d (%s)", rec.Code, tt.code, rec.Body)
+			}
+			var response Response
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			messages := strings.Join(response.Errors, "\n")
+			for _, want := range tt.errors {
+				if !strings.Contains(messages, want) {
+					t.Errorf("errors %q don't mention %q", response.Errors, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	server := newTestServer(t)
+	server.setupRoutes()
+
+	limited := false
+	for i := 0; i < 20 && !limited; i++ {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", i))
+		req.Header.Set(echo.HeaderXRealIP, fmt.Sprintf("198.51.100.%d", i))
+		rec := httptest.NewRecorder()
+		server.echo.ServeHTTP(rec, req)
+		limited = rec.Code == http.StatusTooManyRequests
+	}
+	if !limited {
+		t.Error("spoofed client IPs each got a fresh quota")
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		server := newTestServer(t)
+		server.strictResponses = strict
+		server.echo.Use(server.openAPIMiddleware())
+		// id must be an integer and email is required
+		server.echo.GET("/api/v1/users", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"success": true,
+				"data":    []map[string]interface{}{{"id": "one", "name": "Ann"}},
+			})
+		})
+
+		rec := httptest.NewRecorder()
+		server.echo.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users", nil))
+
+		want := http.StatusOK
+		if strict {
+			want = http.StatusInternalServerError
+		}
+		if rec.Code != want {
+			t.Errorf("strict=%v: status = %d; want %d", strict, rec.Code, want)
+		}
+		if !strict && !strings.Contains(rec.Body.String(), `"one"`) {
+			t.Errorf("response body was not passed through: %s", rec.Body)
+		}
+	}
+}
+
+func TestHandlerErrorsReachErrorHandler(t *testing.T) {
+	server := newTestServer(t)
+	server.echo.Use(server.openAPIMiddleware())
+	server.echo.GET("/api/v1/users/:id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such user")
+	})
+
+	rec := httptest.NewRecorder()
+	server.echo.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/7", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "no such user") {
+		t.Errorf("got %d %q; want the handler's 404", rec.Code, rec.Body)
+	}
+}
+
+func TestGeneratedClient(t *testing.T) {
+	server := newTestServer(t)
+	server.setupRoutes()
+	ts := httptest.NewServer(server.echo)
+	defer ts.Close()
+
+	api, err := client.NewClientWithResponses(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClientWithResponses failed: %v", err)
+	}
+	ctx := context.Background()
+
+	created, err := api.CreateUserWithResponse(ctx, client.UserInput{Name: "Grace", Email: "grace@example.com"})
+	if err != nil || created.JSON201 == nil {
+		t.Fatalf("CreateUser = %v, status %d: %s", err, created.StatusCode(), created.Body)
+	}
+
+	got, err := api.GetUserWithResponse(ctx, created.JSON201.Data.Id)
+	if err != nil || got.JSON200 == nil || got.JSON200.Data.Name != "Grace" {
+		t.Fatalf("GetUser = %v, %+v", err, got)
+	}
+
+	invalid, err := api.CreateUserWithResponse(ctx, client.UserInput{Name: "", Email: "grace@example.com"})
+	if err != nil || invalid.JSON400 == nil || invalid.JSON400.Errors == nil {
+		t.Fatalf("invalid CreateUser = %v, status %d: %s", err, invalid.StatusCode(), invalid.Body)
+	}
+
+	deleted, err := api.DeleteUserWithResponse(ctx, created.JSON201.Data.Id)
+	if err != nil || deleted.JSON200 == nil {
+		t.Fatalf("DeleteUser = %v, status %d", err, deleted.StatusCode())
+	}
+	if missing, _ := api.GetUserWithResponse(ctx, created.JSON201.Data.Id); missing.JSON404 == nil {
+		t.Errorf("deleted user returned %d", missing.StatusCode())
+	}
+}
+
+func TestSpecEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	server.setupRoutes()
+
+	for path, want := range map[string]string{
+		"/openapi.yaml": "operationId: createUser",
+		"/openapi.json": `"operationId":"createUser"`,
+		"/docs":         "swagger-ui",
+		"/":             "/api/v1/users/{id}",
+	} {
+		rec := httptest.NewRecorder()
+		server.echo.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET %s = %d, body missing %q", path, rec.Code, want)
+		}
+	}
+}
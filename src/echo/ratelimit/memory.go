@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many requests pass between removals of idle keys
+const sweepEvery = 1024
+
+// MemoryStore counts requests in this process only
+type MemoryStore struct {
+	algorithm Algorithm
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	calls   int
+}
+
+// memoryEntry is the state of one key; which fields are used depends on
+// the algorithm
+type memoryEntry struct {
+	tokens  float64
+	updated time.Time
+	log     []time.Time
+	// idle is when the entry is back to its initial state and can be dropped
+	idle time.Time
+}
+
+// NewMemoryStore creates a store using algorithm
+func NewMemoryStore(algorithm Algorithm) (*MemoryStore, error) {
+	if algorithm != TokenBucket && algorithm != SlidingWindowLog {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", algorithm)
+	}
+	return &MemoryStore{
+		algorithm: algorithm,
+		now:       time.Now,
+		entries:   make(map[string]*memoryEntry),
+	}, nil
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.calls++
+	if s.calls%sweepEvery == 0 {
+		for k, entry := range s.entries {
+			if !now.Before(entry.idle) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.idle) {
+		entry = &memoryEntry{tokens: float64(limit.Requests), updated: now}
+		s.entries[key] = entry
+	}
+	if s.algorithm == TokenBucket {
+		return entry.takeToken(now, limit), nil
+	}
+	return entry.logRequest(now, limit), nil
+}
+
+// takeToken refills the bucket for the time since the last request, then
+// takes a token if there is one
+func (e *memoryEntry) takeToken(now time.Time, limit Limit) Result {
+	interval := limit.Window / time.Duration(limit.Requests) // per token
+	capacity := float64(limit.Requests)
+
+	e.tokens = math.Min(capacity, e.tokens+float64(now.Sub(e.updated))/float64(interval))
+	e.updated = now
+
+	result := Result{Limit: limit.Requests}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - e.tokens) * float64(interval))
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = time.Duration((capacity - e.tokens) * float64(interval))
+	e.idle = now.Add(result.Reset)
+	return result
+}
+
+// logRequest drops requests older than the window, then records this one
+// if there is room
+func (e *memoryEntry) logRequest(now time.Time, limit Limit) Result {
+	start := now.Add(-limit.Window)
+	i := 0
+	for i < len(e.log) && !e.log[i].After(start) {
+		i++
+	}
+	e.log = e.log[i:]
+
+	result := Result{Limit: limit.Requests}
+	if len(e.log) < limit.Requests {
+		e.log = append(e.log, now)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = e.log[0].Add(limit.Window).Sub(now)
+	}
+	result.Remaining = limit.Requests - len(e.log)
+	if len(e.log) > 0 {
+		e.idle = e.log[len(e.log)-1].Add(limit.Window)
+		result.Reset = e.idle.Sub(now)
+	}
+	return result
+}
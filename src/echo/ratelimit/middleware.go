@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// APIKeyHeader carries the client's API key
+	APIKeyHeader = "X-API-Key"
+	// UserIDKey is the echo context key under which authentication
+	// middleware stores the signed-in user's ID once it has verified their
+	// credentials. Never set it from a header the client controls.
+	UserIDKey = "user_id"
+)
+
+// Limiter applies the configured tiers to requests
+type Limiter struct {
+	store  Store
+	config Config
+	// OnError is called when the store fails. The request is let through,
+	// so an unavailable store doesn't take the API down with it.
+	OnError func(c echo.Context, err error)
+}
+
+// NewLimiter creates a limiter counting in store
+func NewLimiter(store Store, config Config) (*Limiter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Limiter{store: store, config: config}, nil
+}
+
+// NewStore creates the store the config asks for
+func NewStore(config Config) (Store, error) {
+	if config.RedisURL == "" {
+		return NewMemoryStore(config.Algorithm)
+	}
+	options, err := redis.ParseURL(config.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis_url: %w", err)
+	}
+	return NewRedisStore(redis.NewClient(options), config.Algorithm, "ratelimit:")
+}
+
+// Identify returns the tier for a request and the key it is counted
+// under: a known API key, then the signed-in user in their configured tier,
+// then the client IP.
+// Unknown API keys count as anonymous so that made-up keys don't get a
+// fresh quota each.
+func (l *Limiter) Identify(c echo.Context) (tier, key string) {
+	if apiKey := c.Request().Header.Get(APIKeyHeader); apiKey != "" {
+		if tier, ok := l.config.APIKeys[apiKey]; ok {
+			// Keep API keys themselves out of the store
+			sum := sha256.Sum256([]byte(apiKey))
+			return tier, tier + ":key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	if userID := c.Get(UserIDKey); userID != nil {
+		id := fmt.Sprint(userID)
+		tier, ok := l.config.Users[id]
+		if !ok {
+			tier = TierAuthenticated
+		}
+		return tier, tier + ":user:" + id
+	}
+	return TierAnonymous, TierAnonymous + ":ip:" + c.RealIP()
+}
+
+// Middleware counts each request against its quota, sets the RateLimit-*
+// headers and answers 429 once the quota is used up
+func (l *Limiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tier, key := l.Identify(c)
+			limit := l.config.Tiers[tier]
+
+			result, err := l.store.Take(c.Request().Context(), key, limit)
+			if err != nil {
+				if l.OnError != nil {
+					l.OnError(c, err)
+				}
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, seconds(limit.Window)))
+			if !result.Allowed {
+				retryAfter := seconds(result.RetryAfter)
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds up to whole seconds, as the headers require
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
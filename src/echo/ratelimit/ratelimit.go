@@ -0,0 +1,135 @@
+// Package ratelimit limits requests per API key, user or client IP, with
+// tiered quotas and a pluggable store so limits can be shared between
+// server instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Algorithm selects how a store counts requests
+type Algorithm string
+
+const (
+	// TokenBucket refills Requests tokens evenly over Window and allows
+	// bursts of up to Requests
+	TokenBucket Algorithm = "token-bucket"
+	// SlidingWindowLog allows at most Requests in any Window, keeping the
+	// time of each request
+	SlidingWindowLog Algorithm = "sliding-window-log"
+)
+
+// Limit is a quota of Requests per Window
+type Limit struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+// Result is the outcome of counting one request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a request would be allowed, when denied
+	RetryAfter time.Duration
+	// Reset is how long until the full quota is available again
+	Reset time.Duration
+}
+
+// Store counts requests per key. Implementations must be safe for
+// concurrent use; a shared store such as Redis enforces one limit across
+// all server instances.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Config holds the rate limiting settings
+type Config struct {
+	Algorithm Algorithm `yaml:"algorithm"`
+	// RedisURL selects the Redis store, e.g. redis://localhost:6379/0;
+	// requests are counted in memory when empty
+	RedisURL string `yaml:"redis_url"`
+	// Tiers maps tier names to quotas. "anonymous" applies to clients
+	// identified by IP and "authenticated" to signed-in users.
+	Tiers map[string]Limit `yaml:"tiers"`
+	// APIKeys maps API keys to their tier
+	APIKeys map[string]string `yaml:"api_keys"`
+	// Users maps signed-in user IDs to a tier other than "authenticated"
+	Users map[string]string `yaml:"users"`
+}
+
+// Tiers every config must define
+const (
+	TierAnonymous     = "anonymous"
+	TierAuthenticated = "authenticated"
+)
+
+// DefaultConfig returns in-memory token buckets of 10 requests per second
+// for anonymous clients and 100 for signed-in users
+func DefaultConfig() Config {
+	return Config{
+		Algorithm: TokenBucket,
+		Tiers: map[string]Limit{
+			TierAnonymous:     {Requests: 10, Window: time.Second},
+			TierAuthenticated: {Requests: 100, Window: time.Second},
+		},
+	}
+}
+
+// LoadConfig reads a YAML config file. Tiers left out keep their defaults.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read rate limit config: %w", err)
+	}
+	var file Config
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return config, fmt.Errorf("failed to parse rate limit config: %w", err)
+	}
+
+	if file.Algorithm != "" {
+		config.Algorithm = file.Algorithm
+	}
+	config.RedisURL = file.RedisURL
+	for name, limit := range file.Tiers {
+		config.Tiers[name] = limit
+	}
+	config.APIKeys = file.APIKeys
+	config.Users = file.Users
+	return config, config.Validate()
+}
+
+// Validate checks that the algorithm is known, every quota is positive and
+// every API key and user has a defined tier
+func (c Config) Validate() error {
+	if c.Algorithm != TokenBucket && c.Algorithm != SlidingWindowLog {
+		return fmt.Errorf("unknown rate limit algorithm %q", c.Algorithm)
+	}
+	for _, name := range []string{TierAnonymous, TierAuthenticated} {
+		if _, ok := c.Tiers[name]; !ok {
+			return fmt.Errorf("rate limit tier %q is required", name)
+		}
+	}
+	for name, limit := range c.Tiers {
+		if limit.Requests <= 0 || limit.Window <= 0 {
+			return fmt.Errorf("rate limit tier %q needs positive requests and window", name)
+		}
+	}
+	for _, tier := range c.APIKeys {
+		if _, ok := c.Tiers[tier]; !ok {
+			return fmt.Errorf("API key assigned to undefined tier %q", tier)
+		}
+	}
+	for user, tier := range c.Users {
+		if _, ok := c.Tiers[tier]; !ok {
+			return fmt.Errorf("user %q assigned to undefined tier %q", user, tier)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// testClock is shared by a store and its test so time can be moved forward
+type testClock struct {
+	now     time.Time
+	advance func(d time.Duration)
+}
+
+// newTestStores returns every backend for algorithm, each with a clock
+func newTestStores(t *testing.T, algorithm Algorithm) map[string]func() (Store, *testClock) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return map[string]func() (Store, *testClock){
+		"memory": func() (Store, *testClock) {
+			store, err := NewMemoryStore(algorithm)
+			if err != nil {
+				t.Fatalf("NewMemoryStore failed: %v", err)
+			}
+			clock := &testClock{now: start}
+			clock.advance = func(d time.Duration) { clock.now = clock.now.Add(d) }
+			store.now = func() time.Time { return clock.now }
+			return store, clock
+		},
+		"redis": func() (Store, *testClock) {
+			server := miniredis.RunT(t)
+			server.SetTime(start)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { client.Close() })
+
+			store, err := NewRedisStore(client, algorithm, "test:")
+			if err != nil {
+				t.Fatalf("NewRedisStore failed: %v", err)
+			}
+			clock := &testClock{now: start}
+			clock.advance = func(d time.Duration) {
+				clock.now = clock.now.Add(d)
+				server.SetTime(clock.now)
+				server.FastForward(d)
+			}
+			return store, clock
+		},
+	}
+}
+
+func take(t *testing.T, store Store, key string, limit Limit) Result {
+	t.Helper()
+	result, err := store.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	return result
+}
+
+func TestTokenBucket(t *testing.T) {
+	limit := Limit{Requests: 5, Window: 10 * time.Second} // a token every 2s
+
+	for name, newStore := range newTestStores(t, TokenBucket) {
+		t.Run(name, func(t *testing.T) {
+			store, clock := newStore()
+
+			for i := 4; i >= 0; i-- {
+				if r := take(t, store, "a", limit); !r.Allowed || r.Remaining != i {
+					t.Fatalf("burst request: %+v; want allowed with %d remaining", r, i)
+				}
+			}
+			r := take(t, store, "a", limit)
+			if r.Allowed || r.RetryAfter != 2*time.Second || r.Reset != 10*time.Second {
+				t.Errorf("over limit: %+v; want denied, retry after 2s, reset 10s", r)
+			}
+			if r := take(t, store, "b", limit); !r.Allowed {
+				t.Errorf("other key limited: %+v", r)
+			}
+
+			clock.advance(3 * time.Second) // 1.5 tokens
+			if r := take(t, store, "a", limit); !r.Allowed || r.Remaining != 0 {
+				t.Errorf("after refill: %+v; want allowed with 0 remaining", r)
+			}
+			if r := take(t, store, "a", limit); r.Allowed || r.RetryAfter != time.Second {
+				t.Errorf("after refill used: %+v; want denied, retry after 1s", r)
+			}
+
+			clock.advance(time.Hour)
+			if r := take(t, store, "a", limit); !r.Allowed || r.Remaining != 4 {
+				t.Errorf("after idle: %+v; want a full bucket", r)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	limit := Limit{Requests: 3, Window: 10 * time.Second}
+
+	for name, newStore := range newTestStores(t, SlidingWindowLog) {
+		t.Run(name, func(t *testing.T) {
+			store, clock := newStore()
+
+			take(t, store, "a", limit)
+			clock.advance(4 * time.Second)
+			take(t, store, "a", limit)
+			if r := take(t, store, "a", limit); !r.Allowed || r.Remaining != 0 || r.Reset != 10*time.Second {
+				t.Fatalf("third request: %+v; want allowed, 0 remaining, reset 10s", r)
+			}
+			if r := take(t, store, "a", limit); r.Allowed || r.RetryAfter != 6*time.Second {
+				t.Errorf("over limit: %+v; want denied, retry after 6s", r)
+			}
+
+			// The first request leaves the window, the others don't
+			clock.advance(6 * time.Second)
+			if r := take(t, store, "a", limit); !r.Allowed || r.Remaining != 0 {
+				t.Errorf("after first expired: %+v; want allowed, 0 remaining", r)
+			}
+			if r := take(t, store, "a", limit); r.Allowed || r.RetryAfter != 4*time.Second {
+				t.Errorf("window full again: %+v; want denied, retry after 4s", r)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	os.WriteFile(path, []byte(`
+algorithm: sliding-window-log
+tiers:
+  anonymous: {requests: 2, window: 1m}
+  pro: {requests: 1000, window: 1m}
+api_keys:
+  pro-key: pro
+users:
+  "7": pro
+`), 0644)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.Algorithm != SlidingWindowLog || config.Tiers[TierAnonymous].Requests != 2 || config.Tiers[TierAuthenticated].Requests != 100 || config.Users["7"] != "pro" {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	os.WriteFile(path, []byte("api_keys:\n  key: enterprise\n"), 0644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("API key with an undefined tier accepted")
+	}
+	os.WriteFile(path, []byte("users:\n  \"7\": enterprise\n"), 0644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("user with an undefined tier accepted")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	config := DefaultConfig()
+	config.Tiers = map[string]Limit{
+		TierAnonymous:     {Requests: 1, Window: time.Minute},
+		TierAuthenticated: {Requests: 2, Window: time.Minute},
+		"pro":             {Requests: 3, Window: time.Minute},
+	}
+	config.APIKeys = map[string]string{"pro-key": "pro"}
+	config.Users = map[string]string{"7": "pro"}
+	store, _ := NewMemoryStore(config.Algorithm)
+	limiter, err := NewLimiter(store, config)
+	if err != nil {
+		t.Fatalf("NewLimiter failed: %v", err)
+	}
+
+	// Stands in for authentication middleware that verifies a session
+	sessions := map[string]int{"Bearer ada": 42, "Bearer grace": 7}
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if id, ok := sessions[c.Request().Header.Get(echo.HeaderAuthorization)]; ok {
+				c.Set(UserIDKey, id)
+			}
+			return next(c)
+		}
+	})
+	e.Use(limiter.Middleware())
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	// allowed counts the requests that get through out of n
+	allowed := func(n int, header, value string) (count int, last *httptest.ResponseRecorder) {
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			if header != "" {
+				req.Header.Set(header, value)
+			}
+			last = httptest.NewRecorder()
+			e.ServeHTTP(last, req)
+			if last.Code == http.StatusOK {
+				count++
+			}
+		}
+		return count, last
+	}
+
+	count, last := allowed(3, "", "")
+	if count != 1 || last.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous: %d allowed, last %d; want 1 allowed then 429", count, last.Code)
+	}
+	if last.Header().Get("Retry-After") != "60" || last.Header().Get("RateLimit-Policy") != "1;w=60" {
+		t.Errorf("429 headers: %v", last.Header())
+	}
+	if count, _ := allowed(3, echo.HeaderAuthorization, "Bearer ada"); count != 2 {
+		t.Errorf("user: %d allowed; want 2", count)
+	}
+	if count, last := allowed(4, echo.HeaderAuthorization, "Bearer grace"); count != 3 || last.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("pro user: %d allowed, limit %q; want 3", count, last.Header().Get("RateLimit-Limit"))
+	}
+	// A token nobody verified is just another anonymous request
+	if count, _ := allowed(1, echo.HeaderAuthorization, "Bearer mallory"); count != 0 {
+		t.Error("unverified token got its own quota")
+	}
+	if count, last := allowed(4, APIKeyHeader, "pro-key"); count != 3 || last.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("pro key: %d allowed, limit %q; want 3", count, last.Header().Get("RateLimit-Limit"))
+	}
+	// An unknown key is just another anonymous request from the same IP
+	if count, _ := allowed(1, APIKeyHeader, "made-up"); count != 0 {
+		t.Error("unknown API key got its own quota")
+	}
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Both scripts read the clock with TIME so that every server instance
+// agrees on it, and return {allowed, remaining, retry_after_us, reset_us}.
+
+// tokenBucketScript keeps the token count and the time it was computed in
+// a hash. ARGV: capacity, microseconds per token.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) / interval)
+
+local allowed, retry = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) * interval)
+end
+
+local reset = math.ceil((capacity - tokens) * interval)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(reset / 1000) + 1)
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// slidingLogScript keeps one sorted set member per request, scored by its
+// time. ARGV: limit, window in microseconds, unique member.
+var slidingLogScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed, retry = 0, 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[3])
+  count = count + 1
+  allowed = 1
+else
+  local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+  retry = tonumber(oldest[2]) + window - now
+end
+
+local reset = 0
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if newest[2] then
+  reset = tonumber(newest[2]) + window - now
+  redis.call('PEXPIRE', KEYS[1], math.ceil(reset / 1000) + 1)
+end
+return {allowed, limit - count, retry, reset}
+`)
+
+// RedisStore counts requests in Redis, or any server speaking the Redis
+// protocol with Lua scripting, so every instance shares the same limits
+type RedisStore struct {
+	client    redis.Scripter
+	algorithm Algorithm
+	prefix    string
+}
+
+// NewRedisStore creates a store using algorithm. Keys are prefixed with
+// prefix so several services can share a database.
+func NewRedisStore(client redis.Scripter, algorithm Algorithm, prefix string) (*RedisStore, error) {
+	if algorithm != TokenBucket && algorithm != SlidingWindowLog {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", algorithm)
+	}
+	return &RedisStore{client: client, algorithm: algorithm, prefix: prefix}, nil
+}
+
+// Take implements Store
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	keys := []string{s.prefix + key}
+	var reply []int64
+	var err error
+	if s.algorithm == TokenBucket {
+		interval := limit.Window.Microseconds() / int64(limit.Requests)
+		reply, err = tokenBucketScript.Run(ctx, s.client, keys, limit.Requests, interval).Int64Slice()
+	} else {
+		reply, err = slidingLogScript.Run(ctx, s.client, keys, limit.Requests, limit.Window.Microseconds(), uniqueMember()).Int64Slice()
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	if len(reply) != 4 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
+	}
+
+	return Result{
+		Allowed:    reply[0] == 1,
+		Limit:      limit.Requests,
+		Remaining:  int(reply[1]),
+		RetryAfter: time.Duration(reply[2]) * time.Microsecond,
+		Reset:      time.Duration(reply[3]) * time.Microsecond,
+	}, nil
+}
+
+// uniqueMember names a request in the sliding log; two requests in the
+// same microsecond must not collapse into one
+func uniqueMember() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,13 +1,16 @@
 module gobot
 
-go 1.17
+go 1.21
 
 require (
 	github.com/bwmarrin/discordgo v0.27.1
 	github.com/joho/godotenv v1.5.1
 	gobot.io/x/gobot v1.15.0
+	mesh v0.0.0
 )
 
+replace mesh => ../mesh
+
 require (
 	github.com/JuulLabs-OSS/cbgo v0.0.2 // indirect
 	github.com/creack/goselect v0.1.2 // indirect
@@ -26,8 +29,8 @@ require (
 	github.com/sigurn/utils v0.0.0-20190728110027-e1fefb11a144 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
 	go.bug.st/serial v1.3.3 // indirect
-	golang.org/x/crypto v0.1.0 // indirect
-	golang.org/x/sys v0.1.0 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 	periph.io/x/periph v3.6.2+incompatible // indirect
 	tinygo.org/x/bluetooth v0.4.0 // indirect
 )
@@ -3,13 +3,15 @@ package main
 import (
     "bufio"
     "fmt"
-    "net"
+    "log"
     "os"
     "strings"
 
     "gobot.io/x/gobot"
     "gobot.io/x/gobot/drivers/gpio"
     "gobot.io/x/gobot/platforms/raspi"
+
+    "mesh"
 )
 
 func main() {
@@ -17,10 +19,28 @@ func main() {
     adaptor := raspi.NewAdaptor()
     led := gpio.NewLedDriver(adaptor, "7") // Assuming an LED is connected to pin 7
 
+    // Join the mesh; other bots on the LAN are found by multicast
+    node, err := mesh.New(mesh.DefaultConfig(":7946"))
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer node.Close()
+    fmt.Println("Mesh node", node.ID(), "listening on", node.Addr())
+
     work := func() {
-        gobot.Every(gobot.Second, func() {
-            led.Toggle() // Toggle LED every second
-        })
+        // Any node can switch this bot's LED with "led on", "led off" or "led toggle"
+        for m := range node.Messages() {
+            switch strings.TrimSpace(string(m.Payload)) {
+            case "led on":
+                led.On()
+            case "led off":
+                led.Off()
+            case "led toggle":
+                led.Toggle()
+            default:
+                fmt.Printf("Received from %s (%d hops): %s\n", m.From, m.Hops, m.Payload)
+            }
+        }
     }
 
     robot := gobot.NewRobot("bot",
@@ -30,59 +50,25 @@ func main() {
     )
 
     go robot.Start() // Start Gobot routine in a goroutine
-    go startServer() // Start TCP server
-    connectToPeer()  // Act as a TCP client
-
-    select {} // Prevent main from exiting
+    readCommands(node)
 }
 
-func startServer() {
-    listener, err := net.Listen("tcp", ":8080")
-    if err != nil {
-        fmt.Println("Error starting server:", err)
-        return
-    }
-    defer listener.Close()
-    fmt.Println("Server started on :8080")
-
-    for {
-        conn, err := listener.Accept()
-        if err != nil {
-            fmt.Println("Error accepting connection:", err)
+// readCommands broadcasts typed lines; "/to <id> <text>" sends to one bot
+func readCommands(node *mesh.Node) {
+    scanner := bufio.NewScanner(os.Stdin)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if strings.HasPrefix(line, "/to ") {
+            fields := strings.SplitN(strings.TrimPrefix(line, "/to "), " ", 2)
+            if len(fields) == 2 {
+                if err := node.Send(mesh.NodeID(fields[0]), []byte(fields[1])); err != nil {
+                    fmt.Println("Error sending:", err)
+                }
+            }
             continue
         }
-        go handleConnection(conn)
-    }
-}
-
-func connectToPeer() {
-    fmt.Print("Enter peer address (or 'none' to skip): ")
-    reader := bufio.NewReader(os.Stdin)
-    address, _ := reader.ReadString('\n')
-    address = strings.TrimSpace(address)
-
-    if address != "none" {
-        conn, err := net.Dial("tcp", address)
-        if err != nil {
-            fmt.Println("Error connecting to peer:", err)
-            return
-        }
-        defer conn.Close()
-        fmt.Println("Connected to peer", address)
-
-        for {
-            text, _ := reader.ReadString('\n')
-            fmt.Fprint(conn, text)
+        if line != "" {
+            node.Broadcast([]byte(line))
         }
     }
 }
-
-func handleConnection(conn net.Conn) {
-    defer conn.Close()
-    fmt.Println("Connected from", conn.RemoteAddr().String())
-    scanner := bufio.NewScanner(conn)
-    for scanner.Scan() {
-        message := scanner.Text()
-        fmt.Println("Received:", message)
-    }
-}
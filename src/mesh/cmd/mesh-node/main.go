@@ -0,0 +1,124 @@
+// Command mesh-node joins a mesh and chats over it. Lines typed on stdin
+// are broadcast to every node; "/to <id> <text>" sends to one node and
+// "/members" lists the mesh as this node sees it.
+package main
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"mesh"
+)
+
+func main() {
+	defaults := mesh.DefaultConfig(":7946")
+	bind := flag.String("bind", defaults.BindAddr, "UDP address to listen on")
+	id := flag.String("id", "", "node ID, random if empty")
+	advertise := flag.String("advertise", "", "address other nodes should use, if not the bound one")
+	multicast := flag.String("multicast", defaults.MulticastAddr, "multicast group for LAN discovery, empty to disable")
+	seeds := flag.String("join", "", "comma-separated addresses of nodes to join")
+	keyFile := flag.String("key", "", "file holding this node's private key, created if missing; enables encryption")
+	trustFile := flag.String("trust", "", "file listing the public keys of trusted nodes, one per line")
+	verbose := flag.Bool("v", false, "log protocol errors")
+	flag.Parse()
+
+	config := defaults
+	config.BindAddr = *bind
+	config.ID = mesh.NodeID(*id)
+	config.AdvertiseAddr = *advertise
+	config.MulticastAddr = *multicast
+	if *verbose {
+		config.Logger = log.Default()
+	}
+	if *keyFile != "" {
+		security, err := loadSecurity(*keyFile, *trustFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Security = security
+	}
+	node, err := mesh.New(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("node %s listening on %s\n", node.ID(), node.Addr())
+
+	if *seeds != "" {
+		if err := node.Join(strings.Split(*seeds, ",")...); err != nil {
+			log.Printf("failed to join: %v", err)
+		}
+	}
+
+	go func() {
+		for m := range node.Messages() {
+			if m.From == node.ID() {
+				continue
+			}
+			kind := "broadcast"
+			if m.To != "" {
+				kind = "direct"
+			}
+			fmt.Printf("[%s from %s, %d hops] %s\n", kind, m.From, m.Hops, m.Payload)
+		}
+	}()
+	go readCommands(node)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	node.Close()
+}
+
+// loadSecurity reads the node's key and the keys it trusts. The node's own
+// key is always trusted, so nodes may share one.
+func loadSecurity(keyFile, trustFile string) (*mesh.Security, error) {
+	key, err := mesh.LoadOrCreateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("public key %s\n", mesh.PublicKeyString(key.PublicKey()))
+	trusted := []*ecdh.PublicKey{key.PublicKey()}
+	if trustFile != "" {
+		keys, err := mesh.LoadTrustedKeys(trustFile)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, keys...)
+	}
+	return &mesh.Security{Key: key, Trusted: trusted}, nil
+}
+
+// readCommands sends what is typed on stdin
+func readCommands(node *mesh.Node) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case line == "/members":
+			for _, m := range node.Members() {
+				fmt.Printf("%-20s %-8s hops=%-3d neighbor=%-5v %s\n", m.ID, m.State, m.Hops, m.Neighbor, m.Addr)
+			}
+		case strings.HasPrefix(line, "/to "):
+			fields := strings.SplitN(strings.TrimPrefix(line, "/to "), " ", 2)
+			if len(fields) != 2 {
+				fmt.Println("usage: /to <id> <text>")
+				continue
+			}
+			if err := node.Send(mesh.NodeID(fields[0]), []byte(fields[1])); err != nil {
+				fmt.Println("send failed:", err)
+			}
+		default:
+			if err := node.Broadcast([]byte(line)); err != nil {
+				fmt.Println("broadcast failed:", err)
+			}
+		}
+	}
+}
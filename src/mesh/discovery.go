@@ -0,0 +1,72 @@
+package mesh
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// startDiscovery joins the multicast group and starts announcing this node.
+// Nodes that hear an announcement ping its sender, which makes them
+// neighbors.
+func (n *Node) startDiscovery() error {
+	group, err := net.ResolveUDPAddr("udp4", n.config.MulticastAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve multicast group: %w", err)
+	}
+	mcast, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("failed to join multicast group: %w", err)
+	}
+	n.group = group
+	n.mcast = mcast
+
+	n.wg.Add(2)
+	go n.listenDiscovery()
+	go n.announce()
+	return nil
+}
+
+// announce sends a beacon from the node's own socket, so listeners learn
+// the address to ping from the datagram's source
+func (n *Node) announce() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.config.DiscoveryInterval)
+	defer ticker.Stop()
+	for {
+		if err := n.send(n.group, &Frame{Type: FrameAnnounce}); err != nil {
+			n.config.Logger.Printf("mesh: announce failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *Node) listenDiscovery() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacket)
+	for {
+		size, from, err := n.mcast.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+			n.config.Logger.Printf("mesh: discovery read failed: %v", err)
+			continue
+		}
+		frame, err := DecodeFrame(append([]byte(nil), buf[:size]...))
+		if err != nil || frame.Type != FrameAnnounce {
+			continue
+		}
+		if n.config.Security != nil {
+			// Unauthenticated, so only good for a ping that starts a handshake
+			frame.Updates = nil
+		}
+		n.handle(frame, from)
+	}
+}
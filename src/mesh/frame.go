@@ -0,0 +1,195 @@
+package mesh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// FrameType identifies what a frame carries
+type FrameType uint8
+
+const (
+	FramePing     FrameType = iota + 1 // probe; answered with an ack
+	FrameAck                           // answer to a ping, possibly relayed
+	FramePingReq                       // ask a neighbor to probe a target for us
+	FrameRoutes                        // the sender's distance vector
+	FrameData                          // application payload
+	FrameAnnounce                      // multicast discovery beacon
+)
+
+// Frames start with a magic number and version
+const (
+	magic   = 0x4d4e // "MN"
+	version = 1
+)
+
+// MaxPayload is the largest application payload that fits in one datagram
+// alongside the header and piggybacked gossip
+const MaxPayload = 60000
+
+// maxPacket is the largest UDP payload over IPv4
+const maxPacket = 65507
+
+// maxFrame leaves room in a datagram for the secure transport's header
+const maxFrame = maxPacket - transportOverhead
+
+// ErrBadFrame is returned for datagrams that aren't valid mesh frames
+var ErrBadFrame = errors.New("malformed frame")
+
+// Frame is the unit sent between nodes. From is the node that sent this
+// datagram; for data frames Origin is the node that created the message and
+// Target the node it is for, empty for a broadcast.
+type Frame struct {
+	Type    FrameType
+	TTL     uint8
+	Seq     uint32
+	From    NodeID
+	Origin  NodeID
+	Target  NodeID
+	Payload []byte
+	Updates []Update
+	Routes  []Route
+}
+
+// Update is a piece of membership gossip about one node
+type Update struct {
+	ID          NodeID
+	Addr        string
+	Incarnation uint64
+	State       State
+}
+
+// Route advertises that the sender reaches ID in Hops hops
+type Route struct {
+	ID   NodeID
+	Hops uint8
+}
+
+// Encode serializes the frame. Strings are at most 255 bytes.
+func (f *Frame) Encode() ([]byte, error) {
+	if len(f.Payload) > MaxPayload {
+		return nil, fmt.Errorf("payload of %d bytes is over the %d byte limit", len(f.Payload), MaxPayload)
+	}
+	buf := make([]byte, 0, 64+len(f.Payload))
+	buf = binary.BigEndian.AppendUint16(buf, magic)
+	buf = append(buf, version, byte(f.Type), f.TTL)
+	buf = binary.BigEndian.AppendUint32(buf, f.Seq)
+	var err error
+	for _, s := range []string{string(f.From), string(f.Origin), string(f.Target)} {
+		if buf, err = appendString(buf, s); err != nil {
+			return nil, err
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(f.Payload)))
+	buf = append(buf, f.Payload...)
+
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(f.Updates)))
+	for _, u := range f.Updates {
+		if buf, err = appendString(buf, string(u.ID)); err != nil {
+			return nil, err
+		}
+		if buf, err = appendString(buf, u.Addr); err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint64(buf, u.Incarnation)
+		buf = append(buf, byte(u.State))
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(f.Routes)))
+	for _, r := range f.Routes {
+		if buf, err = appendString(buf, string(r.ID)); err != nil {
+			return nil, err
+		}
+		buf = append(buf, r.Hops)
+	}
+	if len(buf) > maxFrame {
+		return nil, fmt.Errorf("frame of %d bytes is over the %d byte limit", len(buf), maxFrame)
+	}
+	return buf, nil
+}
+
+func appendString(buf []byte, s string) ([]byte, error) {
+	if len(s) > 255 {
+		return nil, fmt.Errorf("field %q is over 255 bytes", s[:16])
+	}
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...), nil
+}
+
+// DecodeFrame parses a datagram
+func DecodeFrame(data []byte) (*Frame, error) {
+	r := reader{data: data}
+	if r.uint16() != magic || r.byte() != version {
+		return nil, ErrBadFrame
+	}
+	f := &Frame{Type: FrameType(r.byte()), TTL: r.byte(), Seq: r.uint32()}
+	f.From = NodeID(r.string())
+	f.Origin = NodeID(r.string())
+	f.Target = NodeID(r.string())
+	if n := r.uint32(); n > 0 {
+		f.Payload = r.bytes(int(n))
+	}
+	for n := r.uint16(); n > 0 && r.err == nil; n-- {
+		f.Updates = append(f.Updates, Update{
+			ID:          NodeID(r.string()),
+			Addr:        r.string(),
+			Incarnation: r.uint64(),
+			State:       State(r.byte()),
+		})
+	}
+	for n := r.uint16(); n > 0 && r.err == nil; n-- {
+		f.Routes = append(f.Routes, Route{ID: NodeID(r.string()), Hops: r.byte()})
+	}
+	if r.err != nil || len(r.data) != 0 || f.From == "" {
+		return nil, ErrBadFrame
+	}
+	return f, nil
+}
+
+// reader consumes big endian fields, remembering the first short read
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = ErrBadFrame
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	return string(r.bytes(int(r.byte())))
+}
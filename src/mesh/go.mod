@@ -0,0 +1,7 @@
+module mesh
+
+go 1.21
+
+require golang.org/x/crypto v0.17.0
+
+require golang.org/x/sys v0.15.0 // indirect
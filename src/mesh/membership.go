@@ -0,0 +1,365 @@
+package mesh
+
+import (
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+)
+
+// State is a node's membership state. Later states win over earlier ones
+// at the same incarnation.
+type State uint8
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+// retransmitMult scales how many frames each update is piggybacked on
+const retransmitMult = 4
+
+// maxPiggyback bounds the updates added to one frame
+const maxPiggyback = 8
+
+// Member describes a node as this node sees it
+type Member struct {
+	ID          NodeID
+	Addr        string
+	State       State
+	Incarnation uint64
+	// Neighbor is set when this node exchanges datagrams with it directly
+	Neighbor bool
+	// Hops is 0 for this node and -1 when no route is known
+	Hops int
+}
+
+type member struct {
+	id          NodeID
+	addr        string
+	state       State
+	incarnation uint64
+	changed     time.Time // when state last changed
+	unreachable time.Time // since when no route is known, if alive
+
+	// link is set while datagrams arrive from the node directly
+	link     bool
+	linkAddr *net.UDPAddr
+	heard    time.Time
+}
+
+type queuedUpdate struct {
+	update Update
+	sent   int
+}
+
+// self is this node's own membership update
+func (n *Node) self() Update {
+	state := StateAlive
+	if n.leaving {
+		state = StateDead
+	}
+	return Update{ID: n.id, Addr: n.addr, Incarnation: n.incarnation, State: state}
+}
+
+// Members returns every known node, this one first
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	members := []Member{{ID: n.id, Addr: n.addr, State: StateAlive, Incarnation: n.incarnation}}
+	for _, m := range n.members {
+		hops := -1
+		if path, found := n.path(m.id); found {
+			hops = path.Hops
+		}
+		members = append(members, Member{
+			ID:          m.id,
+			Addr:        m.addr,
+			State:       m.state,
+			Incarnation: m.incarnation,
+			Neighbor:    m.link,
+			Hops:        hops,
+		})
+	}
+	sort.Slice(members[1:], func(i, j int) bool { return members[i+1].ID < members[j+1].ID })
+	return members
+}
+
+// apply merges an update into the member list, queueing it for further
+// gossip if it is news
+func (n *Node) apply(u Update) {
+	if u.ID == n.id {
+		// Refute rumors of our death with a newer incarnation
+		if u.State != StateAlive && u.Incarnation >= n.incarnation && !n.leaving {
+			n.incarnation = u.Incarnation + 1
+			n.enqueue(n.self())
+		}
+		return
+	}
+	m := n.members[u.ID]
+	if m == nil {
+		if u.State == StateDead {
+			return
+		}
+		n.members[u.ID] = &member{id: u.ID, addr: u.Addr, state: u.State, incarnation: u.Incarnation, changed: time.Now()}
+		n.enqueue(u)
+		return
+	}
+	if u.Incarnation < m.incarnation || (u.Incarnation == m.incarnation && u.State <= m.state) {
+		return
+	}
+	if u.State != m.state {
+		m.changed = time.Now()
+	}
+	m.state = u.State
+	m.incarnation = u.Incarnation
+	if u.Addr != "" {
+		m.addr = u.Addr
+	}
+	if m.state == StateDead {
+		n.dropLink(m)
+	}
+	n.enqueue(u)
+}
+
+// heard records a datagram received directly from a node
+func (n *Node) heard(id NodeID, from *net.UDPAddr) {
+	m := n.members[id]
+	if m == nil {
+		// Frames carry the sender's own update, so this only happens for
+		// a sender that announced itself dead
+		return
+	}
+	if m.state == StateDead {
+		// Tell it, so it can refute if it is back
+		n.enqueue(Update{ID: m.id, Addr: m.addr, Incarnation: m.incarnation, State: m.state})
+		return
+	}
+	m.link = true
+	m.linkAddr = from
+	m.heard = time.Now()
+	n.routes[id] = route{next: id, hops: 1, updated: m.heard}
+}
+
+// dropLink forgets the direct link to m and the routes through it
+func (n *Node) dropLink(m *member) {
+	m.link = false
+	for id, r := range n.routes {
+		if r.next == m.id {
+			delete(n.routes, id)
+		}
+	}
+}
+
+// enqueue queues an update for gossip, replacing older news of the node
+func (n *Node) enqueue(u Update) {
+	for i, q := range n.gossip {
+		if q.update.ID == u.ID {
+			n.gossip = append(n.gossip[:i], n.gossip[i+1:]...)
+			break
+		}
+	}
+	n.gossip = append(n.gossip, &queuedUpdate{update: u})
+}
+
+// pickGossip returns the least sent updates, dropping those sent enough
+// times to have reached everyone
+func (n *Node) pickGossip() []Update {
+	if len(n.gossip) == 0 {
+		return nil
+	}
+	limit := retransmitMult * int(math.Ceil(math.Log10(float64(len(n.members)+2))))
+	sort.SliceStable(n.gossip, func(i, j int) bool { return n.gossip[i].sent < n.gossip[j].sent })
+	var updates []Update
+	for _, q := range n.gossip {
+		if len(updates) == maxPiggyback {
+			break
+		}
+		updates = append(updates, q.update)
+		q.sent++
+	}
+	kept := n.gossip[:0]
+	for _, q := range n.gossip {
+		if q.sent < limit {
+			kept = append(kept, q)
+		}
+	}
+	n.gossip = kept
+	return updates
+}
+
+// links returns the live neighbors, leaving out except
+func (n *Node) links(except NodeID) []*member {
+	var links []*member
+	for _, m := range n.members {
+		if m.link && m.state != StateDead && m.id != except {
+			links = append(links, m)
+		}
+	}
+	return links
+}
+
+// linkAddrs returns the addresses of the live neighbors, leaving out except
+func (n *Node) linkAddrs(except NodeID) []*net.UDPAddr {
+	var addrs []*net.UDPAddr
+	for _, m := range n.links(except) {
+		addrs = append(addrs, m.linkAddr)
+	}
+	return addrs
+}
+
+// addrOf returns where to send datagrams for a node
+func (n *Node) addrOf(id NodeID) *net.UDPAddr {
+	m := n.members[id]
+	if m == nil || m.state == StateDead {
+		return nil
+	}
+	if m.link {
+		return m.linkAddr
+	}
+	addr, err := net.ResolveUDPAddr("udp", m.addr)
+	if err != nil || addr.IP == nil || addr.IP.IsUnspecified() {
+		return nil
+	}
+	return addr
+}
+
+// nextProbeTarget walks the neighbors in a shuffled order, reshuffling
+// after each round as SWIM does
+func (n *Node) nextProbeTarget() *member {
+	for {
+		if len(n.probeOrder) == 0 {
+			for _, m := range n.links("") {
+				n.probeOrder = append(n.probeOrder, m.id)
+			}
+			if len(n.probeOrder) == 0 {
+				return nil
+			}
+			rand.Shuffle(len(n.probeOrder), func(i, j int) {
+				n.probeOrder[i], n.probeOrder[j] = n.probeOrder[j], n.probeOrder[i]
+			})
+		}
+		id := n.probeOrder[0]
+		n.probeOrder = n.probeOrder[1:]
+		if m := n.members[id]; m != nil && m.link && m.state != StateDead {
+			return m
+		}
+	}
+}
+
+// probe pings one neighbor, asks others to ping it if it doesn't answer,
+// and handles a failure
+func (n *Node) probe() {
+	n.mu.Lock()
+	target := n.nextProbeTarget()
+	if target == nil {
+		n.mu.Unlock()
+		return
+	}
+	id, addr := target.id, target.linkAddr
+	seq := n.nextSeq()
+	ack := make(chan struct{}, 1)
+	n.acks[seq] = ack
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.acks, seq)
+		n.mu.Unlock()
+	}()
+
+	n.send(addr, &Frame{Type: FramePing, Seq: seq, Target: id})
+	select {
+	case <-ack:
+		return
+	case <-time.After(n.config.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	n.mu.Lock()
+	relays := n.linkAddrs(id)
+	n.mu.Unlock()
+	rand.Shuffle(len(relays), func(i, j int) { relays[i], relays[j] = relays[j], relays[i] })
+	if len(relays) > n.config.IndirectProbes {
+		relays = relays[:n.config.IndirectProbes]
+	}
+	for _, relay := range relays {
+		n.send(relay, &Frame{Type: FramePingReq, Seq: seq, Target: id})
+	}
+	select {
+	case <-ack:
+		return
+	case <-time.After(n.config.ProbeInterval - n.config.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	n.mu.Lock()
+	n.probeFailed(id)
+	n.mu.Unlock()
+}
+
+// probeFailed handles a neighbor that answered neither directly nor
+// through others. If it is still reachable another way only the link is
+// down; otherwise it is suspected.
+func (n *Node) probeFailed(id NodeID) {
+	m := n.members[id]
+	if m == nil || m.state == StateDead {
+		return
+	}
+	n.dropLink(m)
+	if n.nextHop(id) != nil {
+		return
+	}
+	n.suspect(m)
+}
+
+func (n *Node) suspect(m *member) {
+	if m.state == StateAlive {
+		m.state = StateSuspect
+		m.changed = time.Now()
+		n.enqueue(Update{ID: m.id, Addr: m.addr, Incarnation: m.incarnation, State: StateSuspect})
+	}
+}
+
+// expireMembers declares suspects dead after the suspicion timeout, drops
+// links that have gone quiet and forgets long dead nodes
+func (n *Node) expireMembers(now time.Time) {
+	quiet := 3 * n.config.ProbeInterval
+	for id, m := range n.members {
+		switch {
+		case m.state == StateSuspect && now.Sub(m.changed) > n.config.SuspicionTimeout:
+			m.state = StateDead
+			m.changed = now
+			n.dropLink(m)
+			n.enqueue(Update{ID: m.id, Addr: m.addr, Incarnation: m.incarnation, State: StateDead})
+		case m.state == StateDead && now.Sub(m.changed) > 10*n.config.SuspicionTimeout:
+			delete(n.members, id)
+		case m.link && now.Sub(m.heard) > quiet:
+			n.probeFailed(id)
+		}
+
+		// A node nobody can reach any more is suspected too
+		if m.state != StateAlive || n.nextHop(id) != nil {
+			m.unreachable = time.Time{}
+		} else if m.unreachable.IsZero() {
+			m.unreachable = now
+		} else if now.Sub(m.unreachable) > n.config.SuspicionTimeout {
+			n.suspect(m)
+		}
+	}
+}
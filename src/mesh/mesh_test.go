@@ -0,0 +1,255 @@
+package mesh
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// partition drops datagrams between chosen nodes
+type partition struct {
+	mu      sync.Mutex
+	blocked map[string]map[string]bool // receiver address -> sender addresses
+}
+
+func (p *partition) block(a, b *Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.blocked == nil {
+		p.blocked = map[string]map[string]bool{}
+	}
+	for _, pair := range [][2]*Node{{a, b}, {b, a}} {
+		to, from := pair[0].Addr().String(), pair[1].Addr().String()
+		if p.blocked[to] == nil {
+			p.blocked[to] = map[string]bool{}
+		}
+		p.blocked[to][from] = true
+	}
+}
+
+func (p *partition) filter(self *string) func(*net.UDPAddr) bool {
+	return func(from *net.UDPAddr) bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.blocked[*self][from.String()]
+	}
+}
+
+func newTestNode(t *testing.T, id NodeID, p *partition) *Node {
+	t.Helper()
+	self := new(string)
+	config := Config{
+		ID:               id,
+		BindAddr:         "127.0.0.1:0",
+		ProbeInterval:    50 * time.Millisecond,
+		ProbeTimeout:     20 * time.Millisecond,
+		SuspicionTimeout: 300 * time.Millisecond,
+		filter:           p.filter(self),
+	}
+	n, err := New(config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	p.mu.Lock()
+	*self = n.Addr().String()
+	p.mu.Unlock()
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func join(t *testing.T, n, seed *Node) {
+	t.Helper()
+	if err := n.Join(seed.Addr().String()); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func stateOf(n *Node, id NodeID) (State, bool) {
+	for _, m := range n.Members() {
+		if m.ID == id {
+			return m.State, true
+		}
+	}
+	return 0, false
+}
+
+func receive(t *testing.T, n *Node) Message {
+	t.Helper()
+	select {
+	case m := <-n.Messages():
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s received nothing", n.ID())
+	}
+	return Message{}
+}
+
+func TestFrameEncoding(t *testing.T) {
+	frame := &Frame{
+		Type:    FrameData,
+		TTL:     7,
+		Seq:     42,
+		From:    "b",
+		Origin:  "a",
+		Target:  "c",
+		Payload: []byte("hello"),
+		Updates: []Update{{ID: "a", Addr: "10.0.0.1:7946", Incarnation: 3, State: StateSuspect}},
+		Routes:  []Route{{ID: "c", Hops: 2}},
+	}
+	data, err := frame.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	got, err := DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("DecodeFrame failed: %v", err)
+	}
+	if got.Type != frame.Type || got.TTL != 7 || got.Seq != 42 || got.Origin != "a" || got.Target != "c" ||
+		!bytes.Equal(got.Payload, frame.Payload) || got.Updates[0] != frame.Updates[0] || got.Routes[0] != frame.Routes[0] {
+		t.Errorf("round trip = %+v", got)
+	}
+
+	for _, bad := range [][]byte{nil, data[:len(data)-1], append(append([]byte(nil), data...), 0), []byte("GET / HTTP/1.1")} {
+		if _, err := DecodeFrame(bad); err != ErrBadFrame {
+			t.Errorf("DecodeFrame(%q) = %v", bad, err)
+		}
+	}
+	if _, err := (&Frame{From: "a", Payload: make([]byte, MaxPayload+1)}).Encode(); err == nil {
+		t.Error("oversized payload encoded")
+	}
+}
+
+// TestMultiHop builds a - b - c where a and c can't reach each other
+func TestMultiHop(t *testing.T) {
+	p := &partition{}
+	a := newTestNode(t, "a", p)
+	b := newTestNode(t, "b", p)
+	c := newTestNode(t, "c", p)
+	p.block(a, c)
+	join(t, a, b)
+	join(t, c, b)
+
+	waitFor(t, "a route from a to c", func() bool {
+		path, found := a.Routes()["c"]
+		return found && path.Next == "b" && path.Hops == 2
+	})
+	if err := a.Send("c", []byte("over b")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if m := receive(t, c); m.From != "a" || m.To != "c" || m.Hops != 2 || string(m.Payload) != "over b" {
+		t.Errorf("c received %+v", m)
+	}
+	if err := a.Send("nobody", nil); err == nil {
+		t.Error("Send to an unknown node succeeded")
+	}
+
+	// Everyone gets a broadcast once, the sender included
+	c.Broadcast([]byte("all"))
+	for _, n := range []*Node{a, b, c} {
+		if m := receive(t, n); m.From != "c" || m.To != "" || string(m.Payload) != "all" {
+			t.Errorf("%s received %+v", n.ID(), m)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, n := range []*Node{a, b, c} {
+		if len(n.Messages()) != 0 {
+			t.Errorf("%s received the broadcast twice", n.ID())
+		}
+	}
+
+	// Membership reached a through gossip
+	if state, found := stateOf(a, "c"); !found || state != StateAlive {
+		t.Errorf("a sees c as %v (known %v)", state, found)
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	p := &partition{}
+	a := newTestNode(t, "a", p)
+	b := newTestNode(t, "b", p)
+	c := newTestNode(t, "c", p)
+	join(t, b, a)
+	join(t, c, a)
+	waitFor(t, "b to see c", func() bool {
+		_, found := b.Routes()["c"]
+		return found
+	})
+
+	// c crashes: nothing gets in or out
+	p.block(c, a)
+	p.block(c, b)
+	for _, n := range []*Node{a, b} {
+		waitFor(t, string(n.ID())+" to declare c dead", func() bool {
+			state, _ := stateOf(n, "c")
+			return state == StateDead
+		})
+	}
+	if err := a.Send("c", nil); err == nil {
+		t.Error("Send to a dead node succeeded")
+	}
+	if state, _ := stateOf(a, "b"); state != StateAlive {
+		t.Errorf("a sees b as %v", state)
+	}
+}
+
+func TestLeave(t *testing.T) {
+	p := &partition{}
+	a := newTestNode(t, "a", p)
+	b := newTestNode(t, "b", p)
+	join(t, b, a)
+	waitFor(t, "a to see b", func() bool {
+		state, found := stateOf(a, "b")
+		return found && state == StateAlive
+	})
+
+	b.Close()
+	// Faster than a failure would be detected
+	start := time.Now()
+	waitFor(t, "a to see b leave", func() bool {
+		state, _ := stateOf(a, "b")
+		return state == StateDead
+	})
+	if elapsed := time.Since(start); elapsed > a.config.SuspicionTimeout {
+		t.Errorf("leave took %v", elapsed)
+	}
+	if _, ok := <-b.Messages(); ok {
+		t.Error("Messages not closed")
+	}
+	if err := b.Broadcast(nil); err != ErrClosed {
+		t.Errorf("Broadcast after Close: %v", err)
+	}
+}
+
+func TestRefuteSuspicion(t *testing.T) {
+	n := &Node{id: "a", incarnation: 5, members: map[NodeID]*member{}}
+	n.apply(Update{ID: "a", Incarnation: 5, State: StateSuspect})
+	if n.incarnation != 6 || len(n.gossip) != 1 || n.gossip[0].update.State != StateAlive {
+		t.Errorf("incarnation %d, gossip %+v", n.incarnation, n.gossip)
+	}
+
+	// Older news about another node is ignored
+	n.apply(Update{ID: "b", Incarnation: 2, State: StateAlive})
+	n.apply(Update{ID: "b", Incarnation: 1, State: StateDead})
+	n.apply(Update{ID: "b", Incarnation: 2, State: StateSuspect})
+	n.apply(Update{ID: "b", Incarnation: 2, State: StateAlive})
+	if m := n.members["b"]; m.state != StateSuspect || m.incarnation != 2 {
+		t.Errorf("b is %v at %d", m.state, m.incarnation)
+	}
+	n.apply(Update{ID: "b", Incarnation: 3, State: StateAlive})
+	if m := n.members["b"]; m.state != StateAlive {
+		t.Errorf("refutation ignored: b is %v", m.state)
+	}
+}
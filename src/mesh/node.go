@@ -0,0 +1,614 @@
+// Package mesh joins processes on a LAN into a peer-to-peer mesh. Nodes
+// find each other by UDP multicast or seed addresses, agree on membership
+// with SWIM-style gossip and failure detection, and route messages over
+// several hops so any node can reach any other.
+package mesh
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NodeID identifies a node in the mesh
+type NodeID string
+
+var (
+	// ErrNoRoute is returned when no path to a node is known
+	ErrNoRoute = errors.New("no route to node")
+	// ErrClosed is returned after Close
+	ErrClosed = errors.New("mesh node closed")
+)
+
+// Config configures a Node
+type Config struct {
+	// ID names the node; a random one is used if empty
+	ID NodeID
+	// BindAddr is the UDP address to listen on
+	BindAddr string
+	// AdvertiseAddr is the address other nodes are told to use. It defaults
+	// to the bound address.
+	AdvertiseAddr string
+	// MulticastAddr is the group used to discover nodes on the LAN, such
+	// as "239.255.77.77:7947". Empty disables discovery.
+	MulticastAddr string
+	// DiscoveryInterval is how often the node announces itself
+	DiscoveryInterval time.Duration
+
+	// ProbeInterval is how often a neighbor is probed and routes are sent
+	ProbeInterval time.Duration
+	// ProbeTimeout is how long to wait for a direct ack before asking
+	// IndirectProbes other neighbors to probe the target
+	ProbeTimeout   time.Duration
+	IndirectProbes int
+	// SuspicionTimeout is how long a suspected node has to refute before
+	// it is declared dead
+	SuspicionTimeout time.Duration
+	// MaxHops bounds routes and is the TTL of new messages
+	MaxHops int
+	// Buffer is how many received messages may wait in Messages before
+	// more are dropped
+	Buffer int
+	Logger *log.Logger
+	// Security encrypts and authenticates traffic between nodes. Without
+	// it frames travel in the clear and any node may join.
+	Security *Security
+
+	// filter drops datagrams from some addresses, to simulate topologies
+	filter func(from *net.UDPAddr) bool
+}
+
+// DefaultConfig returns the settings for a node listening on bind
+func DefaultConfig(bind string) Config {
+	return Config{
+		BindAddr:          bind,
+		MulticastAddr:     "239.255.77.77:7947",
+		DiscoveryInterval: 5 * time.Second,
+		ProbeInterval:     time.Second,
+		ProbeTimeout:      400 * time.Millisecond,
+		IndirectProbes:    3,
+		SuspicionTimeout:  5 * time.Second,
+		MaxHops:           16,
+		Buffer:            256,
+	}
+}
+
+// withDefaults fills unset fields from DefaultConfig
+func (c Config) withDefaults() Config {
+	d := DefaultConfig(c.BindAddr)
+	if c.ID == "" {
+		c.ID = newNodeID()
+	}
+	if c.DiscoveryInterval <= 0 {
+		c.DiscoveryInterval = d.DiscoveryInterval
+	}
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = d.ProbeInterval
+	}
+	if c.ProbeTimeout <= 0 || c.ProbeTimeout >= c.ProbeInterval {
+		c.ProbeTimeout = c.ProbeInterval * 2 / 5
+	}
+	if c.IndirectProbes <= 0 {
+		c.IndirectProbes = d.IndirectProbes
+	}
+	if c.SuspicionTimeout <= 0 {
+		c.SuspicionTimeout = 5 * c.ProbeInterval
+	}
+	if c.MaxHops <= 0 || c.MaxHops > 255 {
+		c.MaxHops = d.MaxHops
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = d.Buffer
+	}
+	if c.Logger == nil {
+		c.Logger = log.New(io.Discard, "", 0)
+	}
+	return c
+}
+
+func newNodeID() NodeID {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return NodeID(hex.EncodeToString(b))
+}
+
+func randomSeq() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// Message is an application payload received from the mesh
+type Message struct {
+	From NodeID
+	// To is the receiving node, or empty for a broadcast
+	To      NodeID
+	Hops    int
+	Payload []byte
+}
+
+// Node is a member of the mesh
+type Node struct {
+	config Config
+	id     NodeID
+	addr   string
+	conn   *net.UDPConn
+	// transport carries unicast frames; discovery beacons bypass it
+	transport transport
+	group     *net.UDPAddr
+	mcast     *net.UDPConn
+
+	seq      atomic.Uint32
+	messages chan Message
+	dropped  atomic.Uint64
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex
+	closed      bool
+	incarnation uint64
+	leaving     bool
+	members     map[NodeID]*member
+	routes      map[NodeID]route
+	gossip      []*queuedUpdate
+	probeOrder  []NodeID
+	acks        map[uint32]chan struct{}
+	relays      map[uint32]relay
+	seen        map[messageKey]time.Time
+}
+
+// outgoing is a frame waiting to be sent once the lock is released
+type outgoing struct {
+	to    *net.UDPAddr
+	frame *Frame
+}
+
+// New starts a node. Use Join to contact seed nodes when discovery is off
+// or doesn't reach them.
+func New(config Config) (*Node, error) {
+	config = config.withDefaults()
+	if len(config.ID) > 255 {
+		return nil, fmt.Errorf("node ID %q is over 255 bytes", config.ID)
+	}
+	bind, err := net.ResolveUDPAddr("udp", config.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bind address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", bind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	n := &Node{
+		config:    config,
+		id:        config.ID,
+		addr:      config.AdvertiseAddr,
+		conn:      conn,
+		transport: &plainTransport{conn: conn, filter: config.filter},
+		messages:  make(chan Message, config.Buffer),
+		done:      make(chan struct{}),
+		// Starting from the clock makes a restarted node's updates newer
+		// than whatever the mesh remembers about it
+		incarnation: uint64(time.Now().UnixNano()),
+		members:     map[NodeID]*member{},
+		routes:      map[NodeID]route{},
+		acks:        map[uint32]chan struct{}{},
+		relays:      map[uint32]relay{},
+		seen:        map[messageKey]time.Time{},
+	}
+	// Broadcasts are deduplicated by origin and sequence number, so a node
+	// restarted with the same ID mustn't reuse the numbers of its last run
+	n.seq.Store(randomSeq())
+	if n.addr == "" {
+		n.addr = conn.LocalAddr().String()
+	}
+	if config.Security != nil {
+		secure, err := newSecureTransport(conn, config.Security, config.filter, config.Logger)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("invalid security config: %w", err)
+		}
+		n.transport = secure
+	}
+	if config.MulticastAddr != "" {
+		if err := n.startDiscovery(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	n.wg.Add(2)
+	go n.receive()
+	go n.run()
+	return n, nil
+}
+
+// ID returns the node's ID
+func (n *Node) ID() NodeID {
+	return n.id
+}
+
+// Addr returns the UDP address the node listens on
+func (n *Node) Addr() net.Addr {
+	return n.conn.LocalAddr()
+}
+
+// Messages returns the payloads sent to this node or broadcast. If the
+// channel isn't drained, messages beyond the buffer are dropped. It is
+// closed by Close.
+func (n *Node) Messages() <-chan Message {
+	return n.messages
+}
+
+// Dropped returns how many received messages were dropped because
+// Messages was full
+func (n *Node) Dropped() uint64 {
+	return n.dropped.Load()
+}
+
+// Join probes the seed addresses until one answers
+func (n *Node) Join(seeds ...string) error {
+	addrs := make([]*net.UDPAddr, 0, len(seeds))
+	for _, seed := range seeds {
+		addr, err := net.ResolveUDPAddr("udp", seed)
+		if err != nil {
+			return fmt.Errorf("failed to resolve seed %s: %w", seed, err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	ack := make(chan struct{}, 1)
+	seq := n.nextSeq()
+	n.mu.Lock()
+	n.acks[seq] = ack
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.acks, seq)
+		n.mu.Unlock()
+	}()
+
+	// Datagrams get lost, so ask again until the deadline
+	deadline := time.After(5 * n.config.ProbeInterval)
+	for {
+		for _, addr := range addrs {
+			n.send(addr, &Frame{Type: FramePing, Seq: seq})
+		}
+		select {
+		case <-ack:
+			return nil
+		case <-time.After(n.config.ProbeTimeout):
+		case <-deadline:
+			return fmt.Errorf("no answer from seeds %v", seeds)
+		case <-n.done:
+			return ErrClosed
+		}
+	}
+}
+
+// Send routes payload to one node. Delivery is best effort: a frame lost
+// on the way isn't retried.
+func (n *Node) Send(to NodeID, payload []byte) error {
+	if to == n.id {
+		n.deliver(Message{From: n.id, To: n.id, Payload: payload})
+		return nil
+	}
+	if len(payload) > MaxPayload {
+		return fmt.Errorf("payload of %d bytes is over the %d byte limit", len(payload), MaxPayload)
+	}
+	frame := &Frame{
+		Type:    FrameData,
+		TTL:     uint8(n.config.MaxHops),
+		Seq:     n.nextSeq(),
+		Origin:  n.id,
+		Target:  to,
+		Payload: payload,
+	}
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	var addr *net.UDPAddr
+	if next := n.nextHop(to); next != nil {
+		addr = next.linkAddr
+	}
+	n.mu.Unlock()
+	if addr == nil {
+		return fmt.Errorf("%w %s", ErrNoRoute, to)
+	}
+	return n.send(addr, frame)
+}
+
+// Broadcast floods payload to every node in the mesh, this one included
+func (n *Node) Broadcast(payload []byte) error {
+	if len(payload) > MaxPayload {
+		return fmt.Errorf("payload of %d bytes is over the %d byte limit", len(payload), MaxPayload)
+	}
+	frame := &Frame{
+		Type:    FrameData,
+		TTL:     uint8(n.config.MaxHops),
+		Seq:     n.nextSeq(),
+		Origin:  n.id,
+		Payload: payload,
+	}
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	n.seen[messageKey{n.id, frame.Seq}] = time.Now()
+	links := n.linkAddrs("")
+	n.mu.Unlock()
+
+	n.deliver(Message{From: n.id, Payload: payload})
+	for _, addr := range links {
+		n.send(addr, frame)
+	}
+	return nil
+}
+
+// Close tells the neighbors the node is leaving and stops it
+func (n *Node) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.leaving = true
+	links := n.linkAddrs("")
+	n.mu.Unlock()
+	for _, addr := range links {
+		n.send(addr, &Frame{Type: FrameRoutes})
+	}
+
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	close(n.done)
+	err := n.conn.Close()
+	if n.mcast != nil {
+		n.mcast.Close()
+	}
+	n.wg.Wait()
+	close(n.messages)
+	return err
+}
+
+func (n *Node) nextSeq() uint32 {
+	return n.seq.Add(1)
+}
+
+// send stamps the frame with this node's ID and gossip and writes it
+func (n *Node) send(to *net.UDPAddr, f *Frame) error {
+	frame := *f
+	frame.From = n.id
+	// Secure nodes keep membership out of the cleartext announcements
+	if f.Type != FrameAnnounce || n.config.Security == nil {
+		n.mu.Lock()
+		frame.Updates = append([]Update{n.self()}, n.pickGossip()...)
+		n.mu.Unlock()
+	}
+
+	data, err := frame.Encode()
+	if err != nil {
+		return err
+	}
+	if f.Type == FrameAnnounce {
+		_, err = n.conn.WriteToUDP(data, to)
+	} else {
+		err = n.transport.WriteTo(data, to)
+	}
+	if err != nil {
+		select {
+		case <-n.done:
+			return ErrClosed
+		default:
+		}
+		return fmt.Errorf("failed to send to %s: %w", to, err)
+	}
+	return nil
+}
+
+func (n *Node) sendAll(out []outgoing) {
+	for _, o := range out {
+		if err := n.send(o.to, o.frame); err != nil {
+			n.config.Logger.Printf("mesh: %v", err)
+		}
+	}
+}
+
+// receive handles datagrams until the node is closed
+func (n *Node) receive() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacket)
+	for {
+		size, from, err := n.transport.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+			n.config.Logger.Printf("mesh: read failed: %v", err)
+			continue
+		}
+		data := make([]byte, size)
+		copy(data, buf[:size])
+		frame, err := DecodeFrame(data)
+		if err != nil {
+			n.config.Logger.Printf("mesh: dropped datagram from %s: %v", from, err)
+			continue
+		}
+		n.handle(frame, from)
+	}
+}
+
+func (n *Node) handle(f *Frame, from *net.UDPAddr) {
+	if f.From == n.id {
+		return
+	}
+	var out []outgoing
+	var deliver []Message
+
+	n.mu.Lock()
+	for _, u := range f.Updates {
+		n.apply(u)
+	}
+	if f.Type != FrameAnnounce {
+		n.heard(f.From, from)
+	}
+
+	switch f.Type {
+	case FramePing:
+		// A ping for another node reached a restarted or moved address
+		if f.Target == "" || f.Target == n.id {
+			out = append(out, outgoing{from, &Frame{Type: FrameAck, Seq: f.Seq}})
+		}
+	case FrameAck:
+		if ack, found := n.acks[f.Seq]; found {
+			select {
+			case ack <- struct{}{}:
+			default:
+			}
+		} else if r, found := n.relays[f.Seq]; found {
+			delete(n.relays, f.Seq)
+			out = append(out, outgoing{r.requester, &Frame{Type: FrameAck, Seq: r.seq}})
+		}
+	case FramePingReq:
+		if target := n.addrOf(f.Target); target != nil {
+			seq := n.nextSeq()
+			n.relays[seq] = relay{requester: from, seq: f.Seq, expires: time.Now().Add(n.config.ProbeInterval)}
+			out = append(out, outgoing{target, &Frame{Type: FramePing, Seq: seq, Target: f.Target}})
+		}
+	case FrameRoutes:
+		n.applyRoutes(f.From, f.Routes)
+	case FrameData:
+		out, deliver = n.forward(f)
+	case FrameAnnounce:
+		if m := n.members[f.From]; m == nil || !m.link {
+			out = append(out, outgoing{from, &Frame{Type: FramePing, Seq: n.nextSeq(), Target: f.From}})
+		}
+	}
+	n.mu.Unlock()
+
+	for _, m := range deliver {
+		n.deliver(m)
+	}
+	n.sendAll(out)
+}
+
+// forward delivers a data frame here and passes it on as needed
+func (n *Node) forward(f *Frame) ([]outgoing, []Message) {
+	hops := n.config.MaxHops - int(f.TTL) + 1
+	if f.Target == "" {
+		key := messageKey{f.Origin, f.Seq}
+		if _, seen := n.seen[key]; seen {
+			return nil, nil
+		}
+		n.seen[key] = time.Now()
+		deliver := []Message{{From: f.Origin, Hops: hops, Payload: f.Payload}}
+		if f.TTL <= 1 {
+			return nil, deliver
+		}
+		next := *f
+		next.TTL--
+		var out []outgoing
+		for _, m := range n.links(f.From) {
+			if m.id != f.Origin {
+				out = append(out, outgoing{m.linkAddr, &next})
+			}
+		}
+		return out, deliver
+	}
+
+	if f.Target == n.id {
+		return nil, []Message{{From: f.Origin, To: n.id, Hops: hops, Payload: f.Payload}}
+	}
+	if f.TTL <= 1 {
+		return nil, nil
+	}
+	// Never hand a message back to the node it came from
+	to := n.nextHop(f.Target)
+	if to == nil || to.id == f.From {
+		n.config.Logger.Printf("mesh: no route to %s for message from %s", f.Target, f.Origin)
+		return nil, nil
+	}
+	next := *f
+	next.TTL--
+	return []outgoing{{to.linkAddr, &next}}, nil
+}
+
+func (n *Node) deliver(m Message) {
+	select {
+	case n.messages <- m:
+	default:
+		n.dropped.Add(1)
+	}
+}
+
+// run probes neighbors, sends routes and expires state every interval
+func (n *Node) run() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.sendAll(n.tick())
+			n.wg.Add(1)
+			go func() {
+				defer n.wg.Done()
+				n.probe()
+			}()
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// tick expires old state and returns the routes for each neighbor
+func (n *Node) tick() []outgoing {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	n.expireMembers(now)
+	n.expireRoutes(now)
+	for seq, r := range n.relays {
+		if now.After(r.expires) {
+			delete(n.relays, seq)
+		}
+	}
+	for key, at := range n.seen {
+		if now.Sub(at) > time.Minute {
+			delete(n.seen, key)
+		}
+	}
+	return n.routeFrames()
+}
+
+// messageKey identifies a broadcast for deduplication
+type messageKey struct {
+	origin NodeID
+	seq    uint32
+}
+
+// relay remembers a probe made on another node's behalf
+type relay struct {
+	requester *net.UDPAddr
+	seq       uint32
+	expires   time.Time
+}
@@ -0,0 +1,320 @@
+package mesh
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// The handshake is Noise_XX_25519_ChaChaPoly_SHA256: both sides send their
+// static keys, encrypted, so neither needs to know the other's in advance.
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s, se
+const (
+	noiseProtocol = "Noise_XX_25519_ChaChaPoly_SHA256"
+	noisePrologue = "mesh v1"
+	keySize       = 32
+	tagSize       = chacha20poly1305.Overhead
+)
+
+// ErrHandshake is returned when a handshake message doesn't verify
+var ErrHandshake = errors.New("handshake failed")
+
+// cipherState encrypts with one key and a counter nonce
+type cipherState struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func newCipherState(key []byte) *cipherState {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		panic(err) // only for a key of the wrong size
+	}
+	return &cipherState{aead: aead}
+}
+
+func nonce(n uint64) []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], n)
+	return nonce[:]
+}
+
+func (c *cipherState) encrypt(n uint64, ad, plaintext []byte) []byte {
+	return c.aead.Seal(nil, nonce(n), plaintext, ad)
+}
+
+func (c *cipherState) decrypt(n uint64, ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(nil, nonce(n), ciphertext, ad)
+}
+
+// symmetricState holds the chaining key and transcript hash
+type symmetricState struct {
+	ck, h  [sha256.Size]byte
+	cipher *cipherState
+}
+
+func newSymmetricState() *symmetricState {
+	s := &symmetricState{}
+	// The protocol name fits in a hash, so it is used padded
+	copy(s.h[:], noiseProtocol)
+	s.ck = s.h
+	s.mixHash([]byte(noisePrologue))
+	return s
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(s.h[:])
+	h.Write(data)
+	h.Sum(s.h[:0])
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	ck, k := hkdf(s.ck[:], ikm)
+	s.ck = ck
+	s.cipher = newCipherState(k[:])
+}
+
+func (s *symmetricState) encryptAndHash(plaintext []byte) []byte {
+	if s.cipher == nil {
+		s.mixHash(plaintext)
+		return plaintext
+	}
+	ciphertext := s.cipher.encrypt(s.cipher.n, s.h[:], plaintext)
+	s.cipher.n++
+	s.mixHash(ciphertext)
+	return ciphertext
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	if s.cipher == nil {
+		s.mixHash(ciphertext)
+		return ciphertext, nil
+	}
+	plaintext, err := s.cipher.decrypt(s.cipher.n, s.h[:], ciphertext)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	s.cipher.n++
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// split derives the transport keys: the first for messages from the
+// initiator, the second for messages from the responder
+func (s *symmetricState) split() (initiator, responder *cipherState) {
+	k1, k2 := hkdf(s.ck[:], nil)
+	return newCipherState(k1[:]), newCipherState(k2[:])
+}
+
+// hkdf is the two-output HKDF that Noise defines over HMAC-SHA256
+func hkdf(chainingKey, ikm []byte) (out1, out2 [sha256.Size]byte) {
+	mac := hmac.New(sha256.New, chainingKey)
+	mac.Write(ikm)
+	temp := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write([]byte{1})
+	mac.Sum(out1[:0])
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write(out1[:])
+	mac.Write([]byte{2})
+	mac.Sum(out2[:0])
+	return out1, out2
+}
+
+// handshakeState runs one side of the XX handshake
+type handshakeState struct {
+	symmetric *symmetricState
+	initiator bool
+	s         *ecdh.PrivateKey
+	e         *ecdh.PrivateKey
+	rs, re    *ecdh.PublicKey
+}
+
+func newHandshake(static *ecdh.PrivateKey, initiator bool) (*handshakeState, error) {
+	e, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	return &handshakeState{symmetric: newSymmetricState(), initiator: initiator, s: static, e: e}, nil
+}
+
+func (hs *handshakeState) dh(private *ecdh.PrivateKey, public *ecdh.PublicKey) error {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return ErrHandshake
+	}
+	hs.symmetric.mixKey(shared)
+	return nil
+}
+
+func (hs *handshakeState) readEphemeral(msg []byte) ([]byte, error) {
+	if len(msg) < keySize {
+		return nil, ErrHandshake
+	}
+	re, err := ecdh.X25519().NewPublicKey(msg[:keySize])
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	hs.re = re
+	hs.symmetric.mixHash(msg[:keySize])
+	return msg[keySize:], nil
+}
+
+func (hs *handshakeState) readStatic(msg []byte) ([]byte, error) {
+	if len(msg) < keySize+tagSize {
+		return nil, ErrHandshake
+	}
+	key, err := hs.symmetric.decryptAndHash(msg[:keySize+tagSize])
+	if err != nil {
+		return nil, err
+	}
+	rs, err := ecdh.X25519().NewPublicKey(key)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	hs.rs = rs
+	return msg[keySize+tagSize:], nil
+}
+
+// writeMessage1 is the initiator's "-> e"
+func (hs *handshakeState) writeMessage1() []byte {
+	e := hs.e.PublicKey().Bytes()
+	hs.symmetric.mixHash(e)
+	return append(e, hs.symmetric.encryptAndHash(nil)...)
+}
+
+func (hs *handshakeState) readMessage1(msg []byte) error {
+	rest, err := hs.readEphemeral(msg)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return ErrHandshake
+	}
+	_, err = hs.symmetric.decryptAndHash(rest)
+	return err
+}
+
+// writeMessage2 is the responder's "<- e, ee, s, es"
+func (hs *handshakeState) writeMessage2() ([]byte, error) {
+	msg := hs.e.PublicKey().Bytes()
+	hs.symmetric.mixHash(msg)
+	if err := hs.dh(hs.e, hs.re); err != nil {
+		return nil, err
+	}
+	msg = append(msg, hs.symmetric.encryptAndHash(hs.s.PublicKey().Bytes())...)
+	if err := hs.dh(hs.s, hs.re); err != nil {
+		return nil, err
+	}
+	return append(msg, hs.symmetric.encryptAndHash(nil)...), nil
+}
+
+func (hs *handshakeState) readMessage2(msg []byte) error {
+	rest, err := hs.readEphemeral(msg)
+	if err != nil {
+		return err
+	}
+	if err := hs.dh(hs.e, hs.re); err != nil {
+		return err
+	}
+	if rest, err = hs.readStatic(rest); err != nil {
+		return err
+	}
+	if err := hs.dh(hs.e, hs.rs); err != nil {
+		return err
+	}
+	if len(rest) != tagSize {
+		return ErrHandshake
+	}
+	_, err = hs.symmetric.decryptAndHash(rest)
+	return err
+}
+
+// writeMessage3 is the initiator's "-> s, se"
+func (hs *handshakeState) writeMessage3() ([]byte, error) {
+	msg := hs.symmetric.encryptAndHash(hs.s.PublicKey().Bytes())
+	if err := hs.dh(hs.s, hs.re); err != nil {
+		return nil, err
+	}
+	return append(msg, hs.symmetric.encryptAndHash(nil)...), nil
+}
+
+func (hs *handshakeState) readMessage3(msg []byte) error {
+	rest, err := hs.readStatic(msg)
+	if err != nil {
+		return err
+	}
+	if err := hs.dh(hs.e, hs.rs); err != nil {
+		return err
+	}
+	if len(rest) != tagSize {
+		return ErrHandshake
+	}
+	_, err = hs.symmetric.decryptAndHash(rest)
+	return err
+}
+
+// transportKeys returns the keys this side sends and receives with
+func (hs *handshakeState) transportKeys() (send, receive *cipherState) {
+	initiator, responder := hs.symmetric.split()
+	if hs.initiator {
+		return initiator, responder
+	}
+	return responder, initiator
+}
+
+// replayWindowBits is how far behind the newest counter a datagram may
+// arrive and still be accepted
+const replayWindowBits = 1024
+
+// replayWindow rejects transport counters seen before or too old
+type replayWindow struct {
+	top  uint64 // one past the highest counter accepted
+	bits [replayWindowBits / 64]uint64
+}
+
+func (w *replayWindow) bit(counter uint64) (int, uint64) {
+	return int(counter/64) % len(w.bits), 1 << (counter % 64)
+}
+
+// check reports whether counter is new and within the window
+func (w *replayWindow) check(counter uint64) bool {
+	if counter >= w.top {
+		return true
+	}
+	if w.top-counter > replayWindowBits {
+		return false
+	}
+	word, mask := w.bit(counter)
+	return w.bits[word]&mask == 0
+}
+
+// mark records counter; call it only once the datagram has authenticated
+func (w *replayWindow) mark(counter uint64) {
+	if counter >= w.top {
+		if counter-w.top >= replayWindowBits {
+			w.bits = [replayWindowBits / 64]uint64{}
+		} else {
+			for c := w.top; c < counter; c++ {
+				word, mask := w.bit(c)
+				w.bits[word] &^= mask
+			}
+		}
+		w.top = counter + 1
+	}
+	word, mask := w.bit(counter)
+	w.bits[word] |= mask
+}
@@ -0,0 +1,139 @@
+package mesh
+
+import (
+	"sort"
+	"time"
+)
+
+// routesPerFrame keeps a distance vector frame well under a datagram
+const routesPerFrame = 1024
+
+// route is the neighbor to hand messages for a node to
+type route struct {
+	next    NodeID
+	hops    int
+	updated time.Time
+}
+
+// Path is how this node reaches another
+type Path struct {
+	Next NodeID
+	Hops int
+}
+
+// Routes returns the path to every reachable node
+func (n *Node) Routes() map[NodeID]Path {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	paths := map[NodeID]Path{}
+	for id := range n.members {
+		if path, found := n.path(id); found {
+			paths[id] = path
+		}
+	}
+	return paths
+}
+
+func (n *Node) path(id NodeID) (Path, bool) {
+	next := n.nextHop(id)
+	if next == nil {
+		return Path{}, false
+	}
+	if next.id == id {
+		return Path{Next: id, Hops: 1}, true
+	}
+	return Path{Next: next.id, Hops: n.routes[id].hops}, true
+}
+
+// nextHop returns the neighbor to send a node's messages to
+func (n *Node) nextHop(id NodeID) *member {
+	if m := n.members[id]; m != nil {
+		if m.state == StateDead {
+			return nil
+		}
+		if m.link {
+			return m
+		}
+	}
+	r, found := n.routes[id]
+	if !found {
+		return nil
+	}
+	next := n.members[r.next]
+	if next == nil || !next.link || next.state == StateDead {
+		return nil
+	}
+	return next
+}
+
+// applyRoutes merges a neighbor's distance vector: a node it reaches in h
+// hops is h+1 hops from here through it
+func (n *Node) applyRoutes(from NodeID, routes []Route) {
+	now := time.Now()
+	for _, r := range routes {
+		if r.ID == n.id {
+			continue
+		}
+		if m := n.members[r.ID]; m != nil && m.state == StateDead {
+			continue
+		}
+		hops := int(r.Hops) + 1
+		if hops > n.config.MaxHops {
+			continue
+		}
+		current, found := n.routes[r.ID]
+		if !found || current.next == from || hops < current.hops || n.stale(current, now) {
+			n.routes[r.ID] = route{next: from, hops: hops, updated: now}
+		}
+	}
+}
+
+// stale reports whether a route hasn't been refreshed for a while
+func (n *Node) stale(r route, now time.Time) bool {
+	return now.Sub(r.updated) > 3*n.config.ProbeInterval
+}
+
+// expireRoutes forgets stale routes
+func (n *Node) expireRoutes(now time.Time) {
+	for id, r := range n.routes {
+		if n.stale(r, now) {
+			delete(n.routes, id)
+		}
+	}
+}
+
+// routeFrames builds each neighbor's copy of the distance vector. Routes
+// through a neighbor aren't advertised back to it (split horizon), which
+// keeps two nodes from counting to infinity between themselves.
+func (n *Node) routeFrames() []outgoing {
+	ids := make([]NodeID, 0, len(n.routes))
+	for id := range n.routes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var out []outgoing
+	for _, neighbor := range n.links("") {
+		var routes []Route
+		for _, id := range ids {
+			r := n.routes[id]
+			if r.next == neighbor.id || id == neighbor.id || n.nextHop(id) == nil {
+				continue
+			}
+			routes = append(routes, Route{ID: id, Hops: uint8(r.hops)})
+		}
+		// Always send at least one frame: it doubles as a heartbeat
+		for {
+			batch := routes
+			if len(batch) > routesPerFrame {
+				batch = batch[:routesPerFrame]
+			}
+			routes = routes[len(batch):]
+			out = append(out, outgoing{neighbor.linkAddr, &Frame{Type: FrameRoutes, Routes: batch}})
+			if len(routes) == 0 {
+				break
+			}
+		}
+	}
+	return out
+}
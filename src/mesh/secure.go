@@ -0,0 +1,562 @@
+package mesh
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Security turns on encrypted, authenticated sessions between nodes. Every
+// unicast datagram then travels in a session set up by a Noise handshake
+// with a node whose static key is trusted.
+type Security struct {
+	// Key is this node's static key pair
+	Key *ecdh.PrivateKey
+	// Trusted lists the public keys of the nodes allowed to talk to this one
+	Trusted []*ecdh.PublicKey
+	// RekeyAfter is how long a session is used before a new handshake
+	RekeyAfter time.Duration
+}
+
+// GenerateKey returns a new static key pair
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// LoadOrCreateKey reads a base64 private key from path, generating one and
+// writing it readable only by the owner if the file doesn't exist
+func LoadOrCreateKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create key file: %w", err)
+		}
+		defer file.Close()
+		if _, err := fmt.Fprintln(file, base64.StdEncoding.EncodeToString(key.Bytes())); err != nil {
+			return nil, fmt.Errorf("failed to write key file: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// PublicKeyString encodes a public key the way trust files list it
+func PublicKeyString(key *ecdh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key.Bytes())
+}
+
+// ParsePublicKey decodes a base64 public key
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: %w", s, err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: %w", s, err)
+	}
+	return key, nil
+}
+
+// LoadTrustedKeys reads one base64 public key per line. Blank lines and
+// text after a # are ignored.
+func LoadTrustedKeys(path string) ([]*ecdh.PublicKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trust file: %w", err)
+	}
+	defer file.Close()
+
+	var keys []*ecdh.PublicKey
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		key, err := ParsePublicKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trust file: %w", err)
+	}
+	return keys, nil
+}
+
+// transport carries a node's unicast datagrams
+type transport interface {
+	WriteTo(data []byte, to *net.UDPAddr) error
+	ReadFrom(buf []byte) (int, *net.UDPAddr, error)
+}
+
+// plainTransport sends frames as they are
+type plainTransport struct {
+	conn   *net.UDPConn
+	filter func(*net.UDPAddr) bool
+}
+
+func (t *plainTransport) WriteTo(data []byte, to *net.UDPAddr) error {
+	_, err := t.conn.WriteToUDP(data, to)
+	return err
+}
+
+func (t *plainTransport) ReadFrom(buf []byte) (int, *net.UDPAddr, error) {
+	for {
+		n, from, err := t.conn.ReadFromUDP(buf)
+		if err != nil || t.filter == nil || !t.filter(from) {
+			return n, from, err
+		}
+	}
+}
+
+// Secure datagram types. Handshake messages carry the sender's session
+// index, and transport messages the receiver's, so keys are found by
+// index rather than by address.
+const (
+	packetInit      = 1 // type, sender index, -> e
+	packetResponse  = 2 // type, sender index, receiver index, <- e, ee, s, es
+	packetFinal     = 3 // type, receiver index, -> s, se
+	packetTransport = 4 // type, receiver index, counter, ciphertext
+)
+
+const (
+	transportHeader = 1 + 4 + 8
+	// transportOverhead is what a session adds to a frame
+	transportOverhead = transportHeader + tagSize
+	// handshakeRetry is how long to wait for a handshake response
+	handshakeRetry = time.Second
+	// handshakeAttempts bounds the retries before queued frames are dropped
+	handshakeAttempts = 5
+	// maxQueued bounds the frames held for a peer during a handshake
+	maxQueued = 16
+	// maxResponding bounds half-open handshakes, so a flood of first
+	// messages can't exhaust memory
+	maxResponding = 1024
+)
+
+// session is an established pair of transport keys with one peer
+type session struct {
+	local, remote uint32
+	send, receive *cipherState
+	window        replayWindow
+	peerKey       string
+	addr          *net.UDPAddr
+	created       time.Time
+	// confirmed is set once the peer has used the session. Until then the
+	// initiator resends final, in case it was lost.
+	confirmed bool
+	final     []byte
+	lastFinal time.Time
+}
+
+// initiation is a handshake this node started
+type initiation struct {
+	local    uint32
+	hs       *handshakeState
+	packet   []byte
+	sent     time.Time
+	attempts int
+}
+
+// responding is a handshake another node started, waiting for its final
+// message
+type responding struct {
+	hs      *handshakeState
+	remote  uint32
+	created time.Time
+}
+
+type securePeer struct {
+	current, previous *session
+	initiation        *initiation
+	queue             [][]byte
+}
+
+type datagram struct {
+	data []byte
+	to   *net.UDPAddr
+}
+
+// secureTransport runs Noise sessions over the node's UDP socket
+type secureTransport struct {
+	conn    *net.UDPConn
+	key     *ecdh.PrivateKey
+	trusted map[string]bool
+	rekey   time.Duration
+	filter  func(*net.UDPAddr) bool
+	logger  *log.Logger
+
+	mu          sync.Mutex
+	peers       map[string]*securePeer
+	sessions    map[uint32]*session
+	initiations map[uint32]*securePeer
+	responding  map[uint32]*responding
+	swept       time.Time
+}
+
+func newSecureTransport(conn *net.UDPConn, security *Security, filter func(*net.UDPAddr) bool, logger *log.Logger) (*secureTransport, error) {
+	if security.Key == nil {
+		return nil, errors.New("security needs a static key")
+	}
+	if len(security.Trusted) == 0 {
+		return nil, errors.New("security needs at least one trusted key")
+	}
+	t := &secureTransport{
+		conn:        conn,
+		key:         security.Key,
+		trusted:     map[string]bool{},
+		rekey:       security.RekeyAfter,
+		filter:      filter,
+		logger:      logger,
+		peers:       map[string]*securePeer{},
+		sessions:    map[uint32]*session{},
+		initiations: map[uint32]*securePeer{},
+		responding:  map[uint32]*responding{},
+	}
+	if t.rekey <= 0 {
+		t.rekey = 2 * time.Minute
+	}
+	for _, key := range security.Trusted {
+		t.trusted[string(key.Bytes())] = true
+	}
+	return t, nil
+}
+
+// rejectAfter is when a session is no longer accepted at all
+func (t *secureTransport) rejectAfter() time.Duration {
+	return 3 * t.rekey
+}
+
+func (t *secureTransport) peer(addr *net.UDPAddr) *securePeer {
+	p := t.peers[addr.String()]
+	if p == nil {
+		p = &securePeer{}
+		t.peers[addr.String()] = p
+	}
+	return p
+}
+
+// newIndex picks an unused random session index
+func (t *secureTransport) newIndex() uint32 {
+	var b [4]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		index := binary.BigEndian.Uint32(b[:])
+		_, used := t.sessions[index]
+		_, initiating := t.initiations[index]
+		_, responding := t.responding[index]
+		if index != 0 && !used && !initiating && !responding {
+			return index
+		}
+	}
+}
+
+func (t *secureTransport) WriteTo(data []byte, to *net.UDPAddr) error {
+	t.mu.Lock()
+	out, err := t.write(data, to, time.Now())
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return t.sendAll(out)
+}
+
+func (t *secureTransport) write(data []byte, to *net.UDPAddr, now time.Time) ([]datagram, error) {
+	p := t.peer(to)
+	var out []datagram
+	s := p.current
+	if s != nil && now.Sub(s.created) < t.rejectAfter() {
+		if now.Sub(s.created) > t.rekey && p.initiation == nil {
+			initiate, err := t.initiate(p, now)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, datagram{initiate, to})
+		}
+		if !s.confirmed && now.Sub(s.lastFinal) > handshakeRetry/4 {
+			s.lastFinal = now
+			out = append(out, datagram{s.final, to})
+		}
+		return append(out, datagram{t.seal(s, data), to}), nil
+	}
+
+	// No session yet: hold the frame and start or retry a handshake
+	if len(p.queue) == maxQueued {
+		p.queue = p.queue[1:]
+	}
+	p.queue = append(p.queue, append([]byte(nil), data...))
+	switch {
+	case p.initiation == nil:
+		initiate, err := t.initiate(p, now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, datagram{initiate, to})
+	case now.Sub(p.initiation.sent) > handshakeRetry:
+		if p.initiation.attempts >= handshakeAttempts {
+			delete(t.initiations, p.initiation.local)
+			p.initiation = nil
+			p.queue = nil
+			return nil, fmt.Errorf("no handshake response from %s", to)
+		}
+		p.initiation.attempts++
+		p.initiation.sent = now
+		out = append(out, datagram{p.initiation.packet, to})
+	}
+	return out, nil
+}
+
+// initiate starts a handshake with a peer
+func (t *secureTransport) initiate(p *securePeer, now time.Time) ([]byte, error) {
+	hs, err := newHandshake(t.key, true)
+	if err != nil {
+		return nil, err
+	}
+	local := t.newIndex()
+	packet := []byte{packetInit}
+	packet = binary.BigEndian.AppendUint32(packet, local)
+	packet = append(packet, hs.writeMessage1()...)
+	p.initiation = &initiation{local: local, hs: hs, packet: packet, sent: now, attempts: 1}
+	t.initiations[local] = p
+	return packet, nil
+}
+
+// seal encrypts a frame with the next counter
+func (t *secureTransport) seal(s *session, data []byte) []byte {
+	header := make([]byte, transportHeader, transportHeader+len(data)+tagSize)
+	header[0] = packetTransport
+	binary.BigEndian.PutUint32(header[1:5], s.remote)
+	binary.BigEndian.PutUint64(header[5:13], s.send.n)
+	sealed := s.send.aead.Seal(header, nonce(s.send.n), data, header)
+	s.send.n++
+	return sealed
+}
+
+func (t *secureTransport) sendAll(out []datagram) error {
+	for _, d := range out {
+		if _, err := t.conn.WriteToUDP(d.data, d.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *secureTransport) ReadFrom(buf []byte) (int, *net.UDPAddr, error) {
+	raw := make([]byte, maxPacket)
+	for {
+		size, from, err := t.conn.ReadFromUDP(raw)
+		if err != nil {
+			return 0, nil, err
+		}
+		if t.filter != nil && t.filter(from) {
+			continue
+		}
+		t.mu.Lock()
+		plaintext, out, err := t.handle(raw[:size], from, time.Now())
+		t.mu.Unlock()
+		if err != nil {
+			t.logger.Printf("mesh: dropped datagram from %s: %v", from, err)
+		}
+		if err := t.sendAll(out); err != nil {
+			t.logger.Printf("mesh: handshake send failed: %v", err)
+		}
+		if plaintext != nil {
+			return copy(buf, plaintext), from, nil
+		}
+	}
+}
+
+// handle processes one datagram, returning a frame if it carried one and
+// any handshake replies
+func (t *secureTransport) handle(packet []byte, from *net.UDPAddr, now time.Time) ([]byte, []datagram, error) {
+	if now.Sub(t.swept) > handshakeRetry {
+		t.sweep(now)
+	}
+	if len(packet) < 5 {
+		return nil, nil, ErrBadFrame
+	}
+	index := binary.BigEndian.Uint32(packet[1:5])
+
+	switch packet[0] {
+	case packetInit:
+		if len(t.responding) >= maxResponding {
+			return nil, nil, errors.New("too many handshakes in progress")
+		}
+		hs, err := newHandshake(t.key, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := hs.readMessage1(packet[5:]); err != nil {
+			return nil, nil, err
+		}
+		msg, err := hs.writeMessage2()
+		if err != nil {
+			return nil, nil, err
+		}
+		local := t.newIndex()
+		t.responding[local] = &responding{hs: hs, remote: index, created: now}
+		reply := []byte{packetResponse}
+		reply = binary.BigEndian.AppendUint32(reply, local)
+		reply = binary.BigEndian.AppendUint32(reply, index)
+		return nil, []datagram{{append(reply, msg...), from}}, nil
+
+	case packetResponse:
+		if len(packet) < 9 {
+			return nil, nil, ErrBadFrame
+		}
+		local := binary.BigEndian.Uint32(packet[5:9])
+		p := t.initiations[local]
+		if p == nil || p.initiation == nil || p.initiation.local != local {
+			return nil, nil, nil // a duplicate or a response to a retried attempt
+		}
+		hs := p.initiation.hs
+		if err := hs.readMessage2(packet[9:]); err != nil {
+			return nil, nil, err
+		}
+		if !t.trusted[string(hs.rs.Bytes())] {
+			return nil, nil, fmt.Errorf("untrusted key %s", PublicKeyString(hs.rs))
+		}
+		msg, err := hs.writeMessage3()
+		if err != nil {
+			return nil, nil, err
+		}
+		delete(t.initiations, local)
+		p.initiation = nil
+
+		final := []byte{packetFinal}
+		final = binary.BigEndian.AppendUint32(final, index)
+		final = append(final, msg...)
+		s := t.establish(p, hs, local, index, from, now)
+		s.final, s.lastFinal = final, now
+		out := []datagram{{final, from}}
+		return nil, append(out, t.flush(p, s, from)...), nil
+
+	case packetFinal:
+		r := t.responding[index]
+		if r == nil {
+			return nil, nil, nil // a resent final for an established session
+		}
+		delete(t.responding, index)
+		if err := r.hs.readMessage3(packet[5:]); err != nil {
+			return nil, nil, err
+		}
+		if !t.trusted[string(r.hs.rs.Bytes())] {
+			return nil, nil, fmt.Errorf("untrusted key %s", PublicKeyString(r.hs.rs))
+		}
+		p := t.peer(from)
+		s := t.establish(p, r.hs, index, r.remote, from, now)
+		s.confirmed = true
+		return nil, t.flush(p, s, from), nil
+
+	case packetTransport:
+		s := t.sessions[index]
+		if s == nil || len(packet) < transportHeader+tagSize {
+			return nil, nil, nil
+		}
+		counter := binary.BigEndian.Uint64(packet[5:13])
+		if now.Sub(s.created) > t.rejectAfter() {
+			return nil, nil, errors.New("expired session")
+		}
+		if !s.window.check(counter) {
+			return nil, nil, errors.New("replayed datagram")
+		}
+		plaintext, err := s.receive.decrypt(counter, packet[:transportHeader], packet[transportHeader:])
+		if err != nil {
+			return nil, nil, errors.New("datagram failed authentication")
+		}
+		s.window.mark(counter)
+		s.confirmed = true
+		return plaintext, nil, nil
+	}
+	return nil, nil, ErrBadFrame
+}
+
+// establish installs the keys of a finished handshake as the peer's
+// current session, keeping the last one to read late datagrams
+func (t *secureTransport) establish(p *securePeer, hs *handshakeState, local, remote uint32, addr *net.UDPAddr, now time.Time) *session {
+	send, receive := hs.transportKeys()
+	s := &session{
+		local:   local,
+		remote:  remote,
+		send:    send,
+		receive: receive,
+		peerKey: string(hs.rs.Bytes()),
+		addr:    addr,
+		created: now,
+	}
+	if p.previous != nil {
+		delete(t.sessions, p.previous.local)
+	}
+	p.previous, p.current = p.current, s
+	t.sessions[local] = s
+	return s
+}
+
+// flush sends the frames queued during the handshake
+func (t *secureTransport) flush(p *securePeer, s *session, to *net.UDPAddr) []datagram {
+	var out []datagram
+	for _, data := range p.queue {
+		out = append(out, datagram{t.seal(s, data), to})
+	}
+	p.queue = nil
+	return out
+}
+
+// sweep forgets expired sessions and abandoned handshakes
+func (t *secureTransport) sweep(now time.Time) {
+	t.swept = now
+	for index, r := range t.responding {
+		if now.Sub(r.created) > handshakeRetry*handshakeAttempts {
+			delete(t.responding, index)
+		}
+	}
+	for addr, p := range t.peers {
+		if p.previous != nil && now.Sub(p.previous.created) > t.rejectAfter() {
+			delete(t.sessions, p.previous.local)
+			p.previous = nil
+		}
+		if p.current != nil && now.Sub(p.current.created) > t.rejectAfter() {
+			delete(t.sessions, p.current.local)
+			p.current = nil
+		}
+		if p.initiation != nil && now.Sub(p.initiation.sent) > handshakeRetry*handshakeAttempts {
+			delete(t.initiations, p.initiation.local)
+			p.initiation = nil
+			p.queue = nil
+		}
+		if p.current == nil && p.previous == nil && p.initiation == nil {
+			delete(t.peers, addr)
+		}
+	}
+}
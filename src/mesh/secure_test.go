@@ -0,0 +1,280 @@
+package mesh
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) *ecdh.PrivateKey {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return key
+}
+
+func TestHandshake(t *testing.T) {
+	initiatorKey, responderKey := newKey(t), newKey(t)
+	initiator, _ := newHandshake(initiatorKey, true)
+	responder, _ := newHandshake(responderKey, false)
+
+	if err := responder.readMessage1(initiator.writeMessage1()); err != nil {
+		t.Fatalf("readMessage1 failed: %v", err)
+	}
+	msg2, err := responder.writeMessage2()
+	if err != nil {
+		t.Fatalf("writeMessage2 failed: %v", err)
+	}
+	tampered := append([]byte(nil), msg2...)
+	tampered[len(tampered)-1] ^= 1
+	spoiled := *initiator
+	spoiled.symmetric = &symmetricState{}
+	*spoiled.symmetric = *initiator.symmetric
+	if err := spoiled.readMessage2(tampered); err != ErrHandshake {
+		t.Errorf("tampered message 2 = %v", err)
+	}
+
+	if err := initiator.readMessage2(msg2); err != nil {
+		t.Fatalf("readMessage2 failed: %v", err)
+	}
+	msg3, err := initiator.writeMessage3()
+	if err != nil {
+		t.Fatalf("writeMessage3 failed: %v", err)
+	}
+	if err := responder.readMessage3(msg3); err != nil {
+		t.Fatalf("readMessage3 failed: %v", err)
+	}
+	if !initiator.rs.Equal(responderKey.PublicKey()) || !responder.rs.Equal(initiatorKey.PublicKey()) {
+		t.Fatal("static keys weren't exchanged")
+	}
+
+	iSend, iReceive := initiator.transportKeys()
+	rSend, rReceive := responder.transportKeys()
+	for _, pair := range [][2]*cipherState{{iSend, rReceive}, {rSend, iReceive}} {
+		plaintext, err := pair[1].decrypt(0, nil, pair[0].encrypt(0, nil, []byte("hello")))
+		if err != nil || string(plaintext) != "hello" {
+			t.Errorf("transport round trip = %q, %v", plaintext, err)
+		}
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		marked  []uint64
+		counter uint64
+		want    bool
+	}{
+		{"first", nil, 0, true},
+		{"repeat", []uint64{0}, 0, false},
+		{"out of order", []uint64{0, 2}, 1, true},
+		{"repeat behind top", []uint64{0, 1, 2, 5}, 1, false},
+		{"edge of window", []uint64{replayWindowBits}, 1, true},
+		{"behind window", []uint64{replayWindowBits}, 0, false},
+		{"slot reused after jump", []uint64{3, replayWindowBits + 3}, replayWindowBits + 2, true},
+		{"far jump clears", []uint64{7, 10 * replayWindowBits}, 10*replayWindowBits - 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w replayWindow
+			for _, c := range tt.marked {
+				w.mark(c)
+			}
+			if got := w.check(tt.counter); got != tt.want {
+				t.Errorf("check(%d) = %v, want %v", tt.counter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "node.key")
+	key, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey failed: %v", err)
+	}
+	again, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey failed on reload: %v", err)
+	}
+	if !key.Equal(again) {
+		t.Error("reloaded key differs")
+	}
+
+	other := newKey(t)
+	trust := "# the cluster\n" + PublicKeyString(key.PublicKey()) + "\n\n" +
+		PublicKeyString(other.PublicKey()) + " # backup\n"
+	trustPath := filepath.Join(dir, "trusted")
+	os.WriteFile(trustPath, []byte(trust), 0644)
+	keys, err := LoadTrustedKeys(trustPath)
+	if err != nil {
+		t.Fatalf("LoadTrustedKeys failed: %v", err)
+	}
+	if len(keys) != 2 || !keys[0].Equal(key.PublicKey()) || !keys[1].Equal(other.PublicKey()) {
+		t.Errorf("LoadTrustedKeys = %v", keys)
+	}
+
+	os.WriteFile(trustPath, []byte("not a key\n"), 0644)
+	if _, err := LoadTrustedKeys(trustPath); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("bad trust file error = %v", err)
+	}
+}
+
+// secureTransports are driven through handle and write, without sockets
+func newSecurePair(t *testing.T, trustB bool) (a, b *secureTransport) {
+	t.Helper()
+	keyA, keyB := newKey(t), newKey(t)
+	trustedByB := newKey(t).PublicKey()
+	if trustB {
+		trustedByB = keyA.PublicKey()
+	}
+	a, err := newSecureTransport(nil, &Security{Key: keyA, Trusted: []*ecdh.PublicKey{keyB.PublicKey()}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = newSecureTransport(nil, &Security{Key: keyB, Trusted: []*ecdh.PublicKey{trustedByB}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+var (
+	addrA = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	addrB = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}
+)
+
+// connect runs a handshake started by a writing frame, returning what a
+// sent after it and what b received
+func connect(t *testing.T, a, b *secureTransport, frame []byte, now time.Time) ([]datagram, []byte) {
+	t.Helper()
+	out, err := a.write(frame, addrB, now)
+	if err != nil || len(out) != 1 || out[0].data[0] != packetInit {
+		t.Fatalf("write without a session = %v, %v", out, err)
+	}
+	_, replies, err := b.handle(out[0].data, addrA, now)
+	if err != nil || len(replies) != 1 {
+		t.Fatalf("init handled with %v, %v", replies, err)
+	}
+	_, out, err = a.handle(replies[0].data, addrB, now)
+	if err != nil || len(out) != 2 || out[0].data[0] != packetFinal {
+		t.Fatalf("response handled with %v, %v", out, err)
+	}
+	if _, _, err := b.handle(out[0].data, addrA, now); err != nil {
+		return out, nil
+	}
+	received, _, err := b.handle(out[1].data, addrA, now)
+	if err != nil {
+		t.Fatalf("queued frame dropped: %v", err)
+	}
+	return out, received
+}
+
+func TestSecureSession(t *testing.T) {
+	now := time.Now()
+	a, b := newSecurePair(t, true)
+	out, received := connect(t, a, b, []byte("queued"), now)
+	if string(received) != "queued" {
+		t.Fatalf("received %q", received)
+	}
+
+	if _, _, err := b.handle(out[1].data, addrA, now); err == nil {
+		t.Error("replayed datagram accepted")
+	}
+	out, _ = a.write([]byte("second"), addrB, now)
+	sealed := out[len(out)-1].data
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, err := b.handle(tampered, addrA, now); err == nil {
+		t.Error("tampered datagram accepted")
+	}
+	if got, _, err := b.handle(sealed, addrA, now); err != nil || string(got) != "second" {
+		t.Errorf("received %q, %v after a tampered copy", got, err)
+	}
+
+	// b answering confirms the session, so a stops resending its final message
+	out, _ = b.write([]byte("reply"), addrA, now)
+	if got, _, err := a.handle(out[0].data, addrB, now); err != nil || string(got) != "reply" {
+		t.Fatalf("reply = %q, %v", got, err)
+	}
+	if out, _ = a.write([]byte("x"), addrB, now.Add(time.Second)); len(out) != 1 {
+		t.Errorf("confirmed session sent %d datagrams", len(out))
+	}
+
+	// After RekeyAfter a handshake starts while the old session carries on
+	later := now.Add(a.rekey + time.Second)
+	out, _ = a.write([]byte("old keys"), addrB, later)
+	if len(out) != 2 || out[0].data[0] != packetInit {
+		t.Fatalf("rekey sent %v", out)
+	}
+	if got, _, err := b.handle(out[1].data, addrA, later); err != nil || string(got) != "old keys" {
+		t.Errorf("old session frame = %q, %v", got, err)
+	}
+}
+
+func TestSecureUntrusted(t *testing.T) {
+	a, b := newSecurePair(t, false)
+	out, received := connect(t, a, b, []byte("let me in"), time.Now())
+	if received != nil {
+		t.Fatal("untrusted node's frame received")
+	}
+	if got, _, _ := b.handle(out[1].data, addrA, time.Now()); got != nil {
+		t.Error("frame from an untrusted session accepted")
+	}
+	if len(b.sessions) != 0 {
+		t.Errorf("b kept %d sessions", len(b.sessions))
+	}
+}
+
+func TestSecureMesh(t *testing.T) {
+	p := &partition{}
+	keyA, keyB, keyC := newKey(t), newKey(t), newKey(t)
+	cluster := []*ecdh.PublicKey{keyA.PublicKey(), keyB.PublicKey()}
+	secure := func(id NodeID, key *ecdh.PrivateKey) *Node {
+		t.Helper()
+		self := new(string)
+		n, err := New(Config{
+			ID:            id,
+			BindAddr:      "127.0.0.1:0",
+			ProbeInterval: 50 * time.Millisecond,
+			Security:      &Security{Key: key, Trusted: cluster},
+			filter:        p.filter(self),
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		p.mu.Lock()
+		*self = n.Addr().String()
+		p.mu.Unlock()
+		t.Cleanup(func() { n.Close() })
+		return n
+	}
+	a, b, c := secure("a", keyA), secure("b", keyB), secure("c", keyC)
+
+	join(t, b, a)
+	if err := b.Send("a", []byte("sealed")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if m := receive(t, a); !bytes.Equal(m.Payload, []byte("sealed")) {
+		t.Errorf("a received %q", m.Payload)
+	}
+
+	if err := c.Join(a.Addr().String()); err == nil {
+		t.Error("untrusted node joined")
+	}
+	if _, found := stateOf(a, "c"); found {
+		t.Error("a lists the untrusted node")
+	}
+
+	if _, err := New(Config{BindAddr: "127.0.0.1:0", Security: &Security{Key: keyA}}); err == nil {
+		t.Error("security without trusted keys accepted")
+	}
+}
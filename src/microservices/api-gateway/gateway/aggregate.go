@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamError is a non-2xx response from an upstream
+type upstreamError struct {
+	status int
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("upstream returned status %d", e.status)
+}
+
+// userSummary returns a user with their most recent orders, fetched from the
+// users and orders upstreams in parallel. If the orders upstream fails the
+// user is still returned, marked with orders_unavailable. Users can only
+// fetch their own summary.
+func (g *Gateway) userSummary(c *gin.Context) {
+	if !requireAuth(c) {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if userSubject(c) != strconv.Itoa(id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot view another user"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	requestID := c.GetString(requestIDKey)
+
+	var user map[string]interface{}
+	var orders []map[string]interface{}
+	var userErr, ordersErr error
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		userErr = g.fetchJSON(ctx, "users", fmt.Sprintf("/users/%d", id), requestID, &user)
+	}()
+	go func() {
+		defer wg.Done()
+		ordersErr = g.fetchJSON(ctx, "orders", fmt.Sprintf("/orders?user_id=%d&limit=%d", id, limit), requestID, &orders)
+	}()
+	wg.Wait()
+
+	if userErr != nil {
+		if e, ok := userErr.(*upstreamError); ok && e.status == http.StatusNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "User service unavailable"})
+		return
+	}
+
+	response := gin.H{"user": user}
+	if ordersErr != nil {
+		response["orders"] = []interface{}{}
+		response["orders_unavailable"] = true
+	} else {
+		// order-service lists newest first
+		if len(orders) > limit {
+			orders = orders[:limit]
+		}
+		if orders == nil {
+			orders = []map[string]interface{}{}
+		}
+		response["orders"] = orders
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// fetchJSON GETs path from a healthy target of the named upstream
+func (g *Gateway) fetchJSON(ctx context.Context, upstream, path, requestID string, out interface{}) error {
+	pool, ok := g.pools[upstream]
+	if !ok {
+		return fmt.Errorf("upstream %q not configured", upstream)
+	}
+	target := pool.Next()
+	if target == nil {
+		return fmt.Errorf("no healthy %s upstream", upstream)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, singleJoin(target.URL.String(), path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(RequestIDHeader, requestID)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &upstreamError{status: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
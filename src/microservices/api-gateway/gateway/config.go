@@ -0,0 +1,177 @@
+// Package gateway implements the API gateway: configurable routes to
+// upstream services, JWT validation at the edge, per-client rate limiting,
+// request-ID propagation, aggregation endpoints and upstream health checks.
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the gateway configuration, loaded from YAML or built from env
+type Config struct {
+	JWKSURL     string                    `yaml:"jwks_url"` // where token verification keys are published
+	RateLimit   RateLimitConfig           `yaml:"rate_limit"`
+	HealthCheck HealthCheckConfig         `yaml:"health_check"`
+	Upstreams   map[string]UpstreamConfig `yaml:"upstreams"`
+	Routes      []Route                   `yaml:"routes"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For header is
+	// believed for the client IP. With none, the peer address is used.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// RateLimitConfig limits requests per client, keyed by user or IP
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"` // 0 disables limiting
+	Burst             int `yaml:"burst"`
+}
+
+// HealthCheckConfig controls active upstream health checks
+type HealthCheckConfig struct {
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // failures before ejection
+	HealthyThreshold   int           `yaml:"healthy_threshold"`   // successes before re-admission
+}
+
+// UpstreamConfig is a named group of interchangeable service instances
+type UpstreamConfig struct {
+	Targets    []string `yaml:"targets"`
+	HealthPath string   `yaml:"health_path"`
+}
+
+// Route forwards requests under Prefix to an upstream, replacing the prefix
+// with Rewrite. Routes are matched longest prefix first.
+type Route struct {
+	Prefix   string `yaml:"prefix"`
+	Upstream string `yaml:"upstream"`
+	Rewrite  string `yaml:"rewrite"`
+	Public   bool   `yaml:"public"` // no token required
+}
+
+// DefaultConfig routes to user-service and order-service at the given URLs
+// and verifies tokens with the user service's JWKS
+func DefaultConfig(userServiceURL, orderServiceURL string) *Config {
+	userTargets := splitTargets(userServiceURL)
+	cfg := &Config{
+		RateLimit: RateLimitConfig{RequestsPerMinute: 60, Burst: 20},
+		Upstreams: map[string]UpstreamConfig{
+			"users":  {Targets: userTargets},
+			"orders": {Targets: splitTargets(orderServiceURL)},
+		},
+		Routes: []Route{
+			{Prefix: "/api/users/register", Upstream: "users", Rewrite: "/register", Public: true},
+			{Prefix: "/api/users/login", Upstream: "users", Rewrite: "/login", Public: true},
+			{Prefix: "/api/users/token", Upstream: "users", Rewrite: "/token", Public: true},
+			{Prefix: "/api/users/logout", Upstream: "users", Rewrite: "/logout", Public: true},
+			{Prefix: "/api/users/verify-email", Upstream: "users", Rewrite: "/verify-email", Public: true},
+			{Prefix: "/api/users", Upstream: "users", Rewrite: "/users"},
+			{Prefix: "/api/orders", Upstream: "orders", Rewrite: "/orders"},
+		},
+	}
+	if len(userTargets) > 0 {
+		cfg.JWKSURL = userTargets[0] + "/.well-known/jwks.json"
+	}
+	cfg.applyDefaults()
+	return cfg
+}
+
+// LoadConfig reads a YAML config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that every route points at a configured upstream
+func (cfg *Config) Validate() error {
+	if cfg.JWKSURL == "" {
+		return fmt.Errorf("jwks_url is required")
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trusted proxy %q is not an IP or CIDR", proxy)
+		}
+	}
+	for name, upstream := range cfg.Upstreams {
+		if len(upstream.Targets) == 0 {
+			return fmt.Errorf("upstream %q has no targets", name)
+		}
+	}
+	for _, route := range cfg.Routes {
+		if !strings.HasPrefix(route.Prefix, "/") {
+			return fmt.Errorf("route prefix %q must start with /", route.Prefix)
+		}
+		if _, ok := cfg.Upstreams[route.Upstream]; !ok {
+			return fmt.Errorf("route %s uses unknown upstream %q", route.Prefix, route.Upstream)
+		}
+	}
+	return nil
+}
+
+// applyDefaults fills in unset settings and orders routes by prefix length
+func (cfg *Config) applyDefaults() {
+	if cfg.RateLimit.Burst <= 0 {
+		cfg.RateLimit.Burst = cfg.RateLimit.RequestsPerMinute
+	}
+	if cfg.HealthCheck.Interval <= 0 {
+		cfg.HealthCheck.Interval = 10 * time.Second
+	}
+	if cfg.HealthCheck.Timeout <= 0 {
+		cfg.HealthCheck.Timeout = 2 * time.Second
+	}
+	if cfg.HealthCheck.UnhealthyThreshold <= 0 {
+		cfg.HealthCheck.UnhealthyThreshold = 3
+	}
+	if cfg.HealthCheck.HealthyThreshold <= 0 {
+		cfg.HealthCheck.HealthyThreshold = 2
+	}
+	for name, upstream := range cfg.Upstreams {
+		if upstream.HealthPath == "" {
+			upstream.HealthPath = "/health"
+			cfg.Upstreams[name] = upstream
+		}
+	}
+
+	sort.SliceStable(cfg.Routes, func(i, j int) bool {
+		return len(cfg.Routes[i].Prefix) > len(cfg.Routes[j].Prefix)
+	})
+}
+
+// match returns the route for path, matching whole path segments only
+func (cfg *Config) match(path string) (Route, bool) {
+	for _, route := range cfg.Routes {
+		if path == route.Prefix || strings.HasPrefix(path, strings.TrimSuffix(route.Prefix, "/")+"/") {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// splitTargets splits a comma-separated list of upstream URLs
+func splitTargets(value string) []string {
+	var targets []string
+	for _, target := range strings.Split(value, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, strings.TrimRight(target, "/"))
+		}
+	}
+	return targets
+}
@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gateway routes client requests to upstream services
+type Gateway struct {
+	cfg     *Config
+	pools   map[string]*Pool
+	limiter *RateLimiter
+	jwks    *JWKSCache
+	client  *http.Client // for aggregation calls
+	cancel  context.CancelFunc
+}
+
+// New creates a gateway from a validated config
+func New(cfg *Config) (*Gateway, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := &Gateway{
+		cfg:    cfg,
+		pools:  make(map[string]*Pool),
+		client: &http.Client{Timeout: 5 * time.Second},
+		jwks:   NewJWKSCache(cfg.JWKSURL),
+		cancel: func() {},
+	}
+	for name, upstream := range cfg.Upstreams {
+		pool, err := NewPool(name, upstream)
+		if err != nil {
+			return nil, err
+		}
+		g.pools[name] = pool
+	}
+	if cfg.RateLimit.RequestsPerMinute > 0 {
+		g.limiter = NewRateLimiter(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+	}
+	return g, nil
+}
+
+// StartHealthChecks probes upstreams in the background until Close
+func (g *Gateway) StartHealthChecks() {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	for _, pool := range g.pools {
+		go pool.runHealthChecks(ctx, g.cfg.HealthCheck)
+	}
+}
+
+// Close stops the health checks
+func (g *Gateway) Close() {
+	g.cancel()
+}
+
+// Router returns the gateway's routes. Anything not handled by the gateway
+// itself is matched against the configured routes and proxied.
+func (g *Gateway) Router() *gin.Engine {
+	r := gin.Default()
+	if err := r.SetTrustedProxies(g.cfg.TrustedProxies); err != nil {
+		// Validate checked the list; fall back to trusting no proxy rather
+		// than gin's default of trusting every one
+		log.Printf("Invalid trusted proxies, ignoring X-Forwarded-For: %v", err)
+		r.SetTrustedProxies(nil)
+	}
+	r.Use(requestID(), authenticate(g.jwks))
+	if g.limiter != nil {
+		r.Use(rateLimit(g.limiter))
+	}
+
+	r.GET("/health", g.health)
+	r.GET("/api/aggregate/users/:id", g.userSummary)
+	r.NoRoute(g.proxy)
+
+	return r
+}
+
+// health reports the gateway's view of every upstream
+func (g *Gateway) health(c *gin.Context) {
+	status, code := "healthy", http.StatusOK
+	upstreams := gin.H{}
+	for name, pool := range g.pools {
+		healthy := pool.HealthyCount()
+		if healthy == 0 {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+		upstreams[name] = gin.H{"healthy": healthy, "targets": len(pool.Targets)}
+	}
+
+	c.JSON(code, gin.H{
+		"status":    status,
+		"service":   "api-gateway",
+		"upstreams": upstreams,
+		"time":      time.Now().Unix(),
+	})
+}
+
+// proxy forwards a request to the upstream of its route
+func (g *Gateway) proxy(c *gin.Context) {
+	route, ok := g.cfg.match(c.Request.URL.Path)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+		return
+	}
+	if !route.Public && !requireAuth(c) {
+		return
+	}
+
+	pool := g.pools[route.Upstream]
+	target := pool.Next()
+	if target == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("No healthy %s upstream", route.Upstream)})
+		return
+	}
+
+	requestID := c.GetString(requestIDKey)
+	email, userID := userEmail(c), userSubject(c)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target.URL)
+			pr.Out.URL.Path = singleJoin(target.URL.Path, route.Rewrite+strings.TrimPrefix(pr.In.URL.Path, route.Prefix))
+			pr.Out.URL.RawPath = ""
+			pr.SetXForwarded()
+
+			// Identity headers are set by the gateway only, never by clients
+			pr.Out.Header.Del(UserEmailHeader)
+			pr.Out.Header.Del(UserIDHeader)
+			if email != "" {
+				pr.Out.Header.Set(UserEmailHeader, email)
+			}
+			if userID != "" {
+				pr.Out.Header.Set(UserIDHeader, userID)
+			}
+			pr.Out.Header.Set(RequestIDHeader, requestID)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("[%s] upstream %s (%s) failed: %v", requestID, route.Upstream, target.URL, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"error":"Upstream unavailable"}`))
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// singleJoin joins a target base path and a request path with one slash
+func singleJoin(base, path string) string {
+	if path == "" {
+		path = "/"
+	}
+	if base == "" || base == "/" {
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,303 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// echoUpstream responds with the path, request ID and user it received
+func echoUpstream(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":       r.URL.RequestURI(),
+			"request_id": r.Header.Get(RequestIDHeader),
+			"user":       r.Header.Get(UserEmailHeader),
+			"user_id":    r.Header.Get(UserIDHeader),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestGateway serves the gateway over HTTP, since the reverse proxy
+// needs a real connection rather than a ResponseRecorder
+func newTestGateway(t *testing.T, cfg *Config) string {
+	gin.SetMode(gin.TestMode)
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "OKP", "crv": "Ed25519", "kid": testKeyID, "alg": "EdDSA",
+			"x": base64.RawURLEncoding.EncodeToString(testKey.Public().(ed25519.PublicKey)),
+		}}})
+	}))
+	t.Cleanup(jwks.Close)
+	cfg.JWKSURL = jwks.URL
+
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	server := httptest.NewServer(gw.Router())
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// testKey signs tokens the way the user service does, published by the
+// JWKS server of newTestGateway
+var testKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+const testKeyID = "test-key"
+
+// signToken signs an access token for the user with the given ID
+func signToken(t *testing.T, id int, email string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"sub":   strconv.Itoa(id),
+		"email": email,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(testKey)
+	if err != nil {
+		t.Fatalf("SignedString failed: %v", err)
+	}
+	return signed
+}
+
+// get requests path from the gateway and records the response
+func get(t *testing.T, gatewayURL, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", gatewayURL+path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	rec := httptest.NewRecorder()
+	for k, v := range resp.Header {
+		rec.Header()[k] = v
+	}
+	rec.WriteHeader(resp.StatusCode)
+	io.Copy(rec, resp.Body)
+	return rec
+}
+
+func TestProxyRoutesAndAuth(t *testing.T) {
+	upstream := echoUpstream(t)
+	router := newTestGateway(t, DefaultConfig(upstream.URL, upstream.URL))
+	token := signToken(t, 1, "ada@example.com")
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": "mallory@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		code     int
+		upstream string
+	}{
+		{"public route", "/api/users/login", nil, http.StatusOK, "/login"},
+		{"missing token", "/api/orders", nil, http.StatusUnauthorized, ""},
+		{"bad token", "/api/orders", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized, ""},
+		{"HS256 token", "/api/orders", map[string]string{"Authorization": "Bearer " + hmacToken}, http.StatusUnauthorized, ""},
+		{"rewrite with query", "/api/orders/7?expand=items", map[string]string{"Authorization": "Bearer " + token}, http.StatusOK, "/orders/7?expand=items"},
+		{"segment boundary", "/api/ordersx", map[string]string{"Authorization": "Bearer " + token}, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		rec := get(t, router, tt.path, tt.headers)
+		if rec.Code != tt.code {
+			t.Errorf("%s: got %d; want %d", tt.name, rec.Code, tt.code)
+			continue
+		}
+		if tt.upstream == "" {
+			continue
+		}
+		var seen map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &seen)
+		if seen["path"] != tt.upstream {
+			t.Errorf("%s: upstream saw %q; want %q", tt.name, seen["path"], tt.upstream)
+		}
+	}
+}
+
+func TestRequestIDAndIdentityPropagation(t *testing.T) {
+	upstream := echoUpstream(t)
+	router := newTestGateway(t, DefaultConfig(upstream.URL, upstream.URL))
+
+	rec := get(t, router, "/api/orders", map[string]string{
+		"Authorization": "Bearer " + signToken(t, 1, "ada@example.com"),
+		RequestIDHeader: "req-123",
+		UserEmailHeader: "mallory@example.com",
+		UserIDHeader:    "2",
+	})
+	var seen map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &seen)
+
+	if seen["request_id"] != "req-123" || rec.Header().Get(RequestIDHeader) != "req-123" {
+		t.Errorf("request ID not propagated: upstream %q, response %q", seen["request_id"], rec.Header().Get(RequestIDHeader))
+	}
+	if seen["user"] != "ada@example.com" {
+		t.Errorf("upstream saw user %q; want the token's email", seen["user"])
+	}
+	if seen["user_id"] != "1" {
+		t.Errorf("upstream saw user ID %q; want the token's subject", seen["user_id"])
+	}
+
+	rec = get(t, router, "/api/users/login", nil)
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Errorf("no request ID generated")
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	upstream := echoUpstream(t)
+	cfg := DefaultConfig(upstream.URL, upstream.URL)
+	cfg.RateLimit = RateLimitConfig{RequestsPerMinute: 2, Burst: 2}
+	router := newTestGateway(t, cfg)
+
+	ada := map[string]string{"Authorization": "Bearer " + signToken(t, 1, "ada@example.com")}
+	for i := 0; i < 2; i++ {
+		if rec := get(t, router, "/api/orders", ada); rec.Code != http.StatusOK {
+			t.Fatalf("request %d got %d; want 200", i+1, rec.Code)
+		}
+	}
+	if rec := get(t, router, "/api/orders", ada); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("third request got %d; want 429", rec.Code)
+	}
+
+	grace := map[string]string{"Authorization": "Bearer " + signToken(t, 2, "grace@example.com")}
+	if rec := get(t, router, "/api/orders", grace); rec.Code != http.StatusOK {
+		t.Errorf("another user got %d; want their own bucket", rec.Code)
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	upstream := echoUpstream(t)
+	tests := []struct {
+		name    string
+		proxies []string
+		want    int
+	}{
+		{"untrusted peer", nil, http.StatusTooManyRequests},
+		{"trusted proxy", []string{"127.0.0.1"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig(upstream.URL, upstream.URL)
+			cfg.RateLimit = RateLimitConfig{RequestsPerMinute: 2, Burst: 2}
+			cfg.TrustedProxies = tt.proxies
+			router := newTestGateway(t, cfg)
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < 3; i++ {
+				spoofed := map[string]string{"X-Forwarded-For": fmt.Sprintf("203.0.113.%d", i+1)}
+				rec = get(t, router, "/api/users/login", spoofed)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("third request got %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthCheckEjection(t *testing.T) {
+	var failing atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer flaky.Close()
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer stable.Close()
+
+	pool, err := NewPool("users", UpstreamConfig{Targets: []string{flaky.URL, stable.URL}, HealthPath: "/health"})
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	cfg := HealthCheckConfig{UnhealthyThreshold: 2, HealthyThreshold: 2}
+	check := func() { pool.CheckHealth(context.Background(), http.DefaultClient, cfg) }
+
+	failing.Store(true)
+	check()
+	if pool.HealthyCount() != 2 {
+		t.Fatalf("target ejected after one failure")
+	}
+	check()
+	if pool.HealthyCount() != 1 {
+		t.Fatalf("target not ejected after two failures")
+	}
+	for i := 0; i < 4; i++ {
+		if target := pool.Next(); target.URL.String() != stable.URL {
+			t.Fatalf("ejected target %s still receiving traffic", target.URL)
+		}
+	}
+
+	failing.Store(false)
+	check()
+	check()
+	if pool.HealthyCount() != 2 {
+		t.Errorf("target not restored after recovering")
+	}
+}
+
+func TestUserSummaryAggregation(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":1,"name":"Ada"}`))
+	}))
+	defer users.Close()
+	orders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":3},{"id":2},{"id":1}]`))
+	}))
+
+	router := newTestGateway(t, DefaultConfig(users.URL, orders.URL))
+	auth := map[string]string{"Authorization": "Bearer " + signToken(t, 1, "ada@example.com")}
+
+	rec := get(t, router, "/api/aggregate/users/1?limit=2", auth)
+	var summary struct {
+		User   map[string]interface{}   `json:"user"`
+		Orders []map[string]interface{} `json:"orders"`
+		Down   bool                     `json:"orders_unavailable"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &summary)
+	if rec.Code != http.StatusOK || summary.User["name"] != "Ada" || len(summary.Orders) != 2 || summary.Down {
+		t.Errorf("unexpected summary %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := get(t, router, "/api/aggregate/users/2", auth); rec.Code != http.StatusForbidden {
+		t.Errorf("another user's summary got %d; want 403", rec.Code)
+	}
+	grace := map[string]string{"Authorization": "Bearer " + signToken(t, 2, "grace@example.com")}
+	if rec := get(t, router, "/api/aggregate/users/2", grace); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user got %d; want 404", rec.Code)
+	}
+
+	orders.Close()
+	rec = get(t, router, "/api/aggregate/users/1", auth)
+	json.Unmarshal(rec.Body.Bytes(), &summary)
+	if rec.Code != http.StatusOK || !summary.Down {
+		t.Errorf("orders outage not degraded gracefully: %d %s", rec.Code, rec.Body)
+	}
+}
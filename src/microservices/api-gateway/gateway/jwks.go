@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwk is a public key from a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// verificationKey is a parsed public key and the algorithm it verifies
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKSCache verifies tokens with keys fetched from a JWKS endpoint. Keys are
+// refetched when they age past ttl or a token names an unknown kid, which is
+// how keys rotated by the user service are picked up.
+type JWKSCache struct {
+	url         string
+	client      *http.Client
+	ttl         time.Duration
+	minInterval time.Duration // least time between refetches for unknown kids
+
+	mu        sync.Mutex
+	keys      map[string]verificationKey
+	fetchedAt time.Time
+}
+
+// NewJWKSCache creates a cache for the JWKS at url
+func NewJWKSCache(url string) *JWKSCache {
+	return &JWKSCache{
+		url:         url,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		ttl:         5 * time.Minute,
+		minInterval: 10 * time.Second,
+		keys:        make(map[string]verificationKey),
+	}
+}
+
+// Keyfunc resolves the verification key of a token by its kid header
+func (jc *JWKSCache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+
+	key, ok := jc.keys[kid]
+	age := time.Since(jc.fetchedAt)
+	if age > jc.ttl || (!ok && age > jc.minInterval) {
+		if err := jc.refresh(); err != nil && !ok {
+			return nil, err
+		}
+		key, ok = jc.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("token algorithm %s does not match key", token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// refresh replaces the cached keys. Callers hold mu.
+func (jc *JWKSCache) refresh() error {
+	jc.fetchedAt = time.Now()
+
+	resp, err := jc.client.Get(jc.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if key, err := parseJWK(k); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	jc.keys = keys
+	return nil
+}
+
+// parseJWK decodes an RSA or Ed25519 public key
+func parseJWK(k jwk) (verificationKey, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return verificationKey{alg: "RS256", key: pub}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, fmt.Errorf("invalid Ed25519 key %q", k.Kid)
+		}
+		return verificationKey{alg: "EdDSA", key: ed25519.PublicKey(x)}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// RequestIDHeader carries the request ID to upstreams and back to clients
+	RequestIDHeader = "X-Request-ID"
+	// UserEmailHeader carries the authenticated user's email to upstreams
+	UserEmailHeader = "X-User-Email"
+	// UserIDHeader carries the authenticated user's ID, the token subject,
+	// to upstreams so they can limit requests to that user's data
+	UserIDHeader = "X-User-ID"
+
+	claimsKey    = "claims"
+	requestIDKey = "request_id"
+)
+
+// requestID reuses the client's request ID or generates one, and echoes it
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// newRequestID returns 16 random bytes in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// authenticate validates a bearer token if one is sent. Requests without a
+// token pass through; routes that need one check with requireAuth.
+func authenticate(jwks *JWKSCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header"})
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(tokenString, claims, jwks.Keyfunc, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// requireAuth rejects requests that authenticate didn't accept a token for
+func requireAuth(c *gin.Context) bool {
+	if _, ok := c.Get(claimsKey); !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+		return false
+	}
+	return true
+}
+
+// userEmail returns the email claim of the authenticated user
+func userEmail(c *gin.Context) string {
+	if claims, ok := c.Get(claimsKey); ok {
+		email, _ := claims.(jwt.MapClaims)["email"].(string)
+		return email
+	}
+	return ""
+}
+
+// userSubject returns the subject claim, the authenticated user's ID
+func userSubject(c *gin.Context) string {
+	if claims, ok := c.Get(claimsKey); ok {
+		subject, _ := claims.(jwt.MapClaims)["sub"].(string)
+		return subject
+	}
+	return ""
+}
+
+// clientLimiter is a token bucket per client with its last use
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps a token bucket per client, keyed by user or IP
+type RateLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	limit   rate.Limit
+	burst   int
+	idle    time.Duration
+}
+
+// NewRateLimiter allows perMinute requests per client with the given burst
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		clients: make(map[string]*clientLimiter),
+		limit:   rate.Limit(float64(perMinute) / 60),
+		burst:   burst,
+		idle:    10 * time.Minute,
+	}
+}
+
+// Allow reports whether the client may make a request now
+func (rl *RateLimiter) Allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	client, ok := rl.clients[key]
+	if !ok {
+		// Sweep idle clients as new ones arrive so the map stays bounded
+		for k, c := range rl.clients {
+			if now.Sub(c.lastSeen) > rl.idle {
+				delete(rl.clients, k)
+			}
+		}
+		client = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[key] = client
+	}
+	client.lastSeen = now
+	return client.limiter.AllowN(now, 1)
+}
+
+// rateLimit limits authenticated users by email and others by client IP.
+// The IP only comes from X-Forwarded-For when the peer is a trusted proxy.
+func rateLimit(rl *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if email := userEmail(c); email != "" {
+			key = "user:" + email
+		}
+
+		if !rl.Allow(key) {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
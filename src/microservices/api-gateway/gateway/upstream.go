@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Target is one instance of an upstream service
+type Target struct {
+	URL *url.URL
+
+	mu        sync.Mutex
+	healthy   bool
+	failures  int // consecutive failed checks
+	successes int // consecutive passed checks
+}
+
+// Healthy reports whether the target is receiving traffic
+func (t *Target) Healthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.healthy
+}
+
+// record applies a health check result, ejecting the target after
+// unhealthy consecutive failures and re-admitting it after healthy successes.
+// It reports whether the target's state changed.
+func (t *Target) record(ok bool, unhealthy, healthy int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ok {
+		t.failures = 0
+		t.successes++
+		if !t.healthy && t.successes >= healthy {
+			t.healthy = true
+			return true
+		}
+		return false
+	}
+
+	t.successes = 0
+	t.failures++
+	if t.healthy && t.failures >= unhealthy {
+		t.healthy = false
+		return true
+	}
+	return false
+}
+
+// Pool balances requests round-robin across the healthy targets of an upstream
+type Pool struct {
+	Name       string
+	HealthPath string
+	Targets    []*Target
+
+	next uint32
+}
+
+// NewPool creates a pool with every target initially healthy
+func NewPool(name string, cfg UpstreamConfig) (*Pool, error) {
+	pool := &Pool{Name: name, HealthPath: cfg.HealthPath}
+	for _, raw := range cfg.Targets {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("upstream %s: invalid target %q", name, raw)
+		}
+		pool.Targets = append(pool.Targets, &Target{URL: u, healthy: true})
+	}
+	return pool, nil
+}
+
+// Next returns the next healthy target, or nil if all are ejected
+func (p *Pool) Next() *Target {
+	n := len(p.Targets)
+	start := int(atomic.AddUint32(&p.next, 1))
+	for i := 0; i < n; i++ {
+		target := p.Targets[(start+i)%n]
+		if target.Healthy() {
+			return target
+		}
+	}
+	return nil
+}
+
+// HealthyCount returns the number of targets receiving traffic
+func (p *Pool) HealthyCount() int {
+	count := 0
+	for _, target := range p.Targets {
+		if target.Healthy() {
+			count++
+		}
+	}
+	return count
+}
+
+// CheckHealth probes every target once
+func (p *Pool) CheckHealth(ctx context.Context, client *http.Client, cfg HealthCheckConfig) {
+	var wg sync.WaitGroup
+	for _, target := range p.Targets {
+		wg.Add(1)
+		go func(target *Target) {
+			defer wg.Done()
+
+			ok := probe(ctx, client, target.URL.String()+p.HealthPath)
+			if target.record(ok, cfg.UnhealthyThreshold, cfg.HealthyThreshold) {
+				state := "ejected"
+				if ok {
+					state = "restored"
+				}
+				log.Printf("upstream %s: target %s %s", p.Name, target.URL, state)
+			}
+		}(target)
+	}
+	wg.Wait()
+}
+
+// runHealthChecks probes the pool every interval until ctx is cancelled
+func (p *Pool) runHealthChecks(ctx context.Context, cfg HealthCheckConfig) {
+	client := &http.Client{Timeout: cfg.Timeout}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.CheckHealth(ctx, client, cfg)
+		}
+	}
+}
+
+// probe reports whether a GET of url returns a 2xx status
+func probe(ctx context.Context, client *http.Client, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"api-gateway/gateway"
+)
+
+func main() {
+	cfg := gateway.DefaultConfig(
+		getEnv("USER_SERVICE_URL", "http://localhost:8081"),
+		getEnv("ORDER_SERVICE_URL", "http://localhost:8082"),
+	)
+	if path := os.Getenv("GATEWAY_CONFIG"); path != "" {
+		loaded, err := gateway.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load gateway config: %v", err)
+		}
+		cfg = loaded
+	}
+	if url := os.Getenv("JWKS_URL"); url != "" {
+		cfg.JWKSURL = url
+	}
+	if limit, err := strconv.Atoi(os.Getenv("RATE_LIMIT")); err == nil {
+		cfg.RateLimit.RequestsPerMinute = limit
+		cfg.RateLimit.Burst = limit
+	}
+
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.TrustedProxies = nil
+		for _, proxy := range strings.Split(proxies, ",") {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, strings.TrimSpace(proxy))
+		}
+	}
+
+	gw, err := gateway.New(cfg)
+	if err != nil {
+		log.Fatalf("Invalid gateway config: %v", err)
+	}
+	gw.StartHealthChecks()
+	defer gw.Close()
+
+	port := getEnv("PORT", "8080")
+	if err := gw.Router().Run(":" + port); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
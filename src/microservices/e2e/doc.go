@@ -0,0 +1,3 @@
+// Package e2e holds end-to-end tests that boot the microservices in-process
+// and exercise them over real HTTP.
+package e2e
@@ -0,0 +1,78 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"user-service/events"
+	"user-service/users"
+)
+
+// TestUserEventsReachWebhookConsumer registers and deletes a user and checks
+// a downstream consumer sees each event once, even when it is redelivered
+func TestUserEventsReachWebhookConsumer(t *testing.T) {
+	var mu sync.Mutex
+	var received []events.Event
+	consumer := httptest.NewServer(events.WebhookHandler("shared-secret", events.NewDeduplicator(1000), func(e events.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e)
+		return nil
+	}))
+	t.Cleanup(consumer.Close)
+
+	repo := users.NewMemoryRepository()
+	userService, err := users.NewServer(users.DefaultConfig(), repo)
+	if err != nil {
+		t.Fatalf("users.NewServer failed: %v", err)
+	}
+	userServer := httptest.NewServer(userService.Router())
+	t.Cleanup(userServer.Close)
+
+	webhook := events.NewWebhookPublisher(consumer.URL, "shared-secret")
+	relay := events.NewRelay(repo, webhook, 0)
+
+	var user users.User
+	postJSON(t, "POST", userServer.URL+"/register", map[string]string{
+		"name": "Katherine", "email": "katherine@example.com", "password": "password123",
+	}, &user)
+	var login struct {
+		Token string `json:"token"`
+	}
+	postJSON(t, "POST", userServer.URL+"/login", map[string]string{
+		"email": "katherine@example.com", "password": "password123",
+	}, &login)
+
+	req, _ := http.NewRequest("DELETE", userServer.URL+"/users/"+strconv.Itoa(user.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete user failed: %v %v", err, resp)
+	}
+	resp.Body.Close()
+
+	// Simulate a relay that crashed after publishing but before marking
+	pending, _ := repo.Pending(context.Background(), 10)
+	for _, event := range pending {
+		webhook.Publish(context.Background(), event)
+	}
+	if _, err := relay.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[0].Type != events.UserRegistered || received[1].Type != events.UserDeleted {
+		t.Fatalf("consumer received %+v; want UserRegistered then UserDeleted once each", received)
+	}
+	var registered users.User
+	json.Unmarshal(received[0].Data, &registered)
+	if registered.Email != "katherine@example.com" || registered.ID != user.ID {
+		t.Errorf("UserRegistered payload = %s", received[0].Data)
+	}
+}
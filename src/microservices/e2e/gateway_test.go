@@ -0,0 +1,141 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/gateway"
+	"order-service/orders"
+)
+
+// startGateway boots all services with the gateway in front
+func startGateway(t *testing.T) string {
+	userURL, orderURL := startServices(t)
+
+	gw, err := gateway.New(gateway.DefaultConfig(userURL, orderURL))
+	if err != nil {
+		t.Fatalf("gateway.New failed: %v", err)
+	}
+	server := httptest.NewServer(gw.Router())
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// authedJSON sends body as JSON with a bearer token and decodes the response
+func authedJSON(t *testing.T, method, url, token string, body, out interface{}) int {
+	t.Helper()
+
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, url, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestOrderThroughGateway(t *testing.T) {
+	gatewayURL := startGateway(t)
+
+	var user struct {
+		ID int `json:"id"`
+	}
+	credentials := map[string]string{"name": "Ada Lovelace", "email": "ada@example.com", "password": "password123"}
+	if code := postJSON(t, "POST", gatewayURL+"/api/users/register", credentials, &user); code != http.StatusCreated {
+		t.Fatalf("register returned %d", code)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if code := postJSON(t, "POST", gatewayURL+"/api/users/login", credentials, &login); code != http.StatusOK || login.Token == "" {
+		t.Fatalf("login returned %d", code)
+	}
+
+	if code := postJSON(t, "GET", gatewayURL+"/api/orders", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("orders without a token returned %d; want 401", code)
+	}
+
+	var order orders.Order
+	code := authedJSON(t, "POST", gatewayURL+"/api/orders", login.Token, orders.CreateOrderRequest{
+		UserID: user.ID,
+		Items:  []orders.LineItem{{Product: "Go Programming Book", Quantity: 1, UnitPrice: 29.99}},
+	}, &order)
+	if code != http.StatusCreated {
+		t.Fatalf("create order through gateway returned %d", code)
+	}
+
+	var summary struct {
+		User   map[string]interface{} `json:"user"`
+		Orders []orders.Order         `json:"orders"`
+	}
+	code = authedJSON(t, "GET", fmt.Sprintf("%s/api/aggregate/users/%d", gatewayURL, user.ID), login.Token, nil, &summary)
+	if code != http.StatusOK || summary.User["email"] != "ada@example.com" || len(summary.Orders) != 1 || summary.Orders[0].ID != order.ID {
+		t.Errorf("unexpected summary %d %+v", code, summary)
+	}
+}
+
+func TestGatewayKeepsUsersToTheirOwnData(t *testing.T) {
+	gatewayURL := startGateway(t)
+
+	// signUp registers and logs in a user, returning their ID and token
+	signUp := func(name, email string) (int, string) {
+		var user struct {
+			ID int `json:"id"`
+		}
+		credentials := map[string]string{"name": name, "email": email, "password": "password123"}
+		if code := postJSON(t, "POST", gatewayURL+"/api/users/register", credentials, &user); code != http.StatusCreated {
+			t.Fatalf("register returned %d", code)
+		}
+		var login struct {
+			Token string `json:"token"`
+		}
+		postJSON(t, "POST", gatewayURL+"/api/users/login", credentials, &login)
+		return user.ID, login.Token
+	}
+	ada, adaToken := signUp("Ada Lovelace", "ada@example.com")
+	_, graceToken := signUp("Grace Hopper", "grace@example.com")
+
+	var order orders.Order
+	authedJSON(t, "POST", gatewayURL+"/api/orders", adaToken, orders.CreateOrderRequest{
+		UserID: ada,
+		Items:  []orders.LineItem{{Product: "Go Programming Book", Quantity: 1, UnitPrice: 29.99}},
+	}, &order)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{"own orders", "GET", fmt.Sprintf("/api/orders?user_id=%d", ada), adaToken, http.StatusOK},
+		{"another user's orders", "GET", fmt.Sprintf("/api/orders?user_id=%d", ada), graceToken, http.StatusForbidden},
+		{"another user's order", "GET", fmt.Sprintf("/api/orders/%d", order.ID), graceToken, http.StatusNotFound},
+		{"delete another user's order", "DELETE", fmt.Sprintf("/api/orders/%d", order.ID), graceToken, http.StatusNotFound},
+		{"another user's profile", "GET", fmt.Sprintf("/api/users/%d", ada), graceToken, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := authedJSON(t, tt.method, gatewayURL+tt.path, tt.token, nil, nil); code != tt.code {
+			t.Errorf("%s: got %d; want %d", tt.name, code, tt.code)
+		}
+	}
+
+	var listed []orders.Order
+	authedJSON(t, "GET", gatewayURL+"/api/orders", graceToken, nil, &listed)
+	if len(listed) != 0 {
+		t.Errorf("grace sees %d orders; want none of ada's", len(listed))
+	}
+}
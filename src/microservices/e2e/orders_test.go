@@ -0,0 +1,104 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"order-service/orders"
+	"user-service/users"
+)
+
+// startServices boots user-service and an order-service pointing at it
+func startServices(t *testing.T) (userURL, orderURL string) {
+	gin.SetMode(gin.TestMode)
+
+	userService, err := users.NewServer(users.DefaultConfig(), nil)
+	if err != nil {
+		t.Fatalf("users.NewServer failed: %v", err)
+	}
+	userServer := httptest.NewServer(userService.Router())
+	t.Cleanup(userServer.Close)
+
+	store, err := orders.OpenStore(":memory:")
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	handler := orders.NewHandler(store, orders.NewUserClient(userServer.URL))
+	orderServer := httptest.NewServer(orders.NewRouter(handler))
+	t.Cleanup(orderServer.Close)
+
+	return userServer.URL, orderServer.URL
+}
+
+// postJSON sends body as JSON and decodes the response into out
+func postJSON(t *testing.T, method, url string, body, out interface{}) int {
+	t.Helper()
+
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestOrderForRegisteredUser(t *testing.T) {
+	userURL, orderURL := startServices(t)
+
+	var user struct {
+		ID int `json:"id"`
+	}
+	code := postJSON(t, "POST", userURL+"/register",
+		map[string]string{"name": "Grace Hopper", "email": "grace@example.com", "password": "password123"}, &user)
+	if code != http.StatusCreated {
+		t.Fatalf("register returned %d", code)
+	}
+
+	var order orders.Order
+	code = postJSON(t, "POST", orderURL+"/orders", orders.CreateOrderRequest{
+		UserID: user.ID,
+		Items:  []orders.LineItem{{Product: "Go Programming Book", Quantity: 2, UnitPrice: 29.99}},
+	}, &order)
+	if code != http.StatusCreated {
+		t.Fatalf("create order returned %d", code)
+	}
+	if order.UserID != user.ID || order.Total != 59.98 {
+		t.Errorf("unexpected order %+v", order)
+	}
+
+	code = postJSON(t, "PUT", fmt.Sprintf("%s/orders/%d/status", orderURL, order.ID),
+		orders.UpdateStatusRequest{Status: orders.StatusPaid}, &order)
+	if code != http.StatusOK || order.Status != orders.StatusPaid {
+		t.Errorf("pay returned %d with status %s", code, order.Status)
+	}
+}
+
+func TestOrderForUnknownUserIsRejected(t *testing.T) {
+	_, orderURL := startServices(t)
+
+	code := postJSON(t, "POST", orderURL+"/orders", orders.CreateOrderRequest{
+		UserID: 404,
+		Items:  []orders.LineItem{{Product: "Book", Quantity: 1, UnitPrice: 10}},
+	}, nil)
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("create order for unknown user returned %d; want 422", code)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"order-service/orders"
+)
+
+func main() {
+	store, err := orders.OpenStore(getEnv("DB_PATH", "data/orders.db"))
+	if err != nil {
+		log.Fatalf("Failed to open order database: %v", err)
+	}
+	defer store.Close()
+
+	users := orders.NewUserClient(getEnv("USER_SERVICE_URL", "http://localhost:8081"))
+	r := orders.NewRouter(orders.NewHandler(store, users))
+
+	port := getEnv("PORT", "8080")
+	if err := r.Run(":" + port); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,309 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// UserIDHeader carries the ID of the user a request is made for. The
+	// gateway sets it from the verified token; with it a request only sees
+	// and changes that user's orders.
+	UserIDHeader = "X-User-ID"
+
+	userIDKey = "user_id"
+)
+
+// Handler serves the order-service HTTP API
+type Handler struct {
+	store *Store
+	users UserValidator
+}
+
+// NewHandler creates a handler backed by store that validates users with users
+func NewHandler(store *Store, users UserValidator) *Handler {
+	return &Handler{store: store, users: users}
+}
+
+// NewRouter returns the order-service routes
+func NewRouter(h *Handler) *gin.Engine {
+	r := gin.Default()
+	r.Use(identify)
+
+	r.GET("/health", h.health)
+	r.GET("/orders", h.listOrders)
+	r.POST("/orders", h.createOrder)
+
+	order := r.Group("/orders/:id", h.requireOwner)
+	order.GET("", h.getOrder)
+	order.DELETE("", h.deleteOrder)
+	order.PUT("/status", h.updateStatus)
+	order.POST("/items", h.addItem)
+	order.DELETE("/items/:itemId", h.removeItem)
+
+	return r
+}
+
+// identify records the user from UserIDHeader, if the request has one
+func identify(c *gin.Context) {
+	value := c.GetHeader(UserIDHeader)
+	if value == "" {
+		c.Next()
+		return
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + UserIDHeader})
+		return
+	}
+	c.Set(userIDKey, id)
+	c.Next()
+}
+
+// requireOwner answers 404 for an order of another user than the one the
+// request is made for, as if it didn't exist
+func (h *Handler) requireOwner(c *gin.Context) {
+	userID, ok := c.Get(userIDKey)
+	if !ok {
+		c.Next()
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		c.Abort()
+		return
+	}
+	order, err := h.store.Get(c.Request.Context(), id)
+	if err == nil && order.UserID != userID.(int) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		respondError(c, err)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (h *Handler) health(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	status, code := "healthy", http.StatusOK
+	if err := h.store.Ping(ctx); err != nil {
+		status, code = "unhealthy", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":  status,
+		"service": "order-service",
+		"time":    time.Now().Unix(),
+	})
+}
+
+func (h *Handler) listOrders(c *gin.Context) {
+	var filter ListFilter
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		filter.UserID = id
+	}
+	if userID, ok := c.Get(userIDKey); ok {
+		if filter.UserID != 0 && filter.UserID != userID.(int) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot list another user's orders"})
+			return
+		}
+		filter.UserID = userID.(int)
+	}
+	if value := c.Query("status"); value != "" {
+		status, err := ParseStatus(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.Status = status
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		filter.Offset = offset
+	}
+
+	orders, err := h.store.List(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+func (h *Handler) createOrder(c *gin.Context) {
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if userID, ok := c.Get(userIDKey); ok {
+		if req.UserID == 0 {
+			req.UserID = userID.(int)
+		}
+		if req.UserID != userID.(int) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot create orders for another user"})
+			return
+		}
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.users.ValidateUser(c.Request.Context(), req.UserID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	order, err := h.store.Create(c.Request.Context(), req.UserID, req.Items)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *Handler) getOrder(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	order, err := h.store.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) deleteOrder(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.store.Delete(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) updateStatus(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req UpdateStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	status, err := ParseStatus(string(req.Status))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.store.UpdateStatus(c.Request.Context(), id, status)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) addItem(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var item LineItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := item.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.store.AddItem(c.Request.Context(), id, item)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *Handler) removeItem(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	itemID, ok := pathID(c, "itemId")
+	if !ok {
+		return
+	}
+
+	order, err := h.store.RemoveItem(c.Request.Context(), id, itemID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// pathID parses a numeric path parameter, responding 400 if it's invalid
+func pathID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondError maps store and user-service errors to HTTP responses
+func respondError(c *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrItemNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrNotEditable):
+		code = http.StatusConflict
+	case errors.Is(err, ErrUserNotFound):
+		code = http.StatusUnprocessableEntity
+	case errors.Is(err, ErrUserServiceFailure):
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,247 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeUsers knows a fixed set of user IDs
+type fakeUsers map[int]bool
+
+func (f fakeUsers) ValidateUser(ctx context.Context, userID int) error {
+	if !f[userID] {
+		return fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+	}
+	return nil
+}
+
+func setupRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	store, err := OpenStore(":memory:")
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return NewRouter(NewHandler(store, fakeUsers{1: true, 2: true}))
+}
+
+func doJSON(router http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	return doJSONAs(router, "", method, path, body)
+}
+
+// doJSONAs makes the request for userID, as the gateway does
+func doJSONAs(router http.Handler, userID, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if userID != "" {
+		req.Header.Set(UserIDHeader, userID)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	router := setupRouter(t)
+
+	rec := doJSON(router, "POST", "/orders", CreateOrderRequest{
+		UserID: 1,
+		Items:  []LineItem{{Product: "Go Programming Book", Quantity: 2, UnitPrice: 29.99}},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create returned %d: %s", rec.Code, rec.Body)
+	}
+	var order Order
+	json.Unmarshal(rec.Body.Bytes(), &order)
+	if order.Status != StatusCreated || order.Total != 59.98 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	rec = doJSON(router, "POST", fmt.Sprintf("/orders/%d/items", order.ID), LineItem{Product: "Mug", Quantity: 1, UnitPrice: 10})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add item returned %d: %s", rec.Code, rec.Body)
+	}
+	json.Unmarshal(rec.Body.Bytes(), &order)
+	if len(order.Items) != 2 || order.Total != 69.98 {
+		t.Fatalf("unexpected order after adding item %+v", order)
+	}
+
+	steps := []struct {
+		status Status
+		code   int
+	}{
+		{StatusShipped, http.StatusConflict},
+		{StatusPaid, http.StatusOK},
+		{StatusShipped, http.StatusOK},
+		{StatusCancelled, http.StatusConflict},
+	}
+	for _, step := range steps {
+		rec = doJSON(router, "PUT", fmt.Sprintf("/orders/%d/status", order.ID), UpdateStatusRequest{Status: step.status})
+		if rec.Code != step.code {
+			t.Errorf("moving to %s returned %d; want %d", step.status, rec.Code, step.code)
+		}
+	}
+
+	rec = doJSON(router, "POST", fmt.Sprintf("/orders/%d/items", order.ID), LineItem{Product: "Late", Quantity: 1})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("adding to a shipped order returned %d; want 409", rec.Code)
+	}
+	rec = doJSON(router, "DELETE", fmt.Sprintf("/orders/%d", order.ID), nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("deleting a shipped order returned %d; want 409", rec.Code)
+	}
+	if rec = doJSON(router, "GET", fmt.Sprintf("/orders/%d", order.ID), nil); rec.Code != http.StatusOK {
+		t.Errorf("shipped order gone after a refused delete: %d", rec.Code)
+	}
+}
+
+func TestDeleteOrder(t *testing.T) {
+	router := setupRouter(t)
+	for i := 0; i < 2; i++ {
+		doJSON(router, "POST", "/orders", CreateOrderRequest{UserID: 1, Items: []LineItem{{Product: "Book", Quantity: 1, UnitPrice: 5}}})
+	}
+	doJSON(router, "PUT", "/orders/2/status", UpdateStatusRequest{Status: StatusCancelled})
+
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{"created", "/orders/1", http.StatusNoContent},
+		{"cancelled", "/orders/2", http.StatusNoContent},
+		{"already deleted", "/orders/1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := doJSON(router, "DELETE", tt.path, nil); rec.Code != tt.code {
+			t.Errorf("%s: got %d; want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestOrdersScopedToUser(t *testing.T) {
+	router := setupRouter(t)
+	doJSONAs(router, "1", "POST", "/orders", CreateOrderRequest{Items: []LineItem{{Product: "Book", Quantity: 1, UnitPrice: 5}}})
+	doJSONAs(router, "2", "POST", "/orders", CreateOrderRequest{UserID: 2, Items: []LineItem{{Product: "Pen", Quantity: 1, UnitPrice: 1}}})
+
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   interface{}
+		code   int
+	}{
+		{"own orders", "1", "GET", "/orders", nil, http.StatusOK},
+		{"own orders by ID", "1", "GET", "/orders?user_id=1", nil, http.StatusOK},
+		{"another user's orders", "1", "GET", "/orders?user_id=2", nil, http.StatusForbidden},
+		{"own order", "1", "GET", "/orders/1", nil, http.StatusOK},
+		{"another user's order", "1", "GET", "/orders/2", nil, http.StatusNotFound},
+		{"change another user's order", "1", "PUT", "/orders/2/status", UpdateStatusRequest{Status: StatusCancelled}, http.StatusNotFound},
+		{"add to another user's order", "1", "POST", "/orders/2/items", LineItem{Product: "Ink", Quantity: 1}, http.StatusNotFound},
+		{"delete another user's order", "1", "DELETE", "/orders/2", nil, http.StatusNotFound},
+		{"order for another user", "1", "POST", "/orders", CreateOrderRequest{UserID: 2, Items: []LineItem{{Product: "Book", Quantity: 1}}}, http.StatusForbidden},
+		{"invalid user header", "me", "GET", "/orders", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := doJSONAs(router, tt.user, tt.method, tt.path, tt.body); rec.Code != tt.code {
+			t.Errorf("%s: got %d; want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+
+	var orders []Order
+	json.Unmarshal(doJSONAs(router, "2", "GET", "/orders", nil).Body.Bytes(), &orders)
+	if len(orders) != 1 || orders[0].UserID != 2 || orders[0].Status != StatusCreated || len(orders[0].Items) != 1 {
+		t.Errorf("user 2 sees %+v; want only their untouched order", orders)
+	}
+}
+
+func TestCreateOrderValidation(t *testing.T) {
+	router := setupRouter(t)
+
+	tests := []struct {
+		name string
+		req  CreateOrderRequest
+		code int
+	}{
+		{"unknown user", CreateOrderRequest{UserID: 99, Items: []LineItem{{Product: "Book", Quantity: 1}}}, http.StatusUnprocessableEntity},
+		{"no items", CreateOrderRequest{UserID: 1}, http.StatusBadRequest},
+		{"zero quantity", CreateOrderRequest{UserID: 1, Items: []LineItem{{Product: "Book"}}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := doJSON(router, "POST", "/orders", tt.req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: got %d; want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestListOrdersFilters(t *testing.T) {
+	router := setupRouter(t)
+
+	for i := 0; i < 3; i++ {
+		doJSON(router, "POST", "/orders", CreateOrderRequest{UserID: 1, Items: []LineItem{{Product: "Book", Quantity: 1, UnitPrice: 5}}})
+	}
+	doJSON(router, "PUT", "/orders/2/status", UpdateStatusRequest{Status: StatusCancelled})
+
+	rec := doJSON(router, "GET", "/orders?user_id=1&status=created", nil)
+	var orders []Order
+	json.Unmarshal(rec.Body.Bytes(), &orders)
+	if len(orders) != 2 || orders[0].ID != 3 || orders[1].ID != 1 {
+		t.Errorf("unexpected filtered orders %+v", orders)
+	}
+
+	rec = doJSON(router, "GET", "/orders?user_id=1&limit=1&offset=1", nil)
+	json.Unmarshal(rec.Body.Bytes(), &orders)
+	if len(orders) != 1 || orders[0].ID != 2 {
+		t.Errorf("unexpected page %+v", orders)
+	}
+	if rec := doJSON(router, "GET", "/orders?limit=-1", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative limit returned %d; want 400", rec.Code)
+	}
+}
+
+func TestListLoadsItemsInBatches(t *testing.T) {
+	store, err := OpenStore(":memory:")
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	count := itemBatchSize + 10
+	for i := 0; i < count; i++ {
+		if _, err := store.Create(ctx, 1, []LineItem{{Product: "Book", Quantity: i + 1, UnitPrice: 1}}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	orders, err := store.List(ctx, ListFilter{Limit: MaxListLimit})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(orders) != count {
+		t.Fatalf("listed %d orders; want %d", len(orders), count)
+	}
+	for _, order := range orders {
+		if len(order.Items) != 1 || order.Total != float64(order.ID) {
+			t.Fatalf("order %d has items %+v", order.ID, order.Items)
+		}
+	}
+	if orders, _ := store.List(ctx, ListFilter{}); len(orders) != DefaultListLimit {
+		t.Errorf("listed %d orders without a limit; want %d", len(orders), DefaultListLimit)
+	}
+}
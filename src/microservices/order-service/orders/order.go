@@ -0,0 +1,123 @@
+// Package orders implements the order-service: orders with line items, a
+// status workflow, SQLite persistence and user validation via user-service.
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Status is the lifecycle state of an order
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusCancelled Status = "cancelled"
+)
+
+// transitions lists the statuses each status may move to
+var transitions = map[Status][]Status{
+	StatusCreated: {StatusPaid, StatusCancelled},
+	StatusPaid:    {StatusShipped, StatusCancelled},
+}
+
+var (
+	ErrNotFound          = errors.New("order not found")
+	ErrItemNotFound      = errors.New("line item not found")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrNotEditable       = errors.New("order can only be changed while created")
+)
+
+// LineItem is one product on an order
+type LineItem struct {
+	ID        int     `json:"id"`
+	Product   string  `json:"product"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+// Order is a user's order
+type Order struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Status    Status     `json:"status"`
+	Items     []LineItem `json:"items"`
+	Total     float64    `json:"total"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// CreateOrderRequest is the body of POST /orders
+type CreateOrderRequest struct {
+	UserID int        `json:"user_id"`
+	Items  []LineItem `json:"items"`
+}
+
+// UpdateStatusRequest is the body of PUT /orders/:id/status
+type UpdateStatusRequest struct {
+	Status Status `json:"status"`
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatus validates a status name
+func ParseStatus(value string) (Status, error) {
+	switch status := Status(strings.ToLower(value)); status {
+	case StatusCreated, StatusPaid, StatusShipped, StatusCancelled:
+		return status, nil
+	default:
+		return "", fmt.Errorf("invalid status %q", value)
+	}
+}
+
+// Validate checks a line item before it is stored
+func (item LineItem) Validate() error {
+	if strings.TrimSpace(item.Product) == "" {
+		return errors.New("product is required")
+	}
+	if item.Quantity <= 0 {
+		return errors.New("quantity must be positive")
+	}
+	if item.UnitPrice < 0 {
+		return errors.New("unit_price must not be negative")
+	}
+	return nil
+}
+
+// Validate checks a create request
+func (req CreateOrderRequest) Validate() error {
+	if req.UserID <= 0 {
+		return errors.New("user_id is required")
+	}
+	if len(req.Items) == 0 {
+		return errors.New("at least one line item is required")
+	}
+	for i, item := range req.Items {
+		if err := item.Validate(); err != nil {
+			return fmt.Errorf("item %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// computeTotal sums the line items, rounded to cents
+func computeTotal(items []LineItem) float64 {
+	var total float64
+	for _, item := range items {
+		total += float64(item.Quantity) * item.UnitPrice
+	}
+	return math.Round(total*100) / 100
+}
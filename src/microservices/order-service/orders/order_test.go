@@ -0,0 +1,35 @@
+package orders
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		expected bool
+	}{
+		{StatusCreated, StatusPaid, true},
+		{StatusCreated, StatusCancelled, true},
+		{StatusCreated, StatusShipped, false},
+		{StatusPaid, StatusShipped, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusShipped, StatusCancelled, false},
+		{StatusCancelled, StatusPaid, false},
+		{StatusPaid, StatusCreated, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.expected {
+			t.Errorf("CanTransition(%s, %s) = %v; want %v", tt.from, tt.to, got, tt.expected)
+		}
+	}
+}
+
+func TestComputeTotal(t *testing.T) {
+	items := []LineItem{
+		{Product: "Go Programming Book", Quantity: 2, UnitPrice: 29.99},
+		{Product: "Sticker", Quantity: 3, UnitPrice: 0.1},
+	}
+	if got := computeTotal(items); got != 60.28 {
+		t.Errorf("computeTotal = %v; want 60.28", got)
+	}
+}
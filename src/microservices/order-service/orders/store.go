@@ -0,0 +1,378 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Store persists orders in an embedded SQLite database
+type Store struct {
+	db *sql.DB
+}
+
+// ListFilter narrows the orders returned by List and picks a page of them
+type ListFilter struct {
+	UserID int
+	Status Status
+	Limit  int // DefaultListLimit when 0, at most MaxListLimit
+	Offset int
+}
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+
+	// itemBatchSize keeps item lookups well under SQLite's limit on
+	// variables in one statement
+	itemBatchSize = 200
+)
+
+// OpenStore opens (creating if needed) the SQLite database at path.
+// Use ":memory:" for a throwaway database.
+func OpenStore(path string) (*Store, error) {
+	dsn := "file::memory:?_foreign_keys=on"
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		dsn = "file:" + path + "?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows one writer; a single connection also keeps :memory: shared
+	db.SetMaxOpenConns(1)
+
+	store := &Store{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return store, nil
+}
+
+// migrate creates the necessary tables
+func (s *Store) migrate() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'created',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS order_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+		product TEXT NOT NULL,
+		quantity INTEGER NOT NULL,
+		unit_price REAL NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+	CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+	CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+	`
+
+	_, err := s.db.Exec(query)
+	return err
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks the database is reachable
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Create stores a new order with its line items in one transaction
+func (s *Store) Create(ctx context.Context, userID int, items []LineItem) (*Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO orders (user_id, status, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		userID, StatusCreated, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert order: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if _, err := insertItem(ctx, tx, int(id), item); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, int(id))
+}
+
+// Get returns an order with its line items
+func (s *Store) Get(ctx context.Context, id int) (*Order, error) {
+	order := &Order{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, status, created_at, updated_at FROM orders WHERE id = ?`, id).
+		Scan(&order.ID, &order.UserID, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.items(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items[id]
+	if order.Items == nil {
+		order.Items = []LineItem{}
+	}
+	order.Total = computeTotal(order.Items)
+	return order, nil
+}
+
+// List returns a page of the orders matching the filter, newest first
+func (s *Store) List(ctx context.Context, filter ListFilter) ([]Order, error) {
+	query := `SELECT id, user_id, status, created_at, updated_at FROM orders`
+	var conditions []string
+	var args []interface{}
+	if filter.UserID > 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	var ids []int
+	for rows.Next() {
+		var order Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.CreatedAt, &order.UpdatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+		ids = append(ids, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := s.items(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+		if orders[i].Items == nil {
+			orders[i].Items = []LineItem{}
+		}
+		orders[i].Total = computeTotal(orders[i].Items)
+	}
+	return orders, nil
+}
+
+// UpdateStatus moves an order along the status workflow. The update is
+// conditional on the current status so concurrent changes can't skip a step.
+func (s *Store) UpdateStatus(ctx context.Context, id int, to Status) (*Order, error) {
+	order, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(order.Status, to) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, to)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE orders SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		to, time.Now().UTC(), id, order.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update status: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("%w: order changed concurrently", ErrInvalidTransition)
+	}
+	return s.Get(ctx, id)
+}
+
+// AddItem adds a line item to an order that is still being created
+func (s *Store) AddItem(ctx context.Context, orderID int, item LineItem) (*Order, error) {
+	err := s.editItems(ctx, orderID, func(tx *sql.Tx) error {
+		_, err := insertItem(ctx, tx, orderID, item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, orderID)
+}
+
+// RemoveItem removes a line item from an order that is still being created
+func (s *Store) RemoveItem(ctx context.Context, orderID, itemID int) (*Order, error) {
+	err := s.editItems(ctx, orderID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM order_items WHERE id = ? AND order_id = ?`, itemID, orderID)
+		if err != nil {
+			return fmt.Errorf("failed to delete line item: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrItemNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, orderID)
+}
+
+// Delete removes an order. Only created or cancelled orders can be deleted;
+// the status is checked by the delete itself so a concurrent status change
+// can't slip in between.
+func (s *Store) Delete(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM orders WHERE id = ? AND status IN (?, ?)`, id, StatusCreated, StatusCancelled)
+	if err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	// Nothing deleted: the order is missing or in a later status
+	order, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: cannot delete a %s order", ErrNotEditable, order.Status)
+}
+
+// editItems runs fn in a transaction after checking the order is editable
+func (s *Store) editItems(ctx context.Context, orderID int, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status Status
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = ?`, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != StatusCreated {
+		return ErrNotEditable
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET updated_at = ? WHERE id = ?`, time.Now().UTC(), orderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// items loads the line items of the given orders keyed by order ID,
+// itemBatchSize orders per query
+func (s *Store) items(ctx context.Context, orderIDs []int) (map[int][]LineItem, error) {
+	items := make(map[int][]LineItem)
+	for start := 0; start < len(orderIDs); start += itemBatchSize {
+		end := start + itemBatchSize
+		if end > len(orderIDs) {
+			end = len(orderIDs)
+		}
+		if err := s.itemBatch(ctx, orderIDs[start:end], items); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// itemBatch adds the line items of one batch of orders to items
+func (s *Store) itemBatch(ctx context.Context, orderIDs []int, items map[int][]LineItem) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(orderIDs)), ",")
+	args := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		args[i] = id
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, order_id, product, quantity, unit_price FROM order_items
+		 WHERE order_id IN (`+placeholders+`) ORDER BY id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item LineItem
+		var orderID int
+		if err := rows.Scan(&item.ID, &orderID, &item.Product, &item.Quantity, &item.UnitPrice); err != nil {
+			return err
+		}
+		items[orderID] = append(items[orderID], item)
+	}
+	return rows.Err()
+}
+
+// insertItem stores one line item of an order
+func insertItem(ctx context.Context, tx *sql.Tx, orderID int, item LineItem) (int, error) {
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO order_items (order_id, product, quantity, unit_price) VALUES (?, ?, ?, ?)`,
+		orderID, strings.TrimSpace(item.Product), item.Quantity, item.UnitPrice)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert line item: %w", err)
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
@@ -0,0 +1,79 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserServiceFailure = errors.New("user service unavailable")
+)
+
+// UserValidator checks that the user owning an order exists
+type UserValidator interface {
+	ValidateUser(ctx context.Context, userID int) error
+}
+
+// UserClient validates users against user-service's GET /users/:id
+type UserClient struct {
+	baseURL string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewUserClient creates a client for the user-service at baseURL
+func NewUserClient(baseURL string) *UserClient {
+	return &UserClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 3 * time.Second},
+		retries: 2,
+		backoff: 200 * time.Millisecond,
+	}
+}
+
+// ValidateUser returns ErrUserNotFound if user-service doesn't know the user
+// and ErrUserServiceFailure if it can't be reached. Network errors and 5xx
+// responses are retried with a growing backoff.
+func (uc *UserClient) ValidateUser(ctx context.Context, userID int) error {
+	url := fmt.Sprintf("%s/users/%d", uc.baseURL, userID)
+
+	var lastErr error
+	for attempt := 0; attempt <= uc.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %v", ErrUserServiceFailure, ctx.Err())
+			case <-time.After(uc.backoff * time.Duration(attempt)):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := uc.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return nil
+		case resp.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%w: %d", ErrUserNotFound, userID)
+		case resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("status %d", resp.StatusCode)
+		default:
+			return fmt.Errorf("%w: unexpected status %d", ErrUserServiceFailure, resp.StatusCode)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrUserServiceFailure, lastErr)
+}
@@ -0,0 +1,41 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUserClientRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.AddInt32(&calls, 1) == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/users/1":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewUserClient(server.URL)
+	client.backoff = time.Millisecond
+
+	if err := client.ValidateUser(context.Background(), 1); err != nil {
+		t.Errorf("ValidateUser(1) = %v; want nil after retry", err)
+	}
+	if err := client.ValidateUser(context.Background(), 2); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("ValidateUser(2) = %v; want ErrUserNotFound", err)
+	}
+
+	server.Close()
+	if err := client.ValidateUser(context.Background(), 1); !errors.Is(err, ErrUserServiceFailure) {
+		t.Errorf("ValidateUser with service down = %v; want ErrUserServiceFailure", err)
+	}
+}
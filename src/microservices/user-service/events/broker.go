@@ -0,0 +1,202 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// ErrDetached is returned when publishing to a subscriber that has left
+var ErrDetached = errors.New("subscriber detached")
+
+// Message is an event delivered on one topic
+type Message struct {
+	Topic string
+	Event Event
+}
+
+// Broker is an in-process Publisher. Like the broadcast package's Broker,
+// subscribers attach, subscribe to exact topic names and receive every
+// message published on them; an event is published on the topic named by
+// its type.
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[string]*Subscriber
+	topics      map[string]map[string]*Subscriber
+	buffer      int
+}
+
+// NewBroker creates a broker whose subscribers queue up to buffer messages
+// before publishing blocks
+func NewBroker(buffer int) *Broker {
+	return &Broker{
+		subscribers: make(map[string]*Subscriber),
+		topics:      make(map[string]map[string]*Subscriber),
+		buffer:      buffer,
+	}
+}
+
+// Attach creates a subscriber and registers it with the broker
+func (b *Broker) Attach() (*Subscriber, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	s := &Subscriber{
+		id:       hex.EncodeToString(id),
+		messages: make(chan Message, b.buffer),
+		done:     make(chan struct{}),
+		topics:   make(map[string]bool),
+	}
+
+	b.mu.Lock()
+	b.subscribers[s.id] = s
+	b.mu.Unlock()
+	return s, nil
+}
+
+// Subscribe subscribes s to the given topics
+func (b *Broker) Subscribe(s *Subscriber, topics ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics {
+		if b.topics[topic] == nil {
+			b.topics[topic] = make(map[string]*Subscriber)
+		}
+		b.topics[topic][s.id] = s
+		s.addTopic(topic)
+	}
+}
+
+// Unsubscribe removes s from the given topics
+func (b *Broker) Unsubscribe(s *Subscriber, topics ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(b.topics[topic], s.id)
+		if len(b.topics[topic]) == 0 {
+			delete(b.topics, topic)
+		}
+		s.removeTopic(topic)
+	}
+}
+
+// Detach unsubscribes s from everything and closes its message channel
+func (b *Broker) Detach(s *Subscriber) {
+	b.Unsubscribe(s, s.Topics()...)
+	b.mu.Lock()
+	delete(b.subscribers, s.id)
+	b.mu.Unlock()
+	s.destroy()
+}
+
+// Subscribers returns the number of subscribers of a topic
+func (b *Broker) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+// Publish queues the event for every subscriber of its topic, in order.
+// It blocks while a subscriber's queue is full, until ctx is done.
+func (b *Broker) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	subscribers := make([]*Subscriber, 0, len(b.topics[event.Type]))
+	for _, s := range b.topics[event.Type] {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.RUnlock()
+
+	m := Message{Topic: event.Type, Event: event}
+	for _, s := range subscribers {
+		if err := s.signal(ctx, m); err != nil && !errors.Is(err, ErrDetached) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscriber receives the messages of the topics it subscribed to
+type Subscriber struct {
+	id       string
+	messages chan Message
+	done     chan struct{}
+	once     sync.Once
+
+	mu     sync.RWMutex
+	topics map[string]bool
+
+	// sendMu is held for reading while a message is being sent, so the
+	// channel is only closed once no send is in progress
+	sendMu sync.RWMutex
+	closed bool
+}
+
+// ID returns the subscriber's ID
+func (s *Subscriber) ID() string {
+	return s.id
+}
+
+// Messages returns the channel messages are delivered on. It is closed when
+// the subscriber is detached.
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Topics returns the topics the subscriber is subscribed to
+func (s *Subscriber) Topics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+func (s *Subscriber) addTopic(topic string) {
+	s.mu.Lock()
+	s.topics[topic] = true
+	s.mu.Unlock()
+}
+
+func (s *Subscriber) removeTopic(topic string) {
+	s.mu.Lock()
+	delete(s.topics, topic)
+	s.mu.Unlock()
+}
+
+// signal queues a message unless the subscriber is detached
+func (s *Subscriber) signal(ctx context.Context, m Message) error {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+	if s.closed {
+		return ErrDetached
+	}
+
+	select {
+	case s.messages <- m:
+		return nil
+	case <-s.done:
+		return ErrDetached
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// destroy closes the message channel once no signal is in progress
+func (s *Subscriber) destroy() {
+	s.once.Do(func() {
+		// Wake blocked senders so they release the read lock
+		close(s.done)
+		s.sendMu.Lock()
+		s.closed = true
+		close(s.messages)
+		s.sendMu.Unlock()
+	})
+}
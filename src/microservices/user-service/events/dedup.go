@@ -0,0 +1,88 @@
+package events
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrInProgress is returned by Deduplicator.Handle while another delivery of
+// the same event is being handled
+var ErrInProgress = errors.New("event is already being handled")
+
+// Deduplicator remembers the IDs of handled events so redeliveries can be
+// dropped. It keeps the most recent capacity IDs; an event redelivered after
+// that many others is handled again.
+type Deduplicator struct {
+	mu       sync.Mutex
+	seen     map[string]bool
+	order    []string // ring of seen IDs, oldest at next
+	next     int
+	inFlight map[string]bool
+}
+
+// NewDeduplicator creates a deduplicator remembering capacity event IDs
+func NewDeduplicator(capacity int) *Deduplicator {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Deduplicator{
+		seen:     make(map[string]bool),
+		order:    make([]string, 0, capacity),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// Seen reports whether an event ID has been handled
+func (d *Deduplicator) Seen(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.seen[id]
+}
+
+// Mark records an event ID as handled
+func (d *Deduplicator) Mark(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mark(id)
+}
+
+// Handle calls handle unless the event has been handled before. The event
+// only counts as handled if handle succeeds, so a failed one can be retried.
+func (d *Deduplicator) Handle(event Event, handle func(Event) error) error {
+	d.mu.Lock()
+	if d.seen[event.ID] {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.inFlight[event.ID] {
+		d.mu.Unlock()
+		return ErrInProgress
+	}
+	d.inFlight[event.ID] = true
+	d.mu.Unlock()
+
+	err := handle(event)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, event.ID)
+	if err == nil {
+		d.mark(event.ID)
+	}
+	return err
+}
+
+// mark adds an ID, evicting the oldest at capacity. Callers hold mu.
+func (d *Deduplicator) mark(id string) {
+	if d.seen[id] {
+		return
+	}
+	if len(d.order) < cap(d.order) {
+		d.order = append(d.order, id)
+	} else {
+		delete(d.seen, d.order[d.next])
+		d.order[d.next] = id
+		d.next = (d.next + 1) % len(d.order)
+	}
+	d.seen[id] = true
+}
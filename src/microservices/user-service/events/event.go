@@ -0,0 +1,83 @@
+// Package events publishes user-service domain events to other services.
+//
+// Events are written to an outbox in the same transaction as the change they
+// describe and delivered by a Relay, so an event is never lost when the
+// service crashes between committing and publishing. Delivery is
+// at-least-once: consumers see each event one or more times and should drop
+// repeats with a Deduplicator.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types, which double as broker topics
+const (
+	UserRegistered = "UserRegistered"
+	UserUpdated    = "UserUpdated"
+	UserDeleted    = "UserDeleted"
+)
+
+// Event is a change to a user. ID is unique per event and stays the same
+// across redeliveries.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	UserID     int             `json:"user_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewEvent creates an event with a fresh ID, encoding data as its payload
+func NewEvent(eventType string, userID int, data interface{}) (Event, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Event{}, err
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s payload: %w", eventType, err)
+	}
+
+	return Event{
+		ID:         hex.EncodeToString(b),
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: time.Now().UTC(),
+		Data:       payload,
+	}, nil
+}
+
+// Publisher delivers events to consumers. Publish returns nil only once the
+// event has been handed over; the relay retries anything else.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Publishers publishes every event to each publisher in turn. If one fails
+// the event is retried on all of them, so the others may see it again.
+type Publishers []Publisher
+
+func (ps Publishers) Publish(ctx context.Context, event Event) error {
+	for _, p := range ps {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Outbox is where events wait until they have been published. It is
+// implemented by the user repositories, which add events in the same
+// transaction as the user change.
+type Outbox interface {
+	// Pending returns up to limit unpublished events, oldest first
+	Pending(ctx context.Context, limit int) ([]Event, error)
+	// MarkPublished removes an event from the pending ones
+	MarkPublished(ctx context.Context, id string) error
+}
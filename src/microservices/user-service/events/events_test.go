@@ -0,0 +1,209 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryOutbox is an Outbox over a slice
+type memoryOutbox struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (o *memoryOutbox) Pending(ctx context.Context, limit int) ([]Event, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if limit > len(o.events) {
+		limit = len(o.events)
+	}
+	return append([]Event(nil), o.events[:limit]...), nil
+}
+
+func (o *memoryOutbox) MarkPublished(ctx context.Context, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, e := range o.events {
+		if e.ID == id {
+			o.events = append(o.events[:i], o.events[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// flakyPublisher fails the first failures calls
+type flakyPublisher struct {
+	failures  int
+	published []string
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event Event) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("unavailable")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func newEvents(t *testing.T, types ...string) []Event {
+	var list []Event
+	for i, eventType := range types {
+		event, err := NewEvent(eventType, i+1, map[string]int{"id": i + 1})
+		if err != nil {
+			t.Fatalf("NewEvent failed: %v", err)
+		}
+		list = append(list, event)
+	}
+	return list
+}
+
+func TestBrokerDeliversByTopic(t *testing.T) {
+	broker := NewBroker(10)
+	registered, _ := broker.Attach()
+	all, _ := broker.Attach()
+	broker.Subscribe(registered, UserRegistered)
+	broker.Subscribe(all, UserRegistered, UserUpdated, UserDeleted)
+
+	ctx := context.Background()
+	for _, event := range newEvents(t, UserRegistered, UserUpdated, UserRegistered) {
+		if err := broker.Publish(ctx, event); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	if got := len(registered.Messages()); got != 2 {
+		t.Errorf("UserRegistered subscriber got %d messages; want 2", got)
+	}
+	if got := len(all.Messages()); got != 3 {
+		t.Errorf("subscriber of every type got %d messages; want 3", got)
+	}
+	if m := <-all.Messages(); m.Topic != UserRegistered || m.Event.UserID != 1 {
+		t.Errorf("first message = %+v; want UserRegistered for user 1", m)
+	}
+
+	broker.Unsubscribe(all, UserUpdated)
+	if broker.Subscribers(UserUpdated) != 0 {
+		t.Errorf("UserUpdated still has subscribers after Unsubscribe")
+	}
+	// Detach closes the channel once buffered messages are read
+	broker.Detach(registered)
+	for range registered.Messages() {
+	}
+	if broker.Subscribers(UserRegistered) != 1 {
+		t.Errorf("UserRegistered has %d subscribers after Detach; want 1", broker.Subscribers(UserRegistered))
+	}
+}
+
+func TestBrokerPublishBlocksUntilDetach(t *testing.T) {
+	broker := NewBroker(0)
+	s, _ := broker.Attach()
+	broker.Subscribe(s, UserDeleted)
+	event := newEvents(t, UserDeleted)[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := broker.Publish(ctx, event); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish to a stalled subscriber returned %v; want DeadlineExceeded", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- broker.Publish(context.Background(), event) }()
+	time.Sleep(10 * time.Millisecond)
+	broker.Detach(s)
+	if err := <-done; err != nil {
+		t.Errorf("Publish after Detach returned %v; want nil", err)
+	}
+}
+
+func TestRelayRetriesInOrder(t *testing.T) {
+	list := newEvents(t, UserRegistered, UserUpdated, UserDeleted)
+	outbox := &memoryOutbox{events: append([]Event(nil), list...)}
+	publisher := &flakyPublisher{failures: 1}
+	relay := NewRelay(outbox, publisher, time.Millisecond)
+
+	if _, err := relay.Flush(context.Background()); err == nil {
+		t.Fatalf("Flush with a failing publisher returned nil")
+	}
+	if n, _ := outbox.Pending(context.Background(), 10); len(n) != 3 {
+		t.Fatalf("failed event left the outbox")
+	}
+
+	n, err := relay.Flush(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("Flush = %d, %v; want 3, nil", n, err)
+	}
+	for i, id := range publisher.published {
+		if id != list[i].ID {
+			t.Errorf("published[%d] = %s; want %s", i, id, list[i].ID)
+		}
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	dedup := NewDeduplicator(2)
+	list := newEvents(t, UserRegistered, UserUpdated, UserDeleted)
+	calls := 0
+	handle := func(Event) error { calls++; return nil }
+
+	dedup.Handle(list[0], handle)
+	dedup.Handle(list[0], handle)
+	if calls != 1 {
+		t.Errorf("redelivered event handled %d times; want 1", calls)
+	}
+
+	// A failed event is not remembered
+	dedup.Handle(list[1], func(Event) error { return errors.New("boom") })
+	if dedup.Seen(list[1].ID) {
+		t.Errorf("failed event marked as seen")
+	}
+
+	// Capacity 2 evicts the oldest ID
+	dedup.Mark(list[1].ID)
+	dedup.Mark(list[2].ID)
+	if dedup.Seen(list[0].ID) || !dedup.Seen(list[2].ID) {
+		t.Errorf("oldest ID not evicted at capacity")
+	}
+}
+
+func TestWebhookRoundTrip(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	consumer := httptest.NewServer(WebhookHandler("s3cret", NewDeduplicator(100), func(e Event) error {
+		mu.Lock()
+		received = append(received, e)
+		mu.Unlock()
+		return nil
+	}))
+	defer consumer.Close()
+
+	event := newEvents(t, UserRegistered)[0]
+	publisher := NewWebhookPublisher(consumer.URL, "s3cret")
+	for i := 0; i < 2; i++ {
+		if err := publisher.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Publish #%d failed: %v", i, err)
+		}
+	}
+	if len(received) != 1 || received[0].ID != event.ID {
+		t.Errorf("consumer received %d events; want the event once", len(received))
+	}
+
+	if err := NewWebhookPublisher(consumer.URL, "wrong").Publish(context.Background(), event); err == nil {
+		t.Errorf("Publish with the wrong secret succeeded")
+	}
+
+	resp, err := http.Post(consumer.URL, "application/json", bytes.NewReader([]byte(`{"id":"x"}`)))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned request returned %d; want 401", resp.StatusCode)
+	}
+}
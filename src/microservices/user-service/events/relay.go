@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Relay moves events from the outbox to a publisher. An event is marked
+// published only after Publish succeeds, and events are published in order:
+// a failure stops the batch and the same event is tried again later.
+type Relay struct {
+	outbox     Outbox
+	publisher  Publisher
+	interval   time.Duration
+	batchSize  int
+	maxBackoff time.Duration
+}
+
+// NewRelay creates a relay polling the outbox every interval
+func NewRelay(outbox Outbox, publisher Publisher, interval time.Duration) *Relay {
+	return &Relay{
+		outbox:     outbox,
+		publisher:  publisher,
+		interval:   interval,
+		batchSize:  100,
+		maxBackoff: 30 * time.Second,
+	}
+}
+
+// Flush publishes pending events until none are left, returning how many
+// were published
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		pending, err := r.outbox.Pending(ctx, r.batchSize)
+		if err != nil {
+			return published, fmt.Errorf("failed to read outbox: %w", err)
+		}
+		if len(pending) == 0 {
+			return published, nil
+		}
+
+		for _, event := range pending {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				return published, fmt.Errorf("failed to publish %s %s: %w", event.Type, event.ID, err)
+			}
+			// Crashing here publishes the event again on restart, hence
+			// at-least-once
+			if err := r.outbox.MarkPublished(ctx, event.ID); err != nil {
+				return published, fmt.Errorf("failed to mark %s published: %w", event.ID, err)
+			}
+			published++
+		}
+	}
+}
+
+// Run flushes the outbox every interval until ctx is done, backing off
+// while publishing fails
+func (r *Relay) Run(ctx context.Context) {
+	wait := r.interval
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Outbox relay: %v (retrying in %s)", err, wait)
+			wait *= 2
+			if wait > r.maxBackoff {
+				wait = r.maxBackoff
+			}
+		} else {
+			wait = r.interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook request headers
+const (
+	EventIDHeader   = "X-Event-ID"
+	EventTypeHeader = "X-Event-Type"
+	SignatureHeader = "X-Signature"
+)
+
+// maxWebhookBody bounds the size of a webhook request a consumer accepts
+const maxWebhookBody = 1 << 20
+
+// WebhookPublisher POSTs events as JSON to a URL. Bodies are signed with
+// HMAC-SHA256 of the shared secret in the X-Signature header.
+type WebhookPublisher struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher for the webhook at url
+func NewWebhookPublisher(url, secret string) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Publish delivers the event, failing unless the webhook answers 2xx
+func (w *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, event.ID)
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(SignatureHeader, Sign(w.secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver %s to %s: %w", event.ID, w.url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %d for %s", w.url, resp.StatusCode, event.ID)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookHandler is the consumer side of a WebhookPublisher. It checks the
+// signature, drops events dedup has already seen and passes the rest to
+// handle. A handler error answers 500 so the event is redelivered.
+func WebhookHandler(secret string, dedup *Deduplicator, handle func(Event) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if !hmac.Equal([]byte(r.Header.Get(SignatureHeader)), []byte(Sign([]byte(secret), body))) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+
+		switch err := dedup.Handle(event, handle); {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrInProgress):
+			// The sender retries once the other delivery has finished
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/gin-gonic/gin v1.9.1
 	github.com/golang-jwt/jwt/v4 v4.5.0
+	github.com/mattn/go-sqlite3 v1.14.18
 	golang.org/x/crypto v0.17.0
 )
 
@@ -1,113 +1,98 @@
 package main
 
 import (
-	"net/http"
+	"context"
+	"database/sql"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
-)
-
-type User struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password,omitempty"`
-}
+	"user-service/events"
+	"user-service/users"
 
-type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-var users = []User{
-	{ID: 1, Name: "John Doe", Email: "john@example.com"},
-	{ID: 2, Name: "Jane Smith", Email: "jane@example.com"},
-}
-var nextUserID = 3
+	_ "github.com/mattn/go-sqlite3"
+)
 
 func main() {
-	r := gin.Default()
-	
-	r.GET("/health", healthHandler)
-	r.POST("/register", registerHandler)
-	r.POST("/login", loginHandler)
-	r.GET("/users", getUsersHandler)
-	r.GET("/users/:id", getUserHandler)
-	
-	port := getEnv("PORT", "8080")
-	r.Run(":" + port)
-}
-
-func healthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "user-service",
-		"time":    time.Now().Unix(),
-	})
-}
-
-func registerHandler(c *gin.Context) {
-	var user User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
+	cfg := users.DefaultConfig()
+	cfg.SigningAlg = getEnv("JWT_SIGNING_ALG", cfg.SigningAlg)
+	cfg.KeyDir = os.Getenv("JWT_KEY_DIR")
+	cfg.AccessTokenTTL = getDuration("ACCESS_TOKEN_TTL", cfg.AccessTokenTTL)
+	cfg.RefreshTokenTTL = getDuration("REFRESH_TOKEN_TTL", cfg.RefreshTokenTTL)
+	cfg.LockoutDuration = getDuration("LOCKOUT_DURATION", cfg.LockoutDuration)
+	if n, err := strconv.Atoi(os.Getenv("MAX_FAILED_LOGINS")); err == nil && n > 0 {
+		cfg.MaxFailedLogins = n
 	}
 
-	// Hash password
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	user.Password = string(hashedPassword)
-	user.ID = nextUserID
-	nextUserID++
-	
-	users = append(users, user)
-	user.Password = "" // Don't return password
-	
-	c.JSON(http.StatusCreated, user)
-}
+	repo, err := openRepository(os.Getenv("DB_PATH"))
+	if err != nil {
+		log.Fatalf("Failed to open user store: %v", err)
+	}
 
-func loginHandler(c *gin.Context) {
-	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
+	server, err := users.NewServer(cfg, repo)
+	if err != nil {
+		log.Fatalf("Failed to start user service: %v", err)
 	}
+	stop := server.StartKeyRotation(getDuration("KEY_ROTATION_INTERVAL", 24*time.Hour))
+	defer stop()
 
-	// Generate JWT token (simplified)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": req.Email,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
-	})
+	publisher, err := newPublisher(os.Getenv("WEBHOOK_URLS"), os.Getenv("WEBHOOK_SECRET"))
+	if err != nil {
+		log.Fatalf("Failed to set up event publishing: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay := events.NewRelay(repo, publisher, getDuration("OUTBOX_POLL_INTERVAL", time.Second))
+	go relay.Run(ctx)
 
-	tokenString, _ := token.SignedString([]byte("secret"))
-	
-	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user":  gin.H{"email": req.Email},
-	})
+	port := getEnv("PORT", "8080")
+	if err := server.Router().Run(":" + port); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
 }
 
-func getUsersHandler(c *gin.Context) {
-	safeUsers := make([]User, len(users))
-	for i, user := range users {
-		safeUsers[i] = User{ID: user.ID, Name: user.Name, Email: user.Email}
+// openRepository opens the SQLite database at path, or keeps users in memory
+// when no path is given
+func openRepository(path string) (users.UserRepository, error) {
+	if path == "" {
+		log.Println("DB_PATH not set, users are kept in memory")
+		return users.NewMemoryRepository(), nil
 	}
-	c.JSON(http.StatusOK, safeUsers)
+
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer; serialize rather than fail with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	return users.NewSQLRepository(db)
 }
 
-func getUserHandler(c *gin.Context) {
-	id, _ := strconv.Atoi(c.Param("id"))
-	for _, user := range users {
-		if user.ID == id {
-			safeUser := User{ID: user.ID, Name: user.Name, Email: user.Email}
-			c.JSON(http.StatusOK, safeUser)
-			return
+// newPublisher posts events to each comma-separated webhook URL. Without
+// webhooks, events go to an in-process broker that logs them.
+func newPublisher(urls, secret string) (events.Publisher, error) {
+	if urls == "" {
+		broker := events.NewBroker(100)
+		logger, err := broker.Attach()
+		if err != nil {
+			return nil, err
 		}
+		broker.Subscribe(logger, events.UserRegistered, events.UserUpdated, events.UserDeleted)
+		go func() {
+			for m := range logger.Messages() {
+				log.Printf("Event %s %s for user %d", m.Topic, m.Event.ID, m.Event.UserID)
+			}
+		}()
+		return broker, nil
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+
+	var publishers events.Publishers
+	for _, url := range strings.Split(urls, ",") {
+		publishers = append(publishers, events.NewWebhookPublisher(strings.TrimSpace(url), secret))
+	}
+	return publishers, nil
 }
 
 func getEnv(key, fallback string) string {
@@ -115,4 +100,12 @@ func getEnv(key, fallback string) string {
 		return value
 	}
 	return fallback
-}
\ No newline at end of file
+}
+
+// getDuration parses a duration such as 15m from the environment
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
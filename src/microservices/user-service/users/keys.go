@@ -0,0 +1,262 @@
+package users
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one key pair of the key set, identified by its kid
+type SigningKey struct {
+	ID        string
+	Alg       string
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+// method returns the JWT signing method for the key
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the active signing key and the previous keys still needed to
+// verify tokens issued before a rotation. With a directory configured, keys
+// are stored there as PEM files so they survive restarts.
+type KeySet struct {
+	mu      sync.RWMutex
+	alg     string
+	dir     string
+	keep    int
+	keys    []*SigningKey // newest first; keys[0] signs
+	keySize int           // RSA key size in bits
+}
+
+// NewKeySet loads keys from dir (if set) or generates a first key
+func NewKeySet(alg, dir string, keep int) (*KeySet, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q (use %s or %s)", alg, AlgRS256, AlgEdDSA)
+	}
+	if keep < 2 {
+		keep = 2
+	}
+
+	ks := &KeySet{alg: alg, dir: dir, keep: keep, keySize: 2048}
+	if dir != "" {
+		if err := ks.load(); err != nil {
+			return nil, err
+		}
+	}
+	if len(ks.keys) == 0 || ks.keys[0].Alg != alg {
+		if err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[0]
+}
+
+// Lookup returns the key with the given kid, if it hasn't been retired
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Rotate generates a new active key. The oldest keys beyond keep are retired,
+// so tokens they signed stop verifying.
+func (ks *KeySet) Rotate() error {
+	key, err := generateKey(ks.alg, ks.keySize)
+	if err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	if ks.dir != "" {
+		if err := ks.save(key); err != nil {
+			return err
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = append([]*SigningKey{key}, ks.keys...)
+	for len(ks.keys) > ks.keep {
+		retired := ks.keys[len(ks.keys)-1]
+		ks.keys = ks.keys[:len(ks.keys)-1]
+		if ks.dir != "" {
+			os.Remove(filepath.Join(ks.dir, retired.ID+".pem"))
+		}
+	}
+	return nil
+}
+
+// JWKS returns the public keys of every key that can still verify tokens
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Alg}
+		switch pub := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// keyfunc resolves the verification key of a token by its kid header
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Alg {
+		return nil, fmt.Errorf("token algorithm %s does not match key", token.Method.Alg())
+	}
+	return key.Private.Public(), nil
+}
+
+// load reads every PEM key in the key directory, newest first
+func (ks *KeySet) load() error {
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key %s: %w", path, err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("key %s is not PEM encoded", path)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse key %s: %w", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		key := &SigningKey{ID: strings.TrimSuffix(filepath.Base(path), ".pem"), CreatedAt: info.ModTime()}
+		switch private := parsed.(type) {
+		case *rsa.PrivateKey:
+			key.Alg, key.Private = AlgRS256, private
+		case ed25519.PrivateKey:
+			key.Alg, key.Private = AlgEdDSA, private
+		default:
+			return fmt.Errorf("key %s has unsupported type %T", path, parsed)
+		}
+		ks.keys = append(ks.keys, key)
+	}
+
+	sort.Slice(ks.keys, func(i, j int) bool { return ks.keys[i].CreatedAt.After(ks.keys[j].CreatedAt) })
+	if len(ks.keys) > ks.keep {
+		ks.keys = ks.keys[:ks.keep]
+	}
+	return nil
+}
+
+// save writes a key to the key directory as PKCS#8 PEM
+func (ks *KeySet) save(key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(ks.dir, key.ID+".pem"), data, 0600); err != nil {
+		return fmt.Errorf("failed to save signing key: %w", err)
+	}
+	return nil
+}
+
+// generateKey creates a key pair with a random kid
+func generateKey(alg string, rsaBits int) (*SigningKey, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{ID: hex.EncodeToString(id), Alg: alg, CreatedAt: time.Now()}
+
+	if alg == AlgEdDSA {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = private
+		return key, nil
+	}
+
+	private, err := rsa.GenerateKey(rand.Reader, rsaBits)
+	if err != nil {
+		return nil, err
+	}
+	key.Private = private
+	return key, nil
+}
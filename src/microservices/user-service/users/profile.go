@@ -0,0 +1,296 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UpdateUserRequest is the body of PUT /users/:id. Only the fields present
+// are changed; changing the email or password needs the current password.
+type UpdateUserRequest struct {
+	Name            *string `json:"name"`
+	Email           *string `json:"email"`
+	Bio             *string `json:"bio"`
+	AvatarURL       *string `json:"avatar_url"`
+	Location        *string `json:"location"`
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// VerifyEmailRequest is the body of POST /verify-email
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+const (
+	// UserIDHeader carries the ID of the user a request is made for. The
+	// gateway sets it from the verified token; with it GET /users/:id only
+	// returns that user.
+	UserIDHeader = "X-User-ID"
+
+	// userIDKey is the gin context key of the authenticated user's ID
+	userIDKey = "userID"
+)
+
+// validateProfile checks the profile fields of a user, returning a message
+// for the first problem found
+func validateProfile(user User) string {
+	switch {
+	case user.Name == "":
+		return "Name is required"
+	case len(user.Name) > 100:
+		return "Name must be at most 100 characters"
+	case !validEmail(user.Email):
+		return "A valid email is required"
+	case len(user.Bio) > 500:
+		return "Bio must be at most 500 characters"
+	case len(user.Location) > 100:
+		return "Location must be at most 100 characters"
+	case user.AvatarURL != "" && !validURL(user.AvatarURL):
+		return "Avatar URL must be an http or https URL"
+	}
+	return ""
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// newVerification marks a user's email unverified and sets a fresh
+// verification secret, returning it. Only its hash is stored.
+func newVerification(user *User, ttl time.Duration) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	user.EmailVerified = false
+	user.VerifyTokenHash = hashToken(secret)
+	user.VerifyExpiresAt = time.Now().Add(ttl).UTC()
+	return secret, nil
+}
+
+// verificationToken is the token sent to the user: the user ID lets the
+// server find the account without indexing token hashes
+func verificationToken(userID int, secret string) string {
+	return fmt.Sprintf("%d.%s", userID, secret)
+}
+
+// requireSelf only lets the user named by :id through, authenticated by a
+// Bearer access token
+func (s *Server) requireSelf(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	claims, err := s.ParseAccessToken(tokenString)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing token"})
+		return
+	}
+	if claims.Subject != strconv.Itoa(id) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Cannot modify another user"})
+		return
+	}
+
+	c.Set(userIDKey, id)
+	c.Next()
+}
+
+func (s *Server) getUsersHandler(c *gin.Context) {
+	list, err := s.repo.List(c.Request.Context())
+	if err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) getUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if requester := c.GetHeader(UserIDHeader); requester != "" && requester != strconv.Itoa(id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot view another user"})
+		return
+	}
+
+	user, err := s.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (s *Server) updateUserHandler(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, err := s.repo.GetByID(c.Request.Context(), c.GetInt(userIDKey))
+	if err != nil {
+		respondRepoError(c, err)
+		return
+	}
+
+	emailChanged := req.Email != nil && normalizeEmail(*req.Email) != user.Email
+	if emailChanged || req.Password != nil {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+	}
+
+	if req.Name != nil {
+		user.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Bio != nil {
+		user.Bio = strings.TrimSpace(*req.Bio)
+	}
+	if req.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*req.AvatarURL)
+	}
+	if req.Location != nil {
+		user.Location = strings.TrimSpace(*req.Location)
+	}
+	if emailChanged {
+		user.Email = normalizeEmail(*req.Email)
+	}
+	if msg := validateProfile(*user); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if req.Password != nil {
+		if len(*req.Password) < 8 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters"})
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		user.PasswordHash = string(hashedPassword)
+	}
+
+	// A new address has to be verified again
+	var secret string
+	if emailChanged {
+		if secret, err = newVerification(user, s.cfg.VerifyTokenTTL); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification token"})
+			return
+		}
+	}
+
+	if err := s.repo.Update(c.Request.Context(), user); err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	if emailChanged {
+		s.cfg.SendVerification(*user, verificationToken(user.ID, secret))
+	}
+	if req.Password != nil {
+		// Sessions started with the old password end with it
+		s.refresh.RevokeUser(user.ID)
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (s *Server) deleteUserHandler(c *gin.Context) {
+	id := c.GetInt(userIDKey)
+	if err := s.repo.Delete(c.Request.Context(), id); err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	s.refresh.RevokeUser(id)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) resendVerificationHandler(c *gin.Context) {
+	user, err := s.repo.GetByID(c.Request.Context(), c.GetInt(userIDKey))
+	if err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	secret, err := newVerification(user, s.cfg.VerifyTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification token"})
+		return
+	}
+	if err := s.repo.Update(c.Request.Context(), user); err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	s.cfg.SendVerification(*user, verificationToken(user.ID, secret))
+	c.Status(http.StatusAccepted)
+}
+
+func (s *Server) verifyEmailHandler(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	invalid := func() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+	}
+	idPart, secret, ok := strings.Cut(req.Token, ".")
+	id, err := strconv.Atoi(idPart)
+	if !ok || err != nil {
+		invalid()
+		return
+	}
+	user, err := s.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		invalid()
+		return
+	}
+	if user.VerifyTokenHash == "" || time.Now().After(user.VerifyExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(user.VerifyTokenHash)) != 1 {
+		invalid()
+		return
+	}
+
+	user.EmailVerified = true
+	user.VerifyTokenHash = ""
+	user.VerifyExpiresAt = time.Time{}
+	if err := s.repo.Update(c.Request.Context(), user); err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,161 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// sendJSON sends a request with a Bearer token and decodes the response
+func sendJSON(router http.Handler, method, path, token string, body interface{}, out interface{}) int {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil {
+		json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return rec.Code
+}
+
+// registerAndLogin registers a user, returning it, its access token and the
+// verification tokens sent so far
+func registerAndLogin(t *testing.T, cfg Config, email string) (http.Handler, User, string, *[]string) {
+	sent := &[]string{}
+	cfg.SendVerification = func(user User, token string) { *sent = append(*sent, token) }
+	_, router := newTestServer(t, cfg)
+
+	var user User
+	if code := postJSON(router, "/register", RegisterRequest{Name: "Ada", Email: email, Password: "password123"}, &user); code != http.StatusCreated {
+		t.Fatalf("register returned %d", code)
+	}
+	var tokens tokenResponse
+	postJSON(router, "/login", LoginRequest{Email: email, Password: "password123"}, &tokens)
+	return router, user, tokens.Token, sent
+}
+
+func TestUpdateUser(t *testing.T) {
+	router, user, token, sent := registerAndLogin(t, DefaultConfig(), "ada@example.com")
+	path := "/users/" + strconv.Itoa(user.ID)
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		token string
+		req   UpdateUserRequest
+		code  int
+	}{
+		{"no token", "", UpdateUserRequest{Name: str("Ada")}, http.StatusUnauthorized},
+		{"profile", token, UpdateUserRequest{Bio: str("Analyst"), Location: str("London")}, http.StatusOK},
+		{"bad avatar", token, UpdateUserRequest{AvatarURL: str("javascript:alert(1)")}, http.StatusBadRequest},
+		{"email without password", token, UpdateUserRequest{Email: str("lovelace@example.com")}, http.StatusForbidden},
+		{"email", token, UpdateUserRequest{Email: str("lovelace@example.com"), CurrentPassword: "password123"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if code := sendJSON(router, "PUT", path, tt.token, tt.req, nil); code != tt.code {
+			t.Errorf("%s: PUT returned %d; want %d", tt.name, code, tt.code)
+		}
+	}
+
+	var got User
+	sendJSON(router, "GET", path, "", nil, &got)
+	if got.Bio != "Analyst" || got.Location != "London" || got.Email != "lovelace@example.com" {
+		t.Errorf("stored user = %+v", got)
+	}
+	if got.EmailVerified || len(*sent) != 2 {
+		t.Errorf("changing the email should send a new verification; verified=%v sent=%d", got.EmailVerified, len(*sent))
+	}
+
+	if code := sendJSON(router, "PUT", "/users/999", token, UpdateUserRequest{Name: str("x")}, nil); code != http.StatusForbidden {
+		t.Errorf("updating another user returned %d; want 403", code)
+	}
+}
+
+func TestGetUserForGatewayUser(t *testing.T) {
+	router, user, _, _ := registerAndLogin(t, DefaultConfig(), "ada@example.com")
+	path := "/users/" + strconv.Itoa(user.ID)
+
+	tests := []struct {
+		name      string
+		requester string
+		code      int
+	}{
+		{"direct", "", http.StatusOK},
+		{"self", strconv.Itoa(user.ID), http.StatusOK},
+		{"another user", strconv.Itoa(user.ID + 1), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", path, nil)
+		if tt.requester != "" {
+			req.Header.Set(UserIDHeader, tt.requester)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: got %d; want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	router, user, token, sent := registerAndLogin(t, DefaultConfig(), "grace@example.com")
+	if len(*sent) != 1 {
+		t.Fatalf("register sent %d verification tokens; want 1", len(*sent))
+	}
+	first := (*sent)[0]
+
+	// Resending replaces the pending token
+	if code := sendJSON(router, "POST", "/users/"+strconv.Itoa(user.ID)+"/verification", token, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("resend returned %d; want 202", code)
+	}
+	second := (*sent)[1]
+
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{"garbage", http.StatusBadRequest},
+		{first, http.StatusBadRequest},
+		{second, http.StatusOK},
+		{second, http.StatusBadRequest}, // tokens are single use
+	}
+	for i, tt := range tests {
+		if code := postJSON(router, "/verify-email", VerifyEmailRequest{tt.token}, nil); code != tt.code {
+			t.Errorf("verify #%d returned %d; want %d", i, code, tt.code)
+		}
+	}
+
+	var got User
+	sendJSON(router, "GET", "/users/"+strconv.Itoa(user.ID), "", nil, &got)
+	if !got.EmailVerified {
+		t.Errorf("email not verified after a valid token")
+	}
+	if code := sendJSON(router, "POST", "/users/"+strconv.Itoa(user.ID)+"/verification", token, nil, nil); code != http.StatusConflict {
+		t.Errorf("resend after verification returned %d; want 409", code)
+	}
+}
+
+func TestDeleteUserRevokesSessions(t *testing.T) {
+	router, user, token, _ := registerAndLogin(t, DefaultConfig(), "alan@example.com")
+	var tokens tokenResponse
+	postJSON(router, "/login", LoginRequest{Email: "alan@example.com", Password: "password123"}, &tokens)
+
+	path := "/users/" + strconv.Itoa(user.ID)
+	if code := sendJSON(router, "DELETE", path, token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete returned %d; want 204", code)
+	}
+	if code := sendJSON(router, "GET", path, "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("get after delete returned %d; want 404", code)
+	}
+	if code := postJSON(router, "/token/refresh", RefreshRequest{tokens.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh after delete returned %d; want 401", code)
+	}
+}
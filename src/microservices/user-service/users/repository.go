@@ -0,0 +1,189 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"user-service/events"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email already registered")
+)
+
+// UserRepository stores users. Emails are unique, compared after
+// normalizeEmail; implementations must be safe for concurrent use.
+//
+// Create, Update and Delete also add a UserRegistered, UserUpdated or
+// UserDeleted event to the repository's outbox, atomically with the change.
+type UserRepository interface {
+	// Create assigns the user an ID and timestamps and stores it
+	Create(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id int) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// List returns all users ordered by ID
+	List(ctx context.Context) ([]User, error)
+	// Update replaces a stored user and refreshes UpdatedAt
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id int) error
+
+	events.Outbox
+}
+
+// DeletedUser is the payload of a UserDeleted event
+type DeletedUser struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+// MemoryRepository keeps users in memory; data is lost on restart
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	emails map[string]int
+	nextID int
+	outbox []events.Event
+}
+
+// NewMemoryRepository creates an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{users: make(map[int]User), emails: make(map[string]int), nextID: 1}
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email := normalizeEmail(user.Email)
+	if _, taken := r.emails[email]; taken {
+		return ErrEmailTaken
+	}
+
+	created := *user
+	now := time.Now().UTC()
+	created.ID = r.nextID
+	created.Email = email
+	created.CreatedAt, created.UpdatedAt = now, now
+
+	event, err := events.NewEvent(events.UserRegistered, created.ID, created)
+	if err != nil {
+		return err
+	}
+	*user = created
+	r.nextID++
+	r.outbox = append(r.outbox, event)
+	r.users[user.ID] = *user
+	r.emails[email] = user.ID
+	return nil
+}
+
+func (r *MemoryRepository) GetByID(ctx context.Context, id int) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.emails[normalizeEmail(email)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user := r.users[id]
+	return &user, nil
+}
+
+func (r *MemoryRepository) List(ctx context.Context) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	email := normalizeEmail(user.Email)
+	if id, taken := r.emails[email]; taken && id != user.ID {
+		return ErrEmailTaken
+	}
+
+	updated := *user
+	updated.Email = email
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = time.Now().UTC()
+
+	event, err := events.NewEvent(events.UserUpdated, updated.ID, updated)
+	if err != nil {
+		return err
+	}
+	*user = updated
+	r.outbox = append(r.outbox, event)
+	delete(r.emails, existing.Email)
+	r.emails[email] = user.ID
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	event, err := events.NewEvent(events.UserDeleted, id, DeletedUser{ID: id, Email: user.Email})
+	if err != nil {
+		return err
+	}
+	r.outbox = append(r.outbox, event)
+	delete(r.emails, user.Email)
+	delete(r.users, id)
+	return nil
+}
+
+func (r *MemoryRepository) Pending(ctx context.Context, limit int) ([]events.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if limit > len(r.outbox) {
+		limit = len(r.outbox)
+	}
+	return append([]events.Event(nil), r.outbox[:limit]...), nil
+}
+
+func (r *MemoryRepository) MarkPublished(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, event := range r.outbox {
+		if event.ID == id {
+			r.outbox = append(r.outbox[:i], r.outbox[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"user-service/events"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		return NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "users.db"))
+		if err != nil {
+			t.Fatalf("sql.Open failed: %v", err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+
+		repo, err := NewSQLRepository(db)
+		if err != nil {
+			t.Fatalf("NewSQLRepository failed: %v", err)
+		}
+		return repo
+	})
+}
+
+// testUserRepository is the contract every UserRepository must satisfy
+func testUserRepository(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		user := &User{Name: "Ada", Email: " Ada@Example.com ", PasswordHash: "hash", Bio: "Analyst"}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if user.ID == 0 || user.Email != "ada@example.com" || user.CreatedAt.IsZero() {
+			t.Fatalf("Create did not fill in the user: %+v", user)
+		}
+
+		byID, err := repo.GetByID(ctx, user.ID)
+		if err != nil || byID.Name != "Ada" || byID.Bio != "Analyst" || byID.PasswordHash != "hash" {
+			t.Errorf("GetByID = %+v, %v", byID, err)
+		}
+		byEmail, err := repo.GetByEmail(ctx, "ADA@example.com")
+		if err != nil || byEmail.ID != user.ID {
+			t.Errorf("GetByEmail = %+v, %v", byEmail, err)
+		}
+
+		if _, err := repo.GetByID(ctx, user.ID+100); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetByID of a missing user returned %v; want ErrUserNotFound", err)
+		}
+		if _, err := repo.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetByEmail of a missing user returned %v; want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("UniqueEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Create(ctx, &User{Name: "Ada", Email: "ada@example.com"})
+		err := repo.Create(ctx, &User{Name: "Imposter", Email: "ADA@example.com"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("duplicate Create returned %v; want ErrEmailTaken", err)
+		}
+	})
+
+	t.Run("ListOrderedByID", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, name := range []string{"c", "a", "b"} {
+			repo.Create(ctx, &User{Name: name, Email: name + "@example.com"})
+		}
+		list, err := repo.List(ctx)
+		if err != nil || len(list) != 3 {
+			t.Fatalf("List = %v, %v", list, err)
+		}
+		for i, want := range []string{"c", "a", "b"} {
+			if list[i].Name != want {
+				t.Errorf("List[%d] = %s; want %s", i, list[i].Name, want)
+			}
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		ada := &User{Name: "Ada", Email: "ada@example.com"}
+		grace := &User{Name: "Grace", Email: "grace@example.com"}
+		repo.Create(ctx, ada)
+		repo.Create(ctx, grace)
+		created := ada.CreatedAt
+
+		expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		ada.Name, ada.Email, ada.Location = "Ada L.", "lovelace@example.com", "London"
+		ada.VerifyTokenHash, ada.VerifyExpiresAt = "abc", expires
+		ada.CreatedAt = time.Time{}
+		if err := repo.Update(ctx, ada); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if !ada.CreatedAt.Equal(created) || ada.UpdatedAt.Before(created) {
+			t.Errorf("Update timestamps: created %v updated %v; want created %v", ada.CreatedAt, ada.UpdatedAt, created)
+		}
+
+		stored, err := repo.GetByEmail(ctx, "lovelace@example.com")
+		if err != nil || stored.Location != "London" || !stored.VerifyExpiresAt.Equal(expires) {
+			t.Errorf("GetByEmail after update = %+v, %v", stored, err)
+		}
+		if _, err := repo.GetByEmail(ctx, "ada@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("old email still found: %v", err)
+		}
+
+		grace.Email = "LOVELACE@example.com"
+		if err := repo.Update(ctx, grace); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("Update to a taken email returned %v; want ErrEmailTaken", err)
+		}
+		if err := repo.Update(ctx, &User{ID: 999, Name: "x", Email: "x@example.com"}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Update of a missing user returned %v; want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		user := &User{Name: "Ada", Email: "ada@example.com"}
+		repo.Create(ctx, user)
+
+		if err := repo.Delete(ctx, user.ID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if err := repo.Delete(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("second Delete returned %v; want ErrUserNotFound", err)
+		}
+		// The email is free again
+		if err := repo.Create(ctx, &User{Name: "Ada", Email: "ada@example.com"}); err != nil {
+			t.Errorf("Create after Delete failed: %v", err)
+		}
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		repo := newRepo(t)
+		user := &User{Name: "Ada", Email: "ada@example.com"}
+		repo.Create(ctx, user)
+		user.Name = "Ada L."
+		repo.Update(ctx, user)
+		// Failed changes add no event
+		repo.Create(ctx, &User{Name: "Dup", Email: "ada@example.com"})
+		repo.Delete(ctx, user.ID)
+		repo.Delete(ctx, user.ID)
+
+		pending, err := repo.Pending(ctx, 10)
+		if err != nil {
+			t.Fatalf("Pending failed: %v", err)
+		}
+		want := []string{events.UserRegistered, events.UserUpdated, events.UserDeleted}
+		if len(pending) != len(want) {
+			t.Fatalf("outbox has %d events; want %d", len(pending), len(want))
+		}
+		for i, event := range pending {
+			if event.Type != want[i] || event.UserID != user.ID || event.ID == "" {
+				t.Errorf("event %d = %s for user %d; want %s for %d", i, event.Type, event.UserID, want[i], user.ID)
+			}
+		}
+		var updated User
+		if err := json.Unmarshal(pending[1].Data, &updated); err != nil || updated.Name != "Ada L." {
+			t.Errorf("UserUpdated payload = %s", pending[1].Data)
+		}
+
+		if err := repo.MarkPublished(ctx, pending[0].ID); err != nil {
+			t.Fatalf("MarkPublished failed: %v", err)
+		}
+		rest, _ := repo.Pending(ctx, 1)
+		if len(rest) != 1 || rest[0].ID != pending[1].ID {
+			t.Errorf("Pending after MarkPublished = %+v; want the UserUpdated event", rest)
+		}
+	})
+
+	t.Run("ConcurrentCreate", func(t *testing.T) {
+		repo := newRepo(t)
+		const n = 20
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*n)
+		for i := 0; i < n; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				errs <- repo.Create(ctx, &User{Name: "u", Email: fmt.Sprintf("u%d@example.com", i)})
+			}(i)
+			// Everyone races for the same address; exactly one wins
+			go func() {
+				defer wg.Done()
+				errs <- repo.Create(ctx, &User{Name: "same", Email: "same@example.com"})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		taken := 0
+		for err := range errs {
+			if errors.Is(err, ErrEmailTaken) {
+				taken++
+			} else if err != nil {
+				t.Errorf("Create failed: %v", err)
+			}
+		}
+		if taken != n-1 {
+			t.Errorf("%d creates lost the race for one email; want %d", taken, n-1)
+		}
+
+		list, _ := repo.List(ctx)
+		seen := make(map[int]bool)
+		for _, user := range list {
+			if seen[user.ID] {
+				t.Errorf("duplicate ID %d", user.ID)
+			}
+			seen[user.ID] = true
+		}
+		if len(list) != n+1 {
+			t.Errorf("List has %d users; want %d", len(list), n+1)
+		}
+	})
+}
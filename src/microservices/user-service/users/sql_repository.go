@@ -0,0 +1,271 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"user-service/events"
+)
+
+// SQLRepository stores users in a SQLite database through database/sql.
+// The unique index on email enforces unique registration across instances,
+// and outbox events are inserted in the transaction of the user change.
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the users table if needed
+func NewSQLRepository(db *sql.DB) (*SQLRepository, error) {
+	repo := &SQLRepository{db: db}
+	if err := repo.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return repo, nil
+}
+
+// migrate creates the necessary tables
+func (r *SQLRepository) migrate() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL UNIQUE,
+		email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+		bio TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT '',
+		password_hash TEXT NOT NULL,
+		verify_token_hash TEXT NOT NULL DEFAULT '',
+		verify_expires_at DATETIME,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS outbox (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL UNIQUE,
+		type TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		occurred_at DATETIME NOT NULL,
+		data TEXT NOT NULL,
+		published_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(published_at, seq);
+	`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+const userColumns = `id, name, email, email_verified, bio, avatar_url, location,
+	password_hash, verify_token_hash, verify_expires_at, created_at, updated_at`
+
+func (r *SQLRepository) Create(ctx context.Context, user *User) error {
+	created := *user
+	now := time.Now().UTC()
+	created.Email = normalizeEmail(user.Email)
+	created.CreatedAt, created.UpdatedAt = now, now
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO users (name, email, email_verified, bio, avatar_url, location,
+				password_hash, verify_token_hash, verify_expires_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			created.Name, created.Email, created.EmailVerified, created.Bio, created.AvatarURL, created.Location,
+			created.PasswordHash, created.VerifyTokenHash, nullTime(created.VerifyExpiresAt), now, now)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailTaken
+			}
+			return fmt.Errorf("failed to insert user: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		created.ID = int(id)
+		return insertEvent(ctx, tx, events.UserRegistered, created.ID, created)
+	})
+	if err != nil {
+		return err
+	}
+	*user = created
+	return nil
+}
+
+func (r *SQLRepository) GetByID(ctx context.Context, id int) (*User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	return scanUser(row)
+}
+
+func (r *SQLRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`, normalizeEmail(email))
+	return scanUser(row)
+}
+
+func (r *SQLRepository) List(ctx context.Context) ([]User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *user)
+	}
+	return list, rows.Err()
+}
+
+func (r *SQLRepository) Update(ctx context.Context, user *User) error {
+	now := time.Now().UTC()
+	var stored *User
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE users SET name = ?, email = ?, email_verified = ?, bio = ?, avatar_url = ?,
+				location = ?, password_hash = ?, verify_token_hash = ?, verify_expires_at = ?, updated_at = ?
+			WHERE id = ?`,
+			user.Name, normalizeEmail(user.Email), user.EmailVerified, user.Bio, user.AvatarURL,
+			user.Location, user.PasswordHash, user.VerifyTokenHash, nullTime(user.VerifyExpiresAt), now,
+			user.ID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailTaken
+			}
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrUserNotFound
+		}
+
+		stored, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, user.ID))
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, events.UserUpdated, stored.ID, stored)
+	})
+	if err != nil {
+		return err
+	}
+	*user = *stored
+	return nil
+}
+
+func (r *SQLRepository) Delete(ctx context.Context, id int) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		var email string
+		err := tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = ?`, id).Scan(&email)
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return insertEvent(ctx, tx, events.UserDeleted, id, DeletedUser{ID: id, Email: email})
+	})
+}
+
+func (r *SQLRepository) Pending(ctx context.Context, limit int) ([]events.Event, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, type, user_id, occurred_at, data FROM outbox
+		WHERE published_at IS NULL ORDER BY seq LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []events.Event
+	for rows.Next() {
+		var event events.Event
+		var data string
+		if err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.OccurredAt, &data); err != nil {
+			return nil, err
+		}
+		event.Data = []byte(data)
+		pending = append(pending, event)
+	}
+	return pending, rows.Err()
+}
+
+func (r *SQLRepository) MarkPublished(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET published_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	return err
+}
+
+// withTx runs fn in a transaction, committing if it succeeds
+func (r *SQLRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertEvent adds an event to the outbox within tx
+func insertEvent(ctx context.Context, tx *sql.Tx, eventType string, userID int, data interface{}) error {
+	event, err := events.NewEvent(eventType, userID, data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox (id, type, user_id, occurred_at, data) VALUES (?, ?, ?, ?, ?)`,
+		event.ID, event.Type, event.UserID, event.OccurredAt, string(event.Data))
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads the columns of userColumns
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var verifyExpires sql.NullTime
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.Bio,
+		&user.AvatarURL, &user.Location, &user.PasswordHash, &user.VerifyTokenHash,
+		&verifyExpires, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if verifyExpires.Valid {
+		user.VerifyExpiresAt = verifyExpires.Time
+	}
+	return &user, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// isUniqueViolation recognizes unique constraint errors across drivers
+func isUniqueViolation(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique") || strings.Contains(msg, "duplicate")
+}
@@ -0,0 +1,254 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// AccessClaims are the claims of an access token
+type AccessClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// issueAccessToken signs a short-lived access token with the active key
+func (s *Server) issueAccessToken(user User) (string, error) {
+	key := s.keys.Active()
+	now := time.Now()
+
+	token := jwt.NewWithClaims(key.method(), AccessClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			Issuer:    s.cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+		},
+	})
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// ParseAccessToken verifies an access token against the key set
+func (s *Server) ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.keys.keyfunc,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// refreshToken is a stored refresh token. Tokens issued by rotating one
+// another share a family, which is revoked as a whole if a used token is
+// presented again.
+type refreshToken struct {
+	userID    int
+	family    string
+	expiresAt time.Time
+	used      bool
+}
+
+// RefreshStore keeps refresh tokens by the SHA-256 of their value
+type RefreshStore struct {
+	mu      sync.Mutex
+	tokens  map[string]*refreshToken
+	revoked map[string]time.Time // revoked families, until their last token expires
+	ttl     time.Duration
+}
+
+// NewRefreshStore creates a store issuing tokens valid for ttl
+func NewRefreshStore(ttl time.Duration) *RefreshStore {
+	return &RefreshStore{
+		tokens:  make(map[string]*refreshToken),
+		revoked: make(map[string]time.Time),
+		ttl:     ttl,
+	}
+}
+
+// Issue creates a refresh token starting a new family
+func (rs *RefreshStore) Issue(userID int) (string, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.issue(userID, "")
+}
+
+// Rotate exchanges a refresh token for a new one in the same family. A token
+// can be used once; presenting it again revokes the whole family, since
+// either the client or an attacker holds a stolen copy.
+func (rs *RefreshStore) Rotate(token string) (userID int, next string, err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	stored, ok := rs.tokens[hashToken(token)]
+	if !ok || time.Now().After(stored.expiresAt) {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if _, revoked := rs.revoked[stored.family]; revoked {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if stored.used {
+		rs.revoke(stored.family)
+		return 0, "", ErrRefreshTokenReused
+	}
+
+	stored.used = true
+	next, err = rs.issue(stored.userID, stored.family)
+	return stored.userID, next, err
+}
+
+// Revoke revokes the family of a refresh token, logging out that session
+func (rs *RefreshStore) Revoke(token string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	stored, ok := rs.tokens[hashToken(token)]
+	if !ok {
+		return ErrInvalidRefreshToken
+	}
+	rs.revoke(stored.family)
+	return nil
+}
+
+// RevokeUser revokes every refresh token of a user
+func (rs *RefreshStore) RevokeUser(userID int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, stored := range rs.tokens {
+		if stored.userID == userID {
+			rs.revoke(stored.family)
+		}
+	}
+}
+
+// revoke revokes a family. Every token of it was issued by now, so the
+// revocation can be forgotten once a ttl has passed. Callers hold mu.
+func (rs *RefreshStore) revoke(family string) {
+	rs.revoked[family] = time.Now().Add(rs.ttl)
+}
+
+// issue stores a new random token, pruning expired tokens and revocations.
+// Callers hold mu.
+func (rs *RefreshStore) issue(userID int, family string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if family == "" {
+		family = hashToken(token)[:16]
+	}
+
+	now := time.Now()
+	for hash, stored := range rs.tokens {
+		if now.After(stored.expiresAt) {
+			delete(rs.tokens, hash)
+		}
+	}
+	for family, until := range rs.revoked {
+		if now.After(until) {
+			delete(rs.revoked, family)
+		}
+	}
+
+	rs.tokens[hashToken(token)] = &refreshToken{userID: userID, family: family, expiresAt: now.Add(rs.ttl)}
+	return token, nil
+}
+
+// hashToken returns the hex SHA-256 of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lockout locks an account after too many consecutive failed logins.
+// Failures are forgotten after a lockout duration without another one.
+type Lockout struct {
+	mu          sync.Mutex
+	attempts    map[string]*loginAttempts
+	maxFailures int
+	duration    time.Duration
+	swept       time.Time
+}
+
+// loginAttempts tracks failures for one email
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// expired reports whether the attempts no longer count at now
+func (a *loginAttempts) expired(now time.Time, duration time.Duration) bool {
+	return now.After(a.lockedUntil) && now.Sub(a.lastFailure) > duration
+}
+
+// NewLockout locks an account for duration after maxFailures failures
+func NewLockout(maxFailures int, duration time.Duration) *Lockout {
+	return &Lockout{attempts: make(map[string]*loginAttempts), maxFailures: maxFailures, duration: duration}
+}
+
+// Locked returns how long the account stays locked, or zero
+func (l *Lockout) Locked(email string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if a, ok := l.attempts[email]; ok {
+		if remaining := time.Until(a.lockedUntil); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+// Fail records a failed login, locking the account at the limit
+func (l *Lockout) Fail(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	a, ok := l.attempts[email]
+	if ok && a.expired(now, l.duration) {
+		a.failures = 0
+	}
+	if !ok {
+		// Sweep expired entries now and then as new emails arrive, so failures
+		// for made-up emails don't pile up
+		if now.Sub(l.swept) > l.duration {
+			for k, other := range l.attempts {
+				if other.expired(now, l.duration) {
+					delete(l.attempts, k)
+				}
+			}
+			l.swept = now
+		}
+		a = &loginAttempts{}
+		l.attempts[email] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	if a.failures >= l.maxFailures {
+		a.lockedUntil = now.Add(l.duration)
+		a.failures = 0
+	}
+}
+
+// Succeed clears the failures of an account
+func (l *Lockout) Succeed(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, email)
+}
@@ -0,0 +1,337 @@
+// Package users implements the user-service HTTP API so it can be served by
+// main or booted in-process by tests of other services.
+package users
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is a registered account with its profile
+type User struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Bio           string    `json:"bio,omitempty"`
+	AvatarURL     string    `json:"avatar_url,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	PasswordHash    string    `json:"-"`
+	VerifyTokenHash string    `json:"-"` // pending email verification, see profile.go
+	VerifyExpiresAt time.Time `json:"-"`
+}
+
+// RegisterRequest is the body of POST /register
+type RegisterRequest struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Bio       string `json:"bio"`
+	AvatarURL string `json:"avatar_url"`
+	Location  string `json:"location"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest is the body of /token/refresh and /logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// dummyHash is compared against for unknown emails so a failed login takes
+// as long whether or not the account exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// Config configures token signing and login protection
+type Config struct {
+	SigningAlg      string        // RS256 or EdDSA
+	KeyDir          string        // where signing keys are kept; empty keeps them in memory
+	KeepKeys        int           // keys published in the JWKS, including the active one
+	Issuer          string        // iss claim of access tokens
+	AccessTokenTTL  time.Duration // lifetime of access tokens
+	RefreshTokenTTL time.Duration // lifetime of refresh tokens
+	MaxFailedLogins int           // consecutive failures before an account locks
+	LockoutDuration time.Duration // how long a locked account stays locked
+	VerifyTokenTTL  time.Duration // how long an email verification link is valid
+
+	// SendVerification delivers an email verification token; the default logs it
+	SendVerification func(user User, token string)
+}
+
+// DefaultConfig returns the settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		SigningAlg:      AlgRS256,
+		KeepKeys:        3,
+		Issuer:          "user-service",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		MaxFailedLogins: 5,
+		LockoutDuration: 15 * time.Minute,
+		VerifyTokenTTL:  24 * time.Hour,
+		SendVerification: func(user User, token string) {
+			log.Printf("Verification token for %s: %s", user.Email, token)
+		},
+	}
+}
+
+// Server is the user-service with its repository, signing keys and sessions
+type Server struct {
+	cfg     Config
+	repo    UserRepository
+	keys    *KeySet
+	refresh *RefreshStore
+	lockout *Lockout
+}
+
+// NewServer creates a user-service backed by repo, loading or generating its
+// signing keys. A nil repo keeps users in memory.
+func NewServer(cfg Config, repo UserRepository) (*Server, error) {
+	keys, err := NewKeySet(cfg.SigningAlg, cfg.KeyDir, cfg.KeepKeys)
+	if err != nil {
+		return nil, err
+	}
+	if repo == nil {
+		repo = NewMemoryRepository()
+	}
+	if cfg.SendVerification == nil {
+		cfg.SendVerification = DefaultConfig().SendVerification
+	}
+	if cfg.VerifyTokenTTL <= 0 {
+		cfg.VerifyTokenTTL = DefaultConfig().VerifyTokenTTL
+	}
+	return &Server{
+		cfg:     cfg,
+		repo:    repo,
+		keys:    keys,
+		refresh: NewRefreshStore(cfg.RefreshTokenTTL),
+		lockout: NewLockout(cfg.MaxFailedLogins, cfg.LockoutDuration),
+	}, nil
+}
+
+// Keys returns the server's signing key set
+func (s *Server) Keys() *KeySet {
+	return s.keys
+}
+
+// StartKeyRotation rotates the signing key every interval until stop is
+// called. A failed rotation is logged and tried again at the next interval.
+func (s *Server) StartKeyRotation(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.keys.Rotate(); err != nil {
+					log.Printf("Failed to rotate signing key: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// Router returns the user-service routes
+func (s *Server) Router() *gin.Engine {
+	r := gin.Default()
+
+	r.GET("/health", healthHandler)
+	r.GET("/.well-known/jwks.json", s.jwksHandler)
+	r.POST("/register", s.registerHandler)
+	r.POST("/login", s.loginHandler)
+	r.POST("/token/refresh", s.refreshHandler)
+	r.POST("/logout", s.logoutHandler)
+	r.POST("/verify-email", s.verifyEmailHandler)
+	r.GET("/users", s.getUsersHandler)
+	r.GET("/users/:id", s.getUserHandler)
+
+	self := r.Group("/users/:id", s.requireSelf)
+	self.PUT("", s.updateUserHandler)
+	self.DELETE("", s.deleteUserHandler)
+	self.POST("/verification", s.resendVerificationHandler)
+
+	return r
+}
+
+func healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "healthy",
+		"service": "user-service",
+		"time":    time.Now().Unix(),
+	})
+}
+
+func (s *Server) jwksHandler(c *gin.Context) {
+	// Short cache so verifiers pick up rotated keys quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, s.keys.JWKS())
+}
+
+func (s *Server) registerHandler(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user := User{
+		Name:      strings.TrimSpace(req.Name),
+		Email:     normalizeEmail(req.Email),
+		Bio:       strings.TrimSpace(req.Bio),
+		AvatarURL: strings.TrimSpace(req.AvatarURL),
+		Location:  strings.TrimSpace(req.Location),
+	}
+	if msg := validateProfile(user); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if len(req.Password) < 8 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters"})
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	user.PasswordHash = string(hashedPassword)
+	token, err := newVerification(&user, s.cfg.VerifyTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification token"})
+		return
+	}
+
+	if err := s.repo.Create(c.Request.Context(), &user); err != nil {
+		respondRepoError(c, err)
+		return
+	}
+	s.cfg.SendVerification(user, verificationToken(user.ID, token))
+
+	c.JSON(http.StatusCreated, user)
+}
+
+func (s *Server) loginHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	email := normalizeEmail(req.Email)
+
+	if remaining := s.lockout.Locked(email); remaining > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		c.JSON(http.StatusLocked, gin.H{"error": "Account locked after too many failed logins"})
+		return
+	}
+
+	user, err := s.repo.GetByEmail(c.Request.Context(), email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		respondRepoError(c, err)
+		return
+	}
+	hash := dummyHash
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user == nil {
+		s.lockout.Fail(email)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	s.lockout.Succeed(email)
+
+	refreshToken, err := s.refresh.Issue(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+	s.respondWithTokens(c, *user, refreshToken)
+}
+
+func (s *Server) refreshHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, next, err := s.refresh.Rotate(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := s.repo.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		s.refresh.RevokeUser(userID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+		return
+	}
+	s.respondWithTokens(c, *user, next)
+}
+
+func (s *Server) logoutHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Unknown tokens are ignored so logging out twice is harmless
+	s.refresh.Revoke(req.RefreshToken)
+	c.Status(http.StatusNoContent)
+}
+
+// respondWithTokens sends a new access token along with a refresh token
+func (s *Server) respondWithTokens(c *gin.Context, user User, refreshToken string) {
+	accessToken, err := s.issueAccessToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(s.cfg.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"user":          user,
+	})
+}
+
+// respondRepoError maps repository errors to HTTP responses
+func respondRepoError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+	}
+}
+
+// normalizeEmail trims and lower-cases an email for comparison
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
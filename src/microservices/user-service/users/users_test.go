@@ -0,0 +1,206 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestServer(t *testing.T, cfg Config) (*Server, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	return server, server.Router()
+}
+
+func postJSON(router http.Handler, path string, body interface{}, out interface{}) int {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil {
+		json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return rec.Code
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func TestRegisterRejectsDuplicateEmail(t *testing.T) {
+	_, router := newTestServer(t, DefaultConfig())
+
+	tests := []struct {
+		user RegisterRequest
+		code int
+	}{
+		{RegisterRequest{Name: "Ada", Email: "dup@example.com", Password: "password123"}, http.StatusCreated},
+		{RegisterRequest{Name: "Ada again", Email: " DUP@example.com ", Password: "password123"}, http.StatusConflict},
+		{RegisterRequest{Name: "Short", Email: "short@example.com", Password: "pw"}, http.StatusBadRequest},
+		{RegisterRequest{Name: "", Email: "noname@example.com", Password: "password123"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if code := postJSON(router, "/register", tt.user, nil); code != tt.code {
+			t.Errorf("register %q = %d; want %d", tt.user.Email, code, tt.code)
+		}
+	}
+}
+
+func TestLoginVerifiesPasswordAndLocksOut(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxFailedLogins = 3
+	server, router := newTestServer(t, cfg)
+
+	postJSON(router, "/register", RegisterRequest{Name: "Grace", Email: "grace@example.com", Password: "password123"}, nil)
+	good := LoginRequest{Email: "grace@example.com", Password: "password123"}
+	bad := LoginRequest{Email: "grace@example.com", Password: "wrong-password"}
+
+	if code := postJSON(router, "/login", bad, nil); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password returned %d; want 401", code)
+	}
+	var tokens tokenResponse
+	if code := postJSON(router, "/login", good, &tokens); code != http.StatusOK {
+		t.Fatalf("correct password returned %d; want 200", code)
+	}
+	claims, err := server.ParseAccessToken(tokens.Token)
+	if err != nil || claims.Email != "grace@example.com" {
+		t.Errorf("access token invalid: %v %+v", err, claims)
+	}
+
+	for i := 0; i < cfg.MaxFailedLogins; i++ {
+		postJSON(router, "/login", bad, nil)
+	}
+	if code := postJSON(router, "/login", good, nil); code != http.StatusLocked {
+		t.Errorf("login after %d failures returned %d; want 423", cfg.MaxFailedLogins, code)
+	}
+
+	if code := postJSON(router, "/login", LoginRequest{Email: "nobody@example.com", Password: "password123"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("unknown email returned %d; want 401", code)
+	}
+}
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	_, router := newTestServer(t, DefaultConfig())
+
+	postJSON(router, "/register", RegisterRequest{Name: "Alan", Email: "alan@example.com", Password: "password123"}, nil)
+	var first tokenResponse
+	postJSON(router, "/login", LoginRequest{Email: "alan@example.com", Password: "password123"}, &first)
+
+	var second tokenResponse
+	if code := postJSON(router, "/token/refresh", RefreshRequest{first.RefreshToken}, &second); code != http.StatusOK {
+		t.Fatalf("refresh returned %d; want 200", code)
+	}
+	if second.RefreshToken == first.RefreshToken || second.Token == "" {
+		t.Fatalf("refresh did not rotate the token")
+	}
+
+	// Replaying the used token revokes the family, including the new token
+	if code := postJSON(router, "/token/refresh", RefreshRequest{first.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token returned %d; want 401", code)
+	}
+	if code := postJSON(router, "/token/refresh", RefreshRequest{second.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Errorf("token from a revoked family returned %d; want 401", code)
+	}
+
+	var third tokenResponse
+	postJSON(router, "/login", LoginRequest{Email: "alan@example.com", Password: "password123"}, &third)
+	postJSON(router, "/logout", RefreshRequest{third.RefreshToken}, nil)
+	if code := postJSON(router, "/token/refresh", RefreshRequest{third.RefreshToken}, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout returned %d; want 401", code)
+	}
+}
+
+func TestLockoutForgetsExpiredAttempts(t *testing.T) {
+	lockout := NewLockout(2, 20*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		lockout.Fail(fmt.Sprintf("user%d@example.com", i))
+	}
+	lockout.Fail("ada@example.com")
+	lockout.Fail("ada@example.com")
+	if lockout.Locked("ada@example.com") == 0 {
+		t.Fatal("account not locked at the limit")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if lockout.Locked("ada@example.com") != 0 {
+		t.Error("account still locked after the lockout")
+	}
+	lockout.Fail("new@example.com")
+	if len(lockout.attempts) != 1 {
+		t.Errorf("%d accounts tracked after expiry; want 1", len(lockout.attempts))
+	}
+}
+
+func TestRefreshStoreForgetsExpiredRevocations(t *testing.T) {
+	store := NewRefreshStore(20 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		token, _ := store.Issue(i)
+		store.Revoke(token)
+	}
+	if len(store.revoked) != 10 {
+		t.Fatalf("%d families revoked; want 10", len(store.revoked))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	store.Issue(99)
+	if len(store.revoked) != 0 || len(store.tokens) != 1 {
+		t.Errorf("%d revocations and %d tokens kept after expiry", len(store.revoked), len(store.tokens))
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.SigningAlg = alg
+			cfg.KeepKeys = 2
+			server, _ := newTestServer(t, cfg)
+
+			token, err := server.issueAccessToken(User{ID: 7, Email: "kid@example.com"})
+			if err != nil {
+				t.Fatalf("issueAccessToken failed: %v", err)
+			}
+
+			server.Keys().Rotate()
+			if _, err := server.ParseAccessToken(token); err != nil {
+				t.Errorf("token signed before one rotation rejected: %v", err)
+			}
+			if jwks := server.Keys().JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].Alg != alg {
+				t.Errorf("unexpected JWKS after rotation: %+v", jwks)
+			}
+
+			server.Keys().Rotate()
+			if _, err := server.ParseAccessToken(token); err == nil {
+				t.Errorf("token signed by a retired key still accepted")
+			}
+		})
+	}
+}
+
+func TestKeySetPersistsKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := NewKeySet(AlgEdDSA, dir, 3)
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+	reloaded, err := NewKeySet(AlgEdDSA, dir, 3)
+	if err != nil {
+		t.Fatalf("NewKeySet reload failed: %v", err)
+	}
+	if reloaded.Active().ID != first.Active().ID {
+		t.Errorf("reloaded active key %s; want %s", reloaded.Active().ID, first.Active().ID)
+	}
+}
@@ -0,0 +1,249 @@
+// Package pipeline connects typed stages with channels. Every stage runs
+// under the pipeline's context: when a stage fails, the consumer stops or
+// the parent context is cancelled, all of them return and close their
+// outputs, so no goroutine is left blocked.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StageError is the error of a stage that stopped the pipeline
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPolicy decides what a stage does with an item its function fails on
+type ErrorPolicy struct {
+	// Retries is how many more times the item is tried. The wait between
+	// tries starts at Backoff and doubles.
+	Retries int
+	Backoff time.Duration
+	// Skip drops the item after its last failure instead of stopping the
+	// pipeline. OnSkip, if set, is told about each dropped item.
+	Skip   bool
+	OnSkip func(err error)
+}
+
+var (
+	// FailFast stops the pipeline on the first error
+	FailFast = ErrorPolicy{}
+	// SkipErrors drops the items that fail
+	SkipErrors = ErrorPolicy{Skip: true}
+)
+
+// Retry tries a failing item again up to retries times before stopping
+// the pipeline
+func Retry(retries int, backoff time.Duration) ErrorPolicy {
+	return ErrorPolicy{Retries: retries, Backoff: backoff}
+}
+
+// ThenSkip drops an item that still fails after the policy's retries
+func (p ErrorPolicy) ThenSkip() ErrorPolicy {
+	p.Skip = true
+	return p
+}
+
+// Pipeline runs a set of connected stages
+type Pipeline struct {
+	parent  context.Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	stages  atomic.Int32
+	skipped atomic.Int64
+
+	mu  sync.Mutex
+	err error
+}
+
+// New starts an empty pipeline that runs until ctx is done
+func New(ctx context.Context) *Pipeline {
+	p := &Pipeline{parent: ctx}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	return p
+}
+
+// Context is done when the pipeline stops. Functions given to stages
+// receive it.
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Stop tears the pipeline down without an error, for a consumer that
+// doesn't want the rest of the output
+func (p *Pipeline) Stop() {
+	p.cancel()
+}
+
+// Wait waits for every stage to return. It returns the error that stopped
+// the pipeline, or the parent context's error if it was cancelled.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	return p.parent.Err()
+}
+
+// Skipped returns how many items were dropped by stages that skip errors
+func (p *Pipeline) Skipped() int64 {
+	return p.skipped.Load()
+}
+
+// fail records the first error and stops the pipeline
+func (p *Pipeline) fail(stage string, err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = &StageError{Stage: stage, Err: err}
+	}
+	p.mu.Unlock()
+	p.cancel()
+}
+
+// goStage runs a stage goroutine that Wait waits for
+func (p *Pipeline) goStage(run func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		run()
+	}()
+}
+
+// Option configures a stage
+type Option func(*stageOptions)
+
+type stageOptions struct {
+	name    string
+	workers int
+	ordered bool
+	buffer  int
+	policy  ErrorPolicy
+}
+
+// Named names a stage in errors
+func Named(name string) Option {
+	return func(o *stageOptions) { o.name = name }
+}
+
+// Workers runs a stage's function on n items at once
+func Workers(n int) Option {
+	return func(o *stageOptions) { o.workers = n }
+}
+
+// Ordered keeps a parallel stage's output in input order. Items that
+// finish early wait for those before them.
+func Ordered() Option {
+	return func(o *stageOptions) { o.ordered = true }
+}
+
+// Buffer lets a stage get n items ahead of its consumer
+func Buffer(n int) Option {
+	return func(o *stageOptions) { o.buffer = n }
+}
+
+// OnError sets what a stage does when its function fails; the default is
+// FailFast
+func OnError(policy ErrorPolicy) Option {
+	return func(o *stageOptions) { o.policy = policy }
+}
+
+func (p *Pipeline) options(kind string, opts []Option) stageOptions {
+	o := stageOptions{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.name == "" {
+		o.name = fmt.Sprintf("%s#%d", kind, p.stages.Add(1))
+	}
+	if o.workers < 1 {
+		o.workers = 1
+	}
+	if o.buffer < 0 {
+		o.buffer = 0
+	}
+	return o
+}
+
+// send delivers v unless the pipeline stops first
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// receive takes the next item unless the input is closed or the pipeline
+// stops first
+func receive[T any](ctx context.Context, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// apply runs fn on one item under the stage's error policy. It reports
+// false when the item produced no output, having been skipped or having
+// stopped the pipeline.
+func apply[In, Out any](p *Pipeline, o stageOptions, fn func(context.Context, In) (Out, error), v In) (Out, bool) {
+	backoff := o.policy.Backoff
+	for attempt := 0; ; attempt++ {
+		out, err := call(p.ctx, fn, v)
+		if err == nil {
+			return out, true
+		}
+		if p.ctx.Err() != nil {
+			return out, false
+		}
+		if attempt < o.policy.Retries {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-p.ctx.Done():
+				timer.Stop()
+				return out, false
+			}
+			backoff *= 2
+			continue
+		}
+		if o.policy.Skip {
+			p.skipped.Add(1)
+			if o.policy.OnSkip != nil {
+				o.policy.OnSkip(&StageError{Stage: o.name, Err: err})
+			}
+		} else {
+			p.fail(o.name, err)
+		}
+		return out, false
+	}
+}
+
+// call runs fn, turning a panic into an error
+func call[In, Out any](ctx context.Context, fn func(context.Context, In) (Out, error), v In) (out Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, v)
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMap(t *testing.T) {
+	p := New(context.Background())
+	squares := Map(p, From(p, 1, 2, 3), func(_ context.Context, n int) (int, error) { return n * n, nil })
+	labels := Map(p, squares, func(_ context.Context, n int) (string, error) { return strconv.Itoa(n), nil })
+	got, err := Collect(p, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "4", "9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestErrorPolicies(t *testing.T) {
+	errOdd := errors.New("odd")
+	failOdd := func(_ context.Context, n int) (int, error) {
+		if n%2 == 1 {
+			return 0, errOdd
+		}
+		return n, nil
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		p := New(context.Background())
+		_, err := Collect(p, Map(p, From(p, 2, 3, 4), failOdd, Named("evens")))
+		var stageErr *StageError
+		if !errors.As(err, &stageErr) || stageErr.Stage != "evens" || !errors.Is(err, errOdd) {
+			t.Errorf("err = %v", err)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		p := New(context.Background())
+		var skipped []error
+		policy := SkipErrors
+		policy.OnSkip = func(err error) { skipped = append(skipped, err) }
+		got, err := Collect(p, Map(p, From(p, 1, 2, 3, 4), failOdd, OnError(policy)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, []int{2, 4}) || p.Skipped() != 2 || len(skipped) != 2 {
+			t.Errorf("got %v, skipped %d, reported %v", got, p.Skipped(), skipped)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			policy   ErrorPolicy
+			failures int32
+			want     []int
+			wantErr  bool
+		}{
+			{"succeeds", Retry(2, time.Millisecond), 2, []int{1}, false},
+			{"gives up", Retry(2, time.Millisecond), 3, nil, true},
+			{"then skips", Retry(1, time.Millisecond).ThenSkip(), 2, nil, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var calls int32
+				flaky := func(_ context.Context, n int) (int, error) {
+					if atomic.AddInt32(&calls, 1) <= tt.failures {
+						return 0, errors.New("flaky")
+					}
+					return n, nil
+				}
+				p := New(context.Background())
+				got, err := Collect(p, Map(p, From(p, 1), flaky, OnError(tt.policy)))
+				if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, %v", got, err)
+				}
+			})
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		p := New(context.Background())
+		_, err := Collect(p, Map(p, From(p, 1), func(context.Context, int) (int, error) { panic("boom") }))
+		if err == nil {
+			t.Error("panic was not reported")
+		}
+	})
+}
+
+func TestParallelMap(t *testing.T) {
+	items := make([]int, 50)
+	for i := range items {
+		items[i] = i
+	}
+	// Later items finish first
+	slow := func(_ context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(len(items)-n) * 100 * time.Microsecond)
+		return n, nil
+	}
+
+	p := New(context.Background())
+	got, err := Collect(p, Map(p, From(p, items...), slow, Workers(8), Ordered()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("ordered output = %v", got)
+	}
+
+	p = New(context.Background())
+	got, err = Collect(p, Map(p, From(p, items...), slow, Workers(8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("unordered output = %v", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	p := New(context.Background())
+	got, err := Collect(p, Batch(p, From(p, 1, 2, 3, 4, 5), 2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{1, 2}, {3, 4}, {5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("by size = %v, want %v", got, want)
+	}
+
+	p = New(context.Background())
+	in := make(chan int)
+	batches := Batch(p, in, 10, 20*time.Millisecond)
+	in <- 1
+	in <- 2
+	select {
+	case batch := <-batches:
+		if !reflect.DeepEqual(batch, []int{1, 2}) {
+			t.Errorf("by time = %v", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("partial batch was not flushed")
+	}
+	close(in)
+	if _, err := Collect(p, batches); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFanOutFanIn(t *testing.T) {
+	p := New(context.Background())
+	double := func(_ context.Context, n int) (int, error) { return n * 2, nil }
+	var outs []<-chan int
+	for _, branch := range FanOut(p, From(p, 1, 2, 3, 4, 5, 6), 3) {
+		outs = append(outs, Map(p, branch, double))
+	}
+	got, err := Collect(p, FanIn(p, outs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(got)
+	if want := []int{2, 4, 6, 8, 10, 12}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTeardown(t *testing.T) {
+	identity := func(_ context.Context, n int) (int, error) { return n, nil }
+	build := func(p *Pipeline) <-chan int {
+		numbers := Generate(p, func(ctx context.Context, emit func(int) bool) error {
+			for i := 0; emit(i); i++ {
+			}
+			return nil
+		})
+		var outs []<-chan int
+		for _, branch := range FanOut(p, numbers, 2) {
+			outs = append(outs, Map(p, branch, identity, Workers(3), Ordered()))
+		}
+		return Filter(p, FanIn(p, outs...), func(int) bool { return true })
+	}
+
+	tests := []struct {
+		name    string
+		stop    func(p *Pipeline, cancel context.CancelFunc)
+		wantErr error
+	}{
+		{"consumer stops", func(p *Pipeline, _ context.CancelFunc) { p.Stop() }, nil},
+		{"parent cancelled", func(_ *Pipeline, cancel context.CancelFunc) { cancel() }, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			p := New(ctx)
+			out := build(p)
+			for i := 0; i < 10; i++ {
+				<-out
+			}
+			tt.stop(p, cancel)
+
+			done := make(chan error)
+			go func() { done <- p.Wait() }()
+			select {
+			case err := <-done:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Wait = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("stages still running")
+			}
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	errStop := errors.New("stop")
+	p := New(context.Background())
+	var seen []int
+	err := ForEach(p, From(p, 1, 2, 3, 4), func(n int) error {
+		seen = append(seen, n)
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || !reflect.DeepEqual(seen, []int{1, 2}) {
+		t.Errorf("err = %v, seen %v", err, seen)
+	}
+}
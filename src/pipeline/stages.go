@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// From emits items
+func From[T any](p *Pipeline, items ...T) <-chan T {
+	out := make(chan T)
+	p.goStage(func() {
+		defer close(out)
+		for _, v := range items {
+			if !send(p.ctx, out, v) {
+				return
+			}
+		}
+	})
+	return out
+}
+
+// Generate emits what fn passes to emit. Emit returns false once the
+// pipeline has stopped, and fn should then return. An error from fn stops
+// the pipeline.
+func Generate[T any](p *Pipeline, fn func(ctx context.Context, emit func(T) bool) error, opts ...Option) <-chan T {
+	o := p.options("generate", opts)
+	out := make(chan T, o.buffer)
+	p.goStage(func() {
+		defer close(out)
+		emit := func(v T) bool { return send(p.ctx, out, v) }
+		if err := fn(p.ctx, emit); err != nil && p.ctx.Err() == nil {
+			p.fail(o.name, err)
+		}
+	})
+	return out
+}
+
+// Map applies fn to each item. With Workers(n) it runs n at a time,
+// emitting results as they finish, or in input order with Ordered().
+func Map[In, Out any](p *Pipeline, in <-chan In, fn func(context.Context, In) (Out, error), opts ...Option) <-chan Out {
+	o := p.options("map", opts)
+	out := make(chan Out, o.buffer)
+	switch {
+	case o.workers == 1:
+		p.goStage(func() {
+			defer close(out)
+			mapItems(p, o, in, out, fn)
+		})
+	case !o.ordered:
+		var workers sync.WaitGroup
+		workers.Add(o.workers)
+		for i := 0; i < o.workers; i++ {
+			p.goStage(func() {
+				defer workers.Done()
+				mapItems(p, o, in, out, fn)
+			})
+		}
+		p.goStage(func() {
+			workers.Wait()
+			close(out)
+		})
+	default:
+		orderedMap(p, o, in, out, fn)
+	}
+	return out
+}
+
+func mapItems[In, Out any](p *Pipeline, o stageOptions, in <-chan In, out chan<- Out, fn func(context.Context, In) (Out, error)) {
+	for {
+		v, ok := receive(p.ctx, in)
+		if !ok {
+			return
+		}
+		result, ok := apply(p, o, fn, v)
+		if ok && !send(p.ctx, out, result) {
+			return
+		}
+	}
+}
+
+type mapped[Out any] struct {
+	value Out
+	ok    bool
+}
+
+type orderedJob[In, Out any] struct {
+	value  In
+	result chan mapped[Out]
+}
+
+// orderedMap hands items to workers and queues a result slot for each in
+// input order. The collector empties the slots in that order, so at most
+// workers items are held out of order.
+func orderedMap[In, Out any](p *Pipeline, o stageOptions, in <-chan In, out chan<- Out, fn func(context.Context, In) (Out, error)) {
+	jobs := make(chan orderedJob[In, Out])
+	slots := make(chan chan mapped[Out], o.workers)
+
+	p.goStage(func() {
+		defer close(jobs)
+		defer close(slots)
+		for {
+			v, ok := receive(p.ctx, in)
+			if !ok {
+				return
+			}
+			job := orderedJob[In, Out]{value: v, result: make(chan mapped[Out], 1)}
+			if !send(p.ctx, slots, job.result) || !send(p.ctx, jobs, job) {
+				return
+			}
+		}
+	})
+	for i := 0; i < o.workers; i++ {
+		p.goStage(func() {
+			for job := range jobs {
+				value, ok := apply(p, o, fn, job.value)
+				job.result <- mapped[Out]{value, ok}
+			}
+		})
+	}
+	p.goStage(func() {
+		defer close(out)
+		for slot := range slots {
+			result, ok := receive(p.ctx, slot)
+			if !ok {
+				return
+			}
+			if result.ok && !send(p.ctx, out, result.value) {
+				return
+			}
+		}
+	})
+}
+
+// Filter passes on the items keep returns true for
+func Filter[T any](p *Pipeline, in <-chan T, keep func(T) bool, opts ...Option) <-chan T {
+	o := p.options("filter", opts)
+	out := make(chan T, o.buffer)
+	p.goStage(func() {
+		defer close(out)
+		for {
+			v, ok := receive(p.ctx, in)
+			if !ok {
+				return
+			}
+			if keep(v) && !send(p.ctx, out, v) {
+				return
+			}
+		}
+	})
+	return out
+}
+
+// Batch groups items into slices of size. A partial batch is emitted once
+// its first item has waited maxWait, if maxWait is positive, and when
+// the input ends.
+func Batch[T any](p *Pipeline, in <-chan T, size int, maxWait time.Duration, opts ...Option) <-chan []T {
+	o := p.options("batch", opts)
+	out := make(chan []T, o.buffer)
+	if size < 1 {
+		size = 1
+	}
+	p.goStage(func() {
+		defer close(out)
+		var batch []T
+		var expired <-chan time.Time
+		timer := time.NewTimer(time.Hour)
+		stopTimer(timer)
+		defer timer.Stop()
+
+		flush := func() bool {
+			if len(batch) == 0 {
+				return true
+			}
+			full := batch
+			batch = nil
+			expired = nil
+			stopTimer(timer)
+			return send(p.ctx, out, full)
+		}
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					timer.Reset(maxWait)
+					expired = timer.C
+				}
+				if len(batch) == size && !flush() {
+					return
+				}
+			case <-expired:
+				expired = nil
+				if !flush() {
+					return
+				}
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	})
+	return out
+}
+
+// stopTimer stops timer and empties its channel so a Reset can't fire at
+// once with an old tick
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// FanOut spreads items over n outputs, each item going to whichever
+// output's consumer takes it first
+func FanOut[T any](p *Pipeline, in <-chan T, n int) []<-chan T {
+	outs := make([]<-chan T, n)
+	for i := range outs {
+		out := make(chan T)
+		outs[i] = out
+		p.goStage(func() {
+			defer close(out)
+			for {
+				v, ok := receive(p.ctx, in)
+				if !ok || !send(p.ctx, out, v) {
+					return
+				}
+			}
+		})
+	}
+	return outs
+}
+
+// FanIn merges inputs into one output, closed once all inputs are
+func FanIn[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var inputs sync.WaitGroup
+	inputs.Add(len(ins))
+	for _, in := range ins {
+		in := in
+		p.goStage(func() {
+			defer inputs.Done()
+			for {
+				v, ok := receive(p.ctx, in)
+				if !ok || !send(p.ctx, out, v) {
+					return
+				}
+			}
+		})
+	}
+	p.goStage(func() {
+		inputs.Wait()
+		close(out)
+	})
+	return out
+}
+
+// Collect reads in until it closes and returns the items with the
+// pipeline's error
+func Collect[T any](p *Pipeline, in <-chan T) ([]T, error) {
+	var items []T
+	for v := range in {
+		items = append(items, v)
+	}
+	return items, p.Wait()
+}
+
+// ForEach calls fn for each item of in. An error from fn stops the
+// pipeline and is returned.
+func ForEach[T any](p *Pipeline, in <-chan T, fn func(T) error) error {
+	for v := range in {
+		if err := fn(v); err != nil {
+			p.fail("for-each", err)
+			break
+		}
+	}
+	// Let the stages notice the stop and finish
+	p.Stop()
+	for range in {
+	}
+	return p.Wait()
+}
@@ -0,0 +1,84 @@
+package pool
+
+import "time"
+
+// Stats is a snapshot of a pool's load and history
+type Stats struct {
+	Workers int
+	Busy    int
+	// Queued is the queue depth: jobs waiting for a worker
+	Queued int
+	// Submitted counts accepted jobs, and Rejected those refused because
+	// the pool was closed or full
+	Submitted uint64
+	Rejected  uint64
+	// Completed counts finished jobs, of which Failed returned an error
+	Completed uint64
+	Failed    uint64
+	// AvgWait is the mean time a job spent queued, and AvgLatency and
+	// MaxLatency describe how long jobs ran
+	AvgWait    time.Duration
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+	// Utilization is the share of worker time spent running jobs since
+	// the pool started, from 0 to 1
+	Utilization float64
+}
+
+type metrics struct {
+	submitted, rejected uint64
+	completed, failed   uint64
+	wait, latency       time.Duration
+	maxLatency          time.Duration
+
+	// workerTime and busyTime integrate the worker and busy counts over
+	// time, up to last
+	workerTime, busyTime time.Duration
+	last                 time.Time
+}
+
+// account must be called before the worker or busy count changes
+func (m *metrics) account(now time.Time, workers, busy int) {
+	elapsed := now.Sub(m.last)
+	m.workerTime += time.Duration(workers) * elapsed
+	m.busyTime += time.Duration(busy) * elapsed
+	m.last = now
+}
+
+func (m *metrics) record(wait, latency time.Duration, err error) {
+	m.completed++
+	if err != nil {
+		m.failed++
+	}
+	m.wait += wait
+	m.latency += latency
+	if latency > m.maxLatency {
+		m.maxLatency = latency
+	}
+}
+
+// Stats returns the pool's current metrics
+func (p *Pool[In, Out]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := &p.metrics
+	m.account(time.Now(), p.workers, p.busy)
+	stats := Stats{
+		Workers:    p.workers,
+		Busy:       p.busy,
+		Queued:     len(p.queue),
+		Submitted:  m.submitted,
+		Rejected:   m.rejected,
+		Completed:  m.completed,
+		Failed:     m.failed,
+		MaxLatency: m.maxLatency,
+	}
+	if m.completed > 0 {
+		stats.AvgWait = m.wait / time.Duration(m.completed)
+		stats.AvgLatency = m.latency / time.Duration(m.completed)
+	}
+	if m.workerTime > 0 {
+		stats.Utilization = float64(m.busyTime) / float64(m.workerTime)
+	}
+	return stats
+}
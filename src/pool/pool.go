@@ -0,0 +1,403 @@
+// Package pool runs typed jobs on a set of workers that grows with the
+// queue and shrinks when idle.
+package pool
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by Submit once Drain or Stop has been called
+	ErrClosed = errors.New("pool is closed")
+	// ErrQueueFull is returned for a NoWait job when the queue has no room
+	ErrQueueFull = errors.New("pool queue is full")
+	// ErrStopped is the error of a job still queued when Stop was called
+	ErrStopped = errors.New("pool stopped before the job ran")
+)
+
+// PanicError is the error of a job whose function panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", e.Value)
+}
+
+// Func processes one job. It should return when ctx is done.
+type Func[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Options configures a Pool
+type Options struct {
+	// MinWorkers are always running. Up to MaxWorkers run while jobs are
+	// waiting.
+	MinWorkers int
+	MaxWorkers int
+	// QueueSize is how many jobs may wait for a worker. Submit waits for
+	// room when it is full.
+	QueueSize int
+	// IdleTimeout is how long a worker above MinWorkers waits for a job
+	// before it exits
+	IdleTimeout time.Duration
+	// JobTimeout bounds each job unless it sets its own; zero means no limit
+	JobTimeout time.Duration
+}
+
+// DefaultOptions keeps one worker, grows to one per CPU and queues 100 jobs
+func DefaultOptions() Options {
+	return Options{
+		MinWorkers:  1,
+		MaxWorkers:  runtime.NumCPU(),
+		QueueSize:   100,
+		IdleTimeout: 5 * time.Second,
+	}
+}
+
+// JobOptions overrides the pool's settings for one job
+type JobOptions struct {
+	// Priority orders the queue: higher runs first, and equal priorities
+	// run in submission order
+	Priority int
+	// Timeout replaces Options.JobTimeout when positive
+	Timeout time.Duration
+	// NoWait fails with ErrQueueFull instead of waiting for room
+	NoWait bool
+}
+
+// Pool runs a Func on submitted jobs
+type Pool[In, Out any] struct {
+	fn       Func[In, Out]
+	options  Options
+	wake     chan struct{}
+	quit     chan struct{}
+	finished chan struct{}
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	queue   taskQueue[In, Out]
+	seq     uint64
+	space   chan struct{} // closed when a queued job is taken, if anyone waits
+	running map[*Task[In, Out]]context.CancelFunc
+	workers int
+	idle    int
+	busy    int
+	closed  bool
+	stopped bool
+	metrics metrics
+}
+
+// New starts a pool with MinWorkers workers
+func New[In, Out any](fn Func[In, Out], options Options) *Pool[In, Out] {
+	defaults := DefaultOptions()
+	if options.MinWorkers < 0 {
+		options.MinWorkers = 0
+	}
+	if options.MaxWorkers <= 0 {
+		options.MaxWorkers = defaults.MaxWorkers
+	}
+	if options.MaxWorkers < options.MinWorkers {
+		options.MaxWorkers = options.MinWorkers
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaults.QueueSize
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaults.IdleTimeout
+	}
+	p := &Pool[In, Out]{
+		fn:       fn,
+		options:  options,
+		wake:     make(chan struct{}, options.MaxWorkers),
+		quit:     make(chan struct{}),
+		finished: make(chan struct{}),
+		running:  map[*Task[In, Out]]context.CancelFunc{},
+		metrics:  metrics{last: time.Now()},
+	}
+	p.mu.Lock()
+	for i := 0; i < options.MinWorkers; i++ {
+		p.startWorker()
+	}
+	p.mu.Unlock()
+	return p
+}
+
+// Submit queues a job, waiting for room until ctx is done. The job runs
+// with ctx, so cancelling it also cancels the job.
+func (p *Pool[In, Out]) Submit(ctx context.Context, in In) (*Task[In, Out], error) {
+	return p.SubmitWith(ctx, in, JobOptions{})
+}
+
+// SubmitWith queues a job with its own priority and timeout
+func (p *Pool[In, Out]) SubmitWith(ctx context.Context, in In, options JobOptions) (*Task[In, Out], error) {
+	t := &Task[In, Out]{
+		Input:    in,
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		priority: options.Priority,
+		timeout:  options.Timeout,
+	}
+	if t.timeout <= 0 {
+		t.timeout = p.options.JobTimeout
+	}
+
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.metrics.rejected++
+			p.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if len(p.queue) < p.options.QueueSize {
+			break
+		}
+		if options.NoWait {
+			p.metrics.rejected++
+			p.mu.Unlock()
+			return nil, ErrQueueFull
+		}
+		if p.space == nil {
+			p.space = make(chan struct{})
+		}
+		space := p.space
+		p.mu.Unlock()
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mu.Lock()
+	}
+
+	p.seq++
+	t.seq = p.seq
+	t.submitted = time.Now()
+	heap.Push(&p.queue, t)
+	p.metrics.submitted++
+	if p.idle > 0 {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+	if len(p.queue) > p.idle && p.workers < p.options.MaxWorkers {
+		p.startWorker()
+	}
+	p.mu.Unlock()
+	return t, nil
+}
+
+// Resize changes the worker limits. Workers above the new maximum exit
+// once their current job is done.
+func (p *Pool[In, Out]) Resize(minWorkers, maxWorkers int) {
+	if minWorkers < 0 {
+		minWorkers = 0
+	}
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
+	if maxWorkers == 0 {
+		maxWorkers = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.options.MinWorkers = minWorkers
+	p.options.MaxWorkers = maxWorkers
+	if cap(p.wake) < maxWorkers {
+		// Idle workers hold the old channel until they next wake
+		old := p.wake
+		p.wake = make(chan struct{}, maxWorkers)
+		close(old)
+	}
+	for p.workers < minWorkers || (len(p.queue) > p.idle && p.workers < maxWorkers) {
+		p.startWorker()
+	}
+	for i := 0; i < p.idle; i++ {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Drain stops accepting jobs and waits until the queued and running ones
+// are done, or until ctx is done
+func (p *Pool[In, Out]) Drain(ctx context.Context) error {
+	p.close(false)
+	select {
+	case <-p.finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop stops accepting jobs, fails the queued ones with ErrStopped and
+// cancels the running ones, then waits for the workers to exit
+func (p *Pool[In, Out]) Stop() {
+	p.close(true)
+	<-p.finished
+}
+
+func (p *Pool[In, Out]) close(stop bool) {
+	p.mu.Lock()
+	var dropped []*Task[In, Out]
+	if stop && !p.stopped {
+		p.stopped = true
+		dropped = p.queue
+		p.queue = nil
+		for _, cancel := range p.running {
+			cancel()
+		}
+	}
+	if !p.closed {
+		p.closed = true
+		close(p.quit)
+		if p.space != nil {
+			close(p.space)
+			p.space = nil
+		}
+		go func() {
+			p.wg.Wait()
+			close(p.finished)
+		}()
+	}
+	p.mu.Unlock()
+
+	for _, t := range dropped {
+		var zero Out
+		p.finish(t, zero, ErrStopped)
+	}
+}
+
+// startWorker must be called with the lock held
+func (p *Pool[In, Out]) startWorker() {
+	p.metrics.account(time.Now(), p.workers, p.busy)
+	p.workers++
+	p.wg.Add(1)
+	go p.worker()
+}
+
+func (p *Pool[In, Out]) worker() {
+	defer p.wg.Done()
+	for {
+		t := p.next()
+		if t == nil {
+			return
+		}
+		p.run(t)
+	}
+}
+
+// next takes the next job, or returns nil when the worker should exit
+func (p *Pool[In, Out]) next() *Task[In, Out] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.workers > p.options.MaxWorkers {
+			p.exitWorker()
+			return nil
+		}
+		if len(p.queue) > 0 {
+			return p.take()
+		}
+		if p.closed {
+			p.exitWorker()
+			return nil
+		}
+
+		p.idle++
+		wake := p.wake
+		p.mu.Unlock()
+		timer := time.NewTimer(p.options.IdleTimeout)
+		expired := false
+		select {
+		case <-wake:
+		case <-p.quit:
+		case <-timer.C:
+			expired = true
+		}
+		timer.Stop()
+		p.mu.Lock()
+		p.idle--
+		if expired && len(p.queue) == 0 && p.workers > p.options.MinWorkers {
+			p.exitWorker()
+			return nil
+		}
+	}
+}
+
+func (p *Pool[In, Out]) exitWorker() {
+	p.metrics.account(time.Now(), p.workers, p.busy)
+	p.workers--
+}
+
+// take pops the next job and gives it a context that Stop can cancel
+func (p *Pool[In, Out]) take() *Task[In, Out] {
+	t := heap.Pop(&p.queue).(*Task[In, Out])
+	if p.space != nil {
+		close(p.space)
+		p.space = nil
+	}
+	p.metrics.account(time.Now(), p.workers, p.busy)
+	p.busy++
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(t.ctx, t.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(t.ctx)
+	}
+	t.runCtx = ctx
+	p.running[t] = cancel
+	return t
+}
+
+func (p *Pool[In, Out]) run(t *Task[In, Out]) {
+	t.started = time.Now()
+	value, err := p.call(t.runCtx, t.Input)
+
+	p.mu.Lock()
+	p.running[t]()
+	delete(p.running, t)
+	p.metrics.account(time.Now(), p.workers, p.busy)
+	p.busy--
+	p.mu.Unlock()
+	p.finish(t, value, err)
+}
+
+// call runs the function, turning a panic into a PanicError
+func (p *Pool[In, Out]) call(ctx context.Context, in In) (out Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	// The job may have been cancelled while it waited
+	if err := ctx.Err(); err != nil {
+		return out, err
+	}
+	return p.fn(ctx, in)
+}
+
+func (p *Pool[In, Out]) finish(t *Task[In, Out], value Out, err error) {
+	t.finished = time.Now()
+	t.value, t.err = value, err
+	t.runCtx = nil
+
+	p.mu.Lock()
+	p.metrics.record(t.QueueTime(), t.RunTime(), err)
+	p.mu.Unlock()
+	close(t.done)
+}
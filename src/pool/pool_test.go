@@ -0,0 +1,251 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func square(_ context.Context, n int) (int, error) {
+	return n * n, nil
+}
+
+// gated returns a Func that blocks until the gate is closed or the job is
+// cancelled
+func gated(gate chan struct{}) Func[int, int] {
+	return func(ctx context.Context, n int) (int, error) {
+		select {
+		case <-gate:
+			return n, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResults(t *testing.T) {
+	p := New(square, Options{MinWorkers: 2, MaxWorkers: 4})
+	defer p.Stop()
+
+	var tasks []*Task[int, int]
+	for i := 0; i < 50; i++ {
+		task, err := p.Submit(context.Background(), i)
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	for _, task := range tasks {
+		if got, err := task.Result(); err != nil || got != task.Input*task.Input {
+			t.Errorf("job %d = %d, %v", task.Input, got, err)
+		}
+	}
+	if stats := p.Stats(); stats.Submitted != 50 || stats.Completed != 50 || stats.Failed != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	p := New(func(ctx context.Context, n int) (int, error) {
+		switch n {
+		case 1:
+			panic("boom")
+		case 2:
+			<-ctx.Done()
+			return 0, ctx.Err()
+		case 3:
+			return 0, errors.New("bad input")
+		}
+		return n, nil
+	}, Options{MaxWorkers: 2, JobTimeout: 20 * time.Millisecond})
+	defer p.Stop()
+
+	tests := []struct {
+		name  string
+		input int
+		check func(error) bool
+	}{
+		{"panic", 1, func(err error) bool {
+			var panicErr *PanicError
+			return errors.As(err, &panicErr) && panicErr.Value == "boom" && len(panicErr.Stack) > 0
+		}},
+		{"timeout", 2, func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }},
+		{"error", 3, func(err error) bool { return err != nil && err.Error() == "bad input" }},
+		{"success", 4, func(err error) bool { return err == nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := p.Submit(context.Background(), tt.input)
+			if err != nil {
+				t.Fatalf("Submit failed: %v", err)
+			}
+			if _, err := task.Result(); !tt.check(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+
+	// A job's own timeout overrides the pool's
+	task, _ := p.SubmitWith(context.Background(), 2, JobOptions{Timeout: time.Millisecond})
+	if _, err := task.Result(); !errors.Is(err, context.DeadlineExceeded) || task.RunTime() > 15*time.Millisecond {
+		t.Errorf("job timeout = %v after %v", err, task.RunTime())
+	}
+	if stats := p.Stats(); stats.Failed != 4 {
+		t.Errorf("failed = %d, want 4", stats.Failed)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	gate := make(chan struct{})
+	var mu sync.Mutex
+	var order []int
+	p := New(func(ctx context.Context, n int) (int, error) {
+		if n == 0 {
+			<-gate
+		}
+		mu.Lock()
+		order = append(order, n)
+		mu.Unlock()
+		return n, nil
+	}, Options{MinWorkers: 1, MaxWorkers: 1})
+	defer p.Stop()
+
+	p.Submit(context.Background(), 0)
+	waitFor(t, "the first job to start", func() bool { return p.Stats().Busy == 1 })
+	for _, job := range []struct{ n, priority int }{{1, 0}, {2, 5}, {3, 0}, {4, 9}, {5, 5}} {
+		p.SubmitWith(context.Background(), job.n, JobOptions{Priority: job.priority})
+	}
+	close(gate)
+	if err := p.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	want := []int{0, 4, 2, 5, 1, 3}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestScaling(t *testing.T) {
+	gate := make(chan struct{})
+	p := New(gated(gate), Options{MinWorkers: 1, MaxWorkers: 4, IdleTimeout: 20 * time.Millisecond})
+	defer p.Stop()
+
+	for i := 0; i < 8; i++ {
+		p.Submit(context.Background(), i)
+	}
+	waitFor(t, "the pool to grow", func() bool {
+		stats := p.Stats()
+		return stats.Workers == 4 && stats.Busy == 4 && stats.Queued == 4
+	})
+	close(gate)
+	waitFor(t, "idle workers to exit", func() bool { return p.Stats().Workers == 1 })
+
+	stats := p.Stats()
+	if stats.Completed != 8 || stats.Utilization <= 0 || stats.Utilization > 1 || stats.AvgWait <= 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	p.Resize(3, 3)
+	if stats := p.Stats(); stats.Workers != 3 {
+		t.Errorf("workers after growing = %d", stats.Workers)
+	}
+	p.Resize(0, 1)
+	waitFor(t, "workers above the new maximum to exit", func() bool { return p.Stats().Workers == 1 })
+}
+
+func TestQueueFull(t *testing.T) {
+	gate := make(chan struct{})
+	p := New(gated(gate), Options{MinWorkers: 1, MaxWorkers: 1, QueueSize: 1})
+	defer p.Stop()
+
+	p.Submit(context.Background(), 1)
+	waitFor(t, "the first job to start", func() bool { return p.Stats().Busy == 1 })
+	if _, err := p.Submit(context.Background(), 2); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if _, err := p.SubmitWith(context.Background(), 3, JobOptions{NoWait: true}); err != ErrQueueFull {
+		t.Errorf("NoWait on a full queue = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Submit(ctx, 4); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit on a full queue = %v", err)
+	}
+
+	// Room made by the worker lets a waiting Submit through
+	submitted := make(chan error)
+	go func() {
+		_, err := p.Submit(context.Background(), 5)
+		submitted <- err
+	}()
+	close(gate)
+	if err := <-submitted; err != nil {
+		t.Errorf("waiting Submit = %v", err)
+	}
+	if stats := p.Stats(); stats.Rejected != 1 {
+		t.Errorf("rejected = %d", stats.Rejected)
+	}
+}
+
+func TestDrainAndStop(t *testing.T) {
+	t.Run("drain", func(t *testing.T) {
+		p := New(func(ctx context.Context, n int) (int, error) {
+			time.Sleep(5 * time.Millisecond)
+			return n, nil
+		}, Options{MinWorkers: 1, MaxWorkers: 2})
+		var tasks []*Task[int, int]
+		for i := 0; i < 10; i++ {
+			task, _ := p.Submit(context.Background(), i)
+			tasks = append(tasks, task)
+		}
+		if err := p.Drain(context.Background()); err != nil {
+			t.Fatalf("Drain failed: %v", err)
+		}
+		for _, task := range tasks {
+			if _, err := task.Wait(context.Background()); err != nil {
+				t.Errorf("job %d = %v", task.Input, err)
+			}
+		}
+		if _, err := p.Submit(context.Background(), 11); err != ErrClosed {
+			t.Errorf("Submit after Drain = %v", err)
+		}
+		if stats := p.Stats(); stats.Workers != 0 {
+			t.Errorf("%d workers left", stats.Workers)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		p := New(gated(make(chan struct{})), Options{MinWorkers: 1, MaxWorkers: 1})
+		running, _ := p.Submit(context.Background(), 1)
+		waitFor(t, "the first job to start", func() bool { return p.Stats().Busy == 1 })
+		queued, _ := p.Submit(context.Background(), 2)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := p.Drain(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Drain of a stuck job = %v", err)
+		}
+		p.Stop()
+		if _, err := running.Result(); err != context.Canceled {
+			t.Errorf("running job = %v", err)
+		}
+		if _, err := queued.Result(); err != ErrStopped {
+			t.Errorf("queued job = %v", err)
+		}
+	})
+}
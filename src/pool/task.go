@@ -0,0 +1,87 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// Task is a submitted job and, once it is done, its result
+type Task[In, Out any] struct {
+	Input In
+
+	done     chan struct{}
+	ctx      context.Context
+	runCtx   context.Context
+	priority int
+	timeout  time.Duration
+	seq      uint64
+
+	value     Out
+	err       error
+	submitted time.Time
+	started   time.Time
+	finished  time.Time
+}
+
+// Done is closed when the job has finished
+func (t *Task[In, Out]) Done() <-chan struct{} {
+	return t.done
+}
+
+// Result waits for the job and returns what it returned
+func (t *Task[In, Out]) Result() (Out, error) {
+	<-t.done
+	return t.value, t.err
+}
+
+// Wait is Result that gives up when ctx is done. The job carries on.
+func (t *Task[In, Out]) Wait(ctx context.Context) (Out, error) {
+	select {
+	case <-t.done:
+		return t.value, t.err
+	case <-ctx.Done():
+		var zero Out
+		return zero, ctx.Err()
+	}
+}
+
+// QueueTime is how long the job waited for a worker. It is only set once
+// the job is done.
+func (t *Task[In, Out]) QueueTime() time.Duration {
+	if t.started.IsZero() {
+		return t.finished.Sub(t.submitted)
+	}
+	return t.started.Sub(t.submitted)
+}
+
+// RunTime is how long the job ran, zero if it never started
+func (t *Task[In, Out]) RunTime() time.Duration {
+	if t.started.IsZero() {
+		return 0
+	}
+	return t.finished.Sub(t.started)
+}
+
+// taskQueue is a heap of tasks by priority, then submission order
+type taskQueue[In, Out any] []*Task[In, Out]
+
+func (q taskQueue[In, Out]) Len() int { return len(q) }
+
+func (q taskQueue[In, Out]) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue[In, Out]) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue[In, Out]) Push(x any) { *q = append(*q, x.(*Task[In, Out])) }
+
+func (q *taskQueue[In, Out]) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return t
+}
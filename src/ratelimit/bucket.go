@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket holds up to burst tokens and refills at rate. Each event
+// takes a token. The refill is computed from the time since the last call
+// rather than by a ticker.
+type TokenBucket struct {
+	rate  Limit
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket
+func NewTokenBucket(rate Limit, burst int) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: burst, tokens: float64(burst)}
+}
+
+// advance refills the bucket up to now; it must be called with the lock
+// held
+func (b *TokenBucket) advance(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+	}
+	b.last = now
+}
+
+// Tokens returns how many tokens are available at now
+func (b *TokenBucket) Tokens(now time.Time) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	return b.tokens
+}
+
+func (b *TokenBucket) AllowN(now time.Time, n int) bool {
+	if b.rate == Inf {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// ReserveN takes n tokens now, going into debt if there aren't enough;
+// the delay is how long the refill takes to pay the debt. At a zero rate
+// nothing would pay it, so only the tokens left can be reserved.
+func (b *TokenBucket) ReserveN(now time.Time, n int) *Reservation {
+	if b.rate == Inf {
+		return &Reservation{ok: true, timeToAct: now}
+	}
+	if n > b.burst {
+		return &Reservation{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	if b.rate <= 0 {
+		if b.tokens < float64(n) {
+			return &Reservation{}
+		}
+		b.tokens -= float64(n)
+		return &Reservation{ok: true, timeToAct: now}
+	}
+	b.tokens -= float64(n)
+	timeToAct := now
+	if b.tokens < 0 {
+		timeToAct = now.Add(time.Duration(-b.tokens / float64(b.rate) * float64(time.Second)))
+	}
+	return &Reservation{ok: true, timeToAct: timeToAct, cancel: func(at time.Time) {
+		if !timeToAct.After(at) {
+			return // already used
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.advance(at)
+		b.tokens += float64(n)
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+	}}
+}
+
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	return wait(ctx, b, n)
+}
+
+// GCRA is the generic cell rate algorithm: it tracks only the theoretical
+// arrival time of the next event, which moves on by one interval per
+// event. Events are allowed while that time is less than burst intervals
+// ahead. It limits like a token bucket but keeps a single timestamp.
+type GCRA struct {
+	interval time.Duration
+	burst    int
+	noRefill bool // a zero rate allows burst events and then no more
+
+	mu    sync.Mutex
+	tat   time.Time
+	spent int // events allowed so far without refill
+}
+
+// NewGCRA allows rate events per second with bursts of up to burst. Like
+// a token bucket, a zero rate allows burst events in all.
+func NewGCRA(rate Limit, burst int) *GCRA {
+	return &GCRA{interval: rate.interval(), burst: burst, noRefill: rate <= 0}
+}
+
+// reserve returns the new arrival time for n events and when they may
+// happen; it must be called with the lock held
+func (g *GCRA) reserve(now time.Time, n int) (tat, allowAt time.Time) {
+	tat = g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	tat = tat.Add(time.Duration(n) * g.interval)
+	return tat, tat.Add(-time.Duration(g.burst) * g.interval)
+}
+
+func (g *GCRA) AllowN(now time.Time, n int) bool {
+	if g.interval == 0 && !g.noRefill {
+		return true
+	}
+	if n > g.burst {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.noRefill {
+		if g.spent+n > g.burst {
+			return false
+		}
+		g.spent += n
+		return true
+	}
+	tat, allowAt := g.reserve(now, n)
+	if allowAt.After(now) {
+		return false
+	}
+	g.tat = tat
+	return true
+}
+
+func (g *GCRA) ReserveN(now time.Time, n int) *Reservation {
+	if g.interval == 0 && !g.noRefill {
+		return &Reservation{ok: true, timeToAct: now}
+	}
+	if n > g.burst {
+		return &Reservation{}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.noRefill {
+		if g.spent+n > g.burst {
+			return &Reservation{}
+		}
+		g.spent += n
+		return &Reservation{ok: true, timeToAct: now}
+	}
+	tat, allowAt := g.reserve(now, n)
+	g.tat = tat
+	if allowAt.Before(now) {
+		allowAt = now
+	}
+	return &Reservation{ok: true, timeToAct: allowAt, cancel: func(at time.Time) {
+		if !allowAt.After(at) {
+			return
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.tat = g.tat.Add(-time.Duration(n) * g.interval)
+		if g.tat.Before(at) {
+			g.tat = at
+		}
+	}}
+}
+
+func (g *GCRA) WaitN(ctx context.Context, n int) error {
+	return wait(ctx, g, n)
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Concurrency limits how many events are in progress rather than how
+// often they start. Slots taken by AllowN, ReserveN or WaitN are held until
+// ReleaseN gives them back. Waiters are served in arrival order.
+type Concurrency struct {
+	max int
+
+	mu      sync.Mutex
+	inUse   int
+	waiters list.List // of *waiter
+}
+
+type waiter struct {
+	n     int
+	ready chan struct{}
+}
+
+// NewConcurrency allows max events at once
+func NewConcurrency(max int) *Concurrency {
+	return &Concurrency{max: max}
+}
+
+// InUse returns how many slots are held
+func (c *Concurrency) InUse() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inUse
+}
+
+// fits must be called with the lock held. Waiting callers go first, so a
+// stream of small requests can't starve a large one.
+func (c *Concurrency) fits(n int) bool {
+	return c.waiters.Len() == 0 && c.inUse+n <= c.max
+}
+
+func (c *Concurrency) AllowN(_ time.Time, n int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fits(n) {
+		return false
+	}
+	c.inUse += n
+	return true
+}
+
+// ReserveN takes n slots if they are free. Since no one knows when slots
+// will be released, a reservation is never granted for later; cancelling
+// it releases the slots.
+func (c *Concurrency) ReserveN(now time.Time, n int) *Reservation {
+	if !c.AllowN(now, n) {
+		return &Reservation{}
+	}
+	return &Reservation{ok: true, timeToAct: now, cancel: func(time.Time) { c.ReleaseN(n) }}
+}
+
+func (c *Concurrency) WaitN(ctx context.Context, n int) error {
+	if n > c.max {
+		return fmt.Errorf("failed to wait for %d slots: %w", n, ErrExceedsBurst)
+	}
+	c.mu.Lock()
+	if c.fits(n) {
+		c.inUse += n
+		c.mu.Unlock()
+		return nil
+	}
+	w := &waiter{n: n, ready: make(chan struct{})}
+	element := c.waiters.PushBack(w)
+	c.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		select {
+		case <-w.ready:
+			// Granted while giving up: hand the slots on
+			c.inUse -= n
+		default:
+			c.waiters.Remove(element)
+		}
+		c.grant()
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (c *Concurrency) ReleaseN(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse -= n
+	if c.inUse < 0 {
+		c.inUse = 0
+	}
+	c.grant()
+}
+
+// grant hands free slots to waiters in order; it must be called with the
+// lock held
+func (c *Concurrency) grant() {
+	for c.waiters.Len() > 0 {
+		front := c.waiters.Front()
+		w := front.Value.(*waiter)
+		if c.inUse+w.n > c.max {
+			return
+		}
+		c.inUse += w.n
+		c.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// busy keeps a Keyed limiter from evicting a limiter with slots held
+func (c *Concurrency) busy() bool {
+	return c.InUse() > 0
+}
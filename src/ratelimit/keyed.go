@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Keyed keeps a limiter per key, such as one per client, creating them on
+// first use. When it holds capacity limiters the least recently used one
+// is evicted, so memory stays bounded however many clients there are. An
+// evicted key starts again with a fresh limiter.
+type Keyed struct {
+	capacity   int
+	newLimiter func(key string) Limiter
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	recent  list.List // of *keyedEntry, most recently used first
+}
+
+type keyedEntry struct {
+	key     string
+	limiter Limiter
+}
+
+// NewKeyed keeps up to capacity limiters made by newLimiter
+func NewKeyed(capacity int, newLimiter func(key string) Limiter) *Keyed {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &Keyed{capacity: capacity, newLimiter: newLimiter, entries: map[string]*list.Element{}}
+}
+
+// Get returns the key's limiter, creating it if needed
+func (k *Keyed) Get(key string) Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if element, found := k.entries[key]; found {
+		k.recent.MoveToFront(element)
+		return element.Value.(*keyedEntry).limiter
+	}
+	k.evict()
+	entry := &keyedEntry{key: key, limiter: k.newLimiter(key)}
+	k.entries[key] = k.recent.PushFront(entry)
+	return entry.limiter
+}
+
+// evict makes room for one more limiter; it must be called with the lock
+// held. Concurrency limiters with slots held are passed over, since a
+// fresh one would let the key exceed its limit.
+func (k *Keyed) evict() {
+	for element := k.recent.Back(); element != nil && len(k.entries) >= k.capacity; {
+		entry := element.Value.(*keyedEntry)
+		previous := element.Prev()
+		if b, ok := entry.limiter.(interface{ busy() bool }); !ok || !b.busy() {
+			k.recent.Remove(element)
+			delete(k.entries, entry.key)
+		}
+		element = previous
+	}
+}
+
+// Len returns how many keys have a limiter
+func (k *Keyed) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.entries)
+}
+
+// AllowN is AllowN on the key's limiter
+func (k *Keyed) AllowN(key string, now time.Time, n int) bool {
+	return k.Get(key).AllowN(now, n)
+}
+
+// ReserveN is ReserveN on the key's limiter
+func (k *Keyed) ReserveN(key string, now time.Time, n int) *Reservation {
+	return k.Get(key).ReserveN(now, n)
+}
+
+// WaitN is WaitN on the key's limiter
+func (k *Keyed) WaitN(ctx context.Context, key string, n int) error {
+	return k.Get(key).WaitN(ctx, n)
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+)
+
+// KeyFunc picks the key a request is limited under
+type KeyFunc func(r *http.Request) string
+
+// ClientIP keys requests by the host of their remote address
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admit lets one request through the limiter, returning the function to
+// call when it is done, or how long the client should wait before
+// retrying
+func admit(l Limiter, now time.Time) (done func(), retryAfter string) {
+	r := l.ReserveN(now, 1)
+	if !r.OK() {
+		// A full concurrency limiter, or a zero rate one past its burst,
+		// can't say when to retry
+		return nil, "1"
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return nil, strconv.Itoa(int(math.Ceil(delay.Seconds())))
+	}
+	if releaser, ok := l.(Releaser); ok {
+		return func() { releaser.ReleaseN(1) }, ""
+	}
+	return func() {}, ""
+}
+
+// Middleware limits net/http requests per key, answering 429 Too Many
+// Requests with a Retry-After header when a key is over its limit. A nil
+// key function limits by client IP.
+func Middleware(limiter *Keyed, key KeyFunc) func(http.Handler) http.Handler {
+	if key == nil {
+		key = ClientIP
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			done, retryAfter := admit(limiter.Get(key(r)), time.Now())
+			if done == nil {
+				w.Header().Set("Retry-After", retryAfter)
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			defer done()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// EchoMiddleware is Middleware for Echo. A nil key function limits by
+// c.RealIP().
+func EchoMiddleware(limiter *Keyed, key func(c echo.Context) string) echo.MiddlewareFunc {
+	if key == nil {
+		key = func(c echo.Context) string { return c.RealIP() }
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			done, retryAfter := admit(limiter.Get(key(c)), time.Now())
+			if done == nil {
+				c.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+			defer done()
+			return next(c)
+		}
+	}
+}
+
+// GinMiddleware is Middleware for Gin. A nil key function limits by
+// c.ClientIP().
+func GinMiddleware(limiter *Keyed, key func(c *gin.Context) string) gin.HandlerFunc {
+	if key == nil {
+		key = func(c *gin.Context) string { return c.ClientIP() }
+	}
+	return func(c *gin.Context) {
+		done, retryAfter := admit(limiter.Get(key(c)), time.Now())
+		if done == nil {
+			c.Header("Retry-After", retryAfter)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		defer done()
+		c.Next()
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	routers := map[string]func(*Keyed) http.Handler{
+		"net/http": func(k *Keyed) http.Handler {
+			return Middleware(k, nil)(http.HandlerFunc(ok))
+		},
+		"echo": func(k *Keyed) http.Handler {
+			e := echo.New()
+			e.Use(EchoMiddleware(k, nil))
+			e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+			return e
+		},
+		"gin": func(k *Keyed) http.Handler {
+			r := gin.New()
+			r.Use(GinMiddleware(k, nil))
+			r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+			return r
+		},
+	}
+
+	for name, newRouter := range routers {
+		t.Run(name, func(t *testing.T) {
+			router := newRouter(NewKeyed(100, func(string) Limiter { return NewTokenBucket(1, 2) }))
+			request := func(ip string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = ip + ":1234"
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				return rec
+			}
+			for i := 0; i < 2; i++ {
+				if rec := request("10.0.0.1"); rec.Code != http.StatusOK {
+					t.Fatalf("request %d = %d", i, rec.Code)
+				}
+			}
+			rec := request("10.0.0.1")
+			if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+				t.Errorf("third request = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+			}
+			if rec := request("10.0.0.2"); rec.Code != http.StatusOK {
+				t.Errorf("other client = %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestMiddlewareReleasesSlots(t *testing.T) {
+	limiter := NewConcurrency(1)
+	keyed := NewKeyed(1, func(string) Limiter { return limiter })
+	inside := -1
+	handler := Middleware(keyed, func(*http.Request) string { return "all" })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { inside = limiter.InUse() }))
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d", i, rec.Code)
+		}
+	}
+	if inside != 1 || limiter.InUse() != 0 {
+		t.Errorf("slots in use during request = %d, after = %d", inside, limiter.InUse())
+	}
+
+	limiter.AllowN(base, 1)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request with no free slot = %d", rec.Code)
+	}
+}
+
+func TestMiddlewareZeroRate(t *testing.T) {
+	limiters := map[string]func(string) Limiter{
+		"token bucket": func(string) Limiter { return NewTokenBucket(0, 2) },
+		"gcra":         func(string) Limiter { return NewGCRA(0, 2) },
+	}
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			handler := Middleware(NewKeyed(1, newLimiter), nil)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+			// The burst gets through and then nothing does
+			for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != want {
+					t.Errorf("request %d = %d, want %d", i, rec.Code, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package ratelimit provides rate and concurrency limiters that keep no
+// goroutines or timers: their state is brought up to date when they are
+// asked, so one can be kept per client.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	// ErrExceedsBurst is returned when more events are asked for at once
+	// than the limiter ever allows
+	ErrExceedsBurst = errors.New("more events than the limiter allows at once")
+	// ErrDeadline is returned by WaitN when the wait would outlast the
+	// context's deadline
+	ErrDeadline = errors.New("rate limit wait would exceed the context deadline")
+)
+
+// Limit is a rate in events per second
+type Limit float64
+
+// Inf is the rate that allows every event
+const Inf = Limit(math.MaxFloat64)
+
+// Every converts an interval between events to a Limit
+func Every(interval time.Duration) Limit {
+	if interval <= 0 {
+		return Inf
+	}
+	return 1 / Limit(interval.Seconds())
+}
+
+// interval is the time between events at this rate
+func (l Limit) interval() time.Duration {
+	if l == Inf || l <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / float64(l))
+}
+
+// Limiter is implemented by every algorithm in the package
+type Limiter interface {
+	// AllowN reports whether n events may happen at now, and counts them
+	// if so
+	AllowN(now time.Time, n int) bool
+	// ReserveN counts n events and reports how long the caller must wait
+	// before they happen
+	ReserveN(now time.Time, n int) *Reservation
+	// WaitN blocks until n events are allowed or ctx is done
+	WaitN(ctx context.Context, n int) error
+}
+
+// Releaser is implemented by limiters whose capacity is held until it is
+// given back, such as Concurrency
+type Releaser interface {
+	ReleaseN(n int)
+}
+
+// Reservation is a claim on a limiter for events at a later time
+type Reservation struct {
+	ok        bool
+	timeToAct time.Time
+	cancel    func(now time.Time)
+}
+
+// OK reports whether the limiter can ever grant the reservation. Other
+// methods do nothing useful when it is false.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay is how long the caller must wait before acting
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+// DelayFrom is Delay relative to now
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return time.Duration(math.MaxInt64)
+	}
+	if delay := r.timeToAct.Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Cancel gives the reservation back, so other events may use it
+func (r *Reservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+// CancelAt is Cancel at a given time
+func (r *Reservation) CancelAt(now time.Time) {
+	if r.ok && r.cancel != nil {
+		r.cancel(now)
+		r.cancel = nil
+	}
+}
+
+// wait is WaitN for limiters that can reserve ahead of time
+func wait(ctx context.Context, l Limiter, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	r := l.ReserveN(now, n)
+	if !r.OK() {
+		return fmt.Errorf("failed to wait for %d events: %w", n, ErrExceedsBurst)
+	}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		r.CancelAt(now)
+		return ErrDeadline
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
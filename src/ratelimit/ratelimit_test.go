@@ -0,0 +1,250 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// base is on a window boundary, so sliding window tests are exact
+var base = time.Unix(1000, 0)
+
+func at(d time.Duration) time.Time {
+	return base.Add(d)
+}
+
+// Token buckets and GCRA limit the same way: 2 per second, bursts of 3
+func TestRateLimiters(t *testing.T) {
+	limiters := map[string]func() Limiter{
+		"token bucket": func() Limiter { return NewTokenBucket(2, 3) },
+		"gcra":         func() Limiter { return NewGCRA(2, 3) },
+	}
+	steps := []struct {
+		at   time.Duration
+		n    int
+		want bool
+	}{
+		{0, 1, true},
+		{0, 2, true},
+		{0, 1, false},
+		{400 * time.Millisecond, 1, false},
+		{500 * time.Millisecond, 1, true},
+		{500 * time.Millisecond, 1, false},
+		{2 * time.Second, 3, true},
+		{10 * time.Second, 4, false},
+	}
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			l := newLimiter()
+			for i, step := range steps {
+				if got := l.AllowN(at(step.at), step.n); got != step.want {
+					t.Errorf("step %d: AllowN(%v, %d) = %v, want %v", i, step.at, step.n, got, step.want)
+				}
+			}
+
+			l = newLimiter()
+			l.AllowN(base, 3)
+			r := l.ReserveN(base, 2)
+			if !r.OK() || r.DelayFrom(base) != time.Second {
+				t.Fatalf("ReserveN on an empty limiter: ok=%v delay=%v", r.OK(), r.DelayFrom(base))
+			}
+			r.CancelAt(base)
+			if !l.AllowN(at(500*time.Millisecond), 1) {
+				t.Error("cancelled reservation wasn't given back")
+			}
+			if l.ReserveN(base, 4).OK() {
+				t.Error("reservation over the burst granted")
+			}
+		})
+	}
+}
+
+func TestInfiniteRate(t *testing.T) {
+	for _, l := range []Limiter{NewTokenBucket(Inf, 0), NewGCRA(Every(0), 0)} {
+		if !l.AllowN(base, 1000) || l.ReserveN(base, 1000).DelayFrom(base) != 0 {
+			t.Errorf("%T limited an infinite rate", l)
+		}
+	}
+}
+
+func TestZeroRate(t *testing.T) {
+	for _, l := range []Limiter{NewTokenBucket(0, 3), NewGCRA(0, 3)} {
+		if !l.AllowN(base, 2) {
+			t.Errorf("%T refused the burst at a zero rate", l)
+		}
+		if r := l.ReserveN(base, 1); !r.OK() || r.DelayFrom(base) != 0 {
+			t.Errorf("%T refused a reservation from the rest of the burst", l)
+		}
+		if l.AllowN(base.Add(time.Hour), 1) {
+			t.Errorf("%T refilled at a zero rate", l)
+		}
+		if l.ReserveN(base.Add(time.Hour), 1).OK() {
+			t.Errorf("%T granted a reservation past the burst at a zero rate", l)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := NewSlidingWindow(4, time.Second)
+	for i := 0; i < 4; i++ {
+		if !w.AllowN(at(100*time.Millisecond), 1) {
+			t.Fatalf("event %d refused", i)
+		}
+	}
+	if w.AllowN(at(900*time.Millisecond), 1) {
+		t.Error("fifth event in the window allowed")
+	}
+
+	// Halfway through the next window half of the previous count remains
+	if got := w.Count(at(1500 * time.Millisecond)); got != 2 {
+		t.Errorf("Count = %v, want 2", got)
+	}
+	if !w.AllowN(at(1500*time.Millisecond), 2) {
+		t.Error("events refused once the previous window had slid half out")
+	}
+	if w.AllowN(at(1500*time.Millisecond), 1) {
+		t.Error("event over the estimate allowed")
+	}
+
+	// 4*(1-x) + 2 + 1 <= 4 once x = 3/4
+	r := w.ReserveN(at(1500*time.Millisecond), 1)
+	if got := r.DelayFrom(at(1500 * time.Millisecond)); got != 250*time.Millisecond {
+		t.Errorf("delay = %v, want 250ms", got)
+	}
+	r.CancelAt(at(1500 * time.Millisecond))
+	if w.AllowN(at(1600*time.Millisecond), 1) {
+		t.Error("event allowed before the delay passed")
+	}
+	if !w.AllowN(at(1750*time.Millisecond), 1) {
+		t.Error("cancelled reservation still counted")
+	}
+
+	// A reservation can land in a later window
+	w = NewSlidingWindow(2, time.Second)
+	w.AllowN(base, 2)
+	r = w.ReserveN(base, 2)
+	if got := r.DelayFrom(base); got != 2*time.Second {
+		t.Errorf("delay into a later window = %v, want 2s", got)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	c := NewConcurrency(2)
+	if !c.AllowN(base, 2) || c.AllowN(base, 1) {
+		t.Fatal("AllowN didn't fill exactly 2 slots")
+	}
+	if c.ReserveN(base, 1).OK() {
+		t.Error("reservation granted with no free slot")
+	}
+
+	acquired := make(chan int, 2)
+	for i, n := range []int{2, 1} {
+		n := n
+		go func() {
+			if err := c.WaitN(context.Background(), n); err == nil {
+				acquired <- n
+			}
+		}()
+		waitUntil(t, func() bool { return waiters(c) == i+1 })
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.WaitN(ctx, 1); err != context.Canceled {
+		t.Errorf("WaitN with a cancelled context = %v", err)
+	}
+
+	c.ReleaseN(1)
+	select {
+	case n := <-acquired:
+		t.Fatalf("waiter for %d slots served out of order", n)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.ReleaseN(1)
+	if n := <-acquired; n != 2 {
+		t.Errorf("first waiter served = %d", n)
+	}
+	c.ReleaseN(2)
+	if n := <-acquired; n != 1 {
+		t.Errorf("second waiter served = %d", n)
+	}
+	if c.InUse() != 1 {
+		t.Errorf("in use = %d", c.InUse())
+	}
+	if err := c.WaitN(context.Background(), 3); !errors.Is(err, ErrExceedsBurst) {
+		t.Errorf("WaitN over the limit = %v", err)
+	}
+}
+
+func waiters(c *Concurrency) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waiters.Len()
+}
+
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWaitN(t *testing.T) {
+	b := NewTokenBucket(Every(30*time.Millisecond), 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.WaitN(context.Background(), 1); err != nil {
+			t.Fatalf("WaitN failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 55*time.Millisecond {
+		t.Errorf("3 events at 30ms intervals took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := b.WaitN(ctx, 1); err != ErrDeadline {
+		t.Errorf("WaitN past the deadline = %v", err)
+	}
+	if err := b.WaitN(context.Background(), 2); !errors.Is(err, ErrExceedsBurst) {
+		t.Errorf("WaitN over the burst = %v", err)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	created := 0
+	k := NewKeyed(2, func(key string) Limiter {
+		created++
+		return NewTokenBucket(1, 1)
+	})
+	if !k.AllowN("a", base, 1) || k.AllowN("a", base, 1) {
+		t.Fatal("key a not limited")
+	}
+	if !k.AllowN("b", base, 1) {
+		t.Error("key b limited by key a")
+	}
+	k.Get("a") // b is now the least recently used
+	k.AllowN("c", base, 1)
+	if k.Len() != 2 || created != 3 {
+		t.Fatalf("len = %d, created = %d", k.Len(), created)
+	}
+	if k.AllowN("a", base, 1) {
+		t.Error("key a was evicted instead of b")
+	}
+	if !k.AllowN("b", base, 1) {
+		t.Error("key b kept its spent limiter")
+	}
+
+	// A concurrency limiter in use is kept even when least recently used
+	k = NewKeyed(1, func(string) Limiter { return NewConcurrency(1) })
+	k.AllowN("busy", base, 1)
+	k.Get("other")
+	if k.AllowN("busy", base, 1) {
+		t.Error("busy limiter was evicted")
+	}
+}
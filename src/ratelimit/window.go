@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SlidingWindow allows limit events in any window. It counts events per
+// fixed window and estimates the sliding count as the current window's
+// count plus the share of the previous window's still inside the sliding
+// window, which takes two counters instead of a log of timestamps.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+
+	mu sync.Mutex
+	// counts holds events by window number, for the previous window and
+	// any ahead of it with reservations
+	counts map[int64]int
+}
+
+// NewSlidingWindow allows limit events per window
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{limit: limit, window: window, counts: map[int64]int{}}
+}
+
+func (w *SlidingWindow) index(t time.Time) int64 {
+	return t.UnixNano() / int64(w.window)
+}
+
+func (w *SlidingWindow) start(index int64) time.Time {
+	return time.Unix(0, index*int64(w.window))
+}
+
+// prune forgets windows that no longer count; it must be called with the
+// lock held
+func (w *SlidingWindow) prune(current int64) {
+	for index := range w.counts {
+		if index < current-1 {
+			delete(w.counts, index)
+		}
+	}
+}
+
+// earliest finds the first time from now at which n more events fit,
+// with the window they fall in; it must be called with the lock held
+func (w *SlidingWindow) earliest(now time.Time, n int) (time.Time, int64) {
+	for index := w.index(now); ; index++ {
+		start := w.start(index)
+		from := start
+		if now.After(from) {
+			from = now
+		}
+		room := float64(w.limit - n - w.counts[index])
+		if room < 0 {
+			continue
+		}
+		previous := float64(w.counts[index-1])
+		if previous <= room {
+			return from, index
+		}
+		// The previous window's weight falls linearly across this one
+		at := start.Add(time.Duration((1 - room/previous) * float64(w.window)))
+		if at.Before(from) {
+			at = from
+		}
+		if at.Before(start.Add(w.window)) {
+			return at, index
+		}
+	}
+}
+
+// Count estimates the events in the window ending at now
+func (w *SlidingWindow) Count(now time.Time) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	index := w.index(now)
+	elapsed := float64(now.Sub(w.start(index))) / float64(w.window)
+	return float64(w.counts[index]) + float64(w.counts[index-1])*(1-elapsed)
+}
+
+func (w *SlidingWindow) AllowN(now time.Time, n int) bool {
+	if n > w.limit {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	current := w.index(now)
+	w.prune(current)
+	at, index := w.earliest(now, n)
+	if at.After(now) || index != current {
+		return false
+	}
+	w.counts[index] += n
+	return true
+}
+
+func (w *SlidingWindow) ReserveN(now time.Time, n int) *Reservation {
+	if n > w.limit {
+		return &Reservation{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.prune(w.index(now))
+	at, index := w.earliest(now, n)
+	w.counts[index] += n
+	return &Reservation{ok: true, timeToAct: at, cancel: func(now time.Time) {
+		if !at.After(now) {
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.counts[index] >= n {
+			w.counts[index] -= n
+		}
+	}}
+}
+
+func (w *SlidingWindow) WaitN(ctx context.Context, n int) error {
+	return wait(ctx, w, n)
+}
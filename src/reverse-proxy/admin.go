@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// newAdminServer serves the admin API:
+//
+//	GET    /upstreams             list upstreams and their state
+//	POST   /upstreams             add an upstream {"url": ..., "weight": ...}
+//	POST   /upstreams/:id/drain   stop sending new clients to an upstream
+//	POST   /upstreams/:id/enable  undo drain
+//	DELETE /upstreams/:id         remove an upstream
+func newAdminServer(pool *Pool, config AdminConfig) *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(middleware.Recover())
+	if config.Token != "" {
+		e.Use(middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(config.Token)) == 1, nil
+		}))
+	}
+
+	e.GET("/upstreams", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, pool.Status())
+	})
+
+	e.POST("/upstreams", func(c echo.Context) error {
+		var request UpstreamConfig
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+		upstream, err := pool.Add(request)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusCreated, map[string]string{"id": upstream.ID})
+	})
+
+	e.POST("/upstreams/:id/drain", func(c echo.Context) error {
+		return adminResult(c, pool.SetDraining(c.Param("id"), true))
+	})
+
+	e.POST("/upstreams/:id/enable", func(c echo.Context) error {
+		return adminResult(c, pool.SetDraining(c.Param("id"), false))
+	})
+
+	e.DELETE("/upstreams/:id", func(c echo.Context) error {
+		return adminResult(c, pool.Remove(c.Param("id")))
+	})
+
+	return e
+}
+
+// adminResult answers 204, or 404 for an unknown upstream
+func adminResult(c echo.Context, err error) error {
+	if errors.Is(err, ErrUnknownUpstream) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// isLoopback reports whether a listen address only accepts local clients
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,126 @@
+package main
+
+import "time"
+
+// Breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// breakerBuckets is how many slices the rolling window is split into
+const breakerBuckets = 10
+
+type bucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// breaker is a per-upstream circuit breaker over a rolling error rate. It
+// has no lock of its own; the pool guards it.
+type breaker struct {
+	config   CircuitBreakerConfig
+	state    string
+	buckets  [breakerBuckets]bucket
+	openedAt time.Time
+	// half-open bookkeeping: trial requests let through and passed so far
+	trials    int
+	successes int
+}
+
+func newBreaker(config CircuitBreakerConfig) *breaker {
+	return &breaker{config: config, state: breakerClosed}
+}
+
+// current moves an open breaker to half-open once the timeout has passed
+// and returns the state
+func (b *breaker) current(now time.Time) string {
+	if b.state == breakerOpen && !now.Before(b.openedAt.Add(b.config.OpenTimeout)) {
+		b.state = breakerHalfOpen
+		b.trials, b.successes = 0, 0
+	}
+	return b.state
+}
+
+// ready reports whether allow would let a request through
+func (b *breaker) ready(now time.Time) bool {
+	switch b.current(now) {
+	case breakerOpen:
+		return false
+	case breakerHalfOpen:
+		return b.trials < b.config.HalfOpenRequests
+	}
+	return true
+}
+
+// allow lets a request through, counting half-open trials
+func (b *breaker) allow(now time.Time) bool {
+	if !b.ready(now) {
+		return false
+	}
+	if b.state == breakerHalfOpen {
+		b.trials++
+	}
+	return true
+}
+
+// record counts the outcome of a request that allow let through
+func (b *breaker) record(now time.Time, failed bool) {
+	switch b.current(now) {
+	case breakerHalfOpen:
+		if failed {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.state = breakerClosed
+			b.buckets = [breakerBuckets]bucket{}
+		}
+	case breakerClosed:
+		current := b.bucket(now)
+		if failed {
+			current.failures++
+		} else {
+			current.successes++
+		}
+		successes, failures := b.totals(now)
+		total := successes + failures
+		if total >= b.config.MinRequests && failures*100 >= b.config.FailureRate*total {
+			b.open(now)
+		}
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.openedAt = now
+}
+
+// bucket returns the bucket for now, recycling it if it is from an
+// earlier lap of the window
+func (b *breaker) bucket(now time.Time) *bucket {
+	width := b.config.Window / breakerBuckets
+	if width <= 0 {
+		width = 1
+	}
+	start := now.Truncate(width)
+	current := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+// totals sums the buckets still inside the window
+func (b *breaker) totals(now time.Time) (successes, failures int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.config.Window {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
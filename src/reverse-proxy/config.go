@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Balancing algorithms
+const (
+	RoundRobin         = "round-robin"
+	WeightedRoundRobin = "weighted-round-robin"
+	LeastConnections   = "least-connections"
+)
+
+// Config is the proxy configuration file
+type Config struct {
+	Listen    string           `yaml:"listen"`
+	Balancing string           `yaml:"balancing"`
+	Upstreams []UpstreamConfig `yaml:"upstreams"`
+
+	HealthCheck      HealthCheckConfig      `yaml:"health_check"`
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier_detection"`
+	CircuitBreaker   CircuitBreakerConfig   `yaml:"circuit_breaker"`
+	Sticky           StickyConfig           `yaml:"sticky"`
+	Admin            AdminConfig            `yaml:"admin"`
+}
+
+// UpstreamConfig is one target to proxy to
+type UpstreamConfig struct {
+	URL    string `yaml:"url" json:"url"`
+	Weight int    `yaml:"weight" json:"weight"` // relative share of traffic, default 1
+}
+
+// HealthCheckConfig controls active health checks. An upstream leaves the
+// rotation after UnhealthyThreshold failed checks in a row and returns
+// after HealthyThreshold passed ones.
+type HealthCheckConfig struct {
+	Path               string        `yaml:"path"`
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	HealthyThreshold   int           `yaml:"healthy_threshold"`
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"`
+}
+
+// OutlierDetectionConfig controls passive ejection: an upstream that fails
+// ConsecutiveErrors proxied requests in a row is taken out for
+// BaseEjectionTime, longer each time it is ejected again
+type OutlierDetectionConfig struct {
+	ConsecutiveErrors  int           `yaml:"consecutive_errors"`
+	BaseEjectionTime   time.Duration `yaml:"base_ejection_time"`
+	MaxEjectionTime    time.Duration `yaml:"max_ejection_time"`
+	MaxEjectionPercent int           `yaml:"max_ejection_percent"`
+}
+
+// CircuitBreakerConfig controls the per-upstream breakers. A breaker opens
+// when at least FailureRate percent of the requests in Window fail, given
+// at least MinRequests; after OpenTimeout it lets HalfOpenRequests through
+// to decide whether to close again.
+type CircuitBreakerConfig struct {
+	Window           time.Duration `yaml:"window"`
+	MinRequests      int           `yaml:"min_requests"`
+	FailureRate      int           `yaml:"failure_rate"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+// StickyConfig pins clients to an upstream with a cookie
+type StickyConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Cookie  string        `yaml:"cookie"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// AdminConfig serves the admin API on its own address, so it is never
+// reachable through the proxy port
+type AdminConfig struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token"` // bearer token; required unless listening on loopback
+}
+
+// defaultConfig returns the settings used for anything the file leaves out
+func defaultConfig() Config {
+	return Config{
+		Listen:    ":1323",
+		Balancing: RoundRobin,
+		HealthCheck: HealthCheckConfig{
+			Path:               "/health",
+			Interval:           5 * time.Second,
+			Timeout:            2 * time.Second,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 3,
+		},
+		OutlierDetection: OutlierDetectionConfig{
+			ConsecutiveErrors:  5,
+			BaseEjectionTime:   30 * time.Second,
+			MaxEjectionTime:    5 * time.Minute,
+			MaxEjectionPercent: 50,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Window:           10 * time.Second,
+			MinRequests:      20,
+			FailureRate:      50,
+			OpenTimeout:      15 * time.Second,
+			HalfOpenRequests: 3,
+		},
+		Sticky: StickyConfig{Cookie: "proxy_upstream", TTL: time.Hour},
+		Admin:  AdminConfig{Listen: "127.0.0.1:9901"},
+	}
+}
+
+// loadConfig reads the YAML file at path over the defaults
+func loadConfig(path string) (Config, error) {
+	config := defaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks the configuration
+func (c *Config) Validate() error {
+	switch c.Balancing {
+	case RoundRobin, WeightedRoundRobin, LeastConnections:
+	default:
+		return fmt.Errorf("unknown balancing %q", c.Balancing)
+	}
+	if len(c.Upstreams) == 0 {
+		return errors.New("at least one upstream is required")
+	}
+	for i := range c.Upstreams {
+		if err := c.Upstreams[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.HealthCheck.Interval <= 0 || c.HealthCheck.Timeout <= 0 {
+		return errors.New("health_check interval and timeout must be positive")
+	}
+	if c.HealthCheck.HealthyThreshold < 1 || c.HealthCheck.UnhealthyThreshold < 1 {
+		return errors.New("health_check thresholds must be at least 1")
+	}
+	if p := c.OutlierDetection.MaxEjectionPercent; p < 0 || p > 100 {
+		return errors.New("outlier_detection max_ejection_percent must be between 0 and 100")
+	}
+	if r := c.CircuitBreaker.FailureRate; r < 1 || r > 100 {
+		return errors.New("circuit_breaker failure_rate must be between 1 and 100")
+	}
+	if c.CircuitBreaker.Window <= 0 || c.CircuitBreaker.OpenTimeout <= 0 || c.CircuitBreaker.HalfOpenRequests < 1 {
+		return errors.New("circuit_breaker window, open_timeout and half_open_requests must be positive")
+	}
+	if c.Sticky.Enabled && c.Sticky.Cookie == "" {
+		return errors.New("sticky cookie name is required")
+	}
+	if c.Admin.Listen != "" && c.Admin.Token == "" && !isLoopback(c.Admin.Listen) {
+		return errors.New("admin token is required when the admin API listens beyond loopback")
+	}
+	return nil
+}
+
+// validate checks the URL and defaults the weight
+func (u *UpstreamConfig) validate() error {
+	parsed, err := url.Parse(u.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid upstream url %q", u.URL)
+	}
+	if u.Weight == 0 {
+		u.Weight = 1
+	}
+	if u.Weight < 0 {
+		return fmt.Errorf("upstream %s has a negative weight", u.URL)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker probes every upstream on an interval
+type HealthChecker struct {
+	pool   *Pool
+	config HealthCheckConfig
+	client *http.Client
+}
+
+// NewHealthChecker creates a checker for the pool's upstreams
+func NewHealthChecker(pool *Pool, config HealthCheckConfig, transport http.RoundTripper) *HealthChecker {
+	return &HealthChecker{
+		pool:   pool,
+		config: config,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			// A redirect already shows the upstream is up
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run checks all upstreams straight away and then every interval until
+// ctx is done
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	for {
+		h.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll probes every upstream once, in parallel
+func (h *HealthChecker) CheckAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, upstream := range h.pool.snapshot() {
+		wg.Add(1)
+		go func(upstream *Upstream) {
+			defer wg.Done()
+			h.pool.recordCheck(upstream, h.check(ctx, upstream), h.config)
+		}(upstream)
+	}
+	wg.Wait()
+}
+
+// check passes on any 2xx or 3xx answer
+func (h *HealthChecker) check(ctx context.Context, upstream *Upstream) bool {
+	target := *upstream.URL
+	target.Path = h.config.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
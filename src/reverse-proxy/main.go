@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func main() {
+	configPath := flag.String("config", "proxy.yaml", "path to the proxy configuration")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// One transport for every upstream so connections are pooled per host
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 32
+
+	pool, err := NewPool(config, transport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go NewHealthChecker(pool, config.HealthCheck, transport).Run(ctx)
+
+	e := echo.New()
+	e.Use(middleware.Recover())
+	e.Use(middleware.Logger())
+	e.Any("/*", echo.WrapHandler(&Proxy{pool: pool, sticky: config.Sticky}))
+
+	var admin *echo.Echo
+	if config.Admin.Listen != "" {
+		admin = newAdminServer(pool, config.Admin)
+		go func() {
+			if err := admin.Start(config.Admin.Listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("admin server failed: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		if err := e.Start(config.Listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("proxy server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if admin != nil {
+		admin.Shutdown(shutdownCtx)
+	}
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
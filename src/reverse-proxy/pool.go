@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoUpstream is returned when every upstream is down, ejected,
+	// draining or behind an open breaker
+	ErrNoUpstream = errors.New("no upstream available")
+	// ErrUnknownUpstream is returned for an ID the pool doesn't have
+	ErrUnknownUpstream = errors.New("unknown upstream")
+)
+
+// Upstream is one proxy target and its health
+type Upstream struct {
+	ID     string
+	URL    *url.URL
+	Weight int
+
+	proxy   *httputil.ReverseProxy
+	breaker *breaker
+
+	// Everything below is guarded by the pool's mutex
+	healthy  bool
+	draining bool
+	// consecutive active check results in the current direction
+	checkPasses   int
+	checkFailures int
+	// passive outlier detection
+	consecutiveErrors int
+	ejections         int
+	ejectedUntil      time.Time
+	active            int
+	currentWeight     int // smooth weighted round robin
+}
+
+// UpstreamStatus is an upstream as reported by the admin API
+type UpstreamStatus struct {
+	ID           string     `json:"id"`
+	URL          string     `json:"url"`
+	Weight       int        `json:"weight"`
+	Healthy      bool       `json:"healthy"`
+	Draining     bool       `json:"draining"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	Breaker      string     `json:"breaker"`
+	Active       int        `json:"active"`
+}
+
+// Pool holds the upstreams and picks one for each request
+type Pool struct {
+	mu        sync.Mutex
+	upstreams []*Upstream
+	next      int
+
+	balancing string
+	outlier   OutlierDetectionConfig
+	breakers  CircuitBreakerConfig
+	transport http.RoundTripper
+	now       func() time.Time
+}
+
+// NewPool creates a pool with the configured upstreams
+func NewPool(config Config, transport http.RoundTripper) (*Pool, error) {
+	pool := &Pool{
+		balancing: config.Balancing,
+		outlier:   config.OutlierDetection,
+		breakers:  config.CircuitBreaker,
+		transport: transport,
+		now:       time.Now,
+	}
+	for _, upstream := range config.Upstreams {
+		if _, err := pool.Add(upstream); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+// upstreamID derives a stable ID from the URL, so sticky cookies survive
+// restarts and re-adding a target
+func upstreamID(u *url.URL) string {
+	sum := sha256.Sum256([]byte(u.String()))
+	return hex.EncodeToString(sum[:4])
+}
+
+// Add puts a new upstream into rotation. It starts healthy and is taken
+// out by the health checks if it isn't.
+func (p *Pool) Add(config UpstreamConfig) (*Upstream, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	target, _ := url.Parse(config.URL)
+	upstream := &Upstream{
+		ID:      upstreamID(target),
+		URL:     target,
+		Weight:  config.Weight,
+		breaker: newBreaker(p.breakers),
+		healthy: true,
+	}
+	upstream.proxy = newReverseProxy(target, p.transport)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, existing := range p.upstreams {
+		if existing.ID == upstream.ID {
+			return nil, fmt.Errorf("upstream %s already exists", config.URL)
+		}
+	}
+	p.upstreams = append(p.upstreams, upstream)
+	return upstream, nil
+}
+
+// Remove takes an upstream out of the pool. Requests already sent to it
+// are left to finish.
+func (p *Pool) Remove(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, upstream := range p.upstreams {
+		if upstream.ID == id {
+			p.upstreams = append(p.upstreams[:i:i], p.upstreams[i+1:]...)
+			return nil
+		}
+	}
+	return ErrUnknownUpstream
+}
+
+// SetDraining stops (or resumes) sending new clients to an upstream.
+// Clients pinned to it by a sticky cookie keep using it until it is removed.
+func (p *Pool) SetDraining(id string, draining bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	upstream := p.find(id)
+	if upstream == nil {
+		return ErrUnknownUpstream
+	}
+	upstream.draining = draining
+	return nil
+}
+
+// Status reports every upstream, ordered by URL
+func (p *Pool) Status() []UpstreamStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	statuses := make([]UpstreamStatus, 0, len(p.upstreams))
+	for _, upstream := range p.upstreams {
+		status := UpstreamStatus{
+			ID:       upstream.ID,
+			URL:      upstream.URL.String(),
+			Weight:   upstream.Weight,
+			Healthy:  upstream.healthy,
+			Draining: upstream.draining,
+			Breaker:  upstream.breaker.current(now),
+			Active:   upstream.active,
+		}
+		if upstream.ejected(now) {
+			until := upstream.ejectedUntil
+			status.EjectedUntil = &until
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].URL < statuses[j].URL })
+	return statuses
+}
+
+// Acquire picks the upstream for a request. A sticky ID names the upstream
+// the client used before; it is kept if that upstream can still serve.
+// Every successful Acquire must be followed by Release.
+func (p *Pool) Acquire(sticky string) (*Upstream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+
+	if sticky != "" {
+		if upstream := p.find(sticky); upstream != nil && upstream.serving(now) && upstream.breaker.allow(now) {
+			upstream.active++
+			return upstream, nil
+		}
+	}
+
+	var candidates []*Upstream
+	for _, upstream := range p.upstreams {
+		if !upstream.draining && upstream.serving(now) && upstream.breaker.ready(now) {
+			candidates = append(candidates, upstream)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoUpstream
+	}
+
+	upstream := p.choose(candidates)
+	upstream.breaker.allow(now)
+	upstream.active++
+	return upstream, nil
+}
+
+// choose applies the balancing algorithm
+func (p *Pool) choose(candidates []*Upstream) *Upstream {
+	p.next++
+	switch p.balancing {
+	case WeightedRoundRobin:
+		// Smooth weighted round robin, as in nginx: spreads each upstream's
+		// share through the cycle instead of sending it in one run
+		total := 0
+		var best *Upstream
+		for _, upstream := range candidates {
+			upstream.currentWeight += upstream.Weight
+			total += upstream.Weight
+			if best == nil || upstream.currentWeight > best.currentWeight {
+				best = upstream
+			}
+		}
+		best.currentWeight -= total
+		return best
+	case LeastConnections:
+		// Fewest active requests per unit of weight; ties are broken
+		// round robin so idle upstreams share the load
+		var best *Upstream
+		for i := range candidates {
+			upstream := candidates[(p.next+i)%len(candidates)]
+			if best == nil || upstream.active*best.Weight < best.active*upstream.Weight {
+				best = upstream
+			}
+		}
+		return best
+	}
+	return candidates[p.next%len(candidates)]
+}
+
+// Release records the outcome of a request sent to upstream
+func (p *Pool) Release(upstream *Upstream, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	upstream.active--
+	upstream.breaker.record(now, failed)
+
+	if !failed {
+		upstream.consecutiveErrors = 0
+		// Forget earlier ejections once it has behaved for a while
+		if upstream.ejections > 0 && now.After(upstream.ejectedUntil.Add(p.outlier.MaxEjectionTime)) {
+			upstream.ejections = 0
+		}
+		return
+	}
+	upstream.consecutiveErrors++
+	if p.outlier.ConsecutiveErrors > 0 && upstream.consecutiveErrors >= p.outlier.ConsecutiveErrors && p.canEject(now) {
+		upstream.consecutiveErrors = 0
+		upstream.ejections++
+		ejection := p.outlier.BaseEjectionTime * time.Duration(upstream.ejections)
+		if p.outlier.MaxEjectionTime > 0 && ejection > p.outlier.MaxEjectionTime {
+			ejection = p.outlier.MaxEjectionTime
+		}
+		upstream.ejectedUntil = now.Add(ejection)
+	}
+}
+
+// canEject keeps at most MaxEjectionPercent of the upstreams ejected, so a
+// shared failure (a bad deploy, a dead database) can't empty the pool
+func (p *Pool) canEject(now time.Time) bool {
+	ejected := 0
+	for _, upstream := range p.upstreams {
+		if upstream.ejected(now) {
+			ejected++
+		}
+	}
+	return (ejected+1)*100 <= p.outlier.MaxEjectionPercent*len(p.upstreams)
+}
+
+// recordCheck applies an active health check result
+func (p *Pool) recordCheck(upstream *Upstream, passed bool, config HealthCheckConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if passed {
+		upstream.checkFailures = 0
+		upstream.checkPasses++
+		if upstream.checkPasses >= config.HealthyThreshold {
+			upstream.healthy = true
+		}
+		return
+	}
+	upstream.checkPasses = 0
+	upstream.checkFailures++
+	if upstream.checkFailures >= config.UnhealthyThreshold {
+		upstream.healthy = false
+	}
+}
+
+// snapshot returns the current upstreams for the health checker
+func (p *Pool) snapshot() []*Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Upstream(nil), p.upstreams...)
+}
+
+func (p *Pool) find(id string) *Upstream {
+	for _, upstream := range p.upstreams {
+		if upstream.ID == id {
+			return upstream
+		}
+	}
+	return nil
+}
+
+func (u *Upstream) ejected(now time.Time) bool {
+	return now.Before(u.ejectedUntil)
+}
+
+// serving reports whether the upstream may take requests at all
+func (u *Upstream) serving(now time.Time) bool {
+	return u.healthy && !u.ejected(now)
+}
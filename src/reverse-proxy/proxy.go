@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+type outcomeKey struct{}
+
+// outcome is filled in by the reverse proxy hooks while a request is served
+type outcome struct {
+	failed bool
+}
+
+// newReverseProxy proxies to target, marking transport errors and 5xx
+// responses as failures for the breaker and outlier detection
+func newReverseProxy(target *url.URL, transport http.RoundTripper) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			markFailed(resp.Request.Context())
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// A client going away is not the upstream's fault
+		if !errors.Is(err, context.Canceled) {
+			markFailed(r.Context())
+			log.Printf("upstream %s: %v", target.Host, err)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
+
+func markFailed(ctx context.Context) {
+	if o, ok := ctx.Value(outcomeKey{}).(*outcome); ok {
+		o.failed = true
+	}
+}
+
+// Proxy sends each request to an upstream from the pool
+type Proxy struct {
+	pool   *Pool
+	sticky StickyConfig
+}
+
+// ServeHTTP implements http.Handler
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var pinned string
+	if p.sticky.Enabled {
+		if cookie, err := r.Cookie(p.sticky.Cookie); err == nil {
+			pinned = cookie.Value
+		}
+	}
+
+	upstream, err := p.pool.Acquire(pinned)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	result := &outcome{}
+	defer func() { p.pool.Release(upstream, result.failed) }()
+
+	if p.sticky.Enabled && upstream.ID != pinned {
+		http.SetCookie(w, &http.Cookie{
+			Name:     p.sticky.Cookie,
+			Value:    upstream.ID,
+			Path:     "/",
+			MaxAge:   int(p.sticky.TTL.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	upstream.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), outcomeKey{}, result)))
+}
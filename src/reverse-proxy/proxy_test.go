@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testUpstream answers with its name, or with status while it is non-zero
+type testUpstream struct {
+	*httptest.Server
+	name   string
+	status atomic.Int32
+}
+
+func newTestUpstream(t *testing.T, name string) *testUpstream {
+	t.Helper()
+	upstream := &testUpstream{name: name}
+	upstream.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := upstream.status.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		fmt.Fprint(w, name)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+// newTestPool builds a pool over upstreams with a clock the test controls
+func newTestPool(t *testing.T, config Config, upstreams ...*testUpstream) (*Pool, *time.Time) {
+	t.Helper()
+	config.Upstreams = nil
+	for _, upstream := range upstreams {
+		config.Upstreams = append(config.Upstreams, UpstreamConfig{URL: upstream.URL})
+	}
+	if config.Balancing == "" {
+		config.Balancing = RoundRobin
+	}
+	pool, err := NewPool(config, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pool.now = func() time.Time { return now }
+	return pool, &now
+}
+
+// get sends a request through the proxy and returns the body and response
+func get(t *testing.T, proxy http.Handler, cookies ...*http.Cookie) (string, *http.Response) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+	return rec.Body.String(), rec.Result()
+}
+
+// distribution counts which upstream served each of n requests
+func distribution(t *testing.T, proxy http.Handler, n int) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		body, _ := get(t, proxy)
+		counts[body]++
+	}
+	return counts
+}
+
+// statusOf returns the admin status of the upstream at url
+func statusOf(pool *Pool, url string) UpstreamStatus {
+	for _, status := range pool.Status() {
+		if status.URL == url {
+			return status
+		}
+	}
+	return UpstreamStatus{}
+}
+
+func TestBalancing(t *testing.T) {
+	a, b := newTestUpstream(t, "a"), newTestUpstream(t, "b")
+
+	t.Run("round robin", func(t *testing.T) {
+		pool, _ := newTestPool(t, defaultConfig(), a, b)
+		counts := distribution(t, &Proxy{pool: pool}, 10)
+		if counts["a"] != 5 || counts["b"] != 5 {
+			t.Errorf("distribution %v; want 5 each", counts)
+		}
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		config := defaultConfig()
+		config.Balancing = WeightedRoundRobin
+		pool, _ := newTestPool(t, config, a, b)
+		pool.upstreams[0].Weight = 3
+		counts := distribution(t, &Proxy{pool: pool}, 8)
+		if counts["a"] != 6 || counts["b"] != 2 {
+			t.Errorf("distribution %v; want a:6 b:2", counts)
+		}
+	})
+
+	t.Run("least connections", func(t *testing.T) {
+		config := defaultConfig()
+		config.Balancing = LeastConnections
+		pool, _ := newTestPool(t, config, a, b)
+		busy, _ := pool.Acquire("")
+		for i := 0; i < 3; i++ {
+			upstream, _ := pool.Acquire("")
+			if upstream == busy {
+				t.Fatalf("request %d went to the busy upstream", i)
+			}
+			pool.Release(upstream, false)
+		}
+		pool.Release(busy, false)
+	})
+}
+
+func TestStickySessions(t *testing.T) {
+	a, b := newTestUpstream(t, "a"), newTestUpstream(t, "b")
+	config := defaultConfig()
+	config.Sticky.Enabled = true
+	pool, _ := newTestPool(t, config, a, b)
+	proxy := &Proxy{pool: pool, sticky: config.Sticky}
+
+	first, resp := get(t, proxy)
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != config.Sticky.Cookie {
+		t.Fatalf("cookies %v; want %s", cookies, config.Sticky.Cookie)
+	}
+	for i := 0; i < 4; i++ {
+		body, resp := get(t, proxy, cookies[0])
+		if body != first || len(resp.Cookies()) != 0 {
+			t.Fatalf("pinned request served by %q (cookies %v); want %q", body, resp.Cookies(), first)
+		}
+	}
+
+	// Draining keeps pinned clients but takes no new ones
+	pool.SetDraining(cookies[0].Value, true)
+	if body, _ := get(t, proxy, cookies[0]); body != first {
+		t.Errorf("pinned client moved off a draining upstream to %q", body)
+	}
+	for i := 0; i < 4; i++ {
+		if body, _ := get(t, proxy); body == first {
+			t.Fatal("new client sent to a draining upstream")
+		}
+	}
+
+	// A pin to an upstream that is gone is replaced
+	pool.Remove(cookies[0].Value)
+	if body, resp := get(t, proxy, cookies[0]); body == first || len(resp.Cookies()) != 1 {
+		t.Errorf("stale pin served by %q with cookies %v", body, resp.Cookies())
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	a, b := newTestUpstream(t, "a"), newTestUpstream(t, "b")
+	config := defaultConfig()
+	pool, _ := newTestPool(t, config, a, b)
+	checker := NewHealthChecker(pool, config.HealthCheck, http.DefaultTransport)
+	proxy := &Proxy{pool: pool}
+	ctx := context.Background()
+
+	b.status.Store(http.StatusServiceUnavailable)
+	for i := 1; i <= config.HealthCheck.UnhealthyThreshold; i++ {
+		checker.CheckAll(ctx)
+		if healthy := statusOf(pool, b.URL).Healthy; healthy != (i < config.HealthCheck.UnhealthyThreshold) {
+			t.Fatalf("after %d failed checks healthy = %v", i, healthy)
+		}
+	}
+	if counts := distribution(t, proxy, 4); counts["a"] != 4 {
+		t.Errorf("distribution %v; want everything on a", counts)
+	}
+
+	b.status.Store(0)
+	for i := 0; i < config.HealthCheck.HealthyThreshold; i++ {
+		checker.CheckAll(ctx)
+	}
+	if counts := distribution(t, proxy, 4); counts["b"] != 2 {
+		t.Errorf("distribution %v; want b back in rotation", counts)
+	}
+
+	a.status.Store(http.StatusInternalServerError)
+	b.status.Store(http.StatusInternalServerError)
+	for i := 0; i < config.HealthCheck.UnhealthyThreshold; i++ {
+		checker.CheckAll(ctx)
+	}
+	if _, resp := get(t, proxy); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("all down: status %d; want 503", resp.StatusCode)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	a, b, c := newTestUpstream(t, "a"), newTestUpstream(t, "b"), newTestUpstream(t, "c")
+	config := defaultConfig()
+	config.OutlierDetection = OutlierDetectionConfig{
+		ConsecutiveErrors:  2,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    3 * time.Minute,
+		MaxEjectionPercent: 50,
+	}
+	config.CircuitBreaker.MinRequests = 1000 // keep the breakers out of it
+	pool, now := newTestPool(t, config, a, b, c)
+
+	fail := func(upstream *Upstream, times int) {
+		for i := 0; i < times; i++ {
+			upstream.active++
+			pool.Release(upstream, true)
+		}
+	}
+	ejected := func() (ids []string) {
+		for _, status := range pool.Status() {
+			if status.EjectedUntil != nil {
+				ids = append(ids, status.URL)
+			}
+		}
+		return ids
+	}
+
+	first := pool.upstreams[0]
+	fail(first, 2)
+	if got := ejected(); len(got) != 1 || got[0] != first.URL.String() {
+		t.Fatalf("ejected %v; want %s", got, first.URL)
+	}
+	if first.ejectedUntil != now.Add(time.Minute) {
+		t.Errorf("first ejection until %v; want a minute", first.ejectedUntil)
+	}
+
+	// A second upstream would take ejections past 50% of three
+	fail(pool.upstreams[1], 2)
+	if got := ejected(); len(got) != 1 {
+		t.Errorf("ejected %v; want the cap to hold at one", got)
+	}
+
+	// Repeat offenders stay out longer, up to the maximum
+	for i, want := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		*now = first.ejectedUntil
+		fail(first, 2)
+		if got := first.ejectedUntil.Sub(*now); got != want {
+			t.Errorf("ejection %d lasts %v; want %v", i+2, got, want)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	a := newTestUpstream(t, "a")
+	config := defaultConfig()
+	config.OutlierDetection.ConsecutiveErrors = 0
+	config.CircuitBreaker = CircuitBreakerConfig{
+		Window:           10 * time.Second,
+		MinRequests:      4,
+		FailureRate:      50,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 2,
+	}
+	pool, now := newTestPool(t, config, a)
+	proxy := &Proxy{pool: pool}
+	state := func() string { return pool.Status()[0].Breaker }
+
+	get(t, proxy)
+	get(t, proxy)
+	a.status.Store(http.StatusBadGateway)
+	get(t, proxy)
+	if state() != breakerClosed {
+		t.Fatalf("breaker %s below min requests", state())
+	}
+	get(t, proxy)
+	if state() != breakerOpen {
+		t.Fatalf("breaker %s at 50%% failures; want open", state())
+	}
+	if _, resp := get(t, proxy); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("open breaker: status %d; want 503", resp.StatusCode)
+	}
+
+	// Half-open lets a limited number of trials through
+	*now = now.Add(30 * time.Second)
+	first, _ := pool.Acquire("")
+	second, _ := pool.Acquire("")
+	if first == nil || second == nil {
+		t.Fatal("half-open breaker refused its trial requests")
+	}
+	if _, err := pool.Acquire(""); err != ErrNoUpstream {
+		t.Errorf("third half-open request: %v; want ErrNoUpstream", err)
+	}
+	pool.Release(first, false)
+	pool.Release(second, true)
+	if state() != breakerOpen {
+		t.Fatalf("breaker %s after a failed trial; want open", state())
+	}
+
+	*now = now.Add(30 * time.Second)
+	a.status.Store(0)
+	get(t, proxy)
+	get(t, proxy)
+	if state() != breakerClosed {
+		t.Errorf("breaker %s after passed trials; want closed", state())
+	}
+
+	// Old failures leave the window
+	a.status.Store(http.StatusBadGateway)
+	get(t, proxy)
+	get(t, proxy)
+	*now = now.Add(11 * time.Second)
+	a.status.Store(0)
+	get(t, proxy)
+	get(t, proxy)
+	if state() != breakerClosed {
+		t.Errorf("breaker %s counting failures from outside the window", state())
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	a, b := newTestUpstream(t, "a"), newTestUpstream(t, "b")
+	config := defaultConfig()
+	pool, _ := newTestPool(t, config, a)
+	admin := newAdminServer(pool, AdminConfig{Token: "secret"})
+
+	call := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call("GET", "/upstreams", "", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d; want 401", rec.Code)
+	}
+
+	rec := call("POST", "/upstreams", fmt.Sprintf(`{"url":%q,"weight":2}`, b.URL), "secret")
+	var added struct{ ID string }
+	json.Unmarshal(rec.Body.Bytes(), &added)
+	if rec.Code != http.StatusCreated || added.ID == "" {
+		t.Fatalf("add: %d %s", rec.Code, rec.Body)
+	}
+	if rec := call("POST", "/upstreams", fmt.Sprintf(`{"url":%q}`, b.URL), "secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("duplicate add: status %d; want 400", rec.Code)
+	}
+	if rec := call("POST", "/upstreams", `{"url":"ftp://x"}`, "secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid add: status %d; want 400", rec.Code)
+	}
+
+	if rec := call("POST", "/upstreams/"+added.ID+"/drain", "", "secret"); rec.Code != http.StatusNoContent {
+		t.Errorf("drain: status %d", rec.Code)
+	}
+	var statuses []UpstreamStatus
+	json.Unmarshal(call("GET", "/upstreams", "", "secret").Body.Bytes(), &statuses)
+	if len(statuses) != 2 {
+		t.Fatalf("listed %d upstreams; want 2", len(statuses))
+	}
+	for _, status := range statuses {
+		if status.Draining != (status.ID == added.ID) || (status.ID == added.ID && status.Weight != 2) {
+			t.Errorf("unexpected status %+v", status)
+		}
+	}
+
+	if rec := call("POST", "/upstreams/"+added.ID+"/enable", "", "secret"); rec.Code != http.StatusNoContent {
+		t.Errorf("enable: status %d", rec.Code)
+	}
+	if rec := call("DELETE", "/upstreams/"+added.ID, "", "secret"); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", rec.Code)
+	}
+	if rec := call("DELETE", "/upstreams/"+added.ID, "", "secret"); rec.Code != http.StatusNotFound {
+		t.Errorf("delete again: status %d; want 404", rec.Code)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	os.WriteFile(path, []byte(`
+balancing: least-connections
+upstreams:
+  - url: http://localhost:8081
+    weight: 3
+  - url: http://localhost:8082
+health_check:
+  interval: 1s
+`), 0644)
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if config.Balancing != LeastConnections || config.Upstreams[0].Weight != 3 || config.Upstreams[1].Weight != 1 ||
+		config.HealthCheck.Interval != time.Second || config.HealthCheck.Path != "/health" {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	for name, body := range map[string]string{
+		"no upstreams":      "balancing: round-robin\n",
+		"bad balancing":     "balancing: random\nupstreams: [{url: 'http://a'}]\n",
+		"bad url":           "upstreams: [{url: 'localhost:8081'}]\n",
+		"open admin":        "upstreams: [{url: 'http://a'}]\nadmin: {listen: ':9901'}\n",
+		"bad failure rate":  "upstreams: [{url: 'http://a'}]\ncircuit_breaker: {failure_rate: 0}\n",
+		"negative weight":   "upstreams: [{url: 'http://a', weight: -1}]\n",
+		"unknown yaml type": "upstreams: 3\n",
+	} {
+		os.WriteFile(path, []byte(body), 0644)
+		if _, err := loadConfig(path); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	a := newTestUpstream(t, "a")
+	pool, _ := newTestPool(t, defaultConfig(), a)
+	a.Close()
+
+	body, resp := get(t, &Proxy{pool: pool})
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("dead upstream: status %d; want 502 (%s)", resp.StatusCode, body)
+	}
+	if status := pool.Status()[0]; status.Active != 0 {
+		t.Errorf("active = %d after the request finished", status.Active)
+	}
+}
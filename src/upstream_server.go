@@ -54,6 +54,11 @@ func main() {
 		return c.HTML(http.StatusOK, fmt.Sprintf(index, name))
 	})
 
+	// Health check for the reverse proxy
+	e.GET("/health", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
 	// WebSocket handler
 	e.GET("/ws", func(c echo.Context) error {
 		websocket.Handler(func(ws *websocket.Conn) {
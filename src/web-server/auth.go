@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is a user's access level
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"  // manages users and their roles
+	RoleEditor Role = "editor" // creates and edits users
+	RoleViewer Role = "viewer" // reads users
+)
+
+// roleRank orders roles so higher ones include the rights of lower ones
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return roleRank[r] > 0
+}
+
+// AtLeast reports whether r has the rights of min
+func (r Role) AtLeast(min Role) bool {
+	return roleRank[r] >= roleRank[min]
+}
+
+// Claims are the claims of the tokens issued by login
+type Claims struct {
+	Role Role `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Authenticator issues and verifies HS256 login tokens
+type Authenticator struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewAuthenticator creates an authenticator. Without a secret a random one
+// is generated, so tokens don't survive a restart.
+func NewAuthenticator(secret string, ttl time.Duration) (*Authenticator, error) {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &Authenticator{secret: key, ttl: ttl}, nil
+}
+
+// Issue signs a token for user
+func (a *Authenticator) Issue(user User) (string, time.Time, error) {
+	expires := time.Now().Add(a.ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+	signed, err := token.SignedString(a.secret)
+	return signed, expires, err
+}
+
+// Verify parses a token and returns the user ID it was issued to
+func (a *Authenticator) Verify(tokenString string) (int, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+// HashPassword hashes a password with bcrypt
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// contextKey is the type of request context keys set by this package
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// currentUser returns the user authenticated by authMiddleware
+func currentUser(r *http.Request) (User, bool) {
+	user, ok := r.Context().Value(userContextKey).(User)
+	return user, ok
+}
+
+// authMiddleware requires a valid Bearer token. The user is loaded from the
+// store on every request so role changes and deletions apply immediately.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokenString == "" || tokenString == r.Header.Get("Authorization") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.sendErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		id, err := s.auth.Verify(tokenString)
+		if err != nil {
+			s.sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		user, err := s.store.Get(id)
+		if err != nil {
+			s.sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireRole only lets users with at least role min through. It must run
+// after authMiddleware.
+func (s *Server) requireRole(min Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok || !user.Role.AtLeast(min) {
+			s.sendErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Requires the %s role", min))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// loginHandler exchanges an email and password for a token
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if errs := req.Validate(); errs != nil {
+		s.sendValidationErrors(w, errs)
+		return
+	}
+
+	user, err := s.store.GetByEmail(req.Email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		s.sendStoreError(w, err)
+		return
+	}
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		s.logger.WithField("email", req.Email).Warn("Failed login")
+		s.sendErrorResponse(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	token, expires, err := s.auth.Issue(user)
+	if err != nil {
+		s.sendErrorResponse(w, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": user.ID, "role": user.Role}).Info("User logged in")
+	response := APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"token":      token,
+			"token_type": "Bearer",
+			"expires_at": expires.Unix(),
+			"user":       user,
+		},
+	}
+	s.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// meHandler returns the authenticated user
+func (s *Server) meHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	s.sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: user})
+}
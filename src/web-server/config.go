@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds application configuration. It is read from the YAML file
+// named by CONFIG_FILE, if any, with environment variables taking precedence.
+type Config struct {
+	Port            string        `yaml:"port"`
+	Host            string        `yaml:"host"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	LogLevel        string        `yaml:"log_level"`
+	Environment     string        `yaml:"environment"`
+	CORSOrigins     []string      `yaml:"cors_origins"` // "*" allows any origin
+	DBPath          string        `yaml:"db_path"`
+	JWTSecret       string        `yaml:"jwt_secret"`
+	TokenTTL        time.Duration `yaml:"token_ttl"`
+	TLS             TLSConfig     `yaml:"tls"`
+	H2C             bool          `yaml:"h2c"` // serve HTTP/2 without TLS
+
+	File string `yaml:"-"` // where the config was read from, reread on SIGHUP
+}
+
+// TLSConfig enables HTTPS. Certificates are reread on SIGHUP.
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// SelfSigned generates a certificate for local development when the
+	// files don't exist yet
+	SelfSigned bool `yaml:"self_signed"`
+}
+
+// defaultConfig returns the configuration used when nothing is set
+func defaultConfig() *Config {
+	return &Config{
+		Port:            "8080",
+		Host:            "localhost",
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		IdleTimeout:     60 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		LogLevel:        "info",
+		Environment:     "development",
+		CORSOrigins:     []string{"*"},
+		TokenTTL:        time.Hour,
+	}
+}
+
+// loadConfig reads the config file at path, if given, then applies the
+// environment
+func loadConfig(path string) (*Config, error) {
+	config := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+		config.File = path
+	}
+
+	config.applyEnv()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyEnv overrides settings with the environment variables that are set
+func (c *Config) applyEnv() {
+	c.Port = getEnv("PORT", c.Port)
+	c.Host = getEnv("HOST", c.Host)
+	c.LogLevel = getEnv("LOG_LEVEL", c.LogLevel)
+	c.Environment = getEnv("ENV", c.Environment)
+	c.DBPath = getEnv("DB_PATH", c.DBPath)
+	c.JWTSecret = getEnv("JWT_SECRET", c.JWTSecret)
+	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
+		c.CORSOrigins = strings.Split(origins, ",")
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("TOKEN_TTL")); err == nil {
+		c.TokenTTL = ttl
+	}
+	if os.Getenv("TLS_CERT_FILE") != "" {
+		c.TLS.Enabled = true
+		c.TLS.CertFile = os.Getenv("TLS_CERT_FILE")
+		c.TLS.KeyFile = os.Getenv("TLS_KEY_FILE")
+	}
+}
+
+// Validate checks the configuration and fills in derived defaults
+func (c *Config) Validate() error {
+	if c.Port == "" {
+		return errors.New("port is required")
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log_level: %w", err)
+	}
+	for name, d := range map[string]time.Duration{
+		"read_timeout":     c.ReadTimeout,
+		"write_timeout":    c.WriteTimeout,
+		"idle_timeout":     c.IdleTimeout,
+		"shutdown_timeout": c.ShutdownTimeout,
+		"token_ttl":        c.TokenTTL,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	for i, origin := range c.CORSOrigins {
+		c.CORSOrigins[i] = strings.TrimSpace(origin)
+	}
+
+	if c.TLS.Enabled {
+		if c.TLS.SelfSigned && c.Environment == "production" {
+			return errors.New("self-signed certificates are for development only")
+		}
+		if c.TLS.SelfSigned && c.TLS.CertFile == "" && c.TLS.KeyFile == "" {
+			c.TLS.CertFile, c.TLS.KeyFile = "certs/dev-cert.pem", "certs/dev-key.pem"
+		}
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			return errors.New("tls needs cert_file and key_file")
+		}
+	}
+	return nil
+}
+
+// reloadable lists the settings a SIGHUP applies; the rest need a restart
+var reloadable = map[string]bool{
+	"LogLevel":        true,
+	"CORSOrigins":     true,
+	"ReadTimeout":     true,
+	"WriteTimeout":    true,
+	"ShutdownTimeout": true,
+	"TLS":             true, // certificate files only, see Server.reload
+}
+
+// restartRequired returns the names of changed settings that a reload
+// can't apply
+func restartRequired(old, updated *Config) []string {
+	var changed []string
+	ov, nv := reflect.ValueOf(*old), reflect.ValueOf(*updated)
+	for i := 0; i < ov.NumField(); i++ {
+		name := ov.Type().Field(i).Name
+		if reloadable[name] || name == "File" {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	if old.TLS.Enabled != updated.TLS.Enabled {
+		changed = append(changed, "TLS.Enabled")
+	}
+	return changed
+}
+
+// allowsOrigin reports whether CORS requests from origin are allowed
+func (c *Config) allowsOrigin(origin string) bool {
+	for _, allowed := range c.CORSOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -21,49 +25,63 @@ import (
 type Server struct {
 	router *mux.Router
 	logger *logrus.Logger
-	config *Config
-}
+	store  UserStore
+	auth   *Authenticator
+	certs  *certReloader
 
-// Config holds application configuration
-type Config struct {
-	Port         string
-	Host         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	LogLevel     string
-	Environment  string
+	// config is replaced as a whole on reload, see currentConfig
+	configMu sync.RWMutex
+	config   *Config
 }
 
 // User represents a user in our system
 type User struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // APIResponse represents a standard API response
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-	Message string      `json:"message,omitempty"`
-}
-
-// In-memory storage for demo purposes
-var users = []User{
-	{ID: 1, Name: "John Doe", Email: "john@example.com"},
-	{ID: 2, Name: "Jane Smith", Email: "jane@example.com"},
+	Success bool         `json:"success"`
+	Data    interface{}  `json:"data,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Message string       `json:"message,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
 }
-var nextUserID = 3
 
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using defaults")
 	}
+	config, err := loadConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	var store UserStore = NewMemoryStore()
+	if config.DBPath != "" {
+		sqlite, err := NewSQLiteStore(config.DBPath)
+		if err != nil {
+			log.Fatalf("Failed to open user store: %v", err)
+		}
+		store = sqlite
+	}
+	defer store.Close()
 
 	// Create server instance
-	server := NewServer()
+	server, err := NewServer(config, store)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+	if err := server.bootstrapAdmin(os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		log.Fatalf("Failed to create admin user: %v", err)
+	}
 
 	// Setup routes
 	server.setupRoutes()
@@ -73,14 +91,10 @@ func main() {
 }
 
 // NewServer creates a new server instance
-func NewServer() *Server {
-	config := &Config{
-		Port:         getEnv("PORT", "8080"),
-		Host:         getEnv("HOST", "localhost"),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		LogLevel:     getEnv("LOG_LEVEL", "info"),
-		Environment:  getEnv("ENV", "development"),
+func NewServer(config *Config, store UserStore) (*Server, error) {
+	auth, err := NewAuthenticator(config.JWTSecret, config.TokenTTL)
+	if err != nil {
+		return nil, err
 	}
 
 	logger := logrus.New()
@@ -92,11 +106,42 @@ func NewServer() *Server {
 	}
 	logger.SetLevel(level)
 
+	if config.JWTSecret == "" {
+		logger.Warn("JWT_SECRET not set, tokens will not survive a restart")
+	}
+
 	return &Server{
 		router: mux.NewRouter(),
 		logger: logger,
 		config: config,
+		store:  store,
+		auth:   auth,
+		certs:  &certReloader{},
+	}, nil
+}
+
+// bootstrapAdmin creates an admin account when there are no users yet, so
+// the user API can be reached at all
+func (s *Server) bootstrapAdmin(email, password string) error {
+	users, err := s.store.List()
+	if err != nil || len(users) > 0 {
+		return err
+	}
+	if email == "" || password == "" {
+		s.logger.Warn("No users exist; set ADMIN_EMAIL and ADMIN_PASSWORD to create an admin")
+		return nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
 	}
+	admin := User{Name: "Administrator", Email: email, Role: RoleAdmin, PasswordHash: hash}
+	if err := s.store.Create(&admin); err != nil {
+		return err
+	}
+	s.logger.WithField("email", email).Info("Admin user created")
+	return nil
 }
 
 // setupRoutes configures all the routes for the server
@@ -112,12 +157,18 @@ func (s *Server) setupRoutes() {
 	// Health check
 	api.HandleFunc("/health", s.healthHandler).Methods("GET")
 	
-	// User endpoints
-	api.HandleFunc("/users", s.getUsersHandler).Methods("GET")
-	api.HandleFunc("/users", s.createUserHandler).Methods("POST")
-	api.HandleFunc("/users/{id:[0-9]+}", s.getUserHandler).Methods("GET")
-	api.HandleFunc("/users/{id:[0-9]+}", s.updateUserHandler).Methods("PUT")
-	api.HandleFunc("/users/{id:[0-9]+}", s.deleteUserHandler).Methods("DELETE")
+	// Authentication
+	api.HandleFunc("/auth/login", s.loginHandler).Methods("POST")
+	api.Handle("/auth/me", s.authMiddleware(http.HandlerFunc(s.meHandler))).Methods("GET")
+
+	// User endpoints, by minimum role
+	users := api.PathPrefix("/users").Subrouter()
+	users.Use(s.authMiddleware)
+	users.HandleFunc("", s.requireRole(RoleViewer, s.getUsersHandler)).Methods("GET")
+	users.HandleFunc("", s.requireRole(RoleEditor, s.createUserHandler)).Methods("POST")
+	users.HandleFunc("/{id:[0-9]+}", s.requireRole(RoleViewer, s.getUserHandler)).Methods("GET")
+	users.HandleFunc("/{id:[0-9]+}", s.requireRole(RoleEditor, s.updateUserHandler)).Methods("PUT")
+	users.HandleFunc("/{id:[0-9]+}", s.requireRole(RoleAdmin, s.deleteUserHandler)).Methods("DELETE")
 
 	// Static routes
 	s.router.HandleFunc("/", s.indexHandler).Methods("GET")
@@ -151,7 +202,15 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 // corsMiddleware adds CORS headers
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		config := s.currentConfig()
+		if config.allowsOrigin("*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && config.allowsOrigin(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		
@@ -209,6 +268,12 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
     <div class="endpoint">
         <span class="method">GET</span> /api/v1/health - Health check
     </div>
+    <div class="endpoint">
+        <span class="method">POST</span> /api/v1/auth/login - Log in and get a token
+    </div>
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/auth/me - Get the logged-in user
+    </div>
     <div class="endpoint">
         <span class="method">GET</span> /api/v1/users - Get all users
     </div>
@@ -235,6 +300,12 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 
 // getUsersHandler returns all users
 func (s *Server) getUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.List()
+	if err != nil {
+		s.sendStoreError(w, err)
+		return
+	}
+
 	response := APIResponse{
 		Success: true,
 		Data:    users,
@@ -252,43 +323,58 @@ func (s *Server) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, user := range users {
-		if user.ID == id {
-			response := APIResponse{
-				Success: true,
-				Data:    user,
-			}
-			s.sendJSONResponse(w, http.StatusOK, response)
-			return
-		}
+	user, err := s.store.Get(id)
+	if err != nil {
+		s.sendStoreError(w, err)
+		return
 	}
 
-	s.sendErrorResponse(w, http.StatusNotFound, "User not found")
+	response := APIResponse{
+		Success: true,
+		Data:    user,
+	}
+	s.sendJSONResponse(w, http.StatusOK, response)
 }
 
-// createUserHandler creates a new user
+// createUserHandler creates a new user. Editors create viewers and editors;
+// only admins may create admins.
 func (s *Server) createUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	// Validate input
-	if user.Name == "" || user.Email == "" {
-		s.sendErrorResponse(w, http.StatusBadRequest, "Name and email are required")
+	if errs := req.Validate(); errs != nil {
+		s.sendValidationErrors(w, errs)
+		return
+	}
+	role := Role(req.Role)
+	if role == "" {
+		role = RoleViewer
+	}
+	if current, _ := currentUser(r); !current.Role.AtLeast(role) {
+		s.sendErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Cannot create a user with the %s role", role))
 		return
 	}
 
-	// Assign ID and add to users
-	user.ID = nextUserID
-	nextUserID++
-	users = append(users, user)
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		s.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+	user := User{Name: strings.TrimSpace(req.Name), Email: req.Email, Role: role, PasswordHash: hash}
+	if err := s.store.Create(&user); err != nil {
+		s.sendStoreError(w, err)
+		return
+	}
 
 	s.logger.WithFields(logrus.Fields{
 		"user_id": user.ID,
 		"name":    user.Name,
 		"email":   user.Email,
+		"role":    user.Role,
 	}).Info("User created")
 
 	response := APIResponse{
@@ -299,7 +385,9 @@ func (s *Server) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	s.sendJSONResponse(w, http.StatusCreated, response)
 }
 
-// updateUserHandler updates an existing user
+// updateUserHandler updates an existing user. Editors can't change roles,
+// edit admins or set other users' passwords, and admins can't demote
+// themselves.
 func (s *Server) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -308,28 +396,61 @@ func (s *Server) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updatedUser User
-	if err := json.NewDecoder(r.Body).Decode(&updatedUser); err != nil {
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
+	if errs := req.Validate(); errs != nil {
+		s.sendValidationErrors(w, errs)
+		return
+	}
 
-	for i, user := range users {
-		if user.ID == id {
-			updatedUser.ID = id
-			users[i] = updatedUser
-			
-			response := APIResponse{
-				Success: true,
-				Data:    updatedUser,
-				Message: "User updated successfully",
-			}
-			s.sendJSONResponse(w, http.StatusOK, response)
+	user, err := s.store.Get(id)
+	if err != nil {
+		s.sendStoreError(w, err)
+		return
+	}
+
+	current, _ := currentUser(r)
+	role := Role(req.Role)
+	switch {
+	case current.Role != RoleAdmin && user.Role == RoleAdmin:
+		s.sendErrorResponse(w, http.StatusForbidden, "Only admins can edit admins")
+		return
+	case role != "" && role != user.Role && current.Role != RoleAdmin:
+		s.sendErrorResponse(w, http.StatusForbidden, "Only admins can change roles")
+		return
+	case req.Password != "" && current.ID != user.ID && current.Role != RoleAdmin:
+		s.sendErrorResponse(w, http.StatusForbidden, "Only admins can change other users' passwords")
+		return
+	case current.ID == user.ID && role != "" && role != user.Role:
+		s.sendErrorResponse(w, http.StatusForbidden, "You cannot change your own role")
+		return
+	}
+
+	user.Name = strings.TrimSpace(req.Name)
+	user.Email = req.Email
+	if role != "" {
+		user.Role = role
+	}
+	if req.Password != "" {
+		if user.PasswordHash, err = HashPassword(req.Password); err != nil {
+			s.sendErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
 			return
 		}
 	}
+	if err := s.store.Update(&user); err != nil {
+		s.sendStoreError(w, err)
+		return
+	}
 
-	s.sendErrorResponse(w, http.StatusNotFound, "User not found")
+	response := APIResponse{
+		Success: true,
+		Data:    user,
+		Message: "User updated successfully",
+	}
+	s.sendJSONResponse(w, http.StatusOK, response)
 }
 
 // deleteUserHandler deletes a user
@@ -340,25 +461,25 @@ func (s *Server) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		s.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
+	if current, _ := currentUser(r); current.ID == id {
+		s.sendErrorResponse(w, http.StatusForbidden, "You cannot delete yourself")
+		return
+	}
 
-	for i, user := range users {
-		if user.ID == id {
-			users = append(users[:i], users[i+1:]...)
-			
-			s.logger.WithFields(logrus.Fields{
-				"user_id": id,
-			}).Info("User deleted")
-			
-			response := APIResponse{
-				Success: true,
-				Message: "User deleted successfully",
-			}
-			s.sendJSONResponse(w, http.StatusOK, response)
-			return
-		}
+	if err := s.store.Delete(id); err != nil {
+		s.sendStoreError(w, err)
+		return
 	}
 
-	s.sendErrorResponse(w, http.StatusNotFound, "User not found")
+	s.logger.WithFields(logrus.Fields{
+		"user_id": id,
+	}).Info("User deleted")
+
+	response := APIResponse{
+		Success: true,
+		Message: "User deleted successfully",
+	}
+	s.sendJSONResponse(w, http.StatusOK, response)
 }
 
 // Helper functions
@@ -380,40 +501,91 @@ func (s *Server) sendErrorResponse(w http.ResponseWriter, statusCode int, messag
 	s.sendJSONResponse(w, statusCode, response)
 }
 
-// start starts the HTTP server with graceful shutdown
+// sendValidationErrors sends a 422 listing the invalid fields
+func (s *Server) sendValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	response := APIResponse{
+		Success: false,
+		Error:   "Validation failed",
+		Errors:  errs,
+	}
+	s.sendJSONResponse(w, http.StatusUnprocessableEntity, response)
+}
+
+// sendStoreError maps store errors to responses
+func (s *Server) sendStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		s.sendErrorResponse(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, ErrEmailExists):
+		s.sendValidationErrors(w, []FieldError{{Field: "email", Message: "is already taken"}})
+	default:
+		s.logger.WithError(err).Error("User store failed")
+		s.sendErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// start serves until SIGINT or SIGTERM. SIGHUP reloads the config file and
+// certificates; SIGUSR2 hands the listener to a new process and drains.
 func (s *Server) start() {
-	server := &http.Server{
-		Addr:         fmt.Sprintf("%s:%s", s.config.Host, s.config.Port),
-		Handler:      s.router,
-		ReadTimeout:  s.config.ReadTimeout,
-		WriteTimeout: s.config.WriteTimeout,
+	config := s.currentConfig()
+	if config.TLS.Enabled {
+		if err := s.loadCertificates(config); err != nil {
+			s.logger.WithError(err).Fatal("Failed to load TLS certificate")
+		}
 	}
 
-	// Channel to listen for interrupt signal
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	ln, err := inheritedListener()
+	if err != nil {
+		s.logger.WithError(err).Fatal("Failed to use inherited listener")
+	}
+	inherited := ln != nil
+	if !inherited {
+		ln, err = net.Listen("tcp", net.JoinHostPort(config.Host, config.Port))
+		if err != nil {
+			s.logger.WithError(err).Fatal("Failed to listen")
+		}
+	}
+	server := s.newHTTPServer()
 
-	// Start server in a goroutine
 	go func() {
 		s.logger.WithFields(logrus.Fields{
-			"host": s.config.Host,
-			"port": s.config.Port,
-			"env":  s.config.Environment,
+			"addr":      ln.Addr().String(),
+			"env":       config.Environment,
+			"tls":       config.TLS.Enabled,
+			"h2c":       config.H2C && !config.TLS.Enabled,
+			"inherited": inherited,
 		}).Info("Starting HTTP server")
-		
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+
+		if err := s.serve(server, ln); err != nil && err != http.ErrServerClosed {
 			s.logger.WithError(err).Fatal("Failed to start server")
 		}
 	}()
 
 	s.logger.Info("Server is ready to handle requests")
-
-	// Block until signal is received
-	<-done
+	notifyReady()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}, restartSignals...)...)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			if err := s.reload(); err != nil {
+				s.logger.WithError(err).Error("Reload failed, keeping current config")
+			}
+			continue
+		}
+		if sig != os.Interrupt && sig != syscall.SIGTERM {
+			if err := restart(ln); err != nil {
+				s.logger.WithError(err).Error("Restart failed, still serving")
+				continue
+			}
+			s.logger.Info("New process is serving, draining connections")
+		}
+		break
+	}
 	s.logger.Info("Server is shutting down...")
 
 	// Create a context with timeout for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.currentConfig().ShutdownTimeout)
 	defer cancel()
 
 	// Shutdown server gracefully
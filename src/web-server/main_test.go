@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestUserStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) UserStore{
+		"memory": func(t *testing.T) UserStore { return NewMemoryStore() },
+		"sqlite": func(t *testing.T) UserStore {
+			store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "users.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore failed: %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+
+			ada := User{Name: "Ada", Email: "ada@example.com", Role: RoleEditor}
+			if err := store.Create(&ada); err != nil || ada.ID == 0 {
+				t.Fatalf("Create = %v, id %d", err, ada.ID)
+			}
+			if err := store.Create(&User{Name: "Dup", Email: "ADA@example.com", Role: RoleViewer}); !errors.Is(err, ErrEmailExists) {
+				t.Errorf("duplicate email returned %v; want ErrEmailExists", err)
+			}
+
+			ada.Name, ada.Role = "Ada L.", RoleAdmin
+			if err := store.Update(&ada); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			got, err := store.GetByEmail("Ada@Example.com")
+			if err != nil || got.Name != "Ada L." || got.Role != RoleAdmin {
+				t.Errorf("GetByEmail = %+v, %v", got, err)
+			}
+
+			// Concurrent creates must neither race nor reuse IDs
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					store.Create(&User{Name: "u", Email: fmt.Sprintf("u%d@example.com", i), Role: RoleViewer})
+				}(i)
+			}
+			wg.Wait()
+			if users, _ := store.List(); len(users) != 11 {
+				t.Errorf("List has %d users; want 11", len(users))
+			}
+
+			if err := store.Delete(ada.ID); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, err := store.Get(ada.ID); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Get after Delete returned %v; want ErrUserNotFound", err)
+			}
+			if err := store.Update(&ada); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Update after Delete returned %v; want ErrUserNotFound", err)
+			}
+		})
+	}
+}
+
+// newTestServer creates a server with one user per role, all with the
+// password "password123"
+func newTestServer(t *testing.T) (*Server, map[Role]User) {
+	server, err := NewServer(&Config{JWTSecret: "test-secret", TokenTTL: time.Hour, LogLevel: "error"}, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.logger.SetOutput(io.Discard)
+	server.logger.SetLevel(logrus.ErrorLevel)
+	server.setupRoutes()
+
+	hash, _ := HashPassword("password123")
+	users := map[Role]User{}
+	for _, role := range []Role{RoleAdmin, RoleEditor, RoleViewer} {
+		user := User{Name: string(role), Email: string(role) + "@example.com", Role: role, PasswordHash: hash}
+		server.store.Create(&user)
+		users[role] = user
+	}
+	return server, users
+}
+
+func request(s *Server, method, path, token string, body interface{}) (int, APIResponse) {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var response APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func login(t *testing.T, s *Server, email string) string {
+	code, response := request(s, "POST", "/api/v1/auth/login", "", LoginRequest{Email: email, Password: "password123"})
+	if code != http.StatusOK {
+		t.Fatalf("login %s returned %d: %s", email, code, response.Error)
+	}
+	return response.Data.(map[string]interface{})["token"].(string)
+}
+
+func TestLogin(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	if code, _ := request(server, "POST", "/api/v1/auth/login", "", LoginRequest{Email: "admin@example.com", Password: "wrong-password"}); code != http.StatusUnauthorized {
+		t.Errorf("wrong password returned %d; want 401", code)
+	}
+	token := login(t, server, "admin@example.com")
+	code, response := request(server, "GET", "/api/v1/auth/me", token, nil)
+	if code != http.StatusOK || response.Data.(map[string]interface{})["role"] != "admin" {
+		t.Errorf("me returned %d %+v", code, response)
+	}
+	if code, _ := request(server, "GET", "/api/v1/users", "not-a-token", nil); code != http.StatusUnauthorized {
+		t.Errorf("invalid token returned %d; want 401", code)
+	}
+}
+
+func TestRoleAuthorization(t *testing.T) {
+	server, users := newTestServer(t)
+	tokens := map[Role]string{}
+	for role, user := range users {
+		tokens[role] = login(t, server, user.Email)
+	}
+	viewerPath := fmt.Sprintf("/api/v1/users/%d", users[RoleViewer].ID)
+	adminPath := fmt.Sprintf("/api/v1/users/%d", users[RoleAdmin].ID)
+	editorPath := fmt.Sprintf("/api/v1/users/%d", users[RoleEditor].ID)
+	other := User{Name: "Other", Email: "other@example.com", Role: RoleEditor, PasswordHash: users[RoleEditor].PasswordHash}
+	server.store.Create(&other)
+	otherPath := fmt.Sprintf("/api/v1/users/%d", other.ID)
+	newUser := CreateUserRequest{Name: "New", Email: "new@example.com", Password: "password123"}
+
+	tests := []struct {
+		name   string
+		role   Role
+		method string
+		path   string
+		body   interface{}
+		code   int
+	}{
+		{"anonymous list", "", "GET", "/api/v1/users", nil, http.StatusUnauthorized},
+		{"viewer list", RoleViewer, "GET", "/api/v1/users", nil, http.StatusOK},
+		{"viewer create", RoleViewer, "POST", "/api/v1/users", newUser, http.StatusForbidden},
+		{"editor create admin", RoleEditor, "POST", "/api/v1/users", CreateUserRequest{Name: "Boss", Email: "boss@example.com", Password: "password123", Role: "admin"}, http.StatusForbidden},
+		{"editor create", RoleEditor, "POST", "/api/v1/users", newUser, http.StatusCreated},
+		{"editor promote", RoleEditor, "PUT", viewerPath, UpdateUserRequest{Name: "viewer", Email: "viewer@example.com", Role: "admin"}, http.StatusForbidden},
+		{"editor edit admin", RoleEditor, "PUT", adminPath, UpdateUserRequest{Name: "x", Email: "admin@example.com"}, http.StatusForbidden},
+		{"editor rename", RoleEditor, "PUT", viewerPath, UpdateUserRequest{Name: "Viewer", Email: "viewer@example.com"}, http.StatusOK},
+		{"editor set editor password", RoleEditor, "PUT", otherPath, UpdateUserRequest{Name: "Other", Email: "other@example.com", Password: "hijacked123"}, http.StatusForbidden},
+		{"editor set viewer password", RoleEditor, "PUT", viewerPath, UpdateUserRequest{Name: "Viewer", Email: "viewer@example.com", Password: "hijacked123"}, http.StatusForbidden},
+		{"editor set own password", RoleEditor, "PUT", editorPath, UpdateUserRequest{Name: "editor", Email: "editor@example.com", Password: "password123"}, http.StatusOK},
+		{"admin set password", RoleAdmin, "PUT", otherPath, UpdateUserRequest{Name: "Other", Email: "other@example.com", Password: "password456"}, http.StatusOK},
+		{"editor delete", RoleEditor, "DELETE", viewerPath, nil, http.StatusForbidden},
+		{"admin demote self", RoleAdmin, "PUT", adminPath, UpdateUserRequest{Name: "admin", Email: "admin@example.com", Role: "viewer"}, http.StatusForbidden},
+		{"admin delete self", RoleAdmin, "DELETE", adminPath, nil, http.StatusForbidden},
+		{"admin delete", RoleAdmin, "DELETE", viewerPath, nil, http.StatusOK},
+		{"deleted viewer", RoleViewer, "GET", "/api/v1/users", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if code, response := request(server, tt.method, tt.path, tokens[tt.role], tt.body); code != tt.code {
+			t.Errorf("%s: %s %s returned %d (%s); want %d", tt.name, tt.method, tt.path, code, response.Error, tt.code)
+		}
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	server, _ := newTestServer(t)
+	token := login(t, server, "admin@example.com")
+
+	code, response := request(server, "POST", "/api/v1/users", token, CreateUserRequest{Email: "not-an-email", Password: "short", Role: "owner"})
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid user returned %d; want 422", code)
+	}
+	fields := map[string]bool{}
+	for _, e := range response.Errors {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"name", "email", "password", "role"} {
+		if !fields[field] {
+			t.Errorf("no error for %s in %+v", field, response.Errors)
+		}
+	}
+
+	code, response = request(server, "POST", "/api/v1/users", token, CreateUserRequest{Name: "Dup", Email: "viewer@example.com", Password: "password123"})
+	if code != http.StatusUnprocessableEntity || len(response.Errors) != 1 || response.Errors[0].Field != "email" {
+		t.Errorf("duplicate email returned %d %+v; want 422 on email", code, response.Errors)
+	}
+}
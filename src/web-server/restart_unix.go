@@ -0,0 +1,135 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Environment variables naming the descriptors a restarted process inherits
+const (
+	listenFDEnv = "WEB_SERVER_LISTEN_FD"
+	readyFDEnv  = "WEB_SERVER_READY_FD"
+)
+
+// restartSignals trigger a zero-downtime restart
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+// readyTimeout is how long a restarted process has to start serving
+const readyTimeout = 30 * time.Second
+
+// inheritedListener returns the listener handed over by the previous
+// process, or nil if this process was started normally
+func inheritedListener() (net.Listener, error) {
+	value := os.Getenv(listenFDEnv)
+	if value == "" {
+		return nil, nil
+	}
+	os.Unsetenv(listenFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", listenFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// notifyReady tells the previous process that this one is serving, so it
+// can stop accepting and drain
+func notifyReady() {
+	value := os.Getenv(readyFDEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(readyFDEnv)
+
+	if fd, err := strconv.Atoi(value); err == nil {
+		f := os.NewFile(uintptr(fd), "ready")
+		f.Write([]byte{1})
+		f.Close()
+	}
+}
+
+// restart starts a new copy of this binary that inherits ln, returning once
+// it is serving. Until then both processes accept on the same socket, so no
+// connection is refused.
+func restart(ln net.Listener) error {
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		return errors.New("listener can't be handed over")
+	}
+	listenFile, err := tcp.File()
+	if err != nil {
+		return fmt.Errorf("failed to duplicate listener: %w", err)
+	}
+	defer listenFile.Close()
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return err
+	}
+
+	// ExtraFiles become descriptors 3, 4, ... in the child
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{listenFile, readyWriter}
+	cmd.Env = append(withoutEnv(os.Environ(), listenFDEnv, readyFDEnv), listenFDEnv+"=3", readyFDEnv+"=4")
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	go cmd.Wait()
+
+	result := make(chan error, 1)
+	go func() {
+		// EOF without a byte means the child exited before it was ready
+		_, err := ready.Read(make([]byte, 1))
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("new process %d failed to start: %w", cmd.Process.Pid, err)
+		}
+		return nil
+	case <-time.After(readyTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("new process %d not ready after %s", cmd.Process.Pid, readyTimeout)
+	}
+}
+
+// withoutEnv drops the named variables from an environment
+func withoutEnv(env []string, names ...string) []string {
+	kept := env[:0:0]
+	for _, kv := range env {
+		drop := false
+		for _, name := range names {
+			if strings.HasPrefix(kv, name+"=") {
+				drop = true
+			}
+		}
+		if !drop {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestInheritedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	// Stand in for the descriptor a parent process passes down
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("Dup failed: %v", err)
+	}
+	t.Setenv(listenFDEnv, strconv.Itoa(fd))
+
+	inherited, err := inheritedListener()
+	if err != nil || inherited == nil {
+		t.Fatalf("inheritedListener = %v, %v", inherited, err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != ln.Addr().String() {
+		t.Errorf("inherited %s; want %s", inherited.Addr(), ln.Addr())
+	}
+
+	ln.Close()
+	go func() {
+		if conn, err := net.Dial("tcp", inherited.Addr().String()); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := inherited.Accept()
+	if err != nil {
+		t.Fatalf("Accept on inherited listener failed: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Windows can't pass a listening socket to a child process this way, so
+// zero-downtime restarts are not available there
+var restartSignals []os.Signal
+
+func inheritedListener() (net.Listener, error) {
+	return nil, nil
+}
+
+func notifyReady() {}
+
+func restart(ln net.Listener) error {
+	return errors.New("restart is not supported on windows")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// currentConfig returns the active configuration. It must not be modified;
+// reload swaps in a new one.
+func (s *Server) currentConfig() *Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+// reload rereads the config file and applies what can change while
+// serving. Connections are left alone; new requests see the new settings.
+func (s *Server) reload() error {
+	old := s.currentConfig()
+	config, err := loadConfig(old.File)
+	if err != nil {
+		return err
+	}
+	if changed := restartRequired(old, config); len(changed) > 0 {
+		s.logger.WithField("settings", changed).Warn("Some settings only take effect after a restart")
+	}
+
+	if old.TLS.Enabled && config.TLS.Enabled {
+		if err := s.loadCertificates(config); err != nil {
+			return err
+		}
+	}
+	level, _ := logrus.ParseLevel(config.LogLevel)
+	s.logger.SetLevel(level)
+
+	s.configMu.Lock()
+	s.config = config
+	s.configMu.Unlock()
+
+	s.logger.WithFields(logrus.Fields{
+		"log_level":     config.LogLevel,
+		"cors_origins":  config.CORSOrigins,
+		"read_timeout":  config.ReadTimeout,
+		"write_timeout": config.WriteTimeout,
+	}).Info("Configuration reloaded")
+	return nil
+}
+
+// loadCertificates loads the configured certificate, generating a
+// development one first if asked to
+func (s *Server) loadCertificates(config *Config) error {
+	if config.TLS.SelfSigned {
+		created, err := ensureDevCert(config.TLS.CertFile, config.TLS.KeyFile, config.Host)
+		if err != nil {
+			return err
+		}
+		if created {
+			s.logger.WithField("cert_file", config.TLS.CertFile).Warn("Generated self-signed development certificate")
+		}
+	}
+	return s.certs.Load(config.TLS.CertFile, config.TLS.KeyFile)
+}
+
+// newHTTPServer builds the http.Server for the current config. HTTP/2 is
+// negotiated over TLS, or spoken in cleartext (h2c) when enabled without it.
+func (s *Server) newHTTPServer() *http.Server {
+	config := s.currentConfig()
+	h2s := &http2.Server{
+		MaxConcurrentStreams: 250,
+		MaxReadFrameSize:     1 << 20,
+		IdleTimeout:          config.IdleTimeout,
+	}
+
+	var handler http.Handler = s.deadlineHandler(s.router)
+	if config.H2C && !config.TLS.Enabled {
+		handler = h2c.NewHandler(handler, h2s)
+	}
+
+	// Body and write deadlines are set per request by deadlineHandler so
+	// that reloads apply to them; only reading the headers uses the
+	// timeout the server started with
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	if config.TLS.Enabled {
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certs.GetCertificate,
+		}
+		// Adds "h2" to the ALPN protocols
+		if err := http2.ConfigureServer(server, h2s); err != nil {
+			s.logger.WithError(err).Error("HTTP/2 disabled")
+		}
+	}
+	return server
+}
+
+// serve accepts connections on ln until server is shut down
+func (s *Server) serve(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
+
+// deadlineHandler applies the current read and write timeouts to each
+// request
+func (s *Server) deadlineHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := s.currentConfig()
+		now := time.Now()
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(now.Add(config.ReadTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			s.logger.WithError(err).Debug("Failed to set read deadline")
+		}
+		if err := rc.SetWriteDeadline(now.Add(config.WriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			s.logger.WithError(err).Debug("Failed to set write deadline")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
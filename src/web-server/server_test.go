@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+port: "9000"
+read_timeout: 2s
+log_level: debug
+cors_origins: ["https://app.example.com", " https://admin.example.com"]
+tls:
+  enabled: true
+  self_signed: true
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if config.Port != "9000" || config.ReadTimeout != 2*time.Second || config.WriteTimeout != 10*time.Second {
+		t.Errorf("file settings not applied over defaults: %+v", config)
+	}
+	if config.LogLevel != "warn" {
+		t.Errorf("LogLevel = %q; environment should win", config.LogLevel)
+	}
+	if !config.allowsOrigin("https://admin.example.com") || config.allowsOrigin("https://evil.example.com") {
+		t.Errorf("unexpected CORS origins %q", config.CORSOrigins)
+	}
+	if config.TLS.CertFile != "certs/dev-cert.pem" {
+		t.Errorf("self-signed cert file = %q", config.TLS.CertFile)
+	}
+
+	t.Setenv("ENV", "production")
+	if _, err := loadConfig(path); err == nil {
+		t.Error("self-signed certificate accepted in production")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "log_level: info\ncors_origins: [\"https://a.example.com\"]\n")
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	server, err := NewServer(config, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.logger.SetOutput(io.Discard)
+	server.setupRoutes()
+	handler := server.newHTTPServer().Handler
+
+	allowed := func(origin string) string {
+		req := httptest.NewRequest("GET", "/api/v1/health", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := allowed("https://a.example.com"); got != "https://a.example.com" {
+		t.Fatalf("allowed origin got %q", got)
+	}
+
+	writeConfig(t, path, "log_level: debug\nport: \"9999\"\ncors_origins: [\"https://b.example.com\"]\n")
+	if err := server.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if got := allowed("https://a.example.com"); got != "" {
+		t.Errorf("removed origin still allowed: %q", got)
+	}
+	if got := allowed("https://b.example.com"); got != "https://b.example.com" {
+		t.Errorf("added origin got %q", got)
+	}
+	if server.logger.GetLevel() != logrus.DebugLevel {
+		t.Errorf("log level = %s; want debug", server.logger.GetLevel())
+	}
+	if changed := restartRequired(config, server.currentConfig()); len(changed) != 1 || changed[0] != "Port" {
+		t.Errorf("restartRequired = %v; want [Port]", changed)
+	}
+
+	// A broken file keeps the running config
+	writeConfig(t, path, "log_level: loud\n")
+	if err := server.reload(); err == nil {
+		t.Error("invalid config reloaded")
+	}
+	if server.currentConfig().LogLevel != "debug" {
+		t.Errorf("config replaced by invalid one")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if created, err := ensureDevCert(certFile, keyFile, "example.test"); err != nil || !created {
+		t.Fatalf("ensureDevCert = %v, %v", created, err)
+	}
+	if created, _ := ensureDevCert(certFile, keyFile, "example.test"); created {
+		t.Error("existing certificate replaced")
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v", info.Mode().Perm())
+	}
+
+	var reloader certReloader
+	if err := reloader.Load(certFile, keyFile); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	first, _ := reloader.GetCertificate(nil)
+
+	os.Remove(certFile)
+	os.Remove(keyFile)
+	ensureDevCert(certFile, keyFile, "example.test")
+	if err := reloader.Load(certFile, keyFile); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	second, _ := reloader.GetCertificate(nil)
+	if string(first.Certificate[0]) == string(second.Certificate[0]) {
+		t.Error("certificate not replaced")
+	}
+
+	if err := reloader.Load(filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Error("missing certificate loaded")
+	}
+	if current, _ := reloader.GetCertificate(nil); current != second {
+		t.Error("failed load replaced the certificate")
+	}
+}
+
+// startTestServer serves config on a random port and returns its address
+func startTestServer(t *testing.T, config *Config) string {
+	t.Helper()
+	server, err := NewServer(config, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.logger.SetOutput(io.Discard)
+	server.setupRoutes()
+	if config.TLS.Enabled {
+		if err := server.loadCertificates(config); err != nil {
+			t.Fatalf("loadCertificates failed: %v", err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	httpServer := server.newHTTPServer()
+	go server.serve(httpServer, ln)
+	t.Cleanup(func() { httpServer.Shutdown(context.Background()) })
+	return ln.Addr().String()
+}
+
+func TestHTTP2(t *testing.T) {
+	t.Run("tls", func(t *testing.T) {
+		config := defaultConfig()
+		config.TLS = TLSConfig{
+			Enabled:    true,
+			SelfSigned: true,
+			CertFile:   filepath.Join(t.TempDir(), "cert.pem"),
+			KeyFile:    filepath.Join(t.TempDir(), "key.pem"),
+		}
+		addr := startTestServer(t, config)
+
+		pem, _ := os.ReadFile(config.TLS.CertFile)
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(pem)
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}
+		defer transport.CloseIdleConnections()
+
+		resp, err := (&http.Client{Transport: transport}).Get("https://" + strings.Replace(addr, "127.0.0.1", "localhost", 1) + "/api/v1/health")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Proto != "HTTP/2.0" {
+			t.Errorf("got %d over %s; want 200 over HTTP/2.0", resp.StatusCode, resp.Proto)
+		}
+	})
+
+	t.Run("h2c", func(t *testing.T) {
+		config := defaultConfig()
+		config.H2C = true
+		addr := startTestServer(t, config)
+
+		transport := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+		defer transport.CloseIdleConnections()
+
+		resp, err := (&http.Client{Transport: transport}).Get("http://" + addr + "/api/v1/health")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Proto != "HTTP/2.0" {
+			t.Errorf("got %d over %s; want 200 over HTTP/2.0", resp.StatusCode, resp.Proto)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailExists  = errors.New("email already exists")
+)
+
+// UserStore persists users. Implementations are safe for concurrent use and
+// compare emails case-insensitively.
+type UserStore interface {
+	List() ([]User, error)
+	Get(id int) (User, error)
+	GetByEmail(email string) (User, error)
+	// Create assigns the user's ID and timestamps
+	Create(user *User) error
+	Update(user *User) error
+	Delete(id int) error
+	Close() error
+}
+
+// MemoryStore keeps users in memory, guarded by a mutex
+type MemoryStore struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	nextID int
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[int]User), nextID: 1}
+}
+
+func (m *MemoryStore) List() ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (m *MemoryStore) Get(id int) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) GetByEmail(email string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (m *MemoryStore) Create(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(user.Email, 0) {
+		return ErrEmailExists
+	}
+	now := time.Now().UTC()
+	user.ID = m.nextID
+	user.CreatedAt, user.UpdatedAt = now, now
+	m.nextID++
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *MemoryStore) Update(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.users[user.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if m.emailTaken(user.Email, user.ID) {
+		return ErrEmailExists
+	}
+	user.CreatedAt = existing.CreatedAt
+	user.UpdatedAt = time.Now().UTC()
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *MemoryStore) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(m.users, id)
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// emailTaken reports whether another user has the email. Callers hold mu.
+func (m *MemoryStore) emailTaken(email string, exceptID int) bool {
+	for id, user := range m.users {
+		if id != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// SQLiteStore persists users in a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the database at path and creates the schema
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// One connection serializes writers and keeps :memory: databases shared
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return store, nil
+}
+
+// migrate creates the users table
+func (s *SQLiteStore) migrate() error {
+	_, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		role TEXT NOT NULL DEFAULT 'viewer',
+		password_hash TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`)
+	return err
+}
+
+const userColumns = `id, name, email, role, password_hash, created_at, updated_at`
+
+func (s *SQLiteStore) List() ([]User, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteStore) Get(id int) (User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (s *SQLiteStore) GetByEmail(email string) (User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+}
+
+func (s *SQLiteStore) Create(user *User) error {
+	now := time.Now().UTC()
+	result, err := s.db.Exec(`INSERT INTO users (name, email, role, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, user.Name, user.Email, user.Role, user.PasswordHash, now, now)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailExists
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+	user.CreatedAt, user.UpdatedAt = now, now
+	return nil
+}
+
+func (s *SQLiteStore) Update(user *User) error {
+	now := time.Now().UTC()
+	result, err := s.db.Exec(`UPDATE users SET name = ?, email = ?, role = ?, password_hash = ?, updated_at = ?
+		WHERE id = ?`, user.Name, user.Email, user.Role, user.PasswordHash, now, user.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailExists
+		}
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	stored, err := s.Get(user.ID)
+	if err != nil {
+		return err
+	}
+	*user = stored
+	return nil
+}
+
+func (s *SQLiteStore) Delete(id int) error {
+	result, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// isUniqueViolation recognizes SQLite's UNIQUE constraint error
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
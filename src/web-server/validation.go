@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// FieldError describes why one request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validator collects field errors while checking a request
+type Validator struct {
+	errors []FieldError
+}
+
+// Check records message for field unless ok
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.errors = append(v.errors, FieldError{Field: field, Message: message})
+	}
+}
+
+// Errors returns the recorded field errors, nil if there were none
+func (v *Validator) Errors() []FieldError {
+	return v.errors
+}
+
+// validateName checks a required display name
+func (v *Validator) validateName(name string) {
+	name = strings.TrimSpace(name)
+	v.Check(name != "", "name", "is required")
+	v.Check(len(name) <= 100, "name", "must be at most 100 characters")
+}
+
+// validateEmail checks a required email address
+func (v *Validator) validateEmail(email string) {
+	if strings.TrimSpace(email) == "" {
+		v.Check(false, "email", "is required")
+		return
+	}
+	addr, err := mail.ParseAddress(email)
+	v.Check(err == nil && addr.Address == email, "email", "must be a valid email address")
+}
+
+// validatePassword checks a password; required passwords must be present
+func (v *Validator) validatePassword(password string, required bool) {
+	if password == "" {
+		v.Check(!required, "password", "is required")
+		return
+	}
+	v.Check(len(password) >= 8, "password", "must be at least 8 characters")
+	v.Check(len(password) <= 72, "password", "must be at most 72 characters")
+}
+
+// validateRole checks an optional role
+func (v *Validator) validateRole(role string) {
+	v.Check(role == "" || Role(role).Valid(), "role", "must be one of admin, editor, viewer")
+}
+
+// CreateUserRequest is the body of POST /api/v1/users
+type CreateUserRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// Validate returns the field errors of the request
+func (req CreateUserRequest) Validate() []FieldError {
+	var v Validator
+	v.validateName(req.Name)
+	v.validateEmail(req.Email)
+	v.validatePassword(req.Password, true)
+	v.validateRole(req.Role)
+	return v.Errors()
+}
+
+// UpdateUserRequest is the body of PUT /api/v1/users/{id}. Password and
+// role are optional and left unchanged when empty.
+type UpdateUserRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// Validate returns the field errors of the request
+func (req UpdateUserRequest) Validate() []FieldError {
+	var v Validator
+	v.validateName(req.Name)
+	v.validateEmail(req.Email)
+	v.validatePassword(req.Password, false)
+	v.validateRole(req.Role)
+	return v.Errors()
+}
+
+// LoginRequest is the body of POST /api/v1/auth/login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Validate returns the field errors of the request
+func (req LoginRequest) Validate() []FieldError {
+	var v Validator
+	v.Check(req.Email != "", "email", "is required")
+	v.Check(req.Password != "", "password", "is required")
+	return v.Errors()
+}